@@ -13,10 +13,15 @@ package assert
 import (
 	"fmt"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/grafana/oats/casefile"
+	"github.com/grafana/oats/seed"
+	"github.com/grafana/oats/signalcmd"
 )
 
 // Failure carries enough context to render a compact "FAIL <case>  <source>"
@@ -33,9 +38,39 @@ func (f Failure) Error() string { return f.Rule + ": " + f.Detail }
 // assertions. Depending on the signal type, Name is the primary field
 // (`name` for traces, log body for logs, metric name for metrics) and
 // Attributes carries labels/attributes associated with that row.
+//
+// Span rows also carry their IDs when the trace JSON had them, so tree
+// assertions can rebuild parent/child structure, plus kind, status, duration,
+// events and links. Other rows leave them empty.
 type Row struct {
 	Name       string
 	Attributes map[string]string
+
+	// Levels holds the attributes again, split by where they were recorded
+	// ("resource", "scope", "span", "log"), for matcher keys that carry a
+	// level prefix. Nil when the source does not keep levels apart.
+	Levels map[string]map[string]string
+	// Types records each attribute's OTLP value type (see
+	// casefile.AttributeTypes), keyed like Attributes and, in LevelTypes,
+	// like Levels. An attribute without one is a string, which is all Loki
+	// and Prometheus labels can be.
+	Types        map[string]string
+	LevelTypes   map[string]map[string]string
+	ScopeName    string
+	ScopeVersion string
+
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+
+	Kind          string // lower-case short form, e.g. "server"
+	StatusCode    string // "unset", "ok" or "error"
+	StatusMessage string
+	Duration      time.Duration
+	// Events carry Name and Attributes; Links carry TraceID, SpanID and
+	// Attributes.
+	Events []Row
+	Links  []Row
 }
 
 // Contains checks that each substring appears at least once in stdout.
@@ -139,13 +174,45 @@ func MatchRows(rows []Row, entries []casefile.MatchEntry) []Failure {
 		if !anyRowMatches(rows, entry) {
 			fails = append(fails, Failure{
 				Rule:   "match",
-				Detail: fmt.Sprintf("no row matched %s", describeMatch(entry)),
+				Detail: fmt.Sprintf("no row matched %s%s", describeMatch(entry), describeExtras(rows, entry)),
 			})
 		}
 	}
 	return fails
 }
 
+// FilterRows returns the rows that match at least one of entries, in order.
+// With no entries every row qualifies.
+func FilterRows(rows []Row, entries []casefile.MatchEntry) []Row {
+	if len(entries) == 0 {
+		return rows
+	}
+	var out []Row
+	for _, row := range rows {
+		if slices.ContainsFunc(entries, func(e casefile.MatchEntry) bool { return rowMatches(row, e) }) {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+// describeExtras names the extra attributes on the first row that failed a
+// no_extra_attributes entry only because of them, so a leak is reported by
+// key rather than as a bare mismatch.
+func describeExtras(rows []Row, entry casefile.MatchEntry) string {
+	if !entry.NoExtraAttributes {
+		return ""
+	}
+	lenient := entry
+	lenient.NoExtraAttributes = false
+	for _, row := range rows {
+		if rowMatches(row, lenient) {
+			return fmt.Sprintf("; %q matched otherwise but carries extra attributes %s", row.Name, strings.Join(extraAttributes(row, entry), ", "))
+		}
+	}
+	return ""
+}
+
 func anyRowMatches(rows []Row, entry casefile.MatchEntry) bool {
 	for _, row := range rows {
 		if rowMatches(row, entry) {
@@ -162,27 +229,180 @@ func rowMatches(row Row, entry casefile.MatchEntry) bool {
 			return false
 		}
 	}
-	for _, expected := range entry.Attributes {
-		actual, ok := row.Attributes[expected.Key]
-		if expected.Value == nil {
-			if !ok {
+	if !attributesMatch(row, entry.Attributes, matchType) {
+		return false
+	}
+	if entry.Kind != "" && !strings.EqualFold(row.Kind, entry.Kind) {
+		return false
+	}
+	if entry.StatusCode != "" && !strings.EqualFold(row.StatusCode, entry.StatusCode) {
+		return false
+	}
+	if entry.StatusMessage != nil && !matchesValue(row.StatusMessage, *entry.StatusMessage, matchType) {
+		return false
+	}
+	if entry.Duration != "" {
+		op, bound, err := entry.DurationBound()
+		if err != nil || !applyComparison(float64(row.Duration), op, float64(bound)) {
+			return false
+		}
+	}
+	for _, ev := range entry.Events {
+		if !slices.ContainsFunc(row.Events, func(got Row) bool { return eventMatches(got, ev, matchType) }) {
+			return false
+		}
+	}
+	for _, link := range entry.Links {
+		if !slices.ContainsFunc(row.Links, func(got Row) bool { return linkMatches(got, link, matchType) }) {
+			return false
+		}
+	}
+	if entry.NoExtraAttributes && len(extraAttributes(row, entry)) > 0 {
+		return false
+	}
+	// All specified constraints held. This is never vacuously true: casefile's
+	// validateMatchEntries rejects an entry with no constraint at all, so a
+	// row reaching here has matched at least one real constraint.
+	return true
+}
+
+// extraAttributes lists, sorted, the row's attributes that the entry neither
+// matches nor ignores. A row that keeps levels is checked level by level, so
+// extras are named like "resource.host.name" and keys the runner derives
+// (kind, otel.scope.name) never count. __name__ is the metric name Prometheus
+// keeps as a label, not an attribute, and the run ID is OATS's own scoping.
+func extraAttributes(row Row, entry casefile.MatchEntry) []string {
+	allowed := make([]string, 0, len(entry.Attributes)+len(entry.IgnoreAttributes))
+	for _, m := range entry.Attributes {
+		allowed = append(allowed, m.Key)
+	}
+	allowed = append(allowed, entry.IgnoreAttributes...)
+	covered := func(names ...string) bool {
+		for _, pattern := range allowed {
+			for _, name := range names {
+				if prefix, glob := strings.CutSuffix(pattern, "*"); name == pattern || glob && strings.HasPrefix(name, prefix) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	var extra []string
+	if row.Levels == nil {
+		for key := range row.Attributes {
+			if key != "__name__" && !isRunID(key) && !covered(key) {
+				extra = append(extra, key)
+			}
+		}
+	}
+	for level, attrs := range row.Levels {
+		for key := range attrs {
+			if !isRunID(key) && !covered(key, level+"."+key) {
+				extra = append(extra, level+"."+key)
+			}
+		}
+	}
+	sort.Strings(extra)
+	return extra
+}
+
+// isRunID reports whether key is the run ID OATS stamps on telemetry, as an
+// attribute or as the label backends store it under.
+func isRunID(key string) bool {
+	return key == seed.RunIDAttribute || key == signalcmd.RunIDLabel
+}
+
+// attribute looks up the value and type a matcher names. When the key's
+// first segment is a level the row keeps ("resource.service.name" on a span),
+// only that level is read, and "scope.name"/"scope.version" read the
+// instrumentation scope itself. Any other key, "log.file.name" on a span for
+// instance, is looked up as written in the merged attributes.
+func (r Row) attribute(m casefile.AttributeMatcher) (value, typ string, ok bool) {
+	attrs, types, key := r.Attributes, r.Types, m.Key
+	if level, rest, split := m.Level(); split {
+		if levelAttrs, kept := r.Levels[level]; kept {
+			if level == "scope" {
+				switch rest {
+				case "name":
+					return r.ScopeName, "string", r.ScopeName != ""
+				case "version":
+					return r.ScopeVersion, "string", r.ScopeVersion != ""
+				}
+			}
+			attrs, types, key = levelAttrs, r.LevelTypes[level], rest
+		}
+	}
+	value, ok = attrs[key]
+	typ = types[key]
+	if typ == "" {
+		typ = "string"
+	}
+	return value, typ, ok
+}
+
+func attributesMatch(row Row, matchers casefile.AttributeMatchers, matchType casefile.MatchType) bool {
+	for _, expected := range matchers {
+		actual, typ, ok := row.attribute(expected)
+		if expected.Absent {
+			if ok {
 				return false
 			}
 			continue
 		}
-		if !ok {
+		if !ok || !attributeHolds(actual, typ, expected, matchType) {
+			return false
+		}
+	}
+	return true
+}
+
+// attributeHolds checks every operator the matcher sets against a present
+// attribute.
+func attributeHolds(actual, typ string, m casefile.AttributeMatcher, matchType casefile.MatchType) bool {
+	if m.Value != nil && !matchesValue(actual, *m.Value, matchType) {
+		return false
+	}
+	if m.NotEquals != nil && matchesValue(actual, *m.NotEquals, matchType) {
+		return false
+	}
+	if m.OneOf != nil && !slices.ContainsFunc(m.OneOf, func(v string) bool { return matchesValue(actual, v, matchType) }) {
+		return false
+	}
+	if m.Type != "" && typ != m.Type {
+		return false
+	}
+	if m.Compare != "" {
+		op, bound, err := m.CompareBound()
+		if err != nil {
 			return false
 		}
-		if !matchesValue(actual, *expected.Value, matchType) {
+		n, err := strconv.ParseFloat(actual, 64)
+		if err != nil || !applyComparison(n, op, bound) {
 			return false
 		}
 	}
-	// All specified constraints held. This is never vacuously true: casefile's
-	// validateMatchEntries rejects an entry with no name and no attributes, so
-	// a row reaching here has matched at least one real constraint.
 	return true
 }
 
+func eventMatches(got Row, want casefile.SpanEvent, matchType casefile.MatchType) bool {
+	if want.Name != nil && !matchesValue(got.Name, *want.Name, matchType) {
+		return false
+	}
+	return attributesMatch(got, want.Attributes, matchType)
+}
+
+// linkMatches compares IDs exactly (case-insensitively, as hex), whatever
+// the entry's match_type.
+func linkMatches(got Row, want casefile.SpanLink, matchType casefile.MatchType) bool {
+	if want.TraceID != "" && !strings.EqualFold(got.TraceID, want.TraceID) {
+		return false
+	}
+	if want.SpanID != "" && !strings.EqualFold(got.SpanID, want.SpanID) {
+		return false
+	}
+	return attributesMatch(got, want.Attributes, matchType)
+}
+
 func matchesValue(actual, expected string, matchType casefile.MatchType) bool {
 	switch matchType {
 	case casefile.MatchTypeRegexp:
@@ -204,13 +424,50 @@ func describeMatch(entry casefile.MatchEntry) string {
 	if entry.Name != nil {
 		parts = append(parts, fmt.Sprintf("name=%q", *entry.Name))
 	}
-	for _, expected := range entry.Attributes {
-		switch expected.Value {
-		case nil:
-			parts = append(parts, fmt.Sprintf("attribute %s present", expected.Key))
-		default:
-			parts = append(parts, fmt.Sprintf("attribute %s=%q", expected.Key, *expected.Value))
+	parts = append(parts, describeAttributes(entry.Attributes)...)
+	if entry.NoExtraAttributes {
+		desc := "no extra attributes"
+		if len(entry.IgnoreAttributes) > 0 {
+			desc += " (ignoring " + strings.Join(entry.IgnoreAttributes, ", ") + ")"
 		}
+		parts = append(parts, desc)
+	}
+	if entry.Kind != "" {
+		parts = append(parts, fmt.Sprintf("kind=%s", entry.Kind))
+	}
+	if entry.StatusCode != "" {
+		parts = append(parts, fmt.Sprintf("status_code=%s", entry.StatusCode))
+	}
+	if entry.StatusMessage != nil {
+		parts = append(parts, fmt.Sprintf("status_message=%q", *entry.StatusMessage))
+	}
+	if entry.Duration != "" {
+		parts = append(parts, fmt.Sprintf("duration %s", entry.Duration))
+	}
+	for _, ev := range entry.Events {
+		desc := "event"
+		if ev.Name != nil {
+			desc = fmt.Sprintf("event %q", *ev.Name)
+		}
+		if attrs := describeAttributes(ev.Attributes); len(attrs) > 0 {
+			desc += " with " + strings.Join(attrs, ", ")
+		}
+		parts = append(parts, desc)
+	}
+	for _, link := range entry.Links {
+		var ids []string
+		if link.TraceID != "" {
+			ids = append(ids, "trace_id="+link.TraceID)
+		}
+		if link.SpanID != "" {
+			ids = append(ids, "span_id="+link.SpanID)
+		}
+		ids = append(ids, describeAttributes(link.Attributes)...)
+		desc := "link"
+		if len(ids) > 0 {
+			desc += " with " + strings.Join(ids, ", ")
+		}
+		parts = append(parts, desc)
 	}
 	if len(parts) == 0 {
 		return "empty match entry"
@@ -218,6 +475,44 @@ func describeMatch(entry casefile.MatchEntry) string {
 	return strings.Join(parts, ", ")
 }
 
+func describeAttributes(matchers casefile.AttributeMatchers) []string {
+	parts := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		parts = append(parts, "attribute "+m.Key+describeOperators(m))
+	}
+	return parts
+}
+
+func describeOperators(m casefile.AttributeMatcher) string {
+	if m.Absent {
+		return " absent"
+	}
+	var ops []string
+	if m.Value != nil {
+		ops = append(ops, fmt.Sprintf("=%q", *m.Value))
+	}
+	if m.NotEquals != nil {
+		ops = append(ops, fmt.Sprintf(" != %q", *m.NotEquals))
+	}
+	if m.OneOf != nil {
+		quoted := make([]string, len(m.OneOf))
+		for i, v := range m.OneOf {
+			quoted[i] = strconv.Quote(v)
+		}
+		ops = append(ops, fmt.Sprintf(" in [%s]", strings.Join(quoted, ", ")))
+	}
+	if m.Compare != "" {
+		ops = append(ops, " "+strings.TrimSpace(m.Compare))
+	}
+	if m.Type != "" {
+		ops = append(ops, " of type "+m.Type)
+	}
+	if len(ops) == 0 {
+		return " present"
+	}
+	return strings.Join(ops, " and")
+}
+
 // retag relabels a failure set's Rule field. Count and Absent delegate their
 // numeric comparison to Value, then retag the resulting "value" failures as
 // "count"/"absent" so the reported rule matches the assertion the author wrote.
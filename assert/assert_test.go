@@ -1,7 +1,9 @@
 package assert
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/grafana/oats/casefile"
 )
@@ -143,6 +145,236 @@ func TestMatchRows(t *testing.T) {
 	}
 }
 
+func TestMatchRowsSpanDetails(t *testing.T) {
+	rows := []Row{{
+		Name:          "POST /charge",
+		Kind:          "client",
+		StatusCode:    "error",
+		StatusMessage: "card declined: insufficient funds",
+		Duration:      320 * time.Millisecond,
+		Events:        []Row{{Name: "exception", Attributes: map[string]string{"exception.type": "CardError"}}},
+		Links:         []Row{{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331"}},
+	}}
+	cases := []struct {
+		name  string
+		entry casefile.MatchEntry
+		want  string // failure detail; empty means pass
+	}{
+		{name: "kind and status", entry: casefile.MatchEntry{Kind: "CLIENT", StatusCode: "error"}},
+		{name: "status message regexp", entry: casefile.MatchEntry{MatchType: casefile.MatchTypeRegexp, StatusMessage: strPtr("^card declined")}},
+		{name: "duration", entry: casefile.MatchEntry{Duration: "< 500ms"}},
+		{name: "event", entry: casefile.MatchEntry{Events: []casefile.SpanEvent{{
+			Name:       strPtr("exception"),
+			Attributes: casefile.AttributeMatchers{{Key: "exception.type", Value: strPtr("CardError")}},
+		}}}},
+		{name: "any link", entry: casefile.MatchEntry{Links: []casefile.SpanLink{{}}}},
+		{name: "link by ID", entry: casefile.MatchEntry{Links: []casefile.SpanLink{{SpanID: "B7AD6B7169203331"}}}},
+		{
+			name:  "wrong kind",
+			entry: casefile.MatchEntry{Name: strPtr("POST /charge"), Kind: "server"},
+			want:  `no row matched name="POST /charge", kind=server`,
+		},
+		{
+			name:  "too slow",
+			entry: casefile.MatchEntry{Duration: "< 100ms"},
+			want:  "no row matched duration < 100ms",
+		},
+		{
+			name:  "missing event",
+			entry: casefile.MatchEntry{Events: []casefile.SpanEvent{{Name: strPtr("retry")}}},
+			want:  `no row matched event "retry"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := MatchRows(rows, []casefile.MatchEntry{tc.entry})
+			if tc.want == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected pass, got %v", got)
+				}
+				return
+			}
+			if len(got) != 1 || !strings.HasPrefix(got[0].Detail, tc.want) {
+				t.Fatalf("expected failure %q, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchRowsAttributeLevels(t *testing.T) {
+	rows := []Row{{
+		Name:       "GET /",
+		Attributes: map[string]string{"service.name": "frontend", "http.route": "/", "log.file.name": "app.log"},
+		Levels: map[string]map[string]string{
+			"resource": {"service.name": "frontend"},
+			"scope":    {},
+			"span":     {"http.route": "/", "log.file.name": "app.log"},
+		},
+		ScopeName:    "io.opentelemetry.http",
+		ScopeVersion: "2.1.0",
+	}}
+	cases := []struct {
+		name string
+		key  string
+		want string // expected value; empty asserts presence
+		pass bool
+	}{
+		{name: "resource attribute", key: "resource.service.name", want: "frontend", pass: true},
+		{name: "resource attribute is not a span attribute", key: "span.service.name", pass: false},
+		{name: "span attribute is not a resource attribute", key: "resource.http.route", pass: false},
+		{name: "unprefixed matches any level", key: "service.name", want: "frontend", pass: true},
+		{name: "scope name", key: "scope.name", want: "io.opentelemetry.http", pass: true},
+		{name: "scope version", key: "scope.version", want: "2.1.0", pass: true},
+		{name: "level the row does not keep", key: "log.file.name", want: "app.log", pass: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			attr := casefile.AttributeMatcher{Key: tc.key}
+			if tc.want != "" {
+				attr.Value = strPtr(tc.want)
+			}
+			got := MatchRows(rows, []casefile.MatchEntry{{Attributes: casefile.AttributeMatchers{attr}}})
+			if (len(got) == 0) != tc.pass {
+				t.Fatalf("pass=%v, got %v", tc.pass, got)
+			}
+		})
+	}
+}
+
+func TestMatchRowsAttributeOperators(t *testing.T) {
+	rows := []Row{{
+		Name:       "GET /users",
+		Attributes: map[string]string{"http.response.status_code": "503", "http.request.method": "GET", "url.scheme": "https", "tags": "a,b"},
+		Types:      map[string]string{"http.response.status_code": "int", "tags": "array"},
+	}}
+	cases := []struct {
+		name string
+		attr casefile.AttributeMatcher
+		want string // failure detail; empty means pass
+	}{
+		{name: "int >= 500", attr: casefile.AttributeMatcher{Key: "http.response.status_code", Type: "int", Compare: ">= 500"}},
+		{name: "absent", attr: casefile.AttributeMatcher{Key: "user.email", Absent: true}},
+		{name: "not equals", attr: casefile.AttributeMatcher{Key: "url.scheme", NotEquals: strPtr("http")}},
+		{name: "one of", attr: casefile.AttributeMatcher{Key: "http.request.method", OneOf: []string{"GET", "HEAD"}}},
+		{name: "untyped is a string", attr: casefile.AttributeMatcher{Key: "url.scheme", Type: "string"}},
+		{name: "array", attr: casefile.AttributeMatcher{Key: "tags", Type: "array"}},
+		{
+			name: "present but should be absent",
+			attr: casefile.AttributeMatcher{Key: "url.scheme", Absent: true},
+			want: "no row matched attribute url.scheme absent",
+		},
+		{
+			name: "wrong type",
+			attr: casefile.AttributeMatcher{Key: "http.response.status_code", Type: "string", Compare: "< 500"},
+			want: "no row matched attribute http.response.status_code < 500 and of type string",
+		},
+		{
+			name: "not one of",
+			attr: casefile.AttributeMatcher{Key: "http.request.method", OneOf: []string{"POST", "PUT"}},
+			want: `no row matched attribute http.request.method in ["POST", "PUT"]`,
+		},
+		{
+			name: "equals what it must not",
+			attr: casefile.AttributeMatcher{Key: "url.scheme", NotEquals: strPtr("https")},
+			want: `no row matched attribute url.scheme != "https"`,
+		},
+		{
+			name: "compare on a non-number",
+			attr: casefile.AttributeMatcher{Key: "url.scheme", Compare: "> 0"},
+			want: "no row matched attribute url.scheme > 0",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := MatchRows(rows, []casefile.MatchEntry{{Attributes: casefile.AttributeMatchers{tc.attr}}})
+			if tc.want == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected pass, got %v", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Detail != tc.want {
+				t.Fatalf("expected failure %q, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchRowsNoExtraAttributes(t *testing.T) {
+	span := Row{
+		Name:       "POST /login",
+		Attributes: map[string]string{"service.name": "auth", "http.route": "/login", "user.email": "a@b.c", "kind": "SPAN_KIND_SERVER"},
+		Levels: map[string]map[string]string{
+			"resource": {"service.name": "auth"},
+			"span":     {"http.route": "/login", "user.email": "a@b.c"},
+		},
+	}
+	series := Row{Name: "up", Attributes: map[string]string{"__name__": "up", "job": "app"}}
+	cases := []struct {
+		name  string
+		row   Row
+		entry casefile.MatchEntry
+		want  string // failure detail; empty means pass
+	}{
+		{
+			name: "all listed or ignored",
+			row:  span,
+			entry: casefile.MatchEntry{
+				Attributes:        casefile.AttributeMatchers{{Key: "http.route"}, {Key: "user.email"}},
+				NoExtraAttributes: true,
+				IgnoreAttributes:  []string{"resource.*"},
+			},
+		},
+		{
+			name:  "metric name is not an attribute",
+			row:   series,
+			entry: casefile.MatchEntry{Attributes: casefile.AttributeMatchers{{Key: "job"}}, NoExtraAttributes: true},
+		},
+		{
+			name: "run ID is not an attribute",
+			row: Row{
+				Name:       "POST /login",
+				Attributes: map[string]string{"http.route": "/login", "oats.run.id": "r1"},
+				Levels: map[string]map[string]string{
+					"resource": {"oats.run.id": "r1"},
+					"span":     {"http.route": "/login"},
+				},
+			},
+			entry: casefile.MatchEntry{Attributes: casefile.AttributeMatchers{{Key: "http.route"}}, NoExtraAttributes: true},
+		},
+		{
+			name:  "run ID label is not an attribute",
+			row:   Row{Name: "up", Attributes: map[string]string{"__name__": "up", "job": "app", "oats_run_id": "r1"}},
+			entry: casefile.MatchEntry{Attributes: casefile.AttributeMatchers{{Key: "job"}}, NoExtraAttributes: true},
+		},
+		{
+			name: "leaked attribute is named",
+			row:  span,
+			entry: casefile.MatchEntry{
+				Name:              strPtr("POST /login"),
+				Attributes:        casefile.AttributeMatchers{{Key: "http.route"}},
+				NoExtraAttributes: true,
+				IgnoreAttributes:  []string{"service.name"},
+			},
+			want: `no row matched name="POST /login", attribute http.route present, no extra attributes (ignoring service.name); "POST /login" matched otherwise but carries extra attributes span.user.email`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := MatchRows([]Row{tc.row}, []casefile.MatchEntry{tc.entry})
+			if tc.want == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected pass, got %v", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Detail != tc.want {
+				t.Fatalf("expected failure %q, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
 func strPtr(s string) *string { return &s }
 
 func TestFailureError(t *testing.T) {
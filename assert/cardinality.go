@@ -0,0 +1,90 @@
+package assert
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/grafana/oats/casefile"
+)
+
+// maxListedValues caps how many label values a cardinality failure quotes.
+const maxListedValues = 5
+
+// Cardinality checks a budget against the label sets of the series (noun
+// "series") or streams (noun "streams") a query returned. Identical label
+// sets count once, so log rows from one stream may be passed as they are.
+func Cardinality(labelSets []map[string]string, b casefile.CardinalityBudget, noun string) []Failure {
+	units := uniqueLabelSets(labelSets)
+	var fails []Failure
+	fail := func(format string, args ...any) {
+		fails = append(fails, Failure{Rule: "cardinality", Detail: fmt.Sprintf(format, args...)})
+	}
+	if limit := max(b.MaxSeries, b.MaxStreams); limit > 0 {
+		if b.Per == "" {
+			if len(units) > limit {
+				fail("expected at most %d %s, got %d", limit, noun, len(units))
+			}
+		} else {
+			groups := map[string]int{}
+			for _, u := range units {
+				groups[u[b.Per]]++
+			}
+			var over []string
+			for _, v := range slices.Sorted(maps.Keys(groups)) {
+				if groups[v] > limit {
+					over = append(over, fmt.Sprintf("%d for %s=%q", groups[v], b.Per, v))
+				}
+			}
+			if len(over) > 0 {
+				fail("expected at most %d %s per %s, got %s", limit, noun, b.Per, strings.Join(over, ", "))
+			}
+		}
+	}
+	for _, label := range slices.Sorted(maps.Keys(b.MaxLabelValues)) {
+		limit := b.MaxLabelValues[label]
+		seen := map[string]bool{}
+		for _, u := range units {
+			if v, ok := u[label]; ok {
+				seen[v] = true
+			}
+		}
+		if len(seen) <= limit {
+			continue
+		}
+		values := slices.Sorted(maps.Keys(seen))
+		sample := make([]string, 0, maxListedValues)
+		for _, v := range values[:min(len(values), maxListedValues)] {
+			sample = append(sample, fmt.Sprintf("%q", v))
+		}
+		if len(values) > maxListedValues {
+			sample = append(sample, "...")
+		}
+		fail("label %s: expected at most %d distinct values across %s, got %d: %s", label, limit, noun, len(values), strings.Join(sample, ", "))
+	}
+	return fails
+}
+
+// uniqueLabelSets drops repeated label sets, keeping first-seen order.
+func uniqueLabelSets(labelSets []map[string]string) []map[string]string {
+	seen := map[string]bool{}
+	var out []map[string]string
+	for _, ls := range labelSets {
+		keys := make([]string, 0, len(ls))
+		for k := range ls {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var b strings.Builder
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%q=%q,", k, ls[k])
+		}
+		if id := b.String(); !seen[id] {
+			seen[id] = true
+			out = append(out, ls)
+		}
+	}
+	return out
+}
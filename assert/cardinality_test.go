@@ -0,0 +1,52 @@
+package assert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/oats/casefile"
+)
+
+func TestCardinality(t *testing.T) {
+	series := []map[string]string{
+		{"__name__": "http_requests_total", "service": "cart", "route": "/a"},
+		{"__name__": "http_requests_total", "service": "cart", "route": "/b"},
+		{"__name__": "http_requests_total", "service": "cart", "route": "/b"}, // same series twice
+		{"__name__": "http_requests_total", "service": "shop", "route": "/c"},
+	}
+	for _, tc := range []struct {
+		name   string
+		budget casefile.CardinalityBudget
+		want   string // the only failure's detail; empty means pass
+	}{
+		{name: "within budget", budget: casefile.CardinalityBudget{MaxSeries: 3, MaxLabelValues: map[string]int{"route": 3}}},
+		{name: "too many series", budget: casefile.CardinalityBudget{MaxSeries: 2}, want: "expected at most 2 series, got 3"},
+		{name: "per label", budget: casefile.CardinalityBudget{MaxSeries: 1, Per: "service"}, want: `expected at most 1 series per service, got 2 for service="cart"`},
+		{name: "label values", budget: casefile.CardinalityBudget{MaxLabelValues: map[string]int{"route": 2}},
+			want: `label route: expected at most 2 distinct values across series, got 3: "/a", "/b", "/c"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Cardinality(series, tc.budget, "series")
+			if tc.want == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected pass, got %v", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Rule != "cardinality" || got[0].Detail != tc.want {
+				t.Fatalf("expected %q, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCardinalityListsFewValues(t *testing.T) {
+	var streams []map[string]string
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		streams = append(streams, map[string]string{"pod": id})
+	}
+	got := Cardinality(streams, casefile.CardinalityBudget{MaxLabelValues: map[string]int{"pod": 3}}, "streams")
+	if len(got) != 1 || !strings.HasSuffix(got[0].Detail, `got 7: "a", "b", "c", "d", "e", ...`) {
+		t.Fatalf("expected a capped value list, got %v", got)
+	}
+}
@@ -0,0 +1,47 @@
+package assert
+
+import "fmt"
+
+// Correlation is the outcome of resolving the IDs one signal carries in
+// another, e.g. the trace IDs on log lines against Tempo.
+type Correlation struct {
+	Noun    string // "trace ID" or "span ID"
+	From    string // source signal: logs, traces or exemplars
+	To      string // target signal: traces or profiles
+	Resolve string // "all" or "any"
+	Results []Resolution
+}
+
+// Resolution records one ID and, when it did not resolve, why.
+type Resolution struct {
+	ID     string
+	Reason string // empty when the ID resolved
+}
+
+// CheckCorrelation fails when no IDs were found or when too few resolved for
+// the resolve mode. Failures have Rule "correlate" and name the unresolved
+// IDs, e.g. "expected every trace ID from logs to resolve in traces, 1 of 3
+// did not: 4bf92f35 (no trace matched)".
+func CheckCorrelation(c Correlation) []Failure {
+	if len(c.Results) == 0 {
+		return []Failure{{Rule: "correlate", Detail: fmt.Sprintf("found no %ss in %s to resolve", c.Noun, c.From)}}
+	}
+	var unresolved []string
+	for _, res := range c.Results {
+		if res.Reason != "" {
+			unresolved = append(unresolved, res.ID+" ("+res.Reason+")")
+		}
+	}
+	total := len(c.Results)
+	switch {
+	case c.Resolve == "any" && len(unresolved) == total:
+		return []Failure{{Rule: "correlate", Detail: fmt.Sprintf(
+			"expected at least one %s from %s to resolve in %s, none of %d did: %s",
+			c.Noun, c.From, c.To, total, listCapped(unresolved))}}
+	case c.Resolve != "any" && len(unresolved) > 0:
+		return []Failure{{Rule: "correlate", Detail: fmt.Sprintf(
+			"expected every %s from %s to resolve in %s, %d of %d did not: %s",
+			c.Noun, c.From, c.To, len(unresolved), total, listCapped(unresolved))}}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package assert
+
+import (
+	"testing"
+
+	"github.com/grafana/oats/casefile"
+)
+
+func TestCheckCorrelation(t *testing.T) {
+	mixed := []Resolution{{ID: "aa"}, {ID: "bb", Reason: "no trace matched"}}
+	for _, tc := range []struct {
+		name    string
+		resolve string
+		results []Resolution
+		want    string // the only failure's detail; empty means pass
+	}{
+		{name: "all resolved", resolve: "all", results: []Resolution{{ID: "aa"}, {ID: "bb"}}},
+		{name: "all with a miss", resolve: "all", results: mixed,
+			want: "expected every trace ID from logs to resolve in traces, 1 of 2 did not: bb (no trace matched)"},
+		{name: "any with a hit", resolve: "any", results: mixed},
+		{name: "any with none", resolve: "any", results: mixed[1:],
+			want: "expected at least one trace ID from logs to resolve in traces, none of 1 did: bb (no trace matched)"},
+		{name: "no ids", resolve: "all", want: "found no trace IDs in logs to resolve"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CheckCorrelation(Correlation{Noun: "trace ID", From: "logs", To: "traces", Resolve: tc.resolve, Results: tc.results})
+			if tc.want == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected pass, got %v", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Rule != "correlate" || got[0].Detail != tc.want {
+				t.Fatalf("expected %q, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFilterRows(t *testing.T) {
+	rows := []Row{
+		{Name: "a", Attributes: map[string]string{"level": "error"}},
+		{Name: "b", Attributes: map[string]string{"level": "info"}},
+	}
+	if got := FilterRows(rows, nil); len(got) != 2 {
+		t.Errorf("no entries: got %d rows, want 2", len(got))
+	}
+	got := FilterRows(rows, []casefile.MatchEntry{{Attributes: casefile.AttributeMatchers{{Key: "level", Value: strPtr("error")}}}})
+	if len(got) != 1 || got[0].Name != "a" {
+		t.Errorf("got %+v, want only row a", got)
+	}
+}
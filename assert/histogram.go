@@ -0,0 +1,181 @@
+package assert
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/oats/casefile"
+)
+
+// Histogram is a metric histogram summed across the series a query returned.
+// Buckets are cumulative and ascending by upper bound; a classic histogram's
+// last bucket is +Inf.
+type Histogram struct {
+	Count   float64
+	Sum     float64
+	Buckets []Bucket
+	// Native is set for a Prometheus native (exponential) histogram, whose
+	// bucket boundaries follow from its schema rather than a fixed layout.
+	Native bool
+}
+
+// Bucket holds the cumulative count of observations up to UpperBound. Lower
+// is where the bucket starts, for interpolating quantiles inside it.
+type Bucket struct {
+	Lower      float64
+	UpperBound float64
+	Count      float64
+}
+
+// Quantile estimates the q-quantile (0 < q < 1) the way PromQL's
+// histogram_quantile does for classic histograms: find the bucket the rank
+// falls in and interpolate linearly inside it. A rank in the +Inf bucket
+// returns the highest finite bound. NaN means there is nothing to estimate.
+func (h Histogram) Quantile(q float64) float64 {
+	if len(h.Buckets) == 0 {
+		return math.NaN()
+	}
+	total := h.Buckets[len(h.Buckets)-1].Count
+	if total == 0 {
+		return math.NaN()
+	}
+	rank := q * total
+	prev := 0.0
+	for i, b := range h.Buckets {
+		if b.Count < rank {
+			prev = b.Count
+			continue
+		}
+		if math.IsInf(b.UpperBound, 1) {
+			if i == 0 {
+				return math.NaN()
+			}
+			return h.Buckets[i-1].UpperBound
+		}
+		if i == 0 && b.UpperBound <= 0 {
+			return b.UpperBound
+		}
+		if b.Count == prev {
+			return b.UpperBound
+		}
+		return b.Lower + (b.UpperBound-b.Lower)*(rank-prev)/(b.Count-prev)
+	}
+	return h.Buckets[len(h.Buckets)-1].UpperBound
+}
+
+// Bounds lists the finite upper bounds, the bucket layout of a classic
+// histogram.
+func (h Histogram) Bounds() []float64 {
+	var out []float64
+	for _, b := range h.Buckets {
+		if !math.IsInf(b.UpperBound, 1) {
+			out = append(out, b.UpperBound)
+		}
+	}
+	return out
+}
+
+// CheckHistogram runs every check in spec against h. Each failure has Rule
+// "histogram" and names the check, e.g. "p95: expected < 0.3, got 0.41".
+func CheckHistogram(h Histogram, spec casefile.HistogramAssertion) []Failure {
+	var fails []Failure
+	fail := func(format string, args ...any) {
+		fails = append(fails, Failure{Rule: "histogram", Detail: fmt.Sprintf(format, args...)})
+	}
+	if h.Count == 0 && len(h.Buckets) == 0 {
+		return []Failure{{Rule: "histogram", Detail: "no histogram series matched"}}
+	}
+	if spec.Count != "" {
+		op, n, err := parseValueExpr(spec.Count)
+		switch {
+		case err != nil:
+			fail("count: %v", err)
+		case !applyComparison(h.Count, op, n):
+			fail("count: expected %s, got %s", spec.Count, formatFloat(h.Count))
+		}
+	}
+	if spec.Sum != "" {
+		op, bound, err := casefile.HistogramBound(spec.Sum)
+		switch {
+		case err != nil:
+			fail("sum: %v", err)
+		case !applyComparison(h.Sum, op, bound):
+			fail("sum: expected %s, got %s", spec.Sum, formatFloat(h.Sum))
+		}
+	}
+	if spec.Buckets != nil || len(spec.BucketCounts) > 0 {
+		if h.Native {
+			fail("buckets: a native histogram has no fixed bucket layout; check count, sum or quantiles instead")
+		} else {
+			fails = append(fails, checkBuckets(h, spec)...)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(spec.Quantiles)) {
+		expr := spec.Quantiles[key]
+		q, err := casefile.Quantile(key)
+		if err != nil {
+			fail("%s: %v", key, err)
+			continue
+		}
+		op, bound, err := casefile.HistogramBound(expr)
+		if err != nil {
+			fail("%s: %v", key, err)
+			continue
+		}
+		got := h.Quantile(q)
+		if math.IsNaN(got) || !applyComparison(got, op, bound) {
+			fail("%s: expected %s, got %s", key, expr, formatFloat(got))
+		}
+	}
+	return fails
+}
+
+func checkBuckets(h Histogram, spec casefile.HistogramAssertion) []Failure {
+	var fails []Failure
+	bounds := h.Bounds()
+	if spec.Buckets != nil && !slices.Equal(bounds, spec.Buckets) {
+		fails = append(fails, Failure{
+			Rule:   "histogram",
+			Detail: fmt.Sprintf("buckets: expected bounds %s, got %s", formatFloats(spec.Buckets), formatFloats(bounds)),
+		})
+	}
+	for _, bc := range spec.BucketCounts {
+		le, err := strconv.ParseFloat(bc.LE, 64)
+		if err != nil {
+			fails = append(fails, Failure{Rule: "histogram", Detail: fmt.Sprintf("le=%s: %v", bc.LE, err)})
+			continue
+		}
+		i := slices.IndexFunc(h.Buckets, func(b Bucket) bool { return b.UpperBound == le })
+		if i < 0 {
+			fails = append(fails, Failure{
+				Rule:   "histogram",
+				Detail: fmt.Sprintf("le=%s: no such bucket; bounds are %s", bc.LE, formatFloats(bounds)),
+			})
+			continue
+		}
+		op, n, err := parseValueExpr(bc.Count)
+		if err != nil || !applyComparison(h.Buckets[i].Count, op, n) {
+			fails = append(fails, Failure{
+				Rule:   "histogram",
+				Detail: fmt.Sprintf("le=%s: expected count %s, got %s", bc.LE, bc.Count, formatFloat(h.Buckets[i].Count)),
+			})
+		}
+	}
+	return fails
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func formatFloats(fs []float64) string {
+	parts := make([]string, len(fs))
+	for i, f := range fs {
+		parts[i] = formatFloat(f)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
@@ -0,0 +1,110 @@
+package assert
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/grafana/oats/casefile"
+)
+
+// latency has 10 observations: 2 up to 0.1s, 6 up to 0.25s, 9 up to 0.5s and
+// one above.
+var latency = Histogram{
+	Count: 10,
+	Sum:   2.4,
+	Buckets: []Bucket{
+		{Lower: 0, UpperBound: 0.1, Count: 2},
+		{Lower: 0.1, UpperBound: 0.25, Count: 6},
+		{Lower: 0.25, UpperBound: 0.5, Count: 9},
+		{Lower: 0.5, UpperBound: math.Inf(1), Count: 10},
+	},
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	for _, tc := range []struct {
+		q    float64
+		want float64
+	}{
+		{0.1, 0.05},
+		{0.5, 0.2125},
+		{0.9, 0.5},
+		{0.95, 0.5}, // in the +Inf bucket: the highest finite bound
+	} {
+		if got := latency.Quantile(tc.q); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("Quantile(%v): got %v, want %v", tc.q, got, tc.want)
+		}
+	}
+	if got := (Histogram{}).Quantile(0.5); !math.IsNaN(got) {
+		t.Errorf("empty histogram: got %v, want NaN", got)
+	}
+}
+
+func TestCheckHistogram(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		h    Histogram
+		spec casefile.HistogramAssertion
+		want string // substring of the only failure; empty means pass
+	}{
+		{
+			name: "all checks hold",
+			h:    latency,
+			spec: casefile.HistogramAssertion{
+				Count:        "== 10",
+				Sum:          "< 3s",
+				Buckets:      []float64{0.1, 0.25, 0.5},
+				BucketCounts: []casefile.BucketCount{{LE: "0.25", Count: "== 6"}, {LE: "+Inf", Count: "== 10"}},
+				Quantiles:    map[string]string{"p50": "< 250ms", "p90": "<= 0.5"},
+			},
+		},
+		{
+			name: "quantile too high",
+			h:    latency,
+			spec: casefile.HistogramAssertion{Quantiles: map[string]string{"p50": "< 200ms"}},
+			want: "p50: expected < 200ms, got 0.2125",
+		},
+		{
+			name: "bucket layout",
+			h:    latency,
+			spec: casefile.HistogramAssertion{Buckets: []float64{0.1, 0.5}},
+			want: "buckets: expected bounds [0.1, 0.5], got [0.1, 0.25, 0.5]",
+		},
+		{
+			name: "missing bucket",
+			h:    latency,
+			spec: casefile.HistogramAssertion{BucketCounts: []casefile.BucketCount{{LE: "1", Count: ">= 1"}}},
+			want: "le=1: no such bucket; bounds are [0.1, 0.25, 0.5]",
+		},
+		{
+			name: "count",
+			h:    latency,
+			spec: casefile.HistogramAssertion{Count: "> 10"},
+			want: "count: expected > 10, got 10",
+		},
+		{
+			name: "native has no layout",
+			h:    Histogram{Count: 1, Native: true, Buckets: []Bucket{{Lower: 0.5, UpperBound: 1, Count: 1}}},
+			spec: casefile.HistogramAssertion{Buckets: []float64{1}},
+			want: "native histogram has no fixed bucket layout",
+		},
+		{
+			name: "no series",
+			spec: casefile.HistogramAssertion{Count: ">= 0"},
+			want: "no histogram series matched",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CheckHistogram(tc.h, tc.spec)
+			if tc.want == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected pass, got %v", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Rule != "histogram" || !strings.Contains(got[0].Detail, tc.want) {
+				t.Fatalf("expected one histogram failure containing %q, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package assert
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/oats/casefile"
+)
+
+// MetricMetadata is the metadata a backend recorded for one metric. Source
+// says where it came from, for failure messages.
+type MetricMetadata struct {
+	Type        string
+	Unit        string
+	Description string
+	// Temporality is "cumulative" or "delta"; empty for types that have
+	// none, such as gauges, and UnknownTemporality when nothing recorded it.
+	Temporality string
+	Source      string
+}
+
+// UnknownTemporality marks a metric whose temporality the backend did not
+// record and OATS did not send itself.
+const UnknownTemporality = "unknown"
+
+// CheckMetadata compares got against every key want sets. Each failure has
+// Rule "metadata" and names the key.
+func CheckMetadata(got MetricMetadata, want casefile.MetricMetadata) []Failure {
+	var fails []Failure
+	fail := func(key, expected, actual string) {
+		fails = append(fails, Failure{
+			Rule:   "metadata",
+			Detail: fmt.Sprintf("%s: expected %s, got %s (from %s)", key, expected, actual, got.Source),
+		})
+	}
+	if want.Type != "" && !strings.EqualFold(want.Type, got.Type) {
+		fail("type", want.Type, orNone(got.Type))
+	}
+	if want.Unit != nil && *want.Unit != got.Unit {
+		fail("unit", fmt.Sprintf("%q", *want.Unit), fmt.Sprintf("%q", got.Unit))
+	}
+	if want.Description != nil && *want.Description != got.Description {
+		fail("description", fmt.Sprintf("%q", *want.Description), fmt.Sprintf("%q", got.Description))
+	}
+	if want.Temporality != "" && got.Temporality == UnknownTemporality {
+		fails = append(fails, Failure{
+			Rule: "metadata",
+			Detail: fmt.Sprintf("temporality unknown: expected %s, but the series carry no __temporality__ label and the metric is not one of the case's inline-OTLP seeds",
+				want.Temporality),
+		})
+	} else if want.Temporality != "" && !strings.EqualFold(want.Temporality, got.Temporality) {
+		actual := got.Temporality
+		if actual == "" && got.Type != "" {
+			actual = fmt.Sprintf("none, a %s has no temporality", got.Type)
+		}
+		actual = orNone(actual)
+		fail("temporality", want.Temporality, actual)
+	}
+	return fails
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,45 @@
+package assert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/oats/casefile"
+)
+
+func TestCheckMetadata(t *testing.T) {
+	got := MetricMetadata{Type: "gauge", Unit: "By", Description: "Heap in use.", Source: "the metadata API"}
+	for _, tc := range []struct {
+		name string
+		want casefile.MetricMetadata
+		fail string // the only failure's detail; empty means pass
+	}{
+		{name: "all hold", want: casefile.MetricMetadata{Type: "Gauge", Unit: strPtr("By"), Description: strPtr("Heap in use.")}},
+		{name: "type", want: casefile.MetricMetadata{Type: "counter"}, fail: "type: expected counter, got gauge (from the metadata API)"},
+		{name: "unit", want: casefile.MetricMetadata{Unit: strPtr("")}, fail: `unit: expected "", got "By" (from the metadata API)`},
+		{name: "gauge has no temporality", want: casefile.MetricMetadata{Temporality: "cumulative"},
+			fail: "temporality: expected cumulative, got none, a gauge has no temporality (from the metadata API)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fails := CheckMetadata(got, tc.want)
+			if tc.fail == "" {
+				if len(fails) != 0 {
+					t.Fatalf("expected pass, got %v", fails)
+				}
+				return
+			}
+			if len(fails) != 1 || fails[0].Rule != "metadata" || fails[0].Detail != tc.fail {
+				t.Fatalf("expected %q, got %v", tc.fail, fails)
+			}
+		})
+	}
+
+	counter := MetricMetadata{Type: "counter", Temporality: UnknownTemporality, Source: "the metadata API"}
+	fails := CheckMetadata(counter, casefile.MetricMetadata{Temporality: "cumulative"})
+	if len(fails) != 1 || !strings.HasPrefix(fails[0].Detail, "temporality unknown: expected cumulative") {
+		t.Fatalf("expected an unknown temporality failure, got %v", fails)
+	}
+	if fails := CheckMetadata(counter, casefile.MetricMetadata{Type: "counter"}); len(fails) != 0 {
+		t.Fatalf("an unknown temporality must not fail other keys, got %v", fails)
+	}
+}
@@ -0,0 +1,247 @@
+package assert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/oats/casefile"
+)
+
+// Series is one metric series: its labels and the value of its sample (the
+// last point for a range query). Samples holds every point, oldest first.
+type Series struct {
+	Labels  map[string]string
+	Value   float64
+	Samples []Sample
+}
+
+// Sample is one point of a series.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// maxListedSeries caps how many offending series a failure names, so a
+// cardinality-heavy metric doesn't bury the report.
+const maxListedSeries = 5
+
+// Each checks expr holds for every series.
+func Each(series []Series, expr string) []Failure {
+	return quantify(series, expr, "each", func(held, total int) bool { return held == total }, false)
+}
+
+// Any checks expr holds for at least one series.
+func Any(series []Series, expr string) []Failure {
+	return quantify(series, expr, "any", func(held, _ int) bool { return held > 0 }, false)
+}
+
+// None checks expr holds for no series.
+func None(series []Series, expr string) []Failure {
+	return quantify(series, expr, "none", func(held, _ int) bool { return held == 0 }, true)
+}
+
+// quantify counts the series expr holds for and asks ok whether the count
+// satisfies the quantifier. A failure lists the series that explain it: those
+// that held when listHeld is set, those that did not otherwise.
+func quantify(series []Series, expr, rule string, ok func(held, total int) bool, listHeld bool) []Failure {
+	op, threshold, err := parseValueExpr(expr)
+	if err != nil {
+		return []Failure{{Rule: rule, Detail: err.Error()}}
+	}
+	if len(series) == 0 {
+		return []Failure{{Rule: rule, Detail: fmt.Sprintf("expected series with value %s, got no series", expr)}}
+	}
+	var held, listed []Series
+	for _, s := range series {
+		holds := applyComparison(s.Value, op, threshold)
+		if holds {
+			held = append(held, s)
+		}
+		if holds == listHeld {
+			listed = append(listed, s)
+		}
+	}
+	if ok(len(held), len(series)) {
+		return nil
+	}
+	var detail string
+	switch rule {
+	case "each":
+		detail = fmt.Sprintf("expected every series %s, %d of %d did not: %s", expr, len(listed), len(series), describeSeries(listed))
+	case "any":
+		detail = fmt.Sprintf("expected at least one series %s, none of %d did: %s", expr, len(series), describeSeries(listed))
+	default:
+		detail = fmt.Sprintf("expected no series %s, %d of %d did: %s", expr, len(listed), len(series), describeSeries(listed))
+	}
+	return []Failure{{Rule: rule, Detail: detail}}
+}
+
+// describeSeries renders series in PromQL notation with their values, e.g.
+// `up{job="api"} = 0`, listing at most maxListedSeries.
+func describeSeries(series []Series) string {
+	parts := make([]string, 0, min(len(series), maxListedSeries)+1)
+	for i, s := range series {
+		if i == maxListedSeries {
+			parts = append(parts, fmt.Sprintf("and %d more", len(series)-maxListedSeries))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s = %v", labelSet(s.Labels), s.Value))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// labelSet renders labels as name{k="v", ...} with keys sorted.
+func labelSet(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		if k != "__name__" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%q", k, labels[k])
+	}
+	return labels["__name__"] + "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// CheckRange runs spec's over-time checks against every series of a range
+// query, with now as the reference for max_age. Each failure has Rule
+// "range", names the check, and lists the series that broke it.
+func CheckRange(series []Series, spec casefile.RangeAssertion, now time.Time) []Failure {
+	if len(series) == 0 {
+		return []Failure{{Rule: "range", Detail: "expected series over the range, got no series"}}
+	}
+	type check struct {
+		name string
+		why  func(Series) string // "" when the series passes
+	}
+	var checks []check
+	if spec.Samples != "" {
+		op, threshold, err := parseValueExpr(spec.Samples)
+		if err != nil {
+			return []Failure{{Rule: "range", Detail: "samples: " + err.Error()}}
+		}
+		checks = append(checks, check{"samples", func(s Series) string {
+			if applyComparison(float64(len(s.Samples)), op, threshold) {
+				return ""
+			}
+			return fmt.Sprintf("has %d samples", len(s.Samples))
+		}})
+	}
+	if spec.Monotonic {
+		checks = append(checks, check{"monotonic", func(s Series) string {
+			if why := firstDrop(s.Samples); why != "" {
+				return why
+			}
+			if len(s.Samples) < 2 || s.Samples[len(s.Samples)-1].Value <= s.Samples[0].Value {
+				return fmt.Sprintf("did not increase across %d samples", len(s.Samples))
+			}
+			return ""
+		}})
+	}
+	if spec.NoResets {
+		checks = append(checks, check{"no_resets", func(s Series) string { return firstDrop(s.Samples) }})
+	}
+	if spec.Rate != "" {
+		op, threshold, err := parseValueExpr(spec.Rate)
+		if err != nil {
+			return []Failure{{Rule: "range", Detail: "rate: " + err.Error()}}
+		}
+		checks = append(checks, check{"rate", func(s Series) string {
+			if len(s.Samples) < 2 {
+				return fmt.Sprintf("has %d samples, need at least 2 for a rate", len(s.Samples))
+			}
+			rate := perSecondIncrease(s.Samples)
+			if applyComparison(rate, op, threshold) {
+				return ""
+			}
+			return fmt.Sprintf("rate %g/s", rate)
+		}})
+	}
+	if spec.MaxAge > 0 {
+		checks = append(checks, check{"max_age", func(s Series) string {
+			if len(s.Samples) == 0 {
+				return "has no samples"
+			}
+			age := now.Sub(s.Samples[len(s.Samples)-1].Time)
+			if age <= spec.MaxAge {
+				return ""
+			}
+			return fmt.Sprintf("newest sample is %s old", age.Round(time.Second))
+		}})
+	}
+
+	var fails []Failure
+	for _, c := range checks {
+		var reasons []string
+		for _, s := range series {
+			if why := c.why(s); why != "" {
+				reasons = append(reasons, labelSet(s.Labels)+" "+why)
+			}
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		fails = append(fails, Failure{
+			Rule:   "range",
+			Detail: fmt.Sprintf("%s: expected %s, %d of %d series did not: %s", c.name, describeRangeCheck(c.name, spec), len(reasons), len(series), listCapped(reasons)),
+		})
+	}
+	return fails
+}
+
+// firstDrop describes the first point where a series decreased, or "".
+func firstDrop(samples []Sample) string {
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Value < samples[i-1].Value {
+			return fmt.Sprintf("dropped from %g to %g at %s", samples[i-1].Value, samples[i].Value, samples[i].Time.UTC().Format(time.RFC3339))
+		}
+	}
+	return ""
+}
+
+// perSecondIncrease is the increase from the first to the last sample over
+// the time between them. A drop is taken as a counter reset: the series
+// restarted from zero, so the value after it counts in full.
+func perSecondIncrease(samples []Sample) float64 {
+	increase := 0.0
+	for i := 1; i < len(samples); i++ {
+		if d := samples[i].Value - samples[i-1].Value; d >= 0 {
+			increase += d
+		} else {
+			increase += samples[i].Value
+		}
+	}
+	elapsed := samples[len(samples)-1].Time.Sub(samples[0].Time).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return increase / elapsed
+}
+
+func describeRangeCheck(name string, spec casefile.RangeAssertion) string {
+	switch name {
+	case "samples":
+		return "samples " + spec.Samples
+	case "monotonic":
+		return "each series to increase and never drop"
+	case "no_resets":
+		return "no series to drop"
+	case "rate":
+		return "rate " + spec.Rate + " per second"
+	default:
+		return "newest sample within " + spec.MaxAge.String()
+	}
+}
+
+// listCapped joins items, listing at most maxListedSeries.
+func listCapped(items []string) string {
+	if len(items) <= maxListedSeries {
+		return strings.Join(items, "; ")
+	}
+	return strings.Join(items[:maxListedSeries], "; ") + fmt.Sprintf("; and %d more", len(items)-maxListedSeries)
+}
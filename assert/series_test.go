@@ -0,0 +1,107 @@
+package assert
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/oats/casefile"
+)
+
+var upSeries = []Series{
+	{Labels: map[string]string{"__name__": "up", "job": "api", "pod": "a"}, Value: 1},
+	{Labels: map[string]string{"__name__": "up", "job": "api", "pod": "b"}, Value: 0},
+	{Labels: map[string]string{"__name__": "up", "job": "db"}, Value: 1},
+}
+
+func TestSeriesQuantifiers(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		check func([]Series, string) []Failure
+		expr  string
+		want  string // the only failure's detail; empty means pass
+	}{
+		{name: "each fails", check: Each, expr: "== 1", want: `expected every series == 1, 1 of 3 did not: up{job="api", pod="b"} = 0`},
+		{name: "each holds", check: Each, expr: ">= 0"},
+		{name: "any holds", check: Any, expr: "== 0"},
+		{name: "any fails", check: Any, expr: "> 1", want: `expected at least one series > 1, none of 3 did: up{job="api", pod="a"} = 1, up{job="api", pod="b"} = 0, up{job="db"} = 1`},
+		{name: "none holds", check: None, expr: "< 0"},
+		{name: "none fails", check: None, expr: "== 0", want: `expected no series == 0, 1 of 3 did: up{job="api", pod="b"} = 0`},
+		{name: "bad expression", check: Each, expr: "1", want: `expected comparison operator`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.check(upSeries, tc.expr)
+			if tc.want == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected pass, got %v", got)
+				}
+				return
+			}
+			if len(got) != 1 || !strings.HasPrefix(got[0].Detail, tc.want) {
+				t.Fatalf("expected %q, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSeriesQuantifiersEdges(t *testing.T) {
+	if got := None(nil, "> 0"); len(got) != 1 || got[0].Rule != "none" || !strings.Contains(got[0].Detail, "got no series") {
+		t.Errorf("no series should fail, got %v", got)
+	}
+	var many []Series
+	for i := range 8 {
+		many = append(many, Series{Labels: map[string]string{"i": fmt.Sprint(i)}, Value: 0})
+	}
+	if got := Each(many, "> 0"); len(got) != 1 || !strings.HasSuffix(got[0].Detail, `{i="4"} = 0, and 3 more`) {
+		t.Errorf("expected the list capped at five series, got %v", got)
+	}
+}
+
+func TestCheckRange(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	points := func(values ...float64) []Sample {
+		out := make([]Sample, len(values))
+		for i, v := range values {
+			out[i] = Sample{Time: start.Add(time.Duration(i) * 10 * time.Second), Value: v}
+		}
+		return out
+	}
+	steady := Series{Labels: map[string]string{"__name__": "requests_total", "pod": "a"}, Samples: points(0, 10, 20, 30)}
+	reset := Series{Labels: map[string]string{"__name__": "requests_total", "pod": "b"}, Samples: points(5, 15, 2, 12)}
+	flat := Series{Labels: map[string]string{"__name__": "requests_total", "pod": "c"}, Samples: points(7, 7)}
+	now := start.Add(40 * time.Second)
+
+	for _, tc := range []struct {
+		name   string
+		series []Series
+		spec   casefile.RangeAssertion
+		want   string // the only failure's detail; empty means pass
+	}{
+		{name: "all hold", series: []Series{steady}, spec: casefile.RangeAssertion{Monotonic: true, NoResets: true, Samples: ">= 4", Rate: "== 1", MaxAge: 15 * time.Second}},
+		{name: "reset", series: []Series{steady, reset}, spec: casefile.RangeAssertion{NoResets: true},
+			want: `no_resets: expected no series to drop, 1 of 2 series did not: requests_total{pod="b"} dropped from 15 to 2 at 2026-01-01T12:00:20Z`},
+		{name: "flat is not monotonic", series: []Series{flat}, spec: casefile.RangeAssertion{Monotonic: true},
+			want: `monotonic: expected each series to increase and never drop, 1 of 1 series did not: requests_total{pod="c"} did not increase across 2 samples`},
+		{name: "flat has no resets", series: []Series{flat}, spec: casefile.RangeAssertion{NoResets: true}},
+		{name: "rate counts past a reset", series: []Series{reset}, spec: casefile.RangeAssertion{Rate: "> 0.7"}},
+		{name: "too few samples", series: []Series{flat}, spec: casefile.RangeAssertion{Samples: ">= 3"},
+			want: `samples: expected samples >= 3, 1 of 1 series did not: requests_total{pod="c"} has 2 samples`},
+		{name: "stale", series: []Series{flat}, spec: casefile.RangeAssertion{MaxAge: 20 * time.Second},
+			want: `max_age: expected newest sample within 20s, 1 of 1 series did not: requests_total{pod="c"} newest sample is 30s old`},
+		{name: "no series", spec: casefile.RangeAssertion{NoResets: true}, want: "got no series"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CheckRange(tc.series, tc.spec, now)
+			if tc.want == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected pass, got %v", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Rule != "range" || !strings.Contains(got[0].Detail, tc.want) {
+				t.Fatalf("expected %q, got %v", tc.want, got)
+			}
+		})
+	}
+}
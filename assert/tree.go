@@ -0,0 +1,172 @@
+package assert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/oats/casefile"
+)
+
+// MatchTree checks each tree entry against the spans in rows. An entry holds
+// when enough spans match it (its count, ">= 1" by default) whose direct
+// children and descendants in turn satisfy the nested entries. Parent/child
+// links come from each row's SpanID and ParentSpanID within its trace.
+func MatchTree(rows []Row, tree []casefile.SpanTree) []Failure {
+	if len(tree) == 0 {
+		return nil
+	}
+	if needsLinks(tree) && !hasSpanIDs(rows) && len(rows) > 0 {
+		return []Failure{{
+			Rule:   "tree",
+			Detail: "spans carry no span IDs, so children and descendants cannot be resolved",
+		}}
+	}
+	idx := newSpanIndex(rows)
+	all := make([]int, len(rows))
+	for i := range all {
+		all[i] = i
+	}
+	var fails []Failure
+	for _, node := range tree {
+		if reason := idx.check(all, node, "spans"); reason != "" {
+			fails = append(fails, Failure{Rule: "tree", Detail: reason})
+		}
+	}
+	return fails
+}
+
+// SingleTrace checks that every row belongs to one and the same trace.
+func SingleTrace(rows []Row) []Failure {
+	ids := map[string]struct{}{}
+	for _, row := range rows {
+		if row.TraceID == "" {
+			return []Failure{{Rule: "single_trace", Detail: fmt.Sprintf("span %q carries no trace ID", row.Name)}}
+		}
+		ids[row.TraceID] = struct{}{}
+	}
+	switch len(ids) {
+	case 1:
+		return nil
+	case 0:
+		return []Failure{{Rule: "single_trace", Detail: "expected spans from one trace, got none"}}
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	return []Failure{{
+		Rule:   "single_trace",
+		Detail: fmt.Sprintf("expected spans from one trace, got %d: %s", len(ids), strings.Join(sorted, ", ")),
+	}}
+}
+
+type spanKey struct{ trace, span string }
+
+// spanIndex links rows to their children by (trace ID, span ID).
+type spanIndex struct {
+	rows     []Row
+	children map[spanKey][]int
+}
+
+func newSpanIndex(rows []Row) *spanIndex {
+	idx := &spanIndex{rows: rows, children: map[spanKey][]int{}}
+	for i, row := range rows {
+		if row.ParentSpanID == "" {
+			continue
+		}
+		parent := spanKey{row.TraceID, row.ParentSpanID}
+		idx.children[parent] = append(idx.children[parent], i)
+	}
+	return idx
+}
+
+func (x *spanIndex) childrenOf(i int) []int {
+	row := x.rows[i]
+	if row.SpanID == "" {
+		return nil
+	}
+	return x.children[spanKey{row.TraceID, row.SpanID}]
+}
+
+func (x *spanIndex) descendantsOf(i int) []int {
+	var out []int
+	seen := map[int]bool{i: true}
+	queue := x.childrenOf(i)
+	for len(queue) > 0 {
+		j := queue[0]
+		queue = queue[1:]
+		if seen[j] {
+			continue
+		}
+		seen[j] = true
+		out = append(out, j)
+		queue = append(queue, x.childrenOf(j)...)
+	}
+	return out
+}
+
+// check counts the candidates that satisfy node and compares the count. It
+// returns "" when the count holds, otherwise why it did not; when a span
+// matched the node but failed below it, the reason says where.
+func (x *spanIndex) check(candidates []int, node casefile.SpanTree, what string) string {
+	expr := node.EffectiveCount()
+	op, threshold, err := parseValueExpr(expr)
+	if err != nil {
+		return err.Error()
+	}
+	n, near, nearReason := 0, -1, ""
+	for _, i := range candidates {
+		if !rowMatches(x.rows[i], node.MatchEntry) {
+			continue
+		}
+		if reason := x.below(i, node); reason != "" {
+			if near < 0 {
+				near, nearReason = i, reason
+			}
+			continue
+		}
+		n++
+	}
+	if applyComparison(float64(n), op, threshold) {
+		return ""
+	}
+	detail := fmt.Sprintf("expected %s %s matching %s, got %d", expr, what, describeMatch(node.MatchEntry), n)
+	if near >= 0 {
+		detail += fmt.Sprintf("; span %q matched but %s", x.rows[near].Name, nearReason)
+	}
+	return detail
+}
+
+func (x *spanIndex) below(i int, node casefile.SpanTree) string {
+	for _, child := range node.Children {
+		if reason := x.check(x.childrenOf(i), child, "children"); reason != "" {
+			return reason
+		}
+	}
+	for _, desc := range node.Descendants {
+		if reason := x.check(x.descendantsOf(i), desc, "descendants"); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+func needsLinks(tree []casefile.SpanTree) bool {
+	for _, node := range tree {
+		if len(node.Children) > 0 || len(node.Descendants) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSpanIDs(rows []Row) bool {
+	for _, row := range rows {
+		if row.SpanID != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package assert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/oats/casefile"
+)
+
+// checkoutTrace is one trace: a server span with two client children, one of
+// which has a database call below it.
+var checkoutTrace = []Row{
+	{Name: "GET /checkout", TraceID: "t1", SpanID: "a", Attributes: map[string]string{"kind": "SPAN_KIND_SERVER"}},
+	{Name: "POST /payment", TraceID: "t1", SpanID: "b", ParentSpanID: "a", Attributes: map[string]string{"kind": "SPAN_KIND_CLIENT"}},
+	{Name: "GET /stock", TraceID: "t1", SpanID: "c", ParentSpanID: "a", Attributes: map[string]string{"kind": "SPAN_KIND_CLIENT"}},
+	{Name: "SELECT stock", TraceID: "t1", SpanID: "d", ParentSpanID: "c", Attributes: map[string]string{"kind": "SPAN_KIND_CLIENT"}},
+}
+
+func clientKind() casefile.AttributeMatchers {
+	return casefile.AttributeMatchers{{Key: "kind", Value: strPtr("SPAN_KIND_CLIENT")}}
+}
+
+func TestMatchTree(t *testing.T) {
+	cases := []struct {
+		name string
+		tree []casefile.SpanTree
+		want string // substring of the only failure; empty means pass
+	}{
+		{
+			name: "server with two client children",
+			tree: []casefile.SpanTree{{
+				MatchEntry: casefile.MatchEntry{Name: strPtr("GET /checkout")},
+				Children:   []casefile.SpanTree{{MatchEntry: casefile.MatchEntry{Attributes: clientKind()}, Count: "== 2"}},
+			}},
+		},
+		{
+			name: "ancestor",
+			tree: []casefile.SpanTree{{
+				MatchEntry:  casefile.MatchEntry{Name: strPtr("GET /checkout")},
+				Descendants: []casefile.SpanTree{{MatchEntry: casefile.MatchEntry{Name: strPtr("SELECT stock")}}},
+			}},
+		},
+		{
+			name: "grandchild is not a child",
+			tree: []casefile.SpanTree{{
+				MatchEntry: casefile.MatchEntry{Name: strPtr("GET /checkout")},
+				Children:   []casefile.SpanTree{{MatchEntry: casefile.MatchEntry{Name: strPtr("SELECT stock")}}},
+			}},
+			want: `expected >= 1 spans matching name="GET /checkout", got 0; span "GET /checkout" matched but expected >= 1 children matching name="SELECT stock", got 0`,
+		},
+		{
+			name: "wrong child count",
+			tree: []casefile.SpanTree{{
+				MatchEntry: casefile.MatchEntry{Name: strPtr("GET /checkout")},
+				Children:   []casefile.SpanTree{{MatchEntry: casefile.MatchEntry{Attributes: clientKind()}, Count: "== 3"}},
+			}},
+			want: `expected == 3 children matching attribute kind="SPAN_KIND_CLIENT", got 2`,
+		},
+		{
+			name: "nested children",
+			tree: []casefile.SpanTree{{
+				MatchEntry: casefile.MatchEntry{Name: strPtr("GET /checkout")},
+				Children: []casefile.SpanTree{{
+					MatchEntry: casefile.MatchEntry{Name: strPtr("GET /stock")},
+					Children:   []casefile.SpanTree{{MatchEntry: casefile.MatchEntry{Name: strPtr("SELECT stock")}}},
+				}},
+			}},
+		},
+		{
+			name: "top-level count",
+			tree: []casefile.SpanTree{{MatchEntry: casefile.MatchEntry{Attributes: clientKind()}, Count: "== 3"}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := MatchTree(checkoutTrace, tc.tree)
+			if tc.want == "" {
+				if len(got) != 0 {
+					t.Fatalf("expected pass, got %v", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Rule != "tree" || !strings.Contains(got[0].Detail, tc.want) {
+				t.Fatalf("expected one tree failure containing %q, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchTreeWithoutSpanIDs(t *testing.T) {
+	rows := []Row{{Name: "GET /checkout"}, {Name: "POST /payment"}}
+	got := MatchTree(rows, []casefile.SpanTree{{
+		MatchEntry: casefile.MatchEntry{Name: strPtr("GET /checkout")},
+		Children:   []casefile.SpanTree{{MatchEntry: casefile.MatchEntry{Name: strPtr("POST /payment")}}},
+	}})
+	if len(got) != 1 || !strings.Contains(got[0].Detail, "no span IDs") {
+		t.Fatalf("expected a missing-ID failure, got %v", got)
+	}
+}
+
+func TestSingleTrace(t *testing.T) {
+	if got := SingleTrace(checkoutTrace); len(got) != 0 {
+		t.Fatalf("expected one trace, got %v", got)
+	}
+	two := append([]Row{{Name: "other", TraceID: "t2"}}, checkoutTrace...)
+	if got := SingleTrace(two); len(got) != 1 || got[0].Detail != "expected spans from one trace, got 2: t1, t2" {
+		t.Fatalf("expected a two-trace failure, got %v", got)
+	}
+	if got := SingleTrace(nil); len(got) != 1 || !strings.Contains(got[0].Detail, "got none") {
+		t.Fatalf("expected a no-trace failure, got %v", got)
+	}
+}
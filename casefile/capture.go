@@ -0,0 +1,74 @@
+package casefile
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+)
+
+// CaptureSource says where a captured value comes from. On an HTTP input it
+// is a response Header or a JSON path into the response body; on an
+// assertion, TraceID (traces only: the first trace the search returned) or a
+// JSON path into the gcx output of the passing poll. Regex then narrows the
+// value to its first group, or the whole match without one; set alone, it
+// searches the response body or gcx output.
+//
+// Later steps read the value as ${capture.name}.
+type CaptureSource struct {
+	Header  string `yaml:"header,omitempty"`
+	JSON    string `yaml:"json,omitempty"`
+	TraceID bool   `yaml:"trace_id,omitempty"`
+	Regex   string `yaml:"regex,omitempty"`
+}
+
+// CapturesJSON reports whether a capture reads the gcx output as JSON, so
+// the query must ask gcx for it.
+func (a AssertionCommon) CapturesJSON() bool {
+	for _, src := range a.Capture {
+		if src.JSON != "" || src.TraceID {
+			return true
+		}
+	}
+	return false
+}
+
+// captureName is the shape ${capture.name} can reference.
+var captureName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// validateCaptures checks the capture block at path. signal is "input" for
+// an HTTP input, "grpc", "compose" or "kubernetes" for those inputs, or the
+// assertion's signal ("traces", "logs", ...).
+func validateCaptures(path string, captures map[string]CaptureSource, signal string) error {
+	for _, name := range slices.Sorted(maps.Keys(captures)) {
+		src := captures[name]
+		p := path + ".capture." + name
+		if !captureName.MatchString(name) {
+			return fmt.Errorf("%s: name may only contain letters, digits, _ and -", p)
+		}
+		set := 0
+		for _, present := range []bool{src.Header != "", src.JSON != "", src.TraceID} {
+			if present {
+				set++
+			}
+		}
+		if set > 1 {
+			return fmt.Errorf("%s: set at most one of header, json, or trace_id", p)
+		}
+		if set == 0 && src.Regex == "" {
+			return fmt.Errorf("%s: at least one of header, json, trace_id, or regex is required", p)
+		}
+		if src.Header != "" && signal != "input" && signal != "grpc" {
+			return fmt.Errorf("%s.header: only supported on HTTP and gRPC inputs", p)
+		}
+		if src.TraceID && signal != "traces" {
+			return fmt.Errorf("%s.trace_id: only supported on traces", p)
+		}
+		if src.Regex != "" {
+			if _, err := regexp.Compile(src.Regex); err != nil {
+				return fmt.Errorf("%s.regex: invalid regexp %q: %v", p, src.Regex, err)
+			}
+		}
+	}
+	return nil
+}
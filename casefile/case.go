@@ -10,10 +10,15 @@
 package casefile
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"math"
 	"os"
+	"reflect"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,6 +31,8 @@ import (
 // loaded through oats-config.yaml, whose meta.version is the single schema
 // version (see discovery.SupportedVersion).
 type Case struct {
+	// Extends lists fragment files merged under this case; see Load.
+	Extends  []string       `yaml:"extends,omitempty"`
 	Name     string         `yaml:"name"`
 	Tags     []string       `yaml:"tags,omitempty"`
 	Interval time.Duration  `yaml:"interval,omitempty"`
@@ -33,10 +40,19 @@ type Case struct {
 
 	Seed     Seed     `yaml:"seed"`
 	Input    []Input  `yaml:"input,omitempty"`
+	Steps    []Step   `yaml:"steps,omitempty"`
 	Expected Expected `yaml:"expected"`
 
+	// Matrix runs the case once per variant; see Expand.
+	Matrix []MatrixVariant `yaml:"matrix,omitempty"`
+
+	// Variant names the matrix variant an expanded case runs; set by Expand.
+	Variant string `yaml:"-"`
 	// SourcePath is filled by the loader; not part of the yaml surface.
 	SourcePath string `yaml:"-"`
+	// Fragments holds the absolute paths of every file the case extends,
+	// directly or through another fragment. Filled by the loader.
+	Fragments []string `yaml:"-"`
 }
 
 // Seed declares how a case populates the stack before assertions run.
@@ -53,7 +69,7 @@ type Seed struct {
 	Traces  []SeedTrace    `yaml:"traces,omitempty"`
 	Logs    []SeedLog      `yaml:"logs,omitempty"`
 	Metrics []SeedMetric   `yaml:"metrics,omitempty"`
-	Vars    map[string]any `yaml:"vars,omitempty"`
+	Vars    map[string]any `yaml:"vars,omitempty"` // values for ${vars.*} references; see Interpolate
 }
 
 // EffectiveType returns the seed type, defaulting to "app" when unset so an
@@ -82,13 +98,18 @@ type FixtureConfig struct {
 // template defaults to "lgtm" when unset, so OATS boots a builtin
 // grafana/otel-lgtm stack next to the user's file/files. Set template: "none"
 // to opt out and bring your own observability stack via file/files.
+//
+// inject_run_id appends oats.run.id=<id> to app_service's
+// OTEL_RESOURCE_ATTRIBUTES so OATS can scope trace and log queries to the
+// current run.
 type ComposeFixture struct {
-	Template   string   `yaml:"template,omitempty"`
-	File       string   `yaml:"file,omitempty"`  // single compose file; mutually exclusive with files (Validate rejects both)
-	Files      []string `yaml:"files,omitempty"` // multiple compose files; mutually exclusive with file (Validate rejects both)
-	Env        []string `yaml:"env,omitempty"`
-	AppService string   `yaml:"app_service,omitempty"`
-	AppPort    int      `yaml:"app_port,omitempty"`
+	Template    string   `yaml:"template,omitempty"`
+	File        string   `yaml:"file,omitempty"`  // single compose file; mutually exclusive with files (Validate rejects both)
+	Files       []string `yaml:"files,omitempty"` // multiple compose files; mutually exclusive with file (Validate rejects both)
+	Env         []string `yaml:"env,omitempty"`
+	AppService  string   `yaml:"app_service,omitempty"`
+	AppPort     int      `yaml:"app_port,omitempty"`
+	InjectRunID bool     `yaml:"inject_run_id,omitempty"`
 }
 
 // EffectiveTemplate returns the compose template to apply, defaulting an unset
@@ -102,6 +123,8 @@ func (c ComposeFixture) EffectiveTemplate() string {
 }
 
 // K3DFixture boots a k3d cluster and builds/imports the application image.
+// inject_run_id appends oats.run.id=<id> to the OTEL_RESOURCE_ATTRIBUTES of the
+// app_service deployment's app container after the manifests are applied.
 type K3DFixture struct {
 	K8sDir           string   `yaml:"k8s_dir,omitempty"`
 	AppService       string   `yaml:"app_service,omitempty"`
@@ -111,6 +134,7 @@ type K3DFixture struct {
 	AppPort          int      `yaml:"app_port,omitempty"`
 	ImportImages     []string `yaml:"import_images,omitempty"`
 	PoolSize         int      `yaml:"pool_size,omitempty"`
+	InjectRunID      bool     `yaml:"inject_run_id,omitempty"`
 }
 
 // RemoteFixture points at an already-running stack; OATS boots nothing.
@@ -141,6 +165,12 @@ func (f FixtureConfig) HasManagedApp() bool {
 	return f.Compose != nil && f.Compose.AppService != "" && f.Compose.AppPort > 0
 }
 
+// InjectsRunID reports whether the fixture stamps the run ID onto the app's
+// resource attributes, so app-emitted traces and logs can be scoped to a run.
+func (f FixtureConfig) InjectsRunID() bool {
+	return (f.Compose != nil && f.Compose.InjectRunID) || (f.K3D != nil && f.K3D.InjectRunID)
+}
+
 // UsesRelativePaths reports whether the fixture references files/directories
 // resolved relative to the case's directory (compose file/files, k3d manifests
 // or build context). Such fixtures mean different things in different
@@ -179,11 +209,23 @@ type SeedMetric struct {
 	Service string `yaml:"service"`
 	Name    string `yaml:"name"`
 	Value   int64  `yaml:"value"`
+	// Histogram, when set, pushes an explicit-bucket histogram instead of
+	// the monotonic sum Value.
+	Histogram *SeedHistogram `yaml:"histogram,omitempty"`
+}
+
+// SeedHistogram records Observations into buckets with upper Bounds; an
+// implicit +Inf bucket takes anything above the last bound.
+type SeedHistogram struct {
+	Bounds       []float64 `yaml:"bounds"`
+	Observations []float64 `yaml:"observations"`
 }
 
 // Input drives the application under test once, before assertions begin.
 // HTTP inputs keep the request shape from the legacy format (schema version 2);
-// Compose inputs run a one-shot command in a service from the case's fixture.
+// gRPC inputs call one unary method on the application endpoint; Compose
+// inputs run a one-shot command in a service from the case's fixture, and
+// Kubernetes inputs one in a pod or Job of a k3d fixture.
 type Input struct {
 	Scheme  string            `yaml:"scheme,omitempty"`
 	Host    string            `yaml:"host,omitempty"`
@@ -192,8 +234,91 @@ type Input struct {
 	Headers map[string]string `yaml:"headers,omitempty"`
 	Body    string            `yaml:"body,omitempty"`
 	Status  string            `yaml:"status,omitempty"`
-	Retry   *InputRetry       `yaml:"retry,omitempty"`
-	Compose *ComposeInput     `yaml:"compose,omitempty"`
+	// ExpectHeaders and ExpectBody check the response beyond its status; a
+	// mismatch fails the input like a wrong status does.
+	ExpectHeaders map[string]string `yaml:"expect_headers,omitempty"`
+	ExpectBody    *ExpectBody       `yaml:"expect_body,omitempty"`
+	Retry         *InputRetry       `yaml:"retry,omitempty"`
+	Compose       *ComposeInput     `yaml:"compose,omitempty"`
+	GRPC          *GRPCInput        `yaml:"grpc,omitempty"`
+	Kubernetes    *KubernetesInput  `yaml:"kubernetes,omitempty"`
+	// Fixture acts on a service of the fixture instead of driving the app.
+	Fixture *FixtureAction `yaml:"fixture,omitempty"`
+	// Capture records values from the response for later steps.
+	Capture map[string]CaptureSource `yaml:"capture,omitempty"`
+	// TraceContext starts the request's trace in OATS: it sends a generated
+	// traceparent and captures the trace ID for later assertions.
+	TraceContext *TraceContext `yaml:"trace_context,omitempty"`
+
+	// Load generation: send the request Repeat times, or for Duration, from
+	// Concurrency workers (default 1), at most at Rate ("10/s", "600/m")
+	// across all of them.
+	Repeat      int           `yaml:"repeat,omitempty"`
+	Concurrency int           `yaml:"concurrency,omitempty"`
+	Rate        string        `yaml:"rate,omitempty"`
+	Duration    time.Duration `yaml:"duration,omitempty"`
+}
+
+// ExpectBody checks an HTTP input's response body. JSON maps dotted paths,
+// as in json captures, to the value each must hold.
+type ExpectBody struct {
+	Contains StringList        `yaml:"contains,omitempty"`
+	Regex    StringList        `yaml:"regex,omitempty"`
+	JSON     map[string]string `yaml:"json,omitempty"`
+}
+
+// hasHTTPKeys reports whether the input sets a key that only HTTP inputs
+// take; retry, which gRPC inputs take too, is left to the caller.
+func (in Input) hasHTTPKeys() bool {
+	return in.Path != "" || in.Scheme != "" || in.Host != "" || in.Method != "" || in.Headers != nil || in.Body != "" || in.Status != "" ||
+		in.ExpectHeaders != nil || in.ExpectBody != nil
+}
+
+// Load reports whether the input generates load rather than sending one
+// request.
+func (in Input) Load() bool {
+	return in.Repeat > 0 || in.Duration > 0
+}
+
+// ParseRate parses a request rate such as "10/s", "600/m" or "0.5/s" into
+// requests per second.
+func ParseRate(rate string) (float64, error) {
+	n, unit, ok := strings.Cut(strings.TrimSpace(rate), "/")
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[strings.TrimSpace(unit)]
+	count, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+	if !ok || per == 0 || err != nil || count <= 0 || math.IsInf(count, 0) {
+		return 0, fmt.Errorf("expected <count>/<s|m|h> such as 10/s, got %q", rate)
+	}
+	return count / per.Seconds(), nil
+}
+
+// TraceContext configures the W3C trace context an HTTP input sends.
+type TraceContext struct {
+	// Capture names the capture holding the generated trace ID; it defaults
+	// to "trace_id".
+	Capture string `yaml:"capture,omitempty"`
+	// Sampled sets the traceparent sampled flag; it defaults to true.
+	Sampled *bool `yaml:"sampled,omitempty"`
+	// Baggage is sent as a W3C baggage header when set.
+	Baggage map[string]string `yaml:"baggage,omitempty"`
+}
+
+// EffectiveCapture returns the capture name, defaulting to "trace_id".
+func (t TraceContext) EffectiveCapture() string {
+	if t.Capture == "" {
+		return "trace_id"
+	}
+	return t.Capture
+}
+
+// CaptureNames lists the captures the input takes, sorted.
+func (in Input) CaptureNames() []string {
+	names := slices.Collect(maps.Keys(in.Capture))
+	if in.TraceContext != nil {
+		names = append(names, in.TraceContext.EffectiveCapture())
+	}
+	slices.Sort(names)
+	return names
 }
 
 // InputRetry opts an HTTP input into bounded retries. Zero values inherit the
@@ -209,6 +334,86 @@ type InputRetry struct {
 type ComposeInput struct {
 	Service string   `yaml:"service"`
 	Command []string `yaml:"command"`
+	// ExitCode is the exit code the command must return; 0 by default.
+	ExitCode *int `yaml:"exit_code,omitempty"`
+	// Contains and Regex must hold against the command's output, stdout
+	// followed by stderr.
+	Contains StringList `yaml:"contains,omitempty"`
+	Regex    StringList `yaml:"regex,omitempty"`
+}
+
+// KubernetesInput runs a one-shot command on a k3d fixture: with kubectl exec
+// in a running pod of Deployment, or of the pods matching the label Selector,
+// or in a Job created from Image and awaited to completion. Exactly one of
+// the three is set. Command is an argv list, as for Compose inputs; for a Job
+// it is passed as the container's args, so the image's entrypoint still runs,
+// and may be empty to run the image as built.
+type KubernetesInput struct {
+	Deployment string `yaml:"deployment,omitempty"`
+	Selector   string `yaml:"selector,omitempty"`
+	// Container picks the container of a multi-container pod.
+	Container string   `yaml:"container,omitempty"`
+	Image     string   `yaml:"image,omitempty"`
+	Command   []string `yaml:"command,omitempty"`
+	// ExitCode, Contains and Regex check the command as for Compose inputs.
+	ExitCode *int       `yaml:"exit_code,omitempty"`
+	Contains StringList `yaml:"contains,omitempty"`
+	Regex    StringList `yaml:"regex,omitempty"`
+}
+
+// EffectiveExitCode returns the expected exit code, defaulting to 0.
+func (k KubernetesInput) EffectiveExitCode() int {
+	if k.ExitCode == nil {
+		return 0
+	}
+	return *k.ExitCode
+}
+
+// GRPCInput calls one unary method on the application endpoint, over
+// plaintext HTTP/2. Descriptors come from server reflection unless
+// DescriptorSet names a FileDescriptorSet (protoc --descriptor_set_out
+// --include_imports), relative to the case file.
+type GRPCInput struct {
+	// Service is the fully-qualified service name, e.g. helloworld.Greeter.
+	Service string `yaml:"service"`
+	Method  string `yaml:"method"`
+	// Request is the request message in protobuf JSON; empty sends {}.
+	Request  string            `yaml:"request,omitempty"`
+	Metadata map[string]string `yaml:"metadata,omitempty"`
+	// Status is the expected status code, by name (NOT_FOUND) or number;
+	// OK by default.
+	Status        string `yaml:"status,omitempty"`
+	DescriptorSet string `yaml:"descriptor_set,omitempty"`
+}
+
+// GRPCCodes are the gRPC status code names, indexed by code.
+var GRPCCodes = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED",
+	"NOT_FOUND", "ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED",
+	"INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+// ExpectedStatus returns the expected status code, OK when Status is unset.
+func (g GRPCInput) ExpectedStatus() (int, error) {
+	if g.Status == "" {
+		return 0, nil
+	}
+	if i := slices.Index(GRPCCodes, strings.ToUpper(g.Status)); i >= 0 {
+		return i, nil
+	}
+	if n, err := strconv.Atoi(g.Status); err == nil && n >= 0 && n < len(GRPCCodes) {
+		return n, nil
+	}
+	return 0, fmt.Errorf("expected a gRPC status name such as NOT_FOUND or a code 0-%d, got %q", len(GRPCCodes)-1, g.Status)
+}
+
+// EffectiveExitCode returns the expected exit code, defaulting to 0.
+func (c ComposeInput) EffectiveExitCode() int {
+	if c.ExitCode == nil {
+		return 0
+	}
+	return *c.ExitCode
 }
 
 // Expected groups per-signal assertion blocks. A case may omit any signal it
@@ -221,10 +426,12 @@ type Expected struct {
 	Profiles    []ProfileAssertion `yaml:"profiles,omitempty"`
 	ComposeLogs []string           `yaml:"compose-logs,omitempty"`
 	Custom      []CustomCheck      `yaml:"custom-checks,omitempty"`
+	Correlate   []Correlation      `yaml:"correlate,omitempty"`
 }
 
 type CustomCheck struct {
 	Script string `yaml:"script"`
+	When   string `yaml:"when,omitempty"`
 }
 
 // AssertionCommon holds the keys every signal-type assertion supports.
@@ -237,6 +444,24 @@ type AssertionCommon struct {
 	Match       []MatchEntry `yaml:"match,omitempty"`
 	Count       string       `yaml:"count,omitempty"` // ">= 1", "== 0", ...
 	Absent      bool         `yaml:"absent,omitempty"`
+	// ScopeRunID narrows the query to telemetry tagged with this run's ID.
+	// Unset scopes automatically when the run ID reached the signal (inline-otlp
+	// seeds, inject_run_id fixtures); false opts out; true forces it.
+	ScopeRunID *bool `yaml:"scope_run_id,omitempty"`
+	// Queries look back to when the case started seeding, less the runner's
+	// clock-skew allowance. Since pins a fixed lookback instead; Window
+	// replaces the skew allowance. At most one of the two is set.
+	Since  time.Duration `yaml:"since,omitempty"`
+	Window time.Duration `yaml:"window,omitempty"`
+	// When limits the assertion to matrix variants whose name matches this
+	// regexp. Only valid on a case with a matrix.
+	When string `yaml:"when,omitempty"`
+	// Capture records values from the passing poll's output for later steps.
+	Capture map[string]CaptureSource `yaml:"capture,omitempty"`
+	// TraceID pins the assertion to one trace, usually one an input started
+	// with trace_context: traces and logs narrow their query to it, and a
+	// metric needs an exemplar pointing at it.
+	TraceID string `yaml:"trace_id,omitempty"`
 }
 
 type MatchType string
@@ -250,6 +475,70 @@ type MatchEntry struct {
 	MatchType  MatchType         `yaml:"match_type,omitempty"`
 	Name       *string           `yaml:"name,omitempty"`
 	Attributes AttributeMatchers `yaml:"attributes,omitempty"`
+	// NoExtraAttributes requires the row to carry no attribute beyond those
+	// in Attributes and IgnoreAttributes. An IgnoreAttributes entry may name
+	// a level ("resource.host.name") and may end in "*" to ignore a prefix.
+	NoExtraAttributes bool     `yaml:"no_extra_attributes,omitempty"`
+	IgnoreAttributes  []string `yaml:"ignore_attributes,omitempty"`
+
+	// Span-only keys, valid in match_spans and tree. Kind and StatusCode are
+	// compared case-insensitively; StatusMessage and event names honour
+	// MatchType; Duration is a comparison such as "< 500ms".
+	Kind          string      `yaml:"kind,omitempty"`        // server, client, internal, producer, consumer
+	StatusCode    string      `yaml:"status_code,omitempty"` // unset, ok, error
+	StatusMessage *string     `yaml:"status_message,omitempty"`
+	Duration      string      `yaml:"duration,omitempty"`
+	Events        []SpanEvent `yaml:"events,omitempty"`
+	Links         []SpanLink  `yaml:"links,omitempty"`
+}
+
+// SpanEvent matches one event on a span, such as an "exception" event.
+type SpanEvent struct {
+	Name       *string           `yaml:"name,omitempty"`
+	Attributes AttributeMatchers `yaml:"attributes,omitempty"`
+}
+
+// SpanLink matches one link on a span. An empty entry matches any link.
+type SpanLink struct {
+	TraceID    string            `yaml:"trace_id,omitempty"`
+	SpanID     string            `yaml:"span_id,omitempty"`
+	Attributes AttributeMatchers `yaml:"attributes,omitempty"`
+}
+
+// SpanKinds and StatusCodes are the values kind and status_code accept.
+var (
+	SpanKinds   = []string{"unspecified", "internal", "server", "client", "producer", "consumer"}
+	StatusCodes = []string{"unset", "ok", "error"}
+)
+
+// hasSpanKeys reports whether the entry uses any span-only key.
+func (m MatchEntry) hasSpanKeys() bool {
+	return m.Kind != "" || m.StatusCode != "" || m.StatusMessage != nil || m.Duration != "" || len(m.Events) > 0 || len(m.Links) > 0
+}
+
+// DurationBound parses the duration comparison into an operator and bound.
+func (m MatchEntry) DurationBound() (op string, bound time.Duration, err error) {
+	op, rest, err := splitComparison(m.Duration)
+	if err != nil {
+		return "", 0, err
+	}
+	bound, err = time.ParseDuration(rest)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid duration in %q: %v", m.Duration, err)
+	}
+	return op, bound, nil
+}
+
+// splitComparison splits "<op> <operand>" into its operator and operand.
+func splitComparison(expr string) (op, operand string, err error) {
+	trimmed := strings.TrimSpace(expr)
+	// Longest operators first so ">=" is matched before ">".
+	for _, candidate := range []string{">=", "<=", "==", "!=", ">", "<"} {
+		if rest, ok := strings.CutPrefix(trimmed, candidate); ok {
+			return candidate, strings.TrimSpace(rest), nil
+		}
+	}
+	return "", "", fmt.Errorf("expected comparison operator (>=, <=, ==, !=, >, <) at start of %q", expr)
 }
 
 func (m MatchEntry) EffectiveMatchType() MatchType {
@@ -296,9 +585,41 @@ func (s StringList) MarshalYAML() (any, error) {
 	}
 }
 
+// AttributeMatcher checks one attribute. With no operator set it only
+// requires the key to be present; every operator given must hold. Value,
+// NotEquals and OneOf honour the entry's match_type.
 type AttributeMatcher struct {
-	Key   string
-	Value *string
+	Key       string   `yaml:"key"`
+	Value     *string  `yaml:"value,omitempty"`
+	NotEquals *string  `yaml:"not_equals,omitempty"`
+	Compare   string   `yaml:"compare,omitempty"` // numeric comparison, e.g. ">= 500"
+	OneOf     []string `yaml:"one_of,omitempty"`
+	Type      string   `yaml:"type,omitempty"`   // see AttributeTypes
+	Absent    bool     `yaml:"absent,omitempty"` // the key must not exist
+}
+
+// AttributeTypes are the OTLP value types the type operator accepts.
+var AttributeTypes = []string{"string", "int", "double", "bool", "array", "map", "bytes"}
+
+// CompareBound parses the compare operator into an operator and number.
+func (a AttributeMatcher) CompareBound() (op string, bound float64, err error) {
+	op, rest, err := splitComparison(a.Compare)
+	if err != nil {
+		return "", 0, err
+	}
+	bound, err = strconv.ParseFloat(rest, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid number in %q: %v", a.Compare, err)
+	}
+	return op, bound, nil
+}
+
+// Level splits the key at its first dot: "resource.service.name" gives
+// ("resource", "service.name", true). Rows that keep attributes apart by
+// level (resource, scope, span, log) look the rest up in that level only.
+func (a AttributeMatcher) Level() (level, key string, ok bool) {
+	level, key, ok = strings.Cut(a.Key, ".")
+	return level, key, ok && level != "" && key != ""
 }
 
 type AttributeMatchers []AttributeMatcher
@@ -306,18 +627,21 @@ type AttributeMatchers []AttributeMatcher
 func (a *AttributeMatchers) UnmarshalYAML(node *yaml.Node) error {
 	switch node.Kind {
 	case yaml.SequenceNode:
-		type attrDoc struct {
-			Key   string  `yaml:"key"`
-			Value *string `yaml:"value,omitempty"`
+		// node.Decode does not inherit the strict decoder's KnownFields, so
+		// check keys here: a misspelt operator would otherwise be dropped and
+		// leave a bare presence check.
+		known := yamlKeys(reflect.TypeFor[AttributeMatcher]())
+		for _, item := range node.Content {
+			for k := 0; item.Kind == yaml.MappingNode && k < len(item.Content); k += 2 {
+				if key := item.Content[k]; !slices.Contains(known, key.Value) {
+					return fmt.Errorf("line %d: field %s not found in type casefile.AttributeMatcher", key.Line, key.Value)
+				}
+			}
 		}
-		var docs []attrDoc
-		if err := node.Decode(&docs); err != nil {
+		var out []AttributeMatcher
+		if err := node.Decode(&out); err != nil {
 			return err
 		}
-		out := make([]AttributeMatcher, 0, len(docs))
-		for _, doc := range docs {
-			out = append(out, AttributeMatcher(doc))
-		}
 		*a = out
 		return nil
 	case yaml.MappingNode:
@@ -353,35 +677,195 @@ func (a *AttributeMatchers) UnmarshalYAML(node *yaml.Node) error {
 	}
 }
 
+// yamlKeys lists the yaml keys of a struct's fields.
+func yamlKeys(t reflect.Type) []string {
+	keys := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		keys = append(keys, name)
+	}
+	return keys
+}
+
 func (a AttributeMatchers) MarshalYAML() (any, error) {
 	if len(a) == 0 {
 		return nil, nil
 	}
-	type attrDoc struct {
-		Key   string  `yaml:"key"`
-		Value *string `yaml:"value,omitempty"`
-	}
-	out := make([]attrDoc, 0, len(a))
-	for _, attr := range a {
-		out = append(out, attrDoc(attr))
-	}
-	return out, nil
+	return []AttributeMatcher(a), nil
 }
 
 type TraceAssertion struct {
-	TraceQL         string       `yaml:"traceql"`
-	MatchSpans      []MatchEntry `yaml:"match_spans,omitempty"`
+	TraceQL    string       `yaml:"traceql"`
+	MatchSpans []MatchEntry `yaml:"match_spans,omitempty"`
+	// Tree matches spans by their place in the trace: each entry must be
+	// satisfied by some span whose children and descendants satisfy the
+	// nested entries. SingleTrace requires every returned span to share one
+	// trace ID.
+	Tree            []SpanTree `yaml:"tree,omitempty"`
+	SingleTrace     bool       `yaml:"single_trace,omitempty"`
 	AssertionCommon `yaml:",inline"`
 }
 
+// Structured reports whether the assertion inspects individual spans, which
+// needs the JSON search output and the fetched traces rather than gcx text.
+func (a TraceAssertion) Structured() bool {
+	return len(a.MatchSpans) > 0 || len(a.Tree) > 0 || a.SingleTrace
+}
+
+// SpanTree is one node of a tree assertion: a span match plus constraints on
+// the spans below it. Count compares the number of spans at this level
+// (direct children, descendants, or, at the top, any span) that satisfy the
+// node; it defaults to ">= 1".
+type SpanTree struct {
+	MatchEntry  `yaml:",inline"`
+	Count       string     `yaml:"count,omitempty"`
+	Children    []SpanTree `yaml:"children,omitempty"`
+	Descendants []SpanTree `yaml:"descendants,omitempty"`
+}
+
+// EffectiveCount returns the node's count comparison, defaulting to ">= 1".
+func (t SpanTree) EffectiveCount() string {
+	if t.Count == "" {
+		return ">= 1"
+	}
+	return t.Count
+}
+
 type MetricAssertion struct {
-	PromQL          string `yaml:"promql"`
-	Value           string `yaml:"value,omitempty"` // ">= 0", "== 42", ...
+	PromQL string `yaml:"promql"`
+	Value  string `yaml:"value,omitempty"` // ">= 0", "== 42", ... against the first series
+	// Each, Any and None compare every returned series' value: Each must
+	// hold for all of them, Any for at least one, None for none.
+	Each string `yaml:"each,omitempty"`
+	Any  string `yaml:"any,omitempty"`
+	None string `yaml:"none,omitempty"`
+	// Histogram checks the histogram PromQL selects, which must then be a
+	// plain selector such as `http_server_request_duration_seconds{...}`.
+	Histogram *HistogramAssertion `yaml:"histogram,omitempty"`
+	// Range runs PromQL as a range query and checks each series over time.
+	// Value, each/any/none and match then see each series' last sample.
+	Range *RangeAssertion `yaml:"range,omitempty"`
+	// Metadata checks the type, unit, description and temporality the
+	// backend recorded for the metric PromQL selects, which must then be a
+	// plain selector.
+	Metadata *MetricMetadata `yaml:"metadata,omitempty"`
+	// Cardinality caps how many series the query returns.
+	Cardinality     *CardinalityBudget `yaml:"cardinality,omitempty"`
 	AssertionCommon `yaml:",inline"`
 }
 
+// CardinalityBudget caps the series a metric query returns (MaxSeries) or
+// the streams a log query returns (MaxStreams), and how many distinct values
+// each label in MaxLabelValues takes across them. With Per set, the series or
+// stream cap applies to each value of that label separately, e.g. per
+// service_name.
+type CardinalityBudget struct {
+	MaxSeries      int            `yaml:"max_series,omitempty"`
+	MaxStreams     int            `yaml:"max_streams,omitempty"`
+	MaxLabelValues map[string]int `yaml:"max_label_values,omitempty"`
+	Per            string         `yaml:"per,omitempty"`
+}
+
+// MetricMetadata is the expected metadata of a metric. Type and Temporality
+// are compared case-insensitively; Unit and Description exactly, so an empty
+// string asserts the backend recorded none.
+type MetricMetadata struct {
+	Type        string  `yaml:"type,omitempty"` // see MetricTypes
+	Unit        *string `yaml:"unit,omitempty"`
+	Description *string `yaml:"description,omitempty"`
+	Temporality string  `yaml:"temporality,omitempty"` // see Temporalities
+}
+
+// MetricTypes are the Prometheus metric types metadata.type accepts, and
+// Temporalities the values metadata.temporality accepts.
+var (
+	MetricTypes   = []string{"counter", "gauge", "histogram", "gaugehistogram", "summary", "info", "stateset", "unknown"}
+	Temporalities = []string{"cumulative", "delta"}
+)
+
+// RangeAssertion checks every series of a range query evaluated at Step over
+// the query window. Monotonic requires each series to grow and never drop;
+// NoResets only forbids drops. Samples compares the number of points per
+// series, Rate the per-second increase across the window (counter resets
+// accounted for, as PromQL's increase does), and MaxAge bounds how old each
+// series' newest point may be.
+type RangeAssertion struct {
+	Step      time.Duration `yaml:"step"`
+	Monotonic bool          `yaml:"monotonic,omitempty"`
+	NoResets  bool          `yaml:"no_resets,omitempty"`
+	Samples   string        `yaml:"samples,omitempty"`
+	Rate      string        `yaml:"rate,omitempty"`
+	MaxAge    time.Duration `yaml:"max_age,omitempty"`
+}
+
+// ComparesSeries reports whether a sets any of each, any or none.
+func (a MetricAssertion) ComparesSeries() bool {
+	return a.Each != "" || a.Any != "" || a.None != ""
+}
+
+// HistogramAssertion checks a histogram summed across the series the
+// selector matches. Count is a comparison on the observation count; Sum and
+// Quantiles take HistogramBound comparisons; Buckets is the exact list of
+// upper bounds (without +Inf); BucketCounts compares cumulative counts.
+type HistogramAssertion struct {
+	Count        string            `yaml:"count,omitempty"`
+	Sum          string            `yaml:"sum,omitempty"`
+	Buckets      []float64         `yaml:"buckets,omitempty"`
+	BucketCounts []BucketCount     `yaml:"bucket_counts,omitempty"`
+	Quantiles    map[string]string `yaml:"quantiles,omitempty"` // "p95": "< 300ms"
+}
+
+// BucketCount compares the cumulative count of the bucket whose upper bound
+// is LE ("0.25", "+Inf").
+type BucketCount struct {
+	LE    string `yaml:"le"`
+	Count string `yaml:"count"`
+}
+
+// plainSelector is a metric name with optional label matchers.
+var plainSelector = regexp.MustCompile(`(?s)^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(?:\{(.*)\})?\s*$`)
+
+// Selector splits PromQL that is a plain selector, as histogram and metadata
+// require, into the metric name and the label matchers inside its braces.
+func (a MetricAssertion) Selector() (name, matchers string, err error) {
+	m := plainSelector.FindStringSubmatch(a.PromQL)
+	if m == nil {
+		return "", "", fmt.Errorf("needs a plain selector such as name{label=\"value\"}, got %q", a.PromQL)
+	}
+	return m[1], strings.TrimSpace(m[2]), nil
+}
+
+// HistogramBound parses a comparison such as "< 0.3" or "< 300ms". A
+// duration is converted to seconds, the unit OpenTelemetry records latency
+// histograms in.
+func HistogramBound(expr string) (op string, bound float64, err error) {
+	op, rest, err := splitComparison(expr)
+	if err != nil {
+		return "", 0, err
+	}
+	if bound, err = strconv.ParseFloat(rest, 64); err == nil {
+		return op, bound, nil
+	}
+	d, err := time.ParseDuration(rest)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid number or duration in %q", expr)
+	}
+	return op, d.Seconds(), nil
+}
+
+// Quantile parses a quantiles key such as "p95" or "p99.9" into 0.95, 0.999.
+func Quantile(key string) (float64, error) {
+	n, err := strconv.ParseFloat(strings.TrimPrefix(key, "p"), 64)
+	if !strings.HasPrefix(key, "p") || err != nil || n <= 0 || n >= 100 {
+		return 0, fmt.Errorf("expected p<percentile> such as p95 or p99.9, got %q", key)
+	}
+	return n / 100, nil
+}
+
 type LogAssertion struct {
-	LogQL           string `yaml:"logql"`
+	LogQL string `yaml:"logql"`
+	// Cardinality caps how many streams the query returns.
+	Cardinality     *CardinalityBudget `yaml:"cardinality,omitempty"`
 	AssertionCommon `yaml:",inline"`
 }
 
@@ -393,12 +877,19 @@ type ProfileAssertion struct {
 // Load reads a yaml file from disk and returns a parsed, validated Case.
 // Returns an error if the file is missing, the yaml is malformed, or the
 // case violates any structural rule (see Validate).
+//
+// A case may extend fragment files, listed under extends: relative to the
+// file that names them. Fragments are partial cases, and may extend others.
+// They merge in order beneath the case: mappings merge key by key, the input,
+// seed and expected lists concatenate (fragment entries first), and any other
+// value is replaced by the later file. Relative paths inside a fragment, such
+// as compose files or check scripts, resolve against the fragment's directory.
 func Load(path string) (*Case, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("casefile load %s: %w", path, err)
 	}
-	c, err := Parse(data)
+	c, err := parseCase(data, path)
 	if err != nil {
 		return nil, fmt.Errorf("casefile parse %s: %w", path, err)
 	}
@@ -407,25 +898,25 @@ func Load(path string) (*Case, error) {
 }
 
 // Parse is Load's byte-slice counterpart. Useful in tests that hold yaml
-// inline.
+// inline. Extends paths resolve against the working directory.
 func Parse(data []byte) (*Case, error) {
-	dec := yaml.NewDecoder(bytes.NewReader(data))
-	dec.KnownFields(true) // reject unknown keys
-
-	var c Case
-	if err := dec.Decode(&c); err != nil {
-		return nil, err
-	}
-	if err := c.Validate(); err != nil {
-		return nil, err
-	}
-	return &c, nil
+	return parseCase(data, "")
 }
 
 // Validate checks structural rules a yaml parser cannot enforce on its own.
 // Called automatically by Parse; exported for tests that construct Cases
-// programmatically.
+// programmatically. A matrix case is validated once per variant.
 func (c *Case) Validate() error {
+	if len(c.Matrix) > 0 {
+		return c.validateMatrix()
+	}
+	if w := c.Expected.whenClauses("expected"); len(w) > 0 {
+		return fmt.Errorf("%s: requires a matrix", w[0].path)
+	}
+	return c.validate()
+}
+
+func (c *Case) validate() error {
 	if c.Name == "" {
 		return fmt.Errorf("name: required, non-empty")
 	}
@@ -446,6 +937,20 @@ func (c *Case) Validate() error {
 		if len(c.Seed.Traces)+len(c.Seed.Logs)+len(c.Seed.Metrics) == 0 {
 			return fmt.Errorf("seed: inline-otlp must declare at least one trace, log, or metric")
 		}
+		for i, m := range c.Seed.Metrics {
+			if m.Histogram == nil {
+				continue
+			}
+			if m.Value != 0 {
+				return fmt.Errorf("seed.metrics[%d]: set value or histogram, not both", i)
+			}
+			if len(m.Histogram.Observations) == 0 {
+				return fmt.Errorf("seed.metrics[%d].histogram.observations: at least one observation is required", i)
+			}
+			if err := validateBounds(fmt.Sprintf("seed.metrics[%d].histogram.bounds", i), m.Histogram.Bounds); err != nil {
+				return err
+			}
+		}
 		for i, tr := range c.Seed.Traces {
 			for j, sp := range tr.Spans {
 				if sp.Duration == "" {
@@ -459,81 +964,224 @@ func (c *Case) Validate() error {
 	default:
 		return fmt.Errorf("seed.type: unknown value %q (expected app or inline-otlp)", c.Seed.Type)
 	}
-	if len(c.Expected.Traces)+len(c.Expected.Metrics)+len(c.Expected.Logs)+len(c.Expected.Profiles)+len(c.Expected.Custom) == 0 {
-		return fmt.Errorf("expected: at least one assertion required (signal or custom-check)")
+	if !c.Expected.HasAssertions() && !c.hasStepAssertions() {
+		return fmt.Errorf("expected: at least one assertion required (signal, correlate, or custom-check)")
 	}
 	for i, in := range c.Input {
-		hasHTTP := in.Path != "" || in.Scheme != "" || in.Host != "" || in.Method != "" || in.Headers != nil || in.Body != "" || in.Status != "" || in.Retry != nil
-		hasCompose := in.Compose != nil
-		if hasCompose && in.Retry != nil {
-			return fmt.Errorf("input[%d].retry: only supported for HTTP inputs", i)
+		if err := c.validateInput(fmt.Sprintf("input[%d]", i), in); err != nil {
+			return err
 		}
-		if hasHTTP == hasCompose {
-			return fmt.Errorf("input[%d]: set exactly one of path or compose", i)
+	}
+	if err := c.validateSteps(); err != nil {
+		return err
+	}
+	if err := validateExpected("expected", c.Expected); err != nil {
+		return err
+	}
+	return c.validateReferences()
+}
+
+// validateInput checks the input at path: input[i] or steps[i].input.
+func (c *Case) validateInput(path string, in Input) error {
+	if in.Fixture != nil {
+		return c.validateInputFixture(path, in)
+	}
+	hasCompose := in.Compose != nil
+	hasGRPC := in.GRPC != nil
+	hasKubernetes := in.Kubernetes != nil
+	hasHTTP := in.hasHTTPKeys() || (in.Retry != nil && !hasGRPC)
+	if (hasCompose || hasKubernetes) && in.Retry != nil {
+		return fmt.Errorf("%s.retry: only supported for HTTP and gRPC inputs", path)
+	}
+	if err := validateTraceContext(path, in); err != nil {
+		return err
+	}
+	if err := validateLoad(path, in); err != nil {
+		return err
+	}
+	signal := "input"
+	switch {
+	case hasCompose:
+		signal = "compose"
+	case hasGRPC:
+		signal = "grpc"
+	case hasKubernetes:
+		signal = "kubernetes"
+	}
+	if err := validateCaptures(path, in.Capture, signal); err != nil {
+		return err
+	}
+	kinds := 0
+	for _, present := range []bool{hasHTTP, hasCompose, hasGRPC, hasKubernetes} {
+		if present {
+			kinds++
 		}
-		if hasHTTP && in.Path == "" {
-			return fmt.Errorf("input[%d].path: required, non-empty", i)
+	}
+	if kinds != 1 {
+		return fmt.Errorf("%s: set exactly one of path, compose, grpc, kubernetes, or fixture", path)
+	}
+	if hasHTTP && in.Path == "" {
+		return fmt.Errorf("%s.path: required, non-empty", path)
+	}
+	if err := validateExpectResponse(path, in); err != nil {
+		return err
+	}
+	if in.Retry != nil {
+		if in.Retry.Timeout < 0 {
+			return fmt.Errorf("%s.retry.timeout: must be >= 0", path)
 		}
-		if in.Retry != nil {
-			if in.Retry.Timeout < 0 {
-				return fmt.Errorf("input[%d].retry.timeout: must be >= 0", i)
-			}
-			if in.Retry.Interval < 0 {
-				return fmt.Errorf("input[%d].retry.interval: must be >= 0", i)
-			}
+		if in.Retry.Interval < 0 {
+			return fmt.Errorf("%s.retry.interval: must be >= 0", path)
 		}
-		if hasCompose {
-			if c.Fixture != nil && c.Fixture.Kind() != "" && c.Fixture.Kind() != "compose" {
-				return fmt.Errorf("input[%d].compose: requires a Compose fixture", i)
-			}
-			if strings.TrimSpace(in.Compose.Service) == "" {
-				return fmt.Errorf("input[%d].compose.service: required, non-empty", i)
-			}
-			if len(in.Compose.Command) == 0 {
-				return fmt.Errorf("input[%d].compose.command: required, non-empty", i)
-			}
-			for j, arg := range in.Compose.Command {
-				if strings.TrimSpace(arg) == "" {
-					return fmt.Errorf("input[%d].compose.command[%d]: must be non-empty", i, j)
-				}
+	}
+	if hasGRPC {
+		if err := validateGRPC(path+".grpc", *in.GRPC); err != nil {
+			return err
+		}
+	}
+	if hasCompose {
+		if c.Fixture != nil && c.Fixture.Kind() != "" && c.Fixture.Kind() != "compose" {
+			return fmt.Errorf("%s.compose: requires a Compose fixture", path)
+		}
+		if strings.TrimSpace(in.Compose.Service) == "" {
+			return fmt.Errorf("%s.compose.service: required, non-empty", path)
+		}
+		if len(in.Compose.Command) == 0 {
+			return fmt.Errorf("%s.compose.command: required, non-empty", path)
+		}
+		for j, arg := range in.Compose.Command {
+			if strings.TrimSpace(arg) == "" {
+				return fmt.Errorf("%s.compose.command[%d]: must be non-empty", path, j)
 			}
 		}
+		if err := validateCommandChecks(path+".compose", in.Compose.EffectiveExitCode(), in.Compose.Contains, in.Compose.Regex); err != nil {
+			return err
+		}
 	}
-	for i := range c.Expected.Traces {
-		if c.Expected.Traces[i].TraceQL == "" {
-			return fmt.Errorf("expected.traces[%d].traceql: required, non-empty", i)
+	if hasKubernetes {
+		if c.Fixture != nil && c.Fixture.Kind() != "" && c.Fixture.Kind() != "k3d" {
+			return fmt.Errorf("%s.kubernetes: requires a k3d fixture", path)
 		}
-		if err := validateTraceAssertion(i, c.Expected.Traces[i]); err != nil {
+		if err := validateKubernetes(path+".kubernetes", *in.Kubernetes); err != nil {
 			return err
 		}
 	}
-	for i := range c.Expected.Logs {
-		if c.Expected.Logs[i].LogQL == "" {
-			return fmt.Errorf("expected.logs[%d].logql: required, non-empty", i)
+	return nil
+}
+
+func validateKubernetes(path string, k KubernetesInput) error {
+	set := 0
+	for _, target := range []string{k.Deployment, k.Selector, k.Image} {
+		if strings.TrimSpace(target) != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("%s: set exactly one of deployment, selector, or image", path)
+	}
+	if k.Image != "" && k.Container != "" {
+		return fmt.Errorf("%s.container: only supported with deployment or selector", path)
+	}
+	if k.Image == "" && len(k.Command) == 0 {
+		return fmt.Errorf("%s.command: required, non-empty", path)
+	}
+	for j, arg := range k.Command {
+		if strings.TrimSpace(arg) == "" {
+			return fmt.Errorf("%s.command[%d]: must be non-empty", path, j)
 		}
-		if err := validateAssertionCommon("expected.logs", i, c.Expected.Logs[i].AssertionCommon); err != nil {
+	}
+	return validateCommandChecks(path, k.EffectiveExitCode(), k.Contains, k.Regex)
+}
+
+// validateCommandChecks checks the exit_code, contains and regex keys of the
+// command input at path.
+func validateCommandChecks(path string, exitCode int, contains, regex StringList) error {
+	if exitCode < 0 || exitCode > 255 {
+		return fmt.Errorf("%s.exit_code: must be between 0 and 255, got %d", path, exitCode)
+	}
+	for j, s := range contains {
+		if s == "" {
+			return fmt.Errorf("%s.contains[%d]: must be non-empty", path, j)
+		}
+	}
+	for j, p := range regex {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("%s.regex[%d]: invalid regexp %q: %v", path, j, p, err)
+		}
+	}
+	return nil
+}
+
+// validateExpected checks the assertions of the expected block at path:
+// expected or steps[i].expect.
+func validateExpected(path string, e Expected) error {
+	for i := range e.Traces {
+		if e.Traces[i].TraceQL == "" {
+			return fmt.Errorf("%s.traces[%d].traceql: required, non-empty", path, i)
+		}
+		if err := validateTraceAssertion(fmt.Sprintf("%s.traces[%d]", path, i), e.Traces[i]); err != nil {
 			return err
 		}
 	}
-	for i := range c.Expected.Metrics {
-		if c.Expected.Metrics[i].PromQL == "" {
-			return fmt.Errorf("expected.metrics[%d].promql: required, non-empty", i)
+	for i := range e.Logs {
+		if e.Logs[i].LogQL == "" {
+			return fmt.Errorf("%s.logs[%d].logql: required, non-empty", path, i)
 		}
-		if err := validateAssertionCommon("expected.metrics", i, c.Expected.Metrics[i].AssertionCommon); err != nil {
+		if err := validateAssertionCommon(fmt.Sprintf("%s.logs[%d]", path, i), e.Logs[i].AssertionCommon); err != nil {
+			return err
+		}
+		if err := validateCardinality(fmt.Sprintf("%s.logs[%d]", path, i), e.Logs[i].Cardinality, "max_streams", e.Logs[i].Absent); err != nil {
 			return err
 		}
 	}
-	for i := range c.Expected.Profiles {
-		if c.Expected.Profiles[i].Query == "" {
-			return fmt.Errorf("expected.profiles[%d].query: required, non-empty", i)
+	for i := range e.Metrics {
+		if e.Metrics[i].PromQL == "" {
+			return fmt.Errorf("%s.metrics[%d].promql: required, non-empty", path, i)
 		}
-		if err := validateAssertionCommon("expected.profiles", i, c.Expected.Profiles[i].AssertionCommon); err != nil {
+		if err := validateHistogram(fmt.Sprintf("%s.metrics[%d]", path, i), e.Metrics[i]); err != nil {
+			return err
+		}
+		if err := validateQuantifiers(fmt.Sprintf("%s.metrics[%d]", path, i), e.Metrics[i]); err != nil {
+			return err
+		}
+		if err := validateRange(fmt.Sprintf("%s.metrics[%d]", path, i), e.Metrics[i]); err != nil {
+			return err
+		}
+		if err := validateMetadata(fmt.Sprintf("%s.metrics[%d]", path, i), e.Metrics[i]); err != nil {
+			return err
+		}
+		if err := validateCardinality(fmt.Sprintf("%s.metrics[%d]", path, i), e.Metrics[i].Cardinality, "max_series", e.Metrics[i].Absent); err != nil {
+			return err
+		}
+		if e.Metrics[i].TraceID != "" && e.Metrics[i].Absent {
+			return fmt.Errorf("%s.metrics[%d].trace_id: cannot be combined with absent", path, i)
+		}
+		if err := validateAssertionCommon(fmt.Sprintf("%s.metrics[%d]", path, i), e.Metrics[i].AssertionCommon); err != nil {
 			return err
 		}
 	}
-	for i := range c.Expected.Custom {
-		if strings.TrimSpace(c.Expected.Custom[i].Script) == "" {
-			return fmt.Errorf("expected.custom-checks[%d].script: required, non-empty", i)
+	for i := range e.Profiles {
+		if e.Profiles[i].Query == "" {
+			return fmt.Errorf("%s.profiles[%d].query: required, non-empty", path, i)
+		}
+		if err := validateAssertionCommon(fmt.Sprintf("%s.profiles[%d]", path, i), e.Profiles[i].AssertionCommon); err != nil {
+			return err
+		}
+		if e.Profiles[i].ScopeRunID != nil {
+			return fmt.Errorf("%s.profiles[%d].scope_run_id: profiles are not scoped to a run", path, i)
+		}
+		if e.Profiles[i].TraceID != "" {
+			return fmt.Errorf("%s.profiles[%d].trace_id: profiles are not tied to a trace; use correlate", path, i)
+		}
+	}
+	for i := range e.Correlate {
+		if err := validateCorrelation(fmt.Sprintf("%s.correlate[%d]", path, i), e.Correlate[i]); err != nil {
+			return err
+		}
+	}
+	for i := range e.Custom {
+		if strings.TrimSpace(e.Custom[i].Script) == "" {
+			return fmt.Errorf("%s.custom-checks[%d].script: required, non-empty", path, i)
 		}
 	}
 	return nil
@@ -565,6 +1213,9 @@ func (f FixtureConfig) Validate(label string) error {
 		if c.EffectiveTemplate() == "none" && c.File == "" && len(c.Files) == 0 {
 			return fmt.Errorf("fixture %q: compose template=none requires file or files", label)
 		}
+		if c.InjectRunID && c.AppService == "" {
+			return fmt.Errorf("fixture %q: compose inject_run_id requires app_service", label)
+		}
 	case f.K3D != nil:
 		k := f.K3D
 		if k.K8sDir == "" || k.AppService == "" || k.AppDockerFile == "" || k.AppDockerTag == "" || k.AppPort == 0 {
@@ -578,57 +1229,489 @@ func (f FixtureConfig) Validate(label string) error {
 	return nil
 }
 
-func validateTraceAssertion(idx int, a TraceAssertion) error {
-	if err := validateMatchEntries(fmt.Sprintf("expected.traces[%d].match_spans", idx), a.MatchSpans); err != nil {
+func validateHistogram(metricPath string, a MetricAssertion) error {
+	h := a.Histogram
+	if h == nil {
+		return nil
+	}
+	path := metricPath + ".histogram"
+	if a.Value != "" || a.ComparesSeries() || a.Range != nil || len(a.Match) > 0 || a.Count != "" || a.Absent {
+		return fmt.Errorf("%s: cannot be combined with value, each, any, none, range, match, count, or absent", path)
+	}
+	if _, _, err := a.Selector(); err != nil {
+		return fmt.Errorf("%s.promql: histogram %v", metricPath, err)
+	}
+	if h.Count == "" && h.Sum == "" && h.Buckets == nil && len(h.BucketCounts) == 0 && len(h.Quantiles) == 0 {
+		return fmt.Errorf("%s: at least one of count, sum, buckets, bucket_counts, or quantiles is required", path)
+	}
+	if h.Count != "" {
+		if err := validateNumericComparison(h.Count); err != nil {
+			return fmt.Errorf("%s.count: %v", path, err)
+		}
+	}
+	if h.Sum != "" {
+		if _, _, err := HistogramBound(h.Sum); err != nil {
+			return fmt.Errorf("%s.sum: %v", path, err)
+		}
+	}
+	if err := validateBounds(path+".buckets", h.Buckets); err != nil {
 		return err
 	}
-	return validateAssertionCommon("expected.traces", idx, a.AssertionCommon)
+	for i, bc := range h.BucketCounts {
+		if _, err := strconv.ParseFloat(bc.LE, 64); err != nil {
+			return fmt.Errorf("%s.bucket_counts[%d].le: expected a bucket upper bound or +Inf, got %q", path, i, bc.LE)
+		}
+		if err := validateNumericComparison(bc.Count); err != nil {
+			return fmt.Errorf("%s.bucket_counts[%d].count: %v", path, i, err)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(h.Quantiles)) {
+		if _, err := Quantile(key); err != nil {
+			return fmt.Errorf("%s.quantiles.%s: %v", path, key, err)
+		}
+		if _, _, err := HistogramBound(h.Quantiles[key]); err != nil {
+			return fmt.Errorf("%s.quantiles.%s: %v", path, key, err)
+		}
+	}
+	return nil
+}
+
+func validateQuantifiers(path string, a MetricAssertion) error {
+	if a.ComparesSeries() && a.Absent {
+		return fmt.Errorf("%s: each, any, and none cannot be combined with absent", path)
+	}
+	for _, q := range []struct{ key, expr string }{{"each", a.Each}, {"any", a.Any}, {"none", a.None}} {
+		if q.expr == "" {
+			continue
+		}
+		if err := validateNumericComparison(q.expr); err != nil {
+			return fmt.Errorf("%s.%s: %v", path, q.key, err)
+		}
+	}
+	return nil
+}
+
+func validateRange(metricPath string, a MetricAssertion) error {
+	r := a.Range
+	if r == nil {
+		return nil
+	}
+	path := metricPath + ".range"
+	if a.Absent {
+		return fmt.Errorf("%s: cannot be combined with absent", path)
+	}
+	if r.Step <= 0 {
+		return fmt.Errorf("%s.step: required, a positive duration such as 15s", path)
+	}
+	if r.Samples != "" {
+		if err := validateNumericComparison(r.Samples); err != nil {
+			return fmt.Errorf("%s.samples: %v", path, err)
+		}
+	}
+	if r.Rate != "" {
+		if err := validateNumericComparison(r.Rate); err != nil {
+			return fmt.Errorf("%s.rate: %v", path, err)
+		}
+	}
+	if r.MaxAge < 0 {
+		return fmt.Errorf("%s.max_age: must not be negative", path)
+	}
+	return nil
+}
+
+func validateMetadata(metricPath string, a MetricAssertion) error {
+	m := a.Metadata
+	if m == nil {
+		return nil
+	}
+	path := metricPath + ".metadata"
+	if a.Absent {
+		return fmt.Errorf("%s: cannot be combined with absent", path)
+	}
+	if _, _, err := a.Selector(); err != nil {
+		return fmt.Errorf("%s.promql: metadata %v", metricPath, err)
+	}
+	if m.Type == "" && m.Unit == nil && m.Description == nil && m.Temporality == "" {
+		return fmt.Errorf("%s: at least one of type, unit, description, or temporality is required", path)
+	}
+	if m.Type != "" && !slices.Contains(MetricTypes, strings.ToLower(m.Type)) {
+		return fmt.Errorf("%s.type: unknown value %q (expected one of %s)", path, m.Type, strings.Join(MetricTypes, ", "))
+	}
+	if m.Temporality != "" && !slices.Contains(Temporalities, strings.ToLower(m.Temporality)) {
+		return fmt.Errorf("%s.temporality: unknown value %q (expected one of %s)", path, m.Temporality, strings.Join(Temporalities, ", "))
+	}
+	return nil
+}
+
+// validateCardinality checks a budget on the signal at path, whose cap key
+// is capKey: max_series on metrics, max_streams on logs.
+func validateCardinality(path string, b *CardinalityBudget, capKey string, absent bool) error {
+	if b == nil {
+		return nil
+	}
+	path += ".cardinality"
+	if absent {
+		return fmt.Errorf("%s: cannot be combined with absent", path)
+	}
+	if capKey == "max_series" && b.MaxStreams != 0 {
+		return fmt.Errorf("%s.max_streams: only supported on logs; metrics use max_series", path)
+	}
+	if capKey == "max_streams" && b.MaxSeries != 0 {
+		return fmt.Errorf("%s.max_series: only supported on metrics; logs use max_streams", path)
+	}
+	limit := max(b.MaxSeries, b.MaxStreams)
+	if b.MaxSeries < 0 || b.MaxStreams < 0 {
+		return fmt.Errorf("%s.%s: must be positive", path, capKey)
+	}
+	if limit == 0 && len(b.MaxLabelValues) == 0 {
+		return fmt.Errorf("%s: at least one of %s or max_label_values is required", path, capKey)
+	}
+	if b.Per != "" && limit == 0 {
+		return fmt.Errorf("%s.per: requires %s", path, capKey)
+	}
+	for _, label := range slices.Sorted(maps.Keys(b.MaxLabelValues)) {
+		if strings.TrimSpace(label) == "" {
+			return fmt.Errorf("%s.max_label_values: label name is required", path)
+		}
+		if b.MaxLabelValues[label] <= 0 {
+			return fmt.Errorf("%s.max_label_values.%s: must be positive", path, label)
+		}
+	}
+	return nil
+}
+
+func validateNumericComparison(expr string) error {
+	_, rest, err := splitComparison(expr)
+	if err != nil {
+		return err
+	}
+	if _, err := strconv.ParseFloat(rest, 64); err != nil {
+		return fmt.Errorf("invalid number in %q", expr)
+	}
+	return nil
+}
+
+// validateBounds checks histogram upper bounds are finite and ascending.
+func validateBounds(path string, bounds []float64) error {
+	for i, b := range bounds {
+		if math.IsInf(b, 0) || math.IsNaN(b) {
+			return fmt.Errorf("%s[%d]: must be a finite number; +Inf is implicit", path, i)
+		}
+		if i > 0 && b <= bounds[i-1] {
+			return fmt.Errorf("%s[%d]: bounds must be strictly ascending", path, i)
+		}
+	}
+	return nil
+}
+
+func validateTraceAssertion(path string, a TraceAssertion) error {
+	if err := validateMatchEntries(path+".match_spans", a.MatchSpans, true); err != nil {
+		return err
+	}
+	if err := validateSpanTree(path+".tree", a.Tree); err != nil {
+		return err
+	}
+	if a.Absent && (len(a.Tree) > 0 || a.SingleTrace) {
+		return fmt.Errorf("%s: absent cannot be combined with tree or single_trace", path)
+	}
+	return validateAssertionCommon(path, a.AssertionCommon)
+}
+
+func validateTraceContext(inputPath string, in Input) error {
+	tc := in.TraceContext
+	if tc == nil {
+		return nil
+	}
+	path := inputPath + ".trace_context"
+	if in.Compose != nil || in.Kubernetes != nil {
+		return fmt.Errorf("%s: only supported for HTTP and gRPC inputs", path)
+	}
+	headers, kind := in.Headers, "header"
+	if in.GRPC != nil {
+		headers, kind = in.GRPC.Metadata, "metadata key"
+	}
+	for k := range headers {
+		if strings.EqualFold(k, "traceparent") || (tc.Baggage != nil && strings.EqualFold(k, "baggage")) {
+			return fmt.Errorf("%s: conflicts with the %s %s", path, k, kind)
+		}
+	}
+	name := tc.EffectiveCapture()
+	if !captureName.MatchString(name) {
+		return fmt.Errorf("%s.capture: name may only contain letters, digits, _ and -", path)
+	}
+	if _, ok := in.Capture[name]; ok {
+		return fmt.Errorf("%s.capture: %q is also set under capture", path, name)
+	}
+	for k := range tc.Baggage {
+		if strings.TrimSpace(k) == "" || strings.ContainsAny(k, " ,;=") {
+			return fmt.Errorf("%s.baggage: invalid key %q", path, k)
+		}
+	}
+	return nil
+}
+
+func validateExpectResponse(path string, in Input) error {
+	if in.ExpectHeaders == nil && in.ExpectBody == nil {
+		return nil
+	}
+	if in.Load() {
+		return fmt.Errorf("%s: expect_headers and expect_body are not supported with repeat or duration", path)
+	}
+	for _, name := range slices.Sorted(maps.Keys(in.ExpectHeaders)) {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%s.expect_headers: header name must be non-empty", path)
+		}
+	}
+	eb := in.ExpectBody
+	if eb == nil {
+		return nil
+	}
+	if eb.Contains == nil && eb.Regex == nil && eb.JSON == nil {
+		return fmt.Errorf("%s.expect_body: set at least one of contains, regex, or json", path)
+	}
+	for j, s := range eb.Contains {
+		if s == "" {
+			return fmt.Errorf("%s.expect_body.contains[%d]: must be non-empty", path, j)
+		}
+	}
+	for j, p := range eb.Regex {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("%s.expect_body.regex[%d]: invalid regexp %q: %v", path, j, p, err)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(eb.JSON)) {
+		if key == "" || strings.HasPrefix(key, ".") || strings.HasSuffix(key, ".") || strings.Contains(key, "..") {
+			return fmt.Errorf("%s.expect_body.json: invalid path %q", path, key)
+		}
+	}
+	return nil
+}
+
+func validateGRPC(path string, g GRPCInput) error {
+	if strings.TrimSpace(g.Service) == "" {
+		return fmt.Errorf("%s.service: required, non-empty", path)
+	}
+	if strings.TrimSpace(g.Method) == "" {
+		return fmt.Errorf("%s.method: required, non-empty", path)
+	}
+	if strings.ContainsAny(g.Service+g.Method, "/ ") {
+		return fmt.Errorf("%s: service and method are names, not a path; got %q and %q", path, g.Service, g.Method)
+	}
+	if g.Request != "" && !json.Valid([]byte(g.Request)) {
+		return fmt.Errorf("%s.request: not valid JSON", path)
+	}
+	for k := range g.Metadata {
+		if k == "" || k != strings.ToLower(k) || strings.HasPrefix(k, "grpc-") {
+			return fmt.Errorf("%s.metadata: invalid key %q; keys are lowercase and may not start with grpc-", path, k)
+		}
+	}
+	if _, err := g.ExpectedStatus(); err != nil {
+		return fmt.Errorf("%s.status: %w", path, err)
+	}
+	return nil
+}
+
+func validateLoad(path string, in Input) error {
+	switch {
+	case in.Repeat < 0:
+		return fmt.Errorf("%s.repeat: must be >= 1", path)
+	case in.Concurrency < 0:
+		return fmt.Errorf("%s.concurrency: must be >= 1", path)
+	case in.Duration < 0:
+		return fmt.Errorf("%s.duration: must be > 0", path)
+	}
+	if in.Rate != "" {
+		if _, err := ParseRate(in.Rate); err != nil {
+			return fmt.Errorf("%s.rate: %v", path, err)
+		}
+	}
+	if !in.Load() {
+		switch {
+		case in.Concurrency > 0:
+			return fmt.Errorf("%s.concurrency: requires repeat or duration", path)
+		case in.Rate != "":
+			return fmt.Errorf("%s.rate: requires repeat or duration", path)
+		}
+		return nil
+	}
+	switch {
+	case in.Compose != nil || in.GRPC != nil || in.Kubernetes != nil:
+		return fmt.Errorf("%s: repeat and duration are only supported for HTTP inputs", path)
+	case in.Repeat > 0 && in.Duration > 0:
+		return fmt.Errorf("%s: set repeat or duration, not both", path)
+	case in.Retry != nil:
+		return fmt.Errorf("%s.retry: not supported with repeat or duration", path)
+	case in.Capture != nil:
+		return fmt.Errorf("%s.capture: not supported with repeat or duration", path)
+	case in.TraceContext != nil:
+		return fmt.Errorf("%s.trace_context: not supported with repeat or duration", path)
+	}
+	return nil
 }
 
-func validateAssertionCommon(path string, idx int, a AssertionCommon) error {
+// validateAssertionCommon checks the shared keys of the assertion at path,
+// e.g. expected.logs[0].
+func validateAssertionCommon(path string, a AssertionCommon) error {
+	if a.Since < 0 {
+		return fmt.Errorf("%s.since: must be >= 0", path)
+	}
+	if a.Window < 0 {
+		return fmt.Errorf("%s.window: must be >= 0", path)
+	}
+	if a.Since > 0 && a.Window > 0 {
+		return fmt.Errorf("%s: set since or window, not both", path)
+	}
 	for j, p := range a.Regex {
 		if _, err := regexp.Compile(p); err != nil {
-			return fmt.Errorf("%s[%d].regex[%d]: invalid regexp %q: %v", path, idx, j, p, err)
+			return fmt.Errorf("%s.regex[%d]: invalid regexp %q: %v", path, j, p, err)
 		}
 	}
-	if err := validateMatchEntries(fmt.Sprintf("%s[%d].match", path, idx), a.Match); err != nil {
+	if err := validateMatchEntries(path+".match", a.Match, false); err != nil {
 		return err
 	}
+	if a.Capture != nil && a.Absent {
+		return fmt.Errorf("%s.capture: cannot be combined with absent", path)
+	}
+	// The signal is the list the assertion sits in: expected.traces[0] is a trace.
+	signal, _, _ := strings.Cut(path[strings.LastIndex(path, ".")+1:], "[")
+	return validateCaptures(path, a.Capture, signal)
+}
+
+func validateSpanTree(path string, nodes []SpanTree) error {
+	for j, n := range nodes {
+		nodePath := fmt.Sprintf("%s[%d]", path, j)
+		if err := validateMatchEntry(nodePath, n.MatchEntry, true); err != nil {
+			return err
+		}
+		if err := validateSpanTree(nodePath+".children", n.Children); err != nil {
+			return err
+		}
+		if err := validateSpanTree(nodePath+".descendants", n.Descendants); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func validateMatchEntries(path string, entries []MatchEntry) error {
+// validateMatchEntries checks a list of match entries. spans allows the
+// span-only keys (kind, status, duration, events, links).
+func validateMatchEntries(path string, entries []MatchEntry, spans bool) error {
 	for j, m := range entries {
-		matchPath := fmt.Sprintf("%s[%d]", path, j)
-		switch m.EffectiveMatchType() {
-		case MatchTypeStrict, MatchTypeRegexp:
-		default:
-			return fmt.Errorf("%s.match_type: unknown value %q (expected strict or regexp)", matchPath, m.MatchType)
-		}
-		if m.Name == nil && len(m.Attributes) == 0 {
-			return fmt.Errorf("%s: at least one of name or attributes is required", matchPath)
-		}
-		if m.EffectiveMatchType() == MatchTypeRegexp && m.Name != nil {
-			if _, err := regexp.Compile(*m.Name); err != nil {
-				return fmt.Errorf("%s.name: invalid regexp %q: %v", matchPath, *m.Name, err)
-			}
+		if err := validateMatchEntry(fmt.Sprintf("%s[%d]", path, j), m, spans); err != nil {
+			return err
 		}
-		seenKeys := map[string]struct{}{}
-		for i, attr := range m.Attributes {
-			attrPath := fmt.Sprintf("%s.attributes[%d]", matchPath, i)
-			if strings.TrimSpace(attr.Key) == "" {
-				return fmt.Errorf("%s.key: required", attrPath)
-			}
-			if _, ok := seenKeys[attr.Key]; ok {
-				return fmt.Errorf("%s.key: duplicate key %q", attrPath, attr.Key)
+	}
+	return nil
+}
+
+func validateMatchEntry(matchPath string, m MatchEntry, spans bool) error {
+	switch m.EffectiveMatchType() {
+	case MatchTypeStrict, MatchTypeRegexp:
+	default:
+		return fmt.Errorf("%s.match_type: unknown value %q (expected strict or regexp)", matchPath, m.MatchType)
+	}
+	if !spans && m.hasSpanKeys() {
+		return fmt.Errorf("%s: kind, status_code, status_message, duration, events, and links are only supported on trace spans (match_spans, tree)", matchPath)
+	}
+	if m.Name == nil && len(m.Attributes) == 0 && !m.NoExtraAttributes && !m.hasSpanKeys() {
+		return fmt.Errorf("%s: at least one of name or attributes is required", matchPath)
+	}
+	if len(m.IgnoreAttributes) > 0 && !m.NoExtraAttributes {
+		return fmt.Errorf("%s.ignore_attributes: requires no_extra_attributes", matchPath)
+	}
+	for i, key := range m.IgnoreAttributes {
+		if strings.TrimSpace(key) == "" || key == "*" {
+			return fmt.Errorf("%s.ignore_attributes[%d]: must name a key or a key prefix", matchPath, i)
+		}
+	}
+	regexpMode := m.EffectiveMatchType() == MatchTypeRegexp
+	if err := validatePattern(matchPath+".name", m.Name, regexpMode); err != nil {
+		return err
+	}
+	if err := validateAttributeMatchers(matchPath, m.Attributes, regexpMode); err != nil {
+		return err
+	}
+	if m.Kind != "" && !slices.Contains(SpanKinds, strings.ToLower(m.Kind)) {
+		return fmt.Errorf("%s.kind: unknown value %q (expected one of %s)", matchPath, m.Kind, strings.Join(SpanKinds, ", "))
+	}
+	if m.StatusCode != "" && !slices.Contains(StatusCodes, strings.ToLower(m.StatusCode)) {
+		return fmt.Errorf("%s.status_code: unknown value %q (expected one of %s)", matchPath, m.StatusCode, strings.Join(StatusCodes, ", "))
+	}
+	if err := validatePattern(matchPath+".status_message", m.StatusMessage, regexpMode); err != nil {
+		return err
+	}
+	if m.Duration != "" {
+		if _, _, err := m.DurationBound(); err != nil {
+			return fmt.Errorf("%s.duration: %v", matchPath, err)
+		}
+	}
+	for i, ev := range m.Events {
+		evPath := fmt.Sprintf("%s.events[%d]", matchPath, i)
+		if ev.Name == nil && len(ev.Attributes) == 0 {
+			return fmt.Errorf("%s: at least one of name or attributes is required", evPath)
+		}
+		if err := validatePattern(evPath+".name", ev.Name, regexpMode); err != nil {
+			return err
+		}
+		if err := validateAttributeMatchers(evPath, ev.Attributes, regexpMode); err != nil {
+			return err
+		}
+	}
+	for i, link := range m.Links {
+		if err := validateAttributeMatchers(fmt.Sprintf("%s.links[%d]", matchPath, i), link.Attributes, regexpMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePattern checks that a regexp-mode value compiles.
+func validatePattern(path string, v *string, regexpMode bool) error {
+	if !regexpMode || v == nil {
+		return nil
+	}
+	if _, err := regexp.Compile(*v); err != nil {
+		return fmt.Errorf("%s: invalid regexp %q: %v", path, *v, err)
+	}
+	return nil
+}
+
+func validateAttributeMatchers(path string, attrs AttributeMatchers, regexpMode bool) error {
+	seenKeys := map[string]struct{}{}
+	for i, attr := range attrs {
+		attrPath := fmt.Sprintf("%s.attributes[%d]", path, i)
+		if strings.TrimSpace(attr.Key) == "" {
+			return fmt.Errorf("%s.key: required", attrPath)
+		}
+		if _, ok := seenKeys[attr.Key]; ok {
+			return fmt.Errorf("%s.key: duplicate key %q", attrPath, attr.Key)
+		}
+		seenKeys[attr.Key] = struct{}{}
+		if attr.Absent && (attr.Value != nil || attr.NotEquals != nil || attr.Compare != "" || attr.OneOf != nil || attr.Type != "") {
+			return fmt.Errorf("%s.absent: cannot be combined with value, not_equals, compare, one_of, or type", attrPath)
+		}
+		if err := validatePattern(attrPath+".value", attr.Value, regexpMode); err != nil {
+			return err
+		}
+		if err := validatePattern(attrPath+".not_equals", attr.NotEquals, regexpMode); err != nil {
+			return err
+		}
+		if attr.OneOf != nil && len(attr.OneOf) == 0 {
+			return fmt.Errorf("%s.one_of: at least one value is required", attrPath)
+		}
+		for k := range attr.OneOf {
+			if err := validatePattern(fmt.Sprintf("%s.one_of[%d]", attrPath, k), &attr.OneOf[k], regexpMode); err != nil {
+				return err
 			}
-			seenKeys[attr.Key] = struct{}{}
-			if m.EffectiveMatchType() == MatchTypeRegexp && attr.Value != nil {
-				if _, err := regexp.Compile(*attr.Value); err != nil {
-					return fmt.Errorf("%s.value: invalid regexp %q: %v", attrPath, *attr.Value, err)
-				}
+		}
+		if attr.Compare != "" {
+			if _, _, err := attr.CompareBound(); err != nil {
+				return fmt.Errorf("%s.compare: %v", attrPath, err)
 			}
 		}
+		if attr.Type != "" && !slices.Contains(AttributeTypes, attr.Type) {
+			return fmt.Errorf("%s.type: unknown value %q (expected one of %s)", attrPath, attr.Type, strings.Join(AttributeTypes, ", "))
+		}
 	}
 	return nil
 }
@@ -1,6 +1,8 @@
 package casefile
 
 import (
+	"math"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -83,6 +85,7 @@ expected:
 
 func TestValidate_InputKind(t *testing.T) {
 	base := Case{Name: "input validation", Expected: Expected{Logs: []LogAssertion{{LogQL: "{}"}}}}
+	badExit := 256
 	tests := []struct {
 		name  string
 		input Input
@@ -97,7 +100,35 @@ func TestValidate_InputKind(t *testing.T) {
 		{name: "empty argument", input: Input{Compose: &ComposeInput{Service: "app", Command: []string{"run", ""}}}, want: ".compose.command[1]"},
 		{name: "whitespace argument", input: Input{Compose: &ComposeInput{Service: "app", Command: []string{"run", " \t"}}}, want: ".compose.command[1]"},
 		{name: "retry without path", input: Input{Retry: &InputRetry{}}, want: ".path: required"},
-		{name: "retry Compose input", input: Input{Retry: &InputRetry{}, Compose: &ComposeInput{Service: "app", Command: []string{"run"}}}, want: "only supported for HTTP inputs"},
+		{name: "grpc and path", input: Input{Path: "/", GRPC: &GRPCInput{Service: "s.S", Method: "M"}}, want: "set exactly one of path, compose, grpc, kubernetes, or fixture"},
+		{name: "grpc service", input: Input{GRPC: &GRPCInput{Method: "M"}}, want: ".grpc.service: required"},
+		{name: "grpc method", input: Input{GRPC: &GRPCInput{Service: "s.S"}}, want: ".grpc.method: required"},
+		{name: "grpc method path", input: Input{GRPC: &GRPCInput{Service: "s.S", Method: "/s.S/M"}}, want: ".grpc: service and method are names"},
+		{name: "grpc request", input: Input{GRPC: &GRPCInput{Service: "s.S", Method: "M", Request: "{name: x}"}}, want: ".grpc.request: not valid JSON"},
+		{name: "grpc metadata", input: Input{GRPC: &GRPCInput{Service: "s.S", Method: "M", Metadata: map[string]string{"X-Tenant": "a"}}}, want: `.grpc.metadata: invalid key "X-Tenant"`},
+		{name: "grpc status", input: Input{GRPC: &GRPCInput{Service: "s.S", Method: "M", Status: "404"}}, want: ".grpc.status: expected a gRPC status name"},
+		{name: "grpc load", input: Input{Repeat: 2, GRPC: &GRPCInput{Service: "s.S", Method: "M"}}, want: "repeat and duration are only supported for HTTP inputs"},
+		{name: "grpc traceparent metadata", input: Input{TraceContext: &TraceContext{}, GRPC: &GRPCInput{Service: "s.S", Method: "M", Metadata: map[string]string{"traceparent": "x"}}}, want: ".trace_context: conflicts with the traceparent metadata key"},
+		{name: "kubernetes and compose", input: Input{Compose: &ComposeInput{Service: "app", Command: []string{"run"}}, Kubernetes: &KubernetesInput{Deployment: "app", Command: []string{"run"}}}, want: "set exactly one of path, compose, grpc, kubernetes, or fixture"},
+		{name: "kubernetes target", input: Input{Kubernetes: &KubernetesInput{Deployment: "app", Image: "job:dev"}}, want: ".kubernetes: set exactly one of deployment, selector, or image"},
+		{name: "kubernetes no target", input: Input{Kubernetes: &KubernetesInput{Command: []string{"run"}}}, want: ".kubernetes: set exactly one of deployment, selector, or image"},
+		{name: "kubernetes exec command", input: Input{Kubernetes: &KubernetesInput{Selector: "app=worker"}}, want: ".kubernetes.command: required"},
+		{name: "kubernetes empty argument", input: Input{Kubernetes: &KubernetesInput{Deployment: "app", Command: []string{"run", ""}}}, want: ".kubernetes.command[1]: must be non-empty"},
+		{name: "kubernetes job container", input: Input{Kubernetes: &KubernetesInput{Image: "job:dev", Container: "main"}}, want: ".kubernetes.container: only supported with deployment or selector"},
+		{name: "kubernetes exit code", input: Input{Kubernetes: &KubernetesInput{Image: "job:dev", ExitCode: &badExit}}, want: ".kubernetes.exit_code: must be between 0 and 255, got 256"},
+		{name: "kubernetes regex", input: Input{Kubernetes: &KubernetesInput{Image: "job:dev", Regex: StringList{"("}}}, want: ".kubernetes.regex[0]: invalid regexp"},
+		{name: "kubernetes retry", input: Input{Retry: &InputRetry{}, Kubernetes: &KubernetesInput{Image: "job:dev"}}, want: ".retry: only supported for HTTP and gRPC inputs"},
+		{name: "kubernetes header capture", input: Input{Kubernetes: &KubernetesInput{Image: "job:dev"}, Capture: map[string]CaptureSource{"id": {Header: "X-Id"}}}, want: ".header: only supported on HTTP and gRPC inputs"},
+		{name: "kubernetes load", input: Input{Repeat: 2, Kubernetes: &KubernetesInput{Image: "job:dev"}}, want: "repeat and duration are only supported for HTTP inputs"},
+		{name: "kubernetes trace_context", input: Input{TraceContext: &TraceContext{}, Kubernetes: &KubernetesInput{Image: "job:dev"}}, want: ".trace_context: only supported for HTTP and gRPC inputs"},
+		{name: "retry Compose input", input: Input{Retry: &InputRetry{}, Compose: &ComposeInput{Service: "app", Command: []string{"run"}}}, want: "only supported for HTTP and gRPC inputs"},
+		{name: "expect_body without path", input: Input{ExpectBody: &ExpectBody{Contains: StringList{"ok"}}}, want: ".path: required"},
+		{name: "expect_body empty", input: Input{Path: "/", ExpectBody: &ExpectBody{}}, want: ".expect_body: set at least one of contains, regex, or json"},
+		{name: "expect_body contains", input: Input{Path: "/", ExpectBody: &ExpectBody{Contains: StringList{""}}}, want: ".expect_body.contains[0]: must be non-empty"},
+		{name: "expect_body regex", input: Input{Path: "/", ExpectBody: &ExpectBody{Regex: StringList{"("}}}, want: ".expect_body.regex[0]: invalid regexp"},
+		{name: "expect_body json", input: Input{Path: "/", ExpectBody: &ExpectBody{JSON: map[string]string{"a..b": "x"}}}, want: `.expect_body.json: invalid path "a..b"`},
+		{name: "expect_headers name", input: Input{Path: "/", ExpectHeaders: map[string]string{"": "x"}}, want: ".expect_headers: header name must be non-empty"},
+		{name: "expect_headers load", input: Input{Path: "/", Repeat: 2, ExpectHeaders: map[string]string{"Content-Type": "text/plain"}}, want: "expect_headers and expect_body are not supported with repeat or duration"},
 		{name: "negative retry timeout", input: Input{Path: "/run", Retry: &InputRetry{Timeout: -1}}, want: ".retry.timeout: must be >= 0"},
 		{name: "negative retry interval", input: Input{Path: "/run", Retry: &InputRetry{Interval: -1}}, want: ".retry.interval: must be >= 0"},
 	}
@@ -117,6 +148,117 @@ func TestValidate_InputKind(t *testing.T) {
 	if err := remote.Validate(); err == nil || !strings.Contains(err.Error(), "requires a Compose fixture") {
 		t.Fatalf("remote Compose input error = %v", err)
 	}
+	remote.Input = []Input{{Kubernetes: &KubernetesInput{Image: "job:dev"}}}
+	if err := remote.Validate(); err == nil || !strings.Contains(err.Error(), "input[0].kubernetes: requires a k3d fixture") {
+		t.Fatalf("remote Kubernetes input error = %v", err)
+	}
+}
+
+func TestParse_KubernetesInput(t *testing.T) {
+	c, err := Parse([]byte(`
+name: cronjob
+fixture:
+  k3d:
+    k8s_dir: k8s
+    app_service: app
+    app_docker_file: Dockerfile
+    app_docker_tag: app:dev
+    app_port: 8080
+    import_images: [reports:dev]
+input:
+  - kubernetes:
+      selector: app.kubernetes.io/name=worker
+      container: worker
+      command: [worker, --drain]
+  - kubernetes:
+      image: reports:dev
+      exit_code: 3
+      contains: no reports due
+expected:
+  logs:
+    - logql: '{service_name="reports"}'
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	exec, job := c.Input[0].Kubernetes, c.Input[1].Kubernetes
+	if exec == nil || exec.Selector != "app.kubernetes.io/name=worker" || exec.Container != "worker" || len(exec.Command) != 2 {
+		t.Fatalf("exec input = %+v", exec)
+	}
+	if job == nil || job.Image != "reports:dev" || job.EffectiveExitCode() != 3 || len(job.Contains) != 1 {
+		t.Fatalf("job input = %+v", job)
+	}
+}
+
+func TestParse_GRPCInput(t *testing.T) {
+	c, err := Parse([]byte(`
+name: grpc
+input:
+  - grpc:
+      service: helloworld.Greeter
+      method: SayHello
+      request: '{"name": "oats"}'
+      metadata:
+        x-tenant: a
+      status: not_found
+      descriptor_set: greeter.protoset
+    retry: {}
+expected:
+  traces:
+    - traceql: '{ name = "helloworld.Greeter/SayHello" }'
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	g := c.Input[0].GRPC
+	if g == nil || g.Service != "helloworld.Greeter" || g.Method != "SayHello" || g.Metadata["x-tenant"] != "a" || g.DescriptorSet != "greeter.protoset" {
+		t.Fatalf("grpc input = %+v", g)
+	}
+	if code, err := g.ExpectedStatus(); err != nil || code != 5 {
+		t.Fatalf("ExpectedStatus = %d, %v; want 5", code, err)
+	}
+	if code, err := (GRPCInput{Status: "14"}).ExpectedStatus(); err != nil || code != 14 {
+		t.Fatalf("numeric ExpectedStatus = %d, %v; want 14", code, err)
+	}
+}
+
+func TestParse_ExpectResponse(t *testing.T) {
+	c, err := Parse([]byte(`
+name: expect response
+input:
+  - path: /health
+    expect_headers:
+      Content-Type: application/json
+    expect_body:
+      contains: ok
+      regex: ['"version":\s*"\d+']
+      json:
+        status: ok
+        checks.db: up
+expected:
+  traces:
+    - traceql: '{}'
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	in := c.Input[0]
+	if in.ExpectHeaders["Content-Type"] != "application/json" {
+		t.Fatalf("expect_headers = %v", in.ExpectHeaders)
+	}
+	eb := in.ExpectBody
+	if eb == nil || len(eb.Contains) != 1 || eb.Contains[0] != "ok" || len(eb.Regex) != 1 || eb.JSON["checks.db"] != "up" {
+		t.Fatalf("expect_body = %+v", eb)
+	}
 }
 
 func TestParse_InlineOTLPSeed(t *testing.T) {
@@ -145,6 +287,49 @@ expected:
 	}
 }
 
+func TestParse_Histograms(t *testing.T) {
+	src := []byte(`
+name: latency histogram
+seed:
+  type: inline-otlp
+  metrics:
+    - name: request_duration
+      service: dice
+      histogram:
+        bounds: [0.1, 0.5]
+        observations: [0.05, 0.2, 0.7]
+expected:
+  metrics:
+    - promql: 'request_duration{service_name="dice"}'
+      histogram:
+        count: '== 3'
+        sum: '< 1s'
+        buckets: [0.1, 0.5]
+        bucket_counts:
+          - le: "+Inf"
+            count: '== 3'
+        quantiles:
+          p95: '< 300ms'
+`)
+	c, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if sh := c.Seed.Metrics[0].Histogram; sh == nil || len(sh.Bounds) != 2 || len(sh.Observations) != 3 {
+		t.Errorf("seed histogram: %+v", sh)
+	}
+	h := c.Expected.Metrics[0].Histogram
+	if h == nil || h.Count != "== 3" || len(h.BucketCounts) != 1 || h.BucketCounts[0].LE != "+Inf" || h.Quantiles["p95"] != "< 300ms" {
+		t.Fatalf("histogram assertion: %+v", h)
+	}
+	if op, bound, err := HistogramBound(h.Quantiles["p95"]); err != nil || op != "<" || bound != 0.3 {
+		t.Errorf("HistogramBound: %s %v %v", op, bound, err)
+	}
+	if q, err := Quantile("p50"); err != nil || q != 0.5 {
+		t.Errorf("Quantile(p50): %v %v", q, err)
+	}
+}
+
 func TestParse_MatchAssertions(t *testing.T) {
 	src := []byte(`
 name: structured match
@@ -183,6 +368,42 @@ expected:
 	}
 }
 
+func TestParse_AttributeOperators(t *testing.T) {
+	c, err := Parse([]byte(`
+name: operators
+expected:
+  traces:
+    - traceql: '{}'
+      match_spans:
+        - name: GET /users
+          attributes:
+            - key: http.response.status_code
+              type: int
+              compare: '>= 500'
+            - key: http.request.method
+              one_of: [GET, HEAD]
+            - key: user.email
+              absent: true
+            - key: url.scheme
+              not_equals: http
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	attrs := c.Expected.Traces[0].MatchSpans[0].Attributes
+	if attrs[0].Type != "int" || attrs[0].Compare != ">= 500" || len(attrs[1].OneOf) != 2 || !attrs[2].Absent || *attrs[3].NotEquals != "http" {
+		t.Fatalf("operators: %+v", attrs)
+	}
+	if op, bound, err := attrs[0].CompareBound(); op != ">=" || bound != 500 || err != nil {
+		t.Fatalf("CompareBound = %q %v %v", op, bound, err)
+	}
+
+	_, err = Parse([]byte("name: x\nexpected:\n  logs:\n    - logql: '{}'\n      match:\n        - attributes:\n            - key: a\n              not_equal: b\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 8: field not_equal not found") {
+		t.Fatalf("a misspelt operator should be rejected, got %v", err)
+	}
+}
+
 func TestParse_StringListScalarOrList(t *testing.T) {
 	src := []byte(`
 name: text assertions
@@ -329,6 +550,80 @@ func TestValidate_NoExpectations(t *testing.T) {
 	}
 }
 
+func TestParse_Correlate(t *testing.T) {
+	c, err := Parse([]byte(`
+name: logs carry trace ids
+seed:
+  type: app
+  compose: x.yml
+expected:
+  correlate:
+    - from:
+        logql: '{service_name="cart"}'
+        match:
+          - attributes:
+              level: error
+      to:
+        traceql: '{ resource.service.name = "cart" }'
+        match_spans:
+          - name: checkout
+      resolve: any
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	corr := c.Expected.Correlate[0]
+	if corr.From.Signal() != "logs" || corr.EffectiveResolve() != "any" || len(corr.From.Match) != 1 || len(corr.To.MatchSpans) != 1 {
+		t.Errorf("unexpected correlation: %+v", corr)
+	}
+}
+
+func TestParse_Steps(t *testing.T) {
+	c, err := Parse([]byte(`
+name: restart keeps serving
+seed:
+  type: app
+  compose: x.yml
+steps:
+  - input:
+      path: /orders
+      capture:
+        order: {json: id}
+  - expect:
+      traces:
+        - traceql: '{ span.order.id = "${capture.order}" }'
+          capture:
+            instance: {regex: 'service.instance.id=(\S+)'}
+  - fixture:
+      restart: app
+  - sleep: 2s
+  - input:
+      path: /orders/${capture.order}
+      retry: {}
+  - expect:
+      traces:
+        - traceql: '{ resource.service.instance.id != "${capture.instance}" }'
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(c.Steps) != 6 || len(c.Expected.Traces) != 0 {
+		t.Fatalf("steps = %+v", c.Steps)
+	}
+	if command, service := c.Steps[2].Fixture.Action(); command != "restart" || service != "app" {
+		t.Errorf("fixture action = %s %s", command, service)
+	}
+	if c.Steps[3].Sleep != 2*time.Second {
+		t.Errorf("sleep = %s", c.Steps[3].Sleep)
+	}
+	if got := c.CaptureRefs("steps[5].expect.traces[0]"); !slices.Equal(got, []string{"instance"}) {
+		t.Errorf("CaptureRefs = %q", got)
+	}
+	if got := len(c.Inputs()); got != 2 {
+		t.Errorf("Inputs() has %d entries, want 2", got)
+	}
+}
+
 func TestValidate_CustomCheckOnlyCase(t *testing.T) {
 	c := &Case{
 		Name:     "x",
@@ -533,6 +828,352 @@ func TestValidateErrorBranches(t *testing.T) {
 			c.Expected.Custom = []CustomCheck{{Script: "  "}}
 			return c
 		}, want: "custom-checks"},
+		{name: "profile scope_run_id", make: func() *Case {
+			c := valid()
+			off := false
+			c.Expected.Profiles = []ProfileAssertion{{Query: "cpu", AssertionCommon: AssertionCommon{ScopeRunID: &off}}}
+			return c
+		}, want: "profiles are not scoped"},
+		{name: "since and window", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].Since = time.Minute
+			c.Expected.Traces[0].Window = time.Minute
+			return c
+		}, want: "expected.traces[0]: set since or window, not both"},
+		{name: "negative window", make: func() *Case { c := valid(); c.Expected.Traces[0].Window = -time.Second; return c }, want: "window: must be >= 0"},
+		{name: "empty tree child", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].Tree = []SpanTree{{MatchEntry: MatchEntry{Name: stringPtr("root")}, Children: []SpanTree{{}}}}
+			return c
+		}, want: "expected.traces[0].tree[0].children[0]: at least one of name or attributes is required"},
+		{name: "absent tree", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].Absent = true
+			c.Expected.Traces[0].SingleTrace = true
+			return c
+		}, want: "absent cannot be combined with tree or single_trace"},
+		{name: "unknown span kind", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].MatchSpans = []MatchEntry{{Kind: "server-side"}}
+			return c
+		}, want: `expected.traces[0].match_spans[0].kind: unknown value "server-side"`},
+		{name: "bad span duration", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].MatchSpans = []MatchEntry{{Duration: "< 5 parsecs"}}
+			return c
+		}, want: "expected.traces[0].match_spans[0].duration: invalid duration"},
+		{name: "span keys outside spans", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].Match = []MatchEntry{{StatusCode: "error"}}
+			return c
+		}, want: "expected.traces[0].match[0]: kind, status_code, status_message, duration, events, and links are only supported on trace spans"},
+		{name: "absent with value", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].MatchSpans = []MatchEntry{{Attributes: AttributeMatchers{{Key: "user.email", Absent: true, Value: stringPtr("x")}}}}
+			return c
+		}, want: "expected.traces[0].match_spans[0].attributes[0].absent: cannot be combined with value, not_equals, compare, one_of, or type"},
+		{name: "bad compare", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].MatchSpans = []MatchEntry{{Attributes: AttributeMatchers{{Key: "code", Compare: ">= five"}}}}
+			return c
+		}, want: `expected.traces[0].match_spans[0].attributes[0].compare: invalid number in ">= five"`},
+		{name: "unknown attribute type", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].MatchSpans = []MatchEntry{{Attributes: AttributeMatchers{{Key: "code", Type: "integer"}}}}
+			return c
+		}, want: `expected.traces[0].match_spans[0].attributes[0].type: unknown value "integer"`},
+		{name: "empty one_of", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].MatchSpans = []MatchEntry{{Attributes: AttributeMatchers{{Key: "code", OneOf: []string{}}}}}
+			return c
+		}, want: "expected.traces[0].match_spans[0].attributes[0].one_of: at least one value is required"},
+		{name: "histogram with value", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "d", AssertionCommon: AssertionCommon{Count: ">= 1"}, Histogram: &HistogramAssertion{Count: ">= 1"}}}
+			return c
+		}, want: "expected.metrics[0].histogram: cannot be combined with value, each, any, none, range, match, count, or absent"},
+		{name: "histogram over an expression", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "rate(d[1m])", Histogram: &HistogramAssertion{Count: ">= 1"}}}
+			return c
+		}, want: "expected.metrics[0].promql: histogram needs a plain selector"},
+		{name: "empty histogram", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "d", Histogram: &HistogramAssertion{}}}
+			return c
+		}, want: "expected.metrics[0].histogram: at least one of"},
+		{name: "histogram bounds out of order", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "d", Histogram: &HistogramAssertion{Buckets: []float64{0.5, 0.1}}}}
+			return c
+		}, want: "expected.metrics[0].histogram.buckets"},
+		{name: "histogram quantile key", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "d", Histogram: &HistogramAssertion{Quantiles: map[string]string{"median": "< 1"}}}}
+			return c
+		}, want: "expected.metrics[0].histogram.quantiles.median: expected p<percentile>"},
+		{name: "histogram bucket le", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "d", Histogram: &HistogramAssertion{BucketCounts: []BucketCount{{LE: "big", Count: "== 1"}}}}}
+			return c
+		}, want: "expected.metrics[0].histogram.bucket_counts[0].le"},
+		{name: "each with absent", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", Each: "== 1", AssertionCommon: AssertionCommon{Absent: true}}}
+			return c
+		}, want: "expected.metrics[0]: each, any, and none cannot be combined with absent"},
+		{name: "invalid none comparison", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", None: "> lots"}}
+			return c
+		}, want: `expected.metrics[0].none: invalid number in "> lots"`},
+		{name: "range without step", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", Range: &RangeAssertion{Monotonic: true}}}
+			return c
+		}, want: "expected.metrics[0].range.step: required"},
+		{name: "range with absent", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", Range: &RangeAssertion{Step: time.Second}, AssertionCommon: AssertionCommon{Absent: true}}}
+			return c
+		}, want: "expected.metrics[0].range: cannot be combined with absent"},
+		{name: "range rate", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", Range: &RangeAssertion{Step: time.Second, Rate: "fast"}}}
+			return c
+		}, want: "expected.metrics[0].range.rate: expected comparison operator"},
+		{name: "metadata over an expression", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "sum(up)", Metadata: &MetricMetadata{Type: "gauge"}}}
+			return c
+		}, want: "expected.metrics[0].promql: metadata needs a plain selector"},
+		{name: "empty metadata", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", Metadata: &MetricMetadata{}}}
+			return c
+		}, want: "expected.metrics[0].metadata: at least one of"},
+		{name: "metadata type", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", Metadata: &MetricMetadata{Type: "sum"}}}
+			return c
+		}, want: `expected.metrics[0].metadata.type: unknown value "sum"`},
+		{name: "metadata temporality", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", Metadata: &MetricMetadata{Temporality: "monotonic"}}}
+			return c
+		}, want: `expected.metrics[0].metadata.temporality: unknown value "monotonic"`},
+		{name: "max_streams on metrics", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", Cardinality: &CardinalityBudget{MaxStreams: 3}}}
+			return c
+		}, want: "expected.metrics[0].cardinality.max_streams: only supported on logs; metrics use max_series"},
+		{name: "empty log budget", make: func() *Case {
+			c := valid()
+			c.Expected.Logs = []LogAssertion{{LogQL: "{}", Cardinality: &CardinalityBudget{}}}
+			return c
+		}, want: "expected.logs[0].cardinality: at least one of max_streams or max_label_values is required"},
+		{name: "per without cap", make: func() *Case {
+			c := valid()
+			c.Expected.Logs = []LogAssertion{{LogQL: "{}", Cardinality: &CardinalityBudget{Per: "service_name", MaxLabelValues: map[string]int{"pod": 2}}}}
+			return c
+		}, want: "expected.logs[0].cardinality.per: requires max_streams"},
+		{name: "zero label budget", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", Cardinality: &CardinalityBudget{MaxLabelValues: map[string]int{"pod": 0}}}}
+			return c
+		}, want: "expected.metrics[0].cardinality.max_label_values.pod: must be positive"},
+		{name: "correlate without target", make: func() *Case {
+			c := valid()
+			c.Expected.Correlate = []Correlation{{From: CorrelationSource{LogQL: "{}"}}}
+			return c
+		}, want: "expected.correlate[0].to: set exactly one of traceql or profiles"},
+		{name: "correlate two sources", make: func() *Case {
+			c := valid()
+			c.Expected.Correlate = []Correlation{{From: CorrelationSource{LogQL: "{}", Exemplars: "up"}, To: CorrelationTarget{TraceQL: "{}"}}}
+			return c
+		}, want: "expected.correlate[0].from: set exactly one of logql, traceql, or exemplars"},
+		{name: "correlate logs to profiles", make: func() *Case {
+			c := valid()
+			c.Expected.Correlate = []Correlation{{From: CorrelationSource{LogQL: "{}"}, To: CorrelationTarget{Profiles: "process_cpu:cpu:nanoseconds:cpu:nanoseconds{}"}}}
+			return c
+		}, want: "expected.correlate[0].to.profiles: profiles correlate with spans; use traceql in from"},
+		{name: "correlate unknown resolve", make: func() *Case {
+			c := valid()
+			c.Expected.Correlate = []Correlation{{From: CorrelationSource{LogQL: "{}"}, To: CorrelationTarget{TraceQL: "{}"}, Resolve: "most"}}
+			return c
+		}, want: `expected.correlate[0].resolve: unknown value "most" (expected one of all, any)`},
+		{name: "capture header on assertion", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].Capture = map[string]CaptureSource{"tp": {Header: "traceparent"}}
+			return c
+		}, want: "expected.traces[0].capture.tp.header: only supported on HTTP and gRPC inputs"},
+		{name: "capture trace_id on logs", make: func() *Case {
+			c := valid()
+			c.Expected.Logs = []LogAssertion{{LogQL: "{}", AssertionCommon: AssertionCommon{Capture: map[string]CaptureSource{"id": {TraceID: true}}}}}
+			return c
+		}, want: "expected.logs[0].capture.id.trace_id: only supported on traces"},
+		{name: "capture two sources", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Path: "/a", Capture: map[string]CaptureSource{"id": {Header: "x-id", JSON: "id"}}}}
+			return c
+		}, want: "input[0].capture.id: set at most one of header, json, or trace_id"},
+		{name: "capture bad name", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Path: "/a", Capture: map[string]CaptureSource{"order.id": {JSON: "id"}}}}
+			return c
+		}, want: "input[0].capture.order.id: name may only contain letters, digits, _ and -"},
+		{name: "header capture on compose input", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Compose: &ComposeInput{Service: "app", Command: []string{"run"}}, Capture: map[string]CaptureSource{"id": {Header: "X-Id"}}}}
+			return c
+		}, want: "input[0].capture.id.header: only supported on HTTP and gRPC inputs"},
+		{name: "compose exit code out of range", make: func() *Case {
+			c := valid()
+			code := 256
+			c.Input = []Input{{Compose: &ComposeInput{Service: "app", Command: []string{"run"}, ExitCode: &code}}}
+			return c
+		}, want: "input[0].compose.exit_code: must be between 0 and 255, got 256"},
+		{name: "compose empty contains", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Compose: &ComposeInput{Service: "app", Command: []string{"run"}, Contains: StringList{""}}}}
+			return c
+		}, want: "input[0].compose.contains[0]: must be non-empty"},
+		{name: "compose bad regex", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Compose: &ComposeInput{Service: "app", Command: []string{"run"}, Regex: StringList{"("}}}}
+			return c
+		}, want: "input[0].compose.regex[0]: invalid regexp \"(\": error parsing regexp: missing closing ): `(`"},
+		{name: "capture with absent", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].Absent = true
+			c.Expected.Traces[0].Capture = map[string]CaptureSource{"id": {TraceID: true}}
+			return c
+		}, want: "expected.traces[0].capture: cannot be combined with absent"},
+		{name: "trace_context with traceparent header", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Path: "/a", Headers: map[string]string{"Traceparent": "00-x"}, TraceContext: &TraceContext{}}}
+			return c
+		}, want: "input[0].trace_context: conflicts with the Traceparent header"},
+		{name: "trace_context capture clash", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Path: "/a", TraceContext: &TraceContext{}, Capture: map[string]CaptureSource{"trace_id": {Header: "x-trace"}}}}
+			return c
+		}, want: `input[0].trace_context.capture: "trace_id" is also set under capture`},
+		{name: "trace_id on profiles", make: func() *Case {
+			c := valid()
+			c.Expected.Profiles = []ProfileAssertion{{Query: "process_cpu:cpu:nanoseconds:cpu:nanoseconds{}", AssertionCommon: AssertionCommon{TraceID: "abc"}}}
+			return c
+		}, want: "expected.profiles[0].trace_id: profiles are not tied to a trace; use correlate"},
+		{name: "trace_id with absent metric", make: func() *Case {
+			c := valid()
+			c.Expected.Metrics = []MetricAssertion{{PromQL: "up", AssertionCommon: AssertionCommon{TraceID: "abc", Absent: true}}}
+			return c
+		}, want: "expected.metrics[0].trace_id: cannot be combined with absent"},
+		{name: "repeat and duration", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Path: "/a", Repeat: 10, Duration: time.Second}}
+			return c
+		}, want: "input[0]: set repeat or duration, not both"},
+		{name: "rate without repeat", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Path: "/a", Rate: "10/s"}}
+			return c
+		}, want: "input[0].rate: requires repeat or duration"},
+		{name: "bad rate", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Path: "/a", Repeat: 10, Rate: "10/d"}}
+			return c
+		}, want: `input[0].rate: expected <count>/<s|m|h> such as 10/s, got "10/d"`},
+		{name: "repeat on compose input", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Compose: &ComposeInput{Service: "app", Command: []string{"run"}}, Repeat: 5}}
+			return c
+		}, want: "input[0]: repeat and duration are only supported for HTTP inputs"},
+		{name: "repeat with capture", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Path: "/a", Repeat: 5, Capture: map[string]CaptureSource{"id": {JSON: "id"}}}}
+			return c
+		}, want: "input[0].capture: not supported with repeat or duration"},
+		{name: "step with two actions", make: func() *Case {
+			c := valid()
+			c.Steps = []Step{{Input: &Input{Path: "/a"}, Sleep: time.Second}}
+			return c
+		}, want: "steps[0]: set exactly one of input, sleep, expect, or fixture"},
+		{name: "step input without path", make: func() *Case {
+			c := valid()
+			c.Steps = []Step{{Input: &Input{Method: "POST"}}}
+			return c
+		}, want: "steps[0].input.path: required, non-empty"},
+		{name: "step expect with when", make: func() *Case {
+			c := valid()
+			c.Steps = []Step{{Expect: &Expected{Logs: []LogAssertion{{LogQL: "{}", AssertionCommon: AssertionCommon{When: "a"}}}}}}
+			return c
+		}, want: "steps[0].expect.logs[0].when: only supported under expected"},
+		{name: "step expect without logql", make: func() *Case {
+			c := valid()
+			c.Steps = []Step{{Sleep: time.Second}, {Expect: &Expected{Logs: []LogAssertion{{}}}}}
+			return c
+		}, want: "steps[1].expect.logs[0].logql: required, non-empty"},
+		{name: "step fixture action without service", make: func() *Case {
+			c := valid()
+			c.Steps = []Step{{Fixture: &FixtureAction{}}}
+			return c
+		}, want: "steps[0].fixture: set exactly one of restart, stop, start, kill, pause, or unpause"},
+		{name: "step capture used before it is taken", make: func() *Case {
+			c := valid()
+			c.Steps = []Step{
+				{Input: &Input{Path: "/orders/${capture.id}"}},
+				{Input: &Input{Path: "/orders", Capture: map[string]CaptureSource{"id": {JSON: "id"}}}},
+			}
+			return c
+		}, want: `steps[0].input.path: ${capture.id}: capture "id" is not set by an earlier input or assertion`},
+		{name: "fixture input with path", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Path: "/a", Fixture: &FixtureAction{Stop: "app"}}}
+			return c
+		}, want: "input[0]: set exactly one of path, compose, grpc, kubernetes, or fixture"},
+		{name: "signal without kill", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Fixture: &FixtureAction{Stop: "app", Signal: "SIGTERM"}}}
+			return c
+		}, want: "input[0].fixture.signal: only supported with kill"},
+		{name: "bad signal", make: func() *Case {
+			c := valid()
+			c.Input = []Input{{Fixture: &FixtureAction{Kill: "app", Signal: "term now"}}}
+			return c
+		}, want: `input[0].fixture.signal: expected a signal name such as SIGTERM or a number, got "term now"`},
+		{name: "pause on k3d", make: func() *Case {
+			c := valid()
+			c.Fixture = &FixtureConfig{K3D: &K3DFixture{K8sDir: "k8s", AppService: "app", AppDockerFile: "Dockerfile", AppDockerTag: "app:test", AppPort: 8080}}
+			c.Steps = []Step{{Fixture: &FixtureAction{Pause: "app"}}}
+			return c
+		}, want: "steps[0].fixture.pause: not supported on k3d fixtures"},
+		{name: "fixture action on remote", make: func() *Case {
+			c := valid()
+			c.Fixture = &FixtureConfig{Remote: &RemoteFixture{Endpoint: "http://example.test:4318"}}
+			c.Input = []Input{{Fixture: &FixtureAction{Restart: "app"}}}
+			return c
+		}, want: "input[0].fixture: requires a Compose or k3d fixture"},
+		{name: "seed histogram and value", make: func() *Case {
+			c := valid()
+			c.Seed = Seed{Type: "inline-otlp", Metrics: []SeedMetric{{Name: "d", Value: 1, Histogram: &SeedHistogram{Observations: []float64{1}}}}}
+			return c
+		}, want: "seed.metrics[0]: set value or histogram, not both"},
+		{name: "seed histogram without observations", make: func() *Case {
+			c := valid()
+			c.Seed = Seed{Type: "inline-otlp", Metrics: []SeedMetric{{Name: "d", Histogram: &SeedHistogram{Bounds: []float64{1}}}}}
+			return c
+		}, want: "seed.metrics[0].histogram.observations"},
+		{name: "ignore without no_extra", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].MatchSpans = []MatchEntry{{Name: stringPtr("a"), IgnoreAttributes: []string{"host.name"}}}
+			return c
+		}, want: "expected.traces[0].match_spans[0].ignore_attributes: requires no_extra_attributes"},
+		{name: "empty span event", make: func() *Case {
+			c := valid()
+			c.Expected.Traces[0].MatchSpans = []MatchEntry{{Events: []SpanEvent{{}}}}
+			return c
+		}, want: "expected.traces[0].match_spans[0].events[0]: at least one of name or attributes is required"},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			if err := tc.make().Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
@@ -551,6 +1192,7 @@ func TestValidateErrorBranches(t *testing.T) {
 		{name: "compose both", f: FixtureConfig{Compose: &ComposeFixture{File: "a", Files: []string{"b"}}}, want: "file or files"},
 		{name: "k3d incomplete", f: FixtureConfig{K3D: &K3DFixture{}}, want: "k3d requires"},
 		{name: "remote missing endpoint", f: FixtureConfig{Remote: &RemoteFixture{}}, want: "remote requires"},
+		{name: "inject_run_id without app", f: FixtureConfig{Compose: &ComposeFixture{InjectRunID: true}}, want: "inject_run_id requires app_service"},
 	} {
 		t.Run("fixture "+tc.name, func(t *testing.T) {
 			if err := tc.f.Validate("fixture"); err == nil || !strings.Contains(err.Error(), tc.want) {
@@ -563,3 +1205,17 @@ func TestValidateErrorBranches(t *testing.T) {
 		t.Fatal("template=none without files should fail")
 	}
 }
+
+func TestParseRate(t *testing.T) {
+	for rate, want := range map[string]float64{"10/s": 10, "600/m": 10, "0.5/s": 0.5, "36/h": 0.01} {
+		got, err := ParseRate(rate)
+		if err != nil || math.Abs(got-want) > 1e-9 {
+			t.Errorf("ParseRate(%q) = %v, %v; want %v", rate, got, err, want)
+		}
+	}
+	for _, rate := range []string{"10", "0/s", "-1/s", "x/s", "10/d"} {
+		if _, err := ParseRate(rate); err == nil {
+			t.Errorf("ParseRate(%q) succeeded", rate)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package casefile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Correlation checks that telemetry in one signal points at telemetry in
+// another: the IDs the From query yields must resolve in the To query. Log
+// lines and metric exemplars yield trace IDs, which resolve against traces;
+// spans yield the span IDs span profiling records, which resolve against
+// profiles.
+type Correlation struct {
+	From CorrelationSource `yaml:"from"`
+	To   CorrelationTarget `yaml:"to"`
+	// Resolve is "all" (the default), requiring every ID to resolve, or
+	// "any", requiring one.
+	Resolve string `yaml:"resolve,omitempty"`
+	When    string `yaml:"when,omitempty"`
+}
+
+// CorrelationSource is the query whose results carry the IDs. Exactly one of
+// LogQL, TraceQL or Exemplars (PromQL whose exemplars are read) is set; Match
+// narrows the results to the rows matching any of its entries.
+type CorrelationSource struct {
+	LogQL     string       `yaml:"logql,omitempty"`
+	TraceQL   string       `yaml:"traceql,omitempty"`
+	Exemplars string       `yaml:"exemplars,omitempty"`
+	Match     []MatchEntry `yaml:"match,omitempty"`
+}
+
+// CorrelationTarget is the query each ID must resolve in. Exactly one of
+// TraceQL or Profiles is set. MatchSpans, on traces only, must then hold
+// within each resolved trace.
+type CorrelationTarget struct {
+	TraceQL    string       `yaml:"traceql,omitempty"`
+	Profiles   string       `yaml:"profiles,omitempty"`
+	MatchSpans []MatchEntry `yaml:"match_spans,omitempty"`
+}
+
+// ResolveModes are the values resolve accepts.
+var ResolveModes = []string{"all", "any"}
+
+// EffectiveResolve returns the resolve mode, defaulting to "all".
+func (c Correlation) EffectiveResolve() string {
+	if c.Resolve == "" {
+		return "all"
+	}
+	return c.Resolve
+}
+
+// Signal names the source query's signal: logs, traces or exemplars.
+func (s CorrelationSource) Signal() string {
+	switch {
+	case s.LogQL != "":
+		return "logs"
+	case s.TraceQL != "":
+		return "traces"
+	case s.Exemplars != "":
+		return "exemplars"
+	}
+	return ""
+}
+
+func validateCorrelation(path string, c Correlation) error {
+	set := 0
+	for _, q := range []string{c.From.LogQL, c.From.TraceQL, c.From.Exemplars} {
+		if strings.TrimSpace(q) != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("%s.from: set exactly one of logql, traceql, or exemplars", path)
+	}
+	toTraces, toProfiles := strings.TrimSpace(c.To.TraceQL) != "", strings.TrimSpace(c.To.Profiles) != ""
+	if toTraces == toProfiles {
+		return fmt.Errorf("%s.to: set exactly one of traceql or profiles", path)
+	}
+	switch from := c.From.Signal(); {
+	case toTraces && from == "traces":
+		return fmt.Errorf("%s.to.traceql: spans correlate with profiles; use logql or exemplars in from", path)
+	case toProfiles && from != "traces":
+		return fmt.Errorf("%s.to.profiles: profiles correlate with spans; use traceql in from", path)
+	}
+	if len(c.To.MatchSpans) > 0 && !toTraces {
+		return fmt.Errorf("%s.to.match_spans: only supported with to.traceql", path)
+	}
+	if c.Resolve != "" && c.Resolve != "all" && c.Resolve != "any" {
+		return fmt.Errorf("%s.resolve: unknown value %q (expected one of %s)", path, c.Resolve, strings.Join(ResolveModes, ", "))
+	}
+	if err := validateMatchEntries(path+".from.match", c.From.Match, c.From.TraceQL != ""); err != nil {
+		return err
+	}
+	return validateMatchEntries(path+".to.match_spans", c.To.MatchSpans, true)
+}
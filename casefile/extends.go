@@ -0,0 +1,352 @@
+package casefile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// appendPaths are the lists a case extends rather than replaces: a fragment's
+// entries come first, then the extending file's. Every other list, like every
+// scalar, is replaced by the extending file.
+var appendPaths = map[string]bool{
+	"input":                  true,
+	"steps":                  true,
+	"seed.traces":            true,
+	"seed.logs":              true,
+	"seed.metrics":           true,
+	"expected.traces":        true,
+	"expected.metrics":       true,
+	"expected.logs":          true,
+	"expected.profiles":      true,
+	"expected.compose-logs":  true,
+	"expected.custom-checks": true,
+	"expected.correlate":     true,
+}
+
+// fragmentPaths are the fields holding a path relative to the file that sets
+// them. A segment ending in [] visits every entry of a list.
+var fragmentPaths = []string{
+	"fixture.compose.file",
+	"fixture.compose.files[]",
+	"fixture.k3d.k8s_dir",
+	"fixture.k3d.app_docker_file",
+	"fixture.k3d.app_docker_context",
+	"matrix[].fixture.compose.file",
+	"matrix[].fixture.compose.files[]",
+	"matrix[].fixture.k3d.k8s_dir",
+	"matrix[].fixture.k3d.app_docker_file",
+	"matrix[].fixture.k3d.app_docker_context",
+	"seed.compose",
+	"input[].grpc.descriptor_set",
+	"steps[].input.grpc.descriptor_set",
+	"expected.custom-checks[].script",
+	"steps[].expect.custom-checks[].script",
+}
+
+// fragments records where the pieces of a merged case came from, so a
+// validation error can name the fragment that introduced the offending value.
+type fragments struct {
+	root  string   // the case file; empty for Parse
+	files []string // every fragment loaded, first-load order, de-duplicated
+	// items maps an entry of an appended list to the file declaring it.
+	items map[*yaml.Node]string
+	// keys maps a top-level key to every file that set it.
+	keys map[string][]string
+}
+
+// parseCase resolves extends: for the case at path (empty for in-memory
+// yaml), decodes the merged document, and validates it.
+func parseCase(data []byte, path string) (*Case, error) {
+	fr := &fragments{root: path, items: map[*yaml.Node]string{}, keys: map[string][]string{}}
+	var stack []string
+	if path != "" {
+		stack = []string{absPath(path)}
+	}
+	root, err := fr.load(data, path, stack)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := yaml.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	c, err := decodeCase(merged)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fr.annotate(root, err)
+	}
+	c.Fragments = fr.files
+	return c, nil
+}
+
+func decodeCase(data []byte) (*Case, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true) // reject unknown keys
+	var c Case
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// load returns the mapping node for one file with its extends: resolved. The
+// file is decoded on its own first, so an unknown key or a wrong type is
+// reported against the file that holds it, with that file's line numbers.
+func (fr *fragments) load(data []byte, path string, stack []string) (*yaml.Node, error) {
+	own, err := decodeCase(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a mapping at the top level")
+	}
+	deleteKey(root, "extends")
+	if path != fr.root {
+		fr.rebase(root, path)
+	}
+	fr.record(root, path)
+
+	base := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i, ext := range own.Extends {
+		if strings.TrimSpace(ext) == "" {
+			return nil, fmt.Errorf("extends[%d]: path is required and non-empty", i)
+		}
+		file := ext
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		abs := absPath(file)
+		if slices.Contains(stack, abs) {
+			chain := make([]string, 0, len(stack)+1)
+			for _, p := range append(stack, abs) {
+				chain = append(chain, fr.display(p))
+			}
+			return nil, fmt.Errorf("extends[%d]: cycle %s", i, strings.Join(chain, " -> "))
+		}
+		// A fragment reached twice, as in a diamond, is merged once: its
+		// entries are already in the lists, and merging it again would
+		// repeat them.
+		if slices.Contains(fr.files, abs) {
+			continue
+		}
+		fragData, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("extends[%d]: %w", i, err)
+		}
+		frag, err := fr.load(fragData, file, append(stack, abs))
+		if err != nil {
+			return nil, fmt.Errorf("extends[%d] %s: %w", i, fr.display(file), err)
+		}
+		fr.files = append(fr.files, abs)
+		mergeNode(base, frag, "")
+	}
+	mergeNode(base, root, "")
+	return base, nil
+}
+
+// rebase rewrites the relative paths a fragment at path sets so they resolve
+// against the case's directory, where everything downstream looks for them,
+// and still name the file next to the fragment. Paths starting with an
+// interpolation, inline check scripts, and bare script names, which are looked
+// up on PATH, are left alone.
+func (fr *fragments) rebase(root *yaml.Node, path string) {
+	caseDir := absPath(filepath.Dir(fr.root))
+	fragDir := absPath(filepath.Dir(path))
+	if caseDir == fragDir {
+		return
+	}
+	for _, field := range fragmentPaths {
+		script := strings.HasSuffix(field, ".script")
+		eachScalar(root, strings.Split(field, "."), func(n *yaml.Node) {
+			p := strings.TrimSpace(n.Value)
+			switch {
+			case p == "" || filepath.IsAbs(p) || strings.HasPrefix(p, "${"):
+				// An interpolated path may well be absolute once resolved.
+				return
+			case script && (looksInline(p) || !strings.ContainsRune(p, os.PathSeparator)):
+				return
+			}
+			rel, err := filepath.Rel(caseDir, filepath.Join(fragDir, p))
+			if err != nil {
+				rel = filepath.Join(fragDir, p)
+			}
+			if script && !strings.ContainsRune(rel, os.PathSeparator) {
+				rel = "." + string(os.PathSeparator) + rel
+			}
+			n.Value = rel
+		})
+	}
+}
+
+// looksInline reports whether a custom-check script is a script body rather
+// than a path, matching how the runner tells them apart.
+func looksInline(script string) bool {
+	return strings.Contains(script, "\n") || strings.HasPrefix(script, "#!")
+}
+
+// eachScalar calls fn with every scalar node the dotted field segs reaches
+// from n.
+func eachScalar(n *yaml.Node, segs []string, fn func(*yaml.Node)) {
+	if len(segs) == 0 {
+		if n.Kind == yaml.ScalarNode {
+			fn(n)
+		}
+		return
+	}
+	key, each := strings.CutSuffix(segs[0], "[]")
+	i := indexKey(n, key)
+	if n.Kind != yaml.MappingNode || i < 0 {
+		return
+	}
+	val := n.Content[i+1]
+	if !each {
+		eachScalar(val, segs[1:], fn)
+		return
+	}
+	if val.Kind == yaml.SequenceNode {
+		for _, item := range val.Content {
+			eachScalar(item, segs[1:], fn)
+		}
+	}
+}
+
+// record notes which file set each top-level key and each appended entry.
+func (fr *fragments) record(root *yaml.Node, path string) {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, val := root.Content[i].Value, root.Content[i+1]
+		fr.keys[key] = append(fr.keys[key], path)
+		forEachAppended(key, val, func(_ string, item *yaml.Node) {
+			fr.items[item] = path
+		})
+	}
+}
+
+// forEachAppended calls fn with the yaml path and node of every entry in an
+// appended list under the top-level key.
+func forEachAppended(key string, val *yaml.Node, fn func(string, *yaml.Node)) {
+	visit := func(listPath string, list *yaml.Node) {
+		if list.Kind != yaml.SequenceNode || !appendPaths[listPath] {
+			return
+		}
+		for j, item := range list.Content {
+			fn(fmt.Sprintf("%s[%d]", listPath, j), item)
+		}
+	}
+	if val.Kind == yaml.MappingNode {
+		for j := 0; j+1 < len(val.Content); j += 2 {
+			visit(key+"."+val.Content[j].Value, val.Content[j+1])
+		}
+		return
+	}
+	visit(key, val)
+}
+
+// mergeNode merges over into dst in place. Mappings merge key by key, lists on
+// appendPaths concatenate, and anything else in over replaces dst.
+func mergeNode(dst, over *yaml.Node, path string) {
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		key, val := over.Content[i], over.Content[i+1]
+		childPath := key.Value
+		if path != "" {
+			childPath = path + "." + key.Value
+		}
+		j := indexKey(dst, key.Value)
+		if j < 0 {
+			dst.Content = append(dst.Content, key, val)
+			continue
+		}
+		cur := dst.Content[j+1]
+		switch {
+		case cur.Kind == yaml.MappingNode && val.Kind == yaml.MappingNode:
+			mergeNode(cur, val, childPath)
+		case cur.Kind == yaml.SequenceNode && val.Kind == yaml.SequenceNode && appendPaths[childPath]:
+			cur.Content = append(cur.Content, val.Content...)
+		default:
+			dst.Content[j+1] = val
+		}
+	}
+}
+
+func indexKey(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func deleteKey(m *yaml.Node, key string) {
+	if i := indexKey(m, key); i >= 0 {
+		m.Content = slices.Delete(m.Content, i, i+2)
+	}
+}
+
+// annotate appends the fragment(s) behind the field a validation error names.
+// Errors about the case file's own values are returned unchanged.
+func (fr *fragments) annotate(root *yaml.Node, err error) error {
+	if len(fr.files) == 0 {
+		return err
+	}
+	field, _, _ := strings.Cut(err.Error(), ":")
+	field, _, _ = strings.Cut(field, " ")
+
+	var from []string
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		forEachAppended(root.Content[i].Value, root.Content[i+1], func(itemPath string, item *yaml.Node) {
+			if hasFieldPrefix(field, itemPath) {
+				from = []string{fr.items[item]}
+			}
+		})
+	}
+	if from == nil {
+		top, _, _ := strings.Cut(field, ".")
+		top, _, _ = strings.Cut(top, "[")
+		from = fr.keys[top]
+	}
+	var names []string
+	for _, f := range from {
+		if f != fr.root && f != "" {
+			names = append(names, fr.display(f))
+		}
+	}
+	if len(names) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (from %s)", err, strings.Join(names, ", "))
+}
+
+func hasFieldPrefix(field, prefix string) bool {
+	return field == prefix || strings.HasPrefix(field, prefix+".") || strings.HasPrefix(field, prefix+"[")
+}
+
+// display renders a fragment path relative to the case file's directory.
+func (fr *fragments) display(path string) string {
+	if fr.root == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(filepath.Dir(absPath(fr.root)), absPath(path)); err == nil {
+		return rel
+	}
+	return path
+}
+
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return filepath.Clean(p)
+}
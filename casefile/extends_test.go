@@ -0,0 +1,318 @@
+package casefile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeCaseFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for rel, body := range files {
+		p := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad_ExtendsMergesFragments(t *testing.T) {
+	dir := writeCaseFiles(t, map[string]string{
+		"fragments/baseline.yaml": `
+extends: [stack.yaml]
+seed:
+  vars:
+    svc: dice
+    route: /roll
+expected:
+  traces:
+    - traceql: '{ resource.service.name = "${vars.svc}" }'
+  metrics:
+    - promql: up
+      value: '== 1'
+`,
+		"fragments/stack.yaml": `
+fixture:
+  compose:
+    file: docker-compose.yml
+    env: [A=1]
+    app_service: app
+    app_port: 8080
+`,
+		"case.yaml": `
+extends: [fragments/baseline.yaml]
+name: dice rolls
+fixture:
+  compose:
+    env: [B=2]
+seed:
+  vars:
+    route: /rolldice
+input:
+  - path: ${vars.route}
+expected:
+  traces:
+    - traceql: '{ name = "GET ${vars.route}" }'
+`,
+	})
+	c, err := Load(filepath.Join(dir, "case.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.Fixture.Compose.File != filepath.Join("fragments", "docker-compose.yml") || c.Fixture.Compose.AppPort != 8080 {
+		t.Errorf("fixture keys from the nested fragment should survive: %+v", c.Fixture.Compose)
+	}
+	if env := strings.Join(c.Fixture.Compose.Env, ","); env != "B=2" {
+		t.Errorf("a list outside input/seed/expected is replaced: got %s", env)
+	}
+	if c.Seed.Vars["svc"] != "dice" || c.Seed.Vars["route"] != "/rolldice" {
+		t.Errorf("vars should merge with the case winning: %+v", c.Seed.Vars)
+	}
+	if len(c.Expected.Traces) != 2 || c.Expected.Traces[1].TraceQL != `{ name = "GET ${vars.route}" }` {
+		t.Errorf("traces should append fragment first: %+v", c.Expected.Traces)
+	}
+	if len(c.Expected.Metrics) != 1 {
+		t.Errorf("metrics from the fragment: %+v", c.Expected.Metrics)
+	}
+	want := []string{filepath.Join(dir, "fragments/stack.yaml"), filepath.Join(dir, "fragments/baseline.yaml")}
+	if strings.Join(c.Fragments, ",") != strings.Join(want, ",") {
+		t.Errorf("Fragments: got %v, want %v", c.Fragments, want)
+	}
+}
+
+func TestLoad_ExtendsAppendsSteps(t *testing.T) {
+	dir := writeCaseFiles(t, map[string]string{
+		"warmup.yaml": `
+steps:
+  - input:
+      path: /warmup
+  - sleep: 1s
+`,
+		"case.yaml": `
+extends: [warmup.yaml]
+name: steps
+steps:
+  - input:
+      path: /run
+  - expect:
+      traces:
+        - traceql: '{}'
+`,
+	})
+	c, err := Load(filepath.Join(dir, "case.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(c.Steps) != 4 || c.Steps[0].Input == nil || c.Steps[0].Input.Path != "/warmup" || c.Steps[2].Input == nil || c.Steps[2].Input.Path != "/run" {
+		t.Fatalf("steps should append fragment first: %+v", c.Steps)
+	}
+}
+
+func TestLoad_ExtendsResolvesPathsAgainstTheFragment(t *testing.T) {
+	dir := writeCaseFiles(t, map[string]string{
+		"shared/stack.yaml": `
+fixture:
+  k3d:
+    k8s_dir: k8s
+    app_service: app
+    app_docker_file: ../app/Dockerfile
+    app_docker_tag: app:dev
+    app_port: 8080
+input:
+  - grpc:
+      service: shop.Checkout
+      method: Pay
+      descriptor_set: /protos/checkout.protoset
+expected:
+  custom-checks:
+    - script: ./verify.sh
+    - script: ../cases/local.sh
+    - script: oats-check
+    - script: |
+        #!/bin/sh
+        ./not-a-path.sh
+`,
+		"cases/case.yaml": `
+extends: [../shared/stack.yaml]
+name: paths
+expected:
+  custom-checks:
+    - script: ./own.sh
+`,
+	})
+	c, err := Load(filepath.Join(dir, "cases/case.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	k := c.Fixture.K3D
+	if k.K8sDir != filepath.Join("..", "shared", "k8s") || k.AppDockerFile != filepath.Join("..", "app", "Dockerfile") {
+		t.Errorf("k3d paths should resolve against the fragment: %+v", k)
+	}
+	if got := c.Input[0].GRPC.DescriptorSet; got != "/protos/checkout.protoset" {
+		t.Errorf("absolute paths are kept: %s", got)
+	}
+	var scripts []string
+	for _, chk := range c.Expected.Custom {
+		scripts = append(scripts, chk.Script)
+	}
+	want := []string{filepath.Join("..", "shared", "verify.sh"), "./local.sh", "oats-check", "#!/bin/sh\n./not-a-path.sh\n", "./own.sh"}
+	if strings.Join(scripts, "|") != strings.Join(want, "|") {
+		t.Errorf("scripts: got %q, want %q", scripts, want)
+	}
+}
+
+func TestLoad_ExtendsResolvesDescriptorSetAgainstTheFragment(t *testing.T) {
+	dir := writeCaseFiles(t, map[string]string{
+		"protos/grpc.yaml": `
+input:
+  - grpc:
+      service: shop.Checkout
+      method: Pay
+      descriptor_set: checkout.protoset
+steps:
+  - input:
+      grpc:
+        service: shop.Checkout
+        method: Refund
+        descriptor_set: checkout.protoset
+`,
+		"case.yaml": `
+extends: [protos/grpc.yaml]
+name: grpc
+expected:
+  traces:
+    - traceql: '{}'
+`,
+	})
+	c, err := Load(filepath.Join(dir, "case.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := filepath.Join("protos", "checkout.protoset")
+	if got := c.Input[0].GRPC.DescriptorSet; got != want {
+		t.Errorf("input descriptor_set = %q, want %q", got, want)
+	}
+	if got := c.Steps[0].Input.GRPC.DescriptorSet; got != want {
+		t.Errorf("step descriptor_set = %q, want %q", got, want)
+	}
+}
+
+func TestLoad_ExtendsDiamondMergesSharedFragmentOnce(t *testing.T) {
+	dir := writeCaseFiles(t, map[string]string{
+		"stack.yaml": `
+input:
+  - path: /warmup
+expected:
+  metrics:
+    - promql: up
+      value: '== 1'
+`,
+		"traces.yaml": `
+extends: [stack.yaml]
+expected:
+  traces:
+    - traceql: '{}'
+`,
+		"logs.yaml": `
+extends: [stack.yaml]
+expected:
+  logs:
+    - logql: '{}'
+`,
+		"case.yaml": `
+extends: [traces.yaml, logs.yaml]
+name: diamond
+input:
+  - path: /run
+`,
+	})
+	c, err := Load(filepath.Join(dir, "case.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(c.Input) != 2 || c.Input[0].Path != "/warmup" || c.Input[1].Path != "/run" {
+		t.Errorf("the shared fragment's inputs should appear once: %+v", c.Input)
+	}
+	if len(c.Expected.Metrics) != 1 || len(c.Expected.Traces) != 1 || len(c.Expected.Logs) != 1 {
+		t.Errorf("each assertion should appear once: %+v", c.Expected)
+	}
+	want := []string{filepath.Join(dir, "stack.yaml"), filepath.Join(dir, "traces.yaml"), filepath.Join(dir, "logs.yaml")}
+	if strings.Join(c.Fragments, ",") != strings.Join(want, ",") {
+		t.Errorf("Fragments: got %v, want %v", c.Fragments, want)
+	}
+}
+
+func TestLoad_ExtendsErrorsNameTheFragment(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "invalid assertion from fragment",
+			files: map[string]string{
+				"base.yaml": "expected:\n  traces:\n    - traceql: '{}'\n      regex: '['\n",
+				"case.yaml": "extends: [base.yaml]\nname: c\nexpected:\n  logs:\n    - logql: '{}'\n",
+			},
+			want: `expected.traces[0].regex[0]: invalid regexp "[": ` + "error parsing regexp: missing closing ]: `[` (from base.yaml)",
+		},
+		{
+			name: "invalid fixture from fragment",
+			files: map[string]string{
+				"base.yaml": "fixture:\n  compose:\n    template: none\n",
+				"case.yaml": "extends: [base.yaml]\nname: c\nexpected:\n  logs:\n    - logql: '{}'\n",
+			},
+			want: `compose template=none requires file or files (from base.yaml)`,
+		},
+		{
+			name: "unknown key in fragment",
+			files: map[string]string{
+				"base.yaml": "expected:\n  trace: []\n",
+				"case.yaml": "extends: [base.yaml]\nname: c\nexpected:\n  logs:\n    - logql: '{}'\n",
+			},
+			want: "extends[0] base.yaml: yaml: unmarshal errors:\n  line 2: field trace not found",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"a.yaml":    "extends: [b.yaml]\n",
+				"b.yaml":    "extends: [a.yaml]\n",
+				"case.yaml": "extends: [a.yaml]\nname: c\nexpected:\n  logs:\n    - logql: '{}'\n",
+			},
+			want: "extends[0]: cycle case.yaml -> a.yaml -> b.yaml -> a.yaml",
+		},
+		{
+			name: "missing fragment",
+			files: map[string]string{
+				"case.yaml": "extends: [nope.yaml]\nname: c\nexpected:\n  logs:\n    - logql: '{}'\n",
+			},
+			want: "extends[0]: open",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := writeCaseFiles(t, tc.files)
+			_, err := Load(filepath.Join(dir, "case.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad_ExtendsCaseOwnErrorsUnannotated(t *testing.T) {
+	dir := writeCaseFiles(t, map[string]string{
+		"base.yaml": "expected:\n  logs:\n    - logql: '{}'\n",
+		"case.yaml": "extends: [base.yaml]\nname: c\nexpected:\n  logs:\n    - logql: ''\n",
+	})
+	_, err := Load(filepath.Join(dir, "case.yaml"))
+	if err == nil || !strings.HasSuffix(err.Error(), "expected.logs[1].logql: required, non-empty") {
+		t.Fatalf("expected an unannotated error for the case's own entry, got %v", err)
+	}
+}
@@ -0,0 +1,540 @@
+package casefile
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// refPattern matches a ${namespace.name} reference, or the $${ escape that
+// produces a literal "${". A "${" without a namespace-qualified name (such as
+// shell's ${HOME}) is not a reference and passes through untouched.
+var refPattern = regexp.MustCompile(`\$\$\{|\$\{([a-z]+)\.([A-Za-z0-9_.\-]+)\}`)
+
+// RunKeys lists the ${run.*} built-ins the runner provides. Validation rejects
+// any other run key, so a typo fails at load time instead of mid-run.
+var RunKeys = []string{"id"}
+
+// Scope supplies the values behind ${...} references for one case run:
+//
+//	${vars.x}    → seed.vars (nested maps via dots: ${vars.svc.name})
+//	${env.X}     → the OATS process environment
+//	${run.id}    → built-ins shared by every case in the run
+//	${case.name} → the case's own name
+//	${capture.x} → a value an earlier input or assertion captured
+//
+// Vars and case.* come from the Case itself; the caller provides the rest.
+// A capture missing from Captures has not been taken yet: its reference is
+// left as written, to be expanded by a later Interpolate.
+type Scope struct {
+	Env      func(string) (string, bool)
+	Run      map[string]string
+	Captures map[string]string
+}
+
+// Interpolate returns a copy of c with every ${...} reference expanded in the
+// fields that reach the stack: inline seed payloads, input requests, and every
+// assertion query and expectation string. Custom-check scripts are left alone
+// because they are shell, where ${...} already means something.
+func (c *Case) Interpolate(s Scope) (*Case, error) {
+	e := &expander{scope: s, vars: c.Seed.Vars, caseName: c.Name}
+	out := e.caseCopy(c)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return out, nil
+}
+
+// EnvReferences returns the sorted, de-duplicated ${env.*} names the case
+// reads. The runner folds their current values into the cache key so a changed
+// environment is not masked by a stale green record.
+func (c *Case) EnvReferences() []string {
+	seen := map[string]struct{}{}
+	s := Scope{
+		Env: func(name string) (string, bool) {
+			seen[name] = struct{}{}
+			return "", true
+		},
+		Run: placeholderRun(),
+	}
+	e := &expander{scope: s, vars: c.Seed.Vars, caseName: c.Name, lenient: true}
+	e.caseCopy(c)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CaptureRefs returns the sorted, de-duplicated ${capture.*} names read by
+// the step at path, such as "input[1]" or "expected.traces[0]". The runner
+// checks they were all captured before running the step.
+func (c *Case) CaptureRefs(path string) []string {
+	s := Scope{
+		Env: func(string) (string, bool) { return "", true },
+		Run: placeholderRun(),
+	}
+	e := &expander{scope: s, vars: c.Seed.Vars, caseName: c.Name, lenient: true, refPath: path, refs: map[string]struct{}{}}
+	e.caseCopy(c)
+	names := make([]string, 0, len(e.refs))
+	for name := range e.refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateReferences checks every reference without a live environment or
+// run: vars and namespaces must resolve, env is assumed to.
+func (c *Case) validateReferences() error {
+	s := Scope{
+		Env: func(string) (string, bool) { return "", true },
+		Run: placeholderRun(),
+	}
+	_, err := c.Interpolate(s)
+	return err
+}
+
+func placeholderRun() map[string]string {
+	run := make(map[string]string, len(RunKeys))
+	for _, k := range RunKeys {
+		run[k] = ""
+	}
+	return run
+}
+
+type expander struct {
+	scope    Scope
+	vars     map[string]any
+	caseName string
+	// lenient keeps walking past errors; used when only collecting references.
+	lenient bool
+	err     error
+
+	// captured maps each capture name to the step that declares it, filled
+	// in as caseCopy walks the steps in the order the runner runs them.
+	captured map[string]string
+	// path is the field being expanded. When refs is set, the capture names
+	// read by fields under refPath are collected into it.
+	path    string
+	refPath string
+	refs    map[string]struct{}
+}
+
+// str expands one field. The first error wins and is prefixed with the yaml
+// path of the field that carried the reference.
+func (e *expander) str(path, text string) string {
+	if e.err != nil && !e.lenient {
+		return text
+	}
+	e.path = path
+	out, err := e.expand(text)
+	if err != nil && e.err == nil {
+		e.err = fmt.Errorf("%s: %w", path, err)
+	}
+	return out
+}
+
+func (e *expander) expand(text string) (string, error) {
+	if !strings.Contains(text, "${") {
+		return text, nil
+	}
+	var firstErr error
+	out := refPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		m := refPattern.FindStringSubmatch(ref)
+		v, err := e.resolve(m[1], m[2])
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", ref, err)
+			}
+			return ref
+		}
+		return v
+	})
+	return out, firstErr
+}
+
+func (e *expander) resolve(namespace, name string) (string, error) {
+	switch namespace {
+	case "vars":
+		return lookupVar(e.vars, name)
+	case "env":
+		if e.scope.Env == nil {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		v, ok := e.scope.Env(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	case "run":
+		v, ok := e.scope.Run[name]
+		if !ok {
+			return "", fmt.Errorf("unknown run key %q (expected one of %s)", name, strings.Join(RunKeys, ", "))
+		}
+		return v, nil
+	case "case":
+		if name != "name" {
+			return "", fmt.Errorf("unknown case key %q (expected name)", name)
+		}
+		return e.caseName, nil
+	case "capture":
+		if _, ok := e.captured[name]; !ok {
+			return "", fmt.Errorf("capture %q is not set by an earlier input or assertion", name)
+		}
+		if e.refs != nil && (e.path == e.refPath || strings.HasPrefix(e.path, e.refPath+".")) {
+			e.refs[name] = struct{}{}
+		}
+		if v, ok := e.scope.Captures[name]; ok {
+			return v, nil
+		}
+		return "${capture." + name + "}", nil
+	default:
+		return "", fmt.Errorf("unknown namespace %q (expected vars, env, run, case, or capture)", namespace)
+	}
+}
+
+// declare records the captures the step at path takes, for the steps after
+// it. A name may only be captured once per case.
+func (e *expander) declare(path string, names []string) {
+	if e.captured == nil {
+		e.captured = map[string]string{}
+	}
+	for _, name := range names {
+		if prev, ok := e.captured[name]; ok {
+			if e.err == nil {
+				e.err = fmt.Errorf("%s.capture.%s: already captured by %s", path, name, prev)
+			}
+			continue
+		}
+		e.captured[name] = path
+	}
+}
+
+// lookupVar walks seed.vars along a dotted path. The final value must be a
+// scalar; a map or list has no single string form to splice into a query.
+func lookupVar(vars map[string]any, name string) (string, error) {
+	var cur any = vars
+	for _, part := range strings.Split(name, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("undefined variable %q", name)
+		}
+		cur, ok = m[part]
+		if !ok {
+			return "", fmt.Errorf("undefined variable %q", name)
+		}
+	}
+	switch cur.(type) {
+	case map[string]any, []any:
+		return "", fmt.Errorf("variable %q is not a scalar", name)
+	case nil:
+		return "", nil
+	}
+	return fmt.Sprint(cur), nil
+}
+
+// caseCopy copies c, expanding each interpolated field. Slices and maps that
+// carry expanded strings are copied so the loaded case stays untouched.
+// Inputs, steps and assertions are walked in the order the runner runs them,
+// so a capture is visible only to the steps after the one that takes it.
+func (e *expander) caseCopy(c *Case) *Case {
+	out := *c
+
+	out.Seed.Traces = make([]SeedTrace, len(c.Seed.Traces))
+	for i, tr := range c.Seed.Traces {
+		path := fmt.Sprintf("seed.traces[%d]", i)
+		tr.Service = e.str(path+".service", tr.Service)
+		spans := make([]SeedSpan, len(tr.Spans))
+		for j, sp := range tr.Spans {
+			sp.Name = e.str(fmt.Sprintf("%s.spans[%d].name", path, j), sp.Name)
+			spans[j] = sp
+		}
+		tr.Spans = spans
+		out.Seed.Traces[i] = tr
+	}
+	out.Seed.Logs = make([]SeedLog, len(c.Seed.Logs))
+	for i, l := range c.Seed.Logs {
+		path := fmt.Sprintf("seed.logs[%d]", i)
+		l.Service = e.str(path+".service", l.Service)
+		l.Body = e.str(path+".body", l.Body)
+		l.SeverityText = e.str(path+".severity_text", l.SeverityText)
+		out.Seed.Logs[i] = l
+	}
+	out.Seed.Metrics = make([]SeedMetric, len(c.Seed.Metrics))
+	for i, m := range c.Seed.Metrics {
+		path := fmt.Sprintf("seed.metrics[%d]", i)
+		m.Service = e.str(path+".service", m.Service)
+		m.Name = e.str(path+".name", m.Name)
+		out.Seed.Metrics[i] = m
+	}
+
+	out.Input = make([]Input, len(c.Input))
+	for i, in := range c.Input {
+		path := fmt.Sprintf("input[%d]", i)
+		out.Input[i] = e.input(path, in)
+		e.declare(path, in.CaptureNames())
+	}
+
+	if c.Steps != nil {
+		out.Steps = make([]Step, len(c.Steps))
+		for i, st := range c.Steps {
+			path := fmt.Sprintf("steps[%d]", i)
+			if st.Input != nil {
+				in := e.input(path+".input", *st.Input)
+				st.Input = &in
+				e.declare(path+".input", in.CaptureNames())
+			}
+			if st.Expect != nil {
+				exp := e.expected(path+".expect", *st.Expect)
+				st.Expect = &exp
+			}
+			out.Steps[i] = st
+		}
+	}
+	out.Expected = e.expected("expected", c.Expected)
+	return &out
+}
+
+// expected copies the expected block at prefix, declaring captures in the
+// order its assertions run.
+func (e *expander) expected(prefix string, exp Expected) Expected {
+	out := exp
+	out.Traces = make([]TraceAssertion, len(exp.Traces))
+	for i, a := range exp.Traces {
+		path := fmt.Sprintf("%s.traces[%d]", prefix, i)
+		a.TraceQL = e.str(path+".traceql", a.TraceQL)
+		a.MatchSpans = e.matchEntries(path+".match_spans", a.MatchSpans)
+		a.Tree = e.spanTree(path+".tree", a.Tree)
+		a.AssertionCommon = e.common(path, a.AssertionCommon)
+		out.Traces[i] = a
+		e.declare(path, slices.Sorted(maps.Keys(a.Capture)))
+	}
+	out.Logs = make([]LogAssertion, len(exp.Logs))
+	for i, a := range exp.Logs {
+		path := fmt.Sprintf("%s.logs[%d]", prefix, i)
+		a.LogQL = e.str(path+".logql", a.LogQL)
+		a.AssertionCommon = e.common(path, a.AssertionCommon)
+		out.Logs[i] = a
+		e.declare(path, slices.Sorted(maps.Keys(a.Capture)))
+	}
+	out.Metrics = make([]MetricAssertion, len(exp.Metrics))
+	for i, a := range exp.Metrics {
+		path := fmt.Sprintf("%s.metrics[%d]", prefix, i)
+		a.PromQL = e.str(path+".promql", a.PromQL)
+		if a.Metadata != nil {
+			md := *a.Metadata
+			md.Description = e.optStr(path+".metadata.description", md.Description)
+			a.Metadata = &md
+		}
+		a.AssertionCommon = e.common(path, a.AssertionCommon)
+		out.Metrics[i] = a
+		e.declare(path, slices.Sorted(maps.Keys(a.Capture)))
+	}
+	out.Profiles = make([]ProfileAssertion, len(exp.Profiles))
+	for i, a := range exp.Profiles {
+		path := fmt.Sprintf("%s.profiles[%d]", prefix, i)
+		a.Query = e.str(path+".query", a.Query)
+		a.AssertionCommon = e.common(path, a.AssertionCommon)
+		out.Profiles[i] = a
+		e.declare(path, slices.Sorted(maps.Keys(a.Capture)))
+	}
+	out.Correlate = make([]Correlation, len(exp.Correlate))
+	for i, a := range exp.Correlate {
+		path := fmt.Sprintf("%s.correlate[%d]", prefix, i)
+		a.From.LogQL = e.str(path+".from.logql", a.From.LogQL)
+		a.From.TraceQL = e.str(path+".from.traceql", a.From.TraceQL)
+		a.From.Exemplars = e.str(path+".from.exemplars", a.From.Exemplars)
+		a.From.Match = e.matchEntries(path+".from.match", a.From.Match)
+		a.To.TraceQL = e.str(path+".to.traceql", a.To.TraceQL)
+		a.To.Profiles = e.str(path+".to.profiles", a.To.Profiles)
+		a.To.MatchSpans = e.matchEntries(path+".to.match_spans", a.To.MatchSpans)
+		out.Correlate[i] = a
+	}
+	out.ComposeLogs = e.strings(prefix+".compose-logs", exp.ComposeLogs)
+	return out
+}
+
+func (e *expander) input(path string, in Input) Input {
+	in.Scheme = e.str(path+".scheme", in.Scheme)
+	in.Host = e.str(path+".host", in.Host)
+	in.Method = e.str(path+".method", in.Method)
+	in.Path = e.str(path+".path", in.Path)
+	in.Body = e.str(path+".body", in.Body)
+	in.Status = e.str(path+".status", in.Status)
+	in.Rate = e.str(path+".rate", in.Rate)
+	if in.Headers != nil {
+		headers := maps.Clone(in.Headers)
+		for k, v := range headers {
+			headers[k] = e.str(fmt.Sprintf("%s.headers.%s", path, k), v)
+		}
+		in.Headers = headers
+	}
+	if in.ExpectHeaders != nil {
+		headers := maps.Clone(in.ExpectHeaders)
+		for k, v := range headers {
+			headers[k] = e.str(fmt.Sprintf("%s.expect_headers.%s", path, k), v)
+		}
+		in.ExpectHeaders = headers
+	}
+	if in.ExpectBody != nil {
+		eb := *in.ExpectBody
+		eb.Contains = e.strings(path+".expect_body.contains", eb.Contains)
+		eb.Regex = e.strings(path+".expect_body.regex", eb.Regex)
+		if eb.JSON != nil {
+			values := maps.Clone(eb.JSON)
+			for k, v := range values {
+				values[k] = e.str(fmt.Sprintf("%s.expect_body.json.%s", path, k), v)
+			}
+			eb.JSON = values
+		}
+		in.ExpectBody = &eb
+	}
+	if in.TraceContext != nil && in.TraceContext.Baggage != nil {
+		tc := *in.TraceContext
+		tc.Baggage = maps.Clone(tc.Baggage)
+		for k, v := range tc.Baggage {
+			tc.Baggage[k] = e.str(fmt.Sprintf("%s.trace_context.baggage.%s", path, k), v)
+		}
+		in.TraceContext = &tc
+	}
+	if in.GRPC != nil {
+		g := *in.GRPC
+		g.Service = e.str(path+".grpc.service", g.Service)
+		g.Method = e.str(path+".grpc.method", g.Method)
+		g.Request = e.str(path+".grpc.request", g.Request)
+		g.Status = e.str(path+".grpc.status", g.Status)
+		if g.Metadata != nil {
+			md := maps.Clone(g.Metadata)
+			for k, v := range md {
+				md[k] = e.str(fmt.Sprintf("%s.grpc.metadata.%s", path, k), v)
+			}
+			g.Metadata = md
+		}
+		in.GRPC = &g
+	}
+	if in.Compose != nil {
+		compose := *in.Compose
+		compose.Command = e.strings(path+".compose.command", compose.Command)
+		compose.Contains = e.strings(path+".compose.contains", compose.Contains)
+		compose.Regex = e.strings(path+".compose.regex", compose.Regex)
+		in.Compose = &compose
+	}
+	if in.Kubernetes != nil {
+		k := *in.Kubernetes
+		k.Deployment = e.str(path+".kubernetes.deployment", k.Deployment)
+		k.Selector = e.str(path+".kubernetes.selector", k.Selector)
+		k.Container = e.str(path+".kubernetes.container", k.Container)
+		k.Image = e.str(path+".kubernetes.image", k.Image)
+		k.Command = e.strings(path+".kubernetes.command", k.Command)
+		k.Contains = e.strings(path+".kubernetes.contains", k.Contains)
+		k.Regex = e.strings(path+".kubernetes.regex", k.Regex)
+		in.Kubernetes = &k
+	}
+	return in
+}
+
+func (e *expander) common(path string, a AssertionCommon) AssertionCommon {
+	a.Contains = e.strings(path+".contains", a.Contains)
+	a.NotContains = e.strings(path+".not_contains", a.NotContains)
+	a.Regex = e.strings(path+".regex", a.Regex)
+	a.Match = e.matchEntries(path+".match", a.Match)
+	a.TraceID = e.str(path+".trace_id", a.TraceID)
+	return a
+}
+
+func (e *expander) matchEntries(path string, entries []MatchEntry) []MatchEntry {
+	if entries == nil {
+		return nil
+	}
+	out := make([]MatchEntry, len(entries))
+	for i, m := range entries {
+		out[i] = e.matchEntry(fmt.Sprintf("%s[%d]", path, i), m)
+	}
+	return out
+}
+
+func (e *expander) matchEntry(path string, m MatchEntry) MatchEntry {
+	m.Name = e.optStr(path+".name", m.Name)
+	m.Attributes = e.attributes(path, m.Attributes)
+	m.IgnoreAttributes = e.strings(path+".ignore_attributes", m.IgnoreAttributes)
+	m.StatusMessage = e.optStr(path+".status_message", m.StatusMessage)
+	if m.Events != nil {
+		events := make([]SpanEvent, len(m.Events))
+		for j, ev := range m.Events {
+			evPath := fmt.Sprintf("%s.events[%d]", path, j)
+			ev.Name = e.optStr(evPath+".name", ev.Name)
+			ev.Attributes = e.attributes(evPath, ev.Attributes)
+			events[j] = ev
+		}
+		m.Events = events
+	}
+	if m.Links != nil {
+		links := make([]SpanLink, len(m.Links))
+		for j, link := range m.Links {
+			linkPath := fmt.Sprintf("%s.links[%d]", path, j)
+			link.TraceID = e.str(linkPath+".trace_id", link.TraceID)
+			link.SpanID = e.str(linkPath+".span_id", link.SpanID)
+			link.Attributes = e.attributes(linkPath, link.Attributes)
+			links[j] = link
+		}
+		m.Links = links
+	}
+	return m
+}
+
+func (e *expander) attributes(path string, attrs AttributeMatchers) AttributeMatchers {
+	if attrs == nil {
+		return nil
+	}
+	out := make(AttributeMatchers, len(attrs))
+	for j, attr := range attrs {
+		attrPath := fmt.Sprintf("%s.attributes[%d]", path, j)
+		attr.Value = e.optStr(attrPath+".value", attr.Value)
+		attr.NotEquals = e.optStr(attrPath+".not_equals", attr.NotEquals)
+		attr.OneOf = e.strings(attrPath+".one_of", attr.OneOf)
+		out[j] = attr
+	}
+	return out
+}
+
+func (e *expander) optStr(path string, s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := e.str(path, *s)
+	return &v
+}
+
+func (e *expander) spanTree(path string, nodes []SpanTree) []SpanTree {
+	if nodes == nil {
+		return nil
+	}
+	out := make([]SpanTree, len(nodes))
+	for i, n := range nodes {
+		nodePath := fmt.Sprintf("%s[%d]", path, i)
+		n.MatchEntry = e.matchEntry(nodePath, n.MatchEntry)
+		n.Children = e.spanTree(nodePath+".children", n.Children)
+		n.Descendants = e.spanTree(nodePath+".descendants", n.Descendants)
+		out[i] = n
+	}
+	return out
+}
+
+func (e *expander) strings(path string, list []string) []string {
+	if list == nil {
+		return nil
+	}
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = e.str(fmt.Sprintf("%s[%d]", path, i), s)
+	}
+	return out
+}
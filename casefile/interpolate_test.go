@@ -0,0 +1,240 @@
+package casefile
+
+import (
+	"strings"
+	"testing"
+)
+
+const interpolateCase = `
+name: checkout emits spans
+seed:
+  type: inline-otlp
+  vars:
+    svc: checkout
+    route: /cart
+    db:
+      system: postgresql
+  traces:
+    - service: ${vars.svc}-${run.id}
+      spans:
+        - name: GET ${vars.route}
+input:
+  - path: ${vars.route}?user=${env.OATS_TEST_USER}
+    headers:
+      X-Case: ${case.name}
+    body: '{"svc":"${vars.svc}"}'
+expected:
+  traces:
+    - traceql: '{ resource.service.name = "${vars.svc}-${run.id}" }'
+      contains: ["GET ${vars.route}"]
+      match:
+        - name: GET ${vars.route}
+          attributes:
+            db.system: ${vars.db.system}
+  logs:
+    - logql: '{service_name="${vars.svc}"} |= "$${literal}"'
+  custom-checks:
+    - script: echo ${HOME} ${vars.svc}
+`
+
+func TestInterpolate_ExpandsAcrossCase(t *testing.T) {
+	c, err := Parse([]byte(interpolateCase))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	env := map[string]string{"OATS_TEST_USER": "alice"}
+	got, err := c.Interpolate(Scope{
+		Env: func(k string) (string, bool) { v, ok := env[k]; return v, ok },
+		Run: map[string]string{"id": "r1"},
+	})
+	if err != nil {
+		t.Fatalf("Interpolate: %v", err)
+	}
+
+	if s := got.Seed.Traces[0].Service; s != "checkout-r1" {
+		t.Errorf("seed service: got %q", s)
+	}
+	if s := got.Seed.Traces[0].Spans[0].Name; s != "GET /cart" {
+		t.Errorf("seed span: got %q", s)
+	}
+	if s := got.Input[0].Path; s != "/cart?user=alice" {
+		t.Errorf("input path: got %q", s)
+	}
+	if s := got.Input[0].Headers["X-Case"]; s != "checkout emits spans" {
+		t.Errorf("input header: got %q", s)
+	}
+	if s := got.Input[0].Body; s != `{"svc":"checkout"}` {
+		t.Errorf("input body: got %q", s)
+	}
+	tr := got.Expected.Traces[0]
+	if tr.TraceQL != `{ resource.service.name = "checkout-r1" }` {
+		t.Errorf("traceql: got %q", tr.TraceQL)
+	}
+	if tr.Contains[0] != "GET /cart" || *tr.Match[0].Name != "GET /cart" {
+		t.Errorf("trace expectations: %+v", tr)
+	}
+	if v := *tr.Match[0].Attributes[0].Value; v != "postgresql" {
+		t.Errorf("nested var: got %q", v)
+	}
+	if q := got.Expected.Logs[0].LogQL; q != `{service_name="checkout"} |= "${literal}"` {
+		t.Errorf("logql: got %q", q)
+	}
+	if s := got.Expected.Custom[0].Script; s != "echo ${HOME} ${vars.svc}" {
+		t.Errorf("custom-check script must not be expanded: got %q", s)
+	}
+
+	// The loaded case stays untouched so it can be expanded again per run.
+	if c.Seed.Traces[0].Service != "${vars.svc}-${run.id}" || *c.Expected.Traces[0].Match[0].Name != "GET ${vars.route}" {
+		t.Errorf("Interpolate mutated the source case")
+	}
+}
+
+func TestInterpolate_MissingEnv(t *testing.T) {
+	c, err := Parse([]byte(interpolateCase))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	_, err = c.Interpolate(Scope{
+		Env: func(string) (string, bool) { return "", false },
+		Run: map[string]string{"id": "r1"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "input[0].path: ${env.OATS_TEST_USER}: environment variable OATS_TEST_USER is not set") {
+		t.Fatalf("expected missing env error, got %v", err)
+	}
+}
+
+func TestValidate_RejectsBadReferences(t *testing.T) {
+	cases := []struct {
+		name, traceql, want string
+	}{
+		{"undefined var", `{ name = "${vars.nope}" }`, `expected.traces[0].traceql: ${vars.nope}: undefined variable "nope"`},
+		{"non-scalar var", `{ name = "${vars.db}" }`, `variable "db" is not a scalar`},
+		{"unknown namespace", `{ name = "${seed.svc}" }`, `unknown namespace "seed"`},
+		{"unknown run key", `{ name = "${run.start}" }`, `unknown run key "start"`},
+		{"unknown case key", `{ name = "${case.tags}" }`, `unknown case key "tags"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte(`
+name: bad refs
+seed:
+  vars:
+    db: {system: postgresql}
+expected:
+  traces:
+    - traceql: '` + tc.traceql + `'
+`))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestValidate_RejectsBadCaptureReferences(t *testing.T) {
+	cases := []struct {
+		name, src, want string
+	}{
+		{"never captured", `
+input:
+  - path: /a
+expected:
+  traces:
+    - traceql: '{ trace:id = "${capture.trace_id}" }'
+`, `expected.traces[0].traceql: ${capture.trace_id}: capture "trace_id" is not set by an earlier input or assertion`},
+		{"captured later", `
+input:
+  - path: /a/${capture.order_id}
+  - path: /b
+    capture:
+      order_id: {json: id}
+expected:
+  traces:
+    - traceql: '{}'
+`, `input[0].path: ${capture.order_id}: capture "order_id" is not set by an earlier input or assertion`},
+		{"captured twice", `
+input:
+  - path: /a
+    capture:
+      id: {json: id}
+  - path: /b
+    capture:
+      id: {json: id}
+expected:
+  traces:
+    - traceql: '{}'
+`, `input[1].capture.id: already captured by input[0]`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte("name: bad captures\n" + tc.src))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestInterpolate_DefersCaptures(t *testing.T) {
+	c, err := Parse([]byte(`
+name: captures
+input:
+  - path: /checkout
+    capture:
+      trace_id: {header: traceparent, regex: '^00-([0-9a-f]{32})-'}
+expected:
+  traces:
+    - traceql: '{ trace:id = "${capture.trace_id}" }'
+  logs:
+    - logql: '{service_name="cart"}'
+      contains: $${capture.literal}
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	scope := Scope{Env: func(string) (string, bool) { return "", true }, Run: map[string]string{"id": "r1"}}
+	before, err := c.Interpolate(scope)
+	if err != nil {
+		t.Fatalf("Interpolate: %v", err)
+	}
+	if got := before.Expected.Traces[0].TraceQL; got != `{ trace:id = "${capture.trace_id}" }` {
+		t.Errorf("before capture: got %q", got)
+	}
+	scope.Captures = map[string]string{"trace_id": "4bf92f35"}
+	after, err := c.Interpolate(scope)
+	if err != nil {
+		t.Fatalf("Interpolate: %v", err)
+	}
+	if got := after.Expected.Traces[0].TraceQL; got != `{ trace:id = "4bf92f35" }` {
+		t.Errorf("after capture: got %q", got)
+	}
+	if got := after.Expected.Logs[0].Contains[0]; got != "${capture.literal}" {
+		t.Errorf("escaped reference: got %q", got)
+	}
+	if got := strings.Join(c.CaptureRefs("expected.traces[0]"), ","); got != "trace_id" {
+		t.Errorf("CaptureRefs(expected.traces[0]): got %q", got)
+	}
+	if got := c.CaptureRefs("expected.logs[0]"); len(got) != 0 {
+		t.Errorf("CaptureRefs(expected.logs[0]): got %q", got)
+	}
+}
+
+func TestEnvReferences(t *testing.T) {
+	c, err := Parse([]byte(`
+name: env refs
+input:
+  - path: /${env.B_PATH}
+    headers:
+      Authorization: Bearer ${env.A_TOKEN}
+expected:
+  metrics:
+    - promql: 'up{job="${env.B_PATH}"}'
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got := strings.Join(c.EnvReferences(), ",")
+	if got != "A_TOKEN,B_PATH" {
+		t.Fatalf("EnvReferences: got %q", got)
+	}
+}
@@ -0,0 +1,264 @@
+package casefile
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// MatrixVariant is one row of a case's matrix: block. Each variant runs the
+// case once, against the case fixture overlaid with the variant's fixture, and
+// with the variant's vars layered over seed.vars. Assertions and custom checks
+// opt into a subset of variants with when:.
+type MatrixVariant struct {
+	Name    string         `yaml:"name"`
+	Fixture *FixtureConfig `yaml:"fixture,omitempty"`
+	Vars    map[string]any `yaml:"vars,omitempty"`
+}
+
+// Expand returns one case per matrix variant, or c itself when it declares no
+// matrix. A variant case is named "name[variant]", carries the merged fixture
+// and vars, and keeps only the assertions whose when: matches the variant. The
+// result has no matrix or when: left, so it validates and runs like any other
+// case.
+func (c *Case) Expand() ([]*Case, error) {
+	if len(c.Matrix) == 0 {
+		return []*Case{c}, nil
+	}
+	if err := c.Expected.validateWhen(); err != nil {
+		return nil, err
+	}
+	out := make([]*Case, 0, len(c.Matrix))
+	for i, v := range c.Matrix {
+		vc, err := c.withVariant(v)
+		if err != nil {
+			return nil, fmt.Errorf("matrix[%d].fixture: %w", i, err)
+		}
+		vc.Expected = c.Expected.forVariant(v.Name)
+		out = append(out, vc)
+	}
+	return out, nil
+}
+
+// validateMatrix checks the matrix declaration, then validates the case as each
+// variant sees it. Assertion indices in errors refer to the case file, not to
+// the filtered variant.
+func (c *Case) validateMatrix() error {
+	seen := map[string]bool{}
+	for i, v := range c.Matrix {
+		if strings.TrimSpace(v.Name) == "" {
+			return fmt.Errorf("matrix[%d].name: required, non-empty", i)
+		}
+		if strings.ContainsAny(v.Name, "[]") {
+			return fmt.Errorf("matrix[%d].name: must not contain brackets", i)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("matrix[%d].name: duplicate variant %q", i, v.Name)
+		}
+		seen[v.Name] = true
+	}
+	if err := c.Expected.validateWhen(); err != nil {
+		return err
+	}
+	for i, v := range c.Matrix {
+		vc, err := c.withVariant(v)
+		if err != nil {
+			return fmt.Errorf("matrix[%d].fixture: %w", i, err)
+		}
+		if err := vc.validate(); err != nil {
+			return fmt.Errorf("matrix[%d] %q: %w", i, v.Name, err)
+		}
+		if !c.Expected.forVariant(v.Name).HasAssertions() && !c.hasStepAssertions() {
+			return fmt.Errorf("matrix[%d] %q: no assertion applies to this variant", i, v.Name)
+		}
+	}
+	return nil
+}
+
+// withVariant returns a copy of c with v's fixture and vars applied. The copy
+// keeps every assertion; Expand filters them by when:.
+func (c *Case) withVariant(v MatrixVariant) (*Case, error) {
+	fx, err := overlayFixture(c.Fixture, v.Fixture)
+	if err != nil {
+		return nil, err
+	}
+	out := *c
+	out.Name = fmt.Sprintf("%s[%s]", c.Name, v.Name)
+	out.Variant = v.Name
+	out.Matrix = nil
+	out.Fixture = fx
+	if len(v.Vars) > 0 {
+		vars := maps.Clone(c.Seed.Vars)
+		if vars == nil {
+			vars = map[string]any{}
+		}
+		maps.Copy(vars, v.Vars)
+		out.Seed.Vars = vars
+	}
+	return &out, nil
+}
+
+// overlayFixture layers a variant fixture over the case fixture. Fields the
+// variant sets replace the case's; compose env merges by variable name, the
+// variant winning. Either side may be nil, but both must be the same kind.
+func overlayFixture(base, over *FixtureConfig) (*FixtureConfig, error) {
+	if over == nil {
+		return base, nil
+	}
+	if base == nil {
+		cp := *over
+		return &cp, nil
+	}
+	if base.Kind() != over.Kind() {
+		return nil, fmt.Errorf("a %s variant cannot overlay a %s fixture", over.Kind(), base.Kind())
+	}
+	out := FixtureConfig{}
+	switch {
+	case over.Compose != nil:
+		cp := *base.Compose
+		o := over.Compose
+		if o.Template != "" {
+			cp.Template = o.Template
+		}
+		if o.File != "" || len(o.Files) > 0 {
+			cp.File, cp.Files = o.File, o.Files
+		}
+		cp.Env = mergeEnv(cp.Env, o.Env)
+		if o.AppService != "" {
+			cp.AppService = o.AppService
+		}
+		if o.AppPort != 0 {
+			cp.AppPort = o.AppPort
+		}
+		cp.InjectRunID = cp.InjectRunID || o.InjectRunID
+		out.Compose = &cp
+	case over.K3D != nil:
+		cp := *base.K3D
+		o := over.K3D
+		for _, f := range []struct{ dst, src *string }{
+			{&cp.K8sDir, &o.K8sDir},
+			{&cp.AppService, &o.AppService},
+			{&cp.AppDockerFile, &o.AppDockerFile},
+			{&cp.AppDockerContext, &o.AppDockerContext},
+			{&cp.AppDockerTag, &o.AppDockerTag},
+		} {
+			if *f.src != "" {
+				*f.dst = *f.src
+			}
+		}
+		if o.AppPort != 0 {
+			cp.AppPort = o.AppPort
+		}
+		if o.ImportImages != nil {
+			cp.ImportImages = o.ImportImages
+		}
+		if o.PoolSize != 0 {
+			cp.PoolSize = o.PoolSize
+		}
+		cp.InjectRunID = cp.InjectRunID || o.InjectRunID
+		out.K3D = &cp
+	case over.Remote != nil:
+		cp := *base.Remote
+		if over.Remote.Endpoint != "" {
+			cp.Endpoint = over.Remote.Endpoint
+		}
+		out.Remote = &cp
+	}
+	return &out, nil
+}
+
+// mergeEnv appends over to base, replacing any base entry that sets the same
+// variable so each name appears once.
+func mergeEnv(base, over []string) []string {
+	if len(over) == 0 {
+		return base
+	}
+	out := slices.Clone(base)
+	for _, kv := range over {
+		name, _, _ := strings.Cut(kv, "=")
+		out = slices.DeleteFunc(out, func(e string) bool {
+			n, _, _ := strings.Cut(e, "=")
+			return n == name
+		})
+		out = append(out, kv)
+	}
+	return out
+}
+
+// forVariant returns the expectations that apply to variant, with when:
+// cleared. A when: is a regexp matched against the variant name, the same
+// rule the legacy matrix-condition used.
+func (e Expected) forVariant(variant string) Expected {
+	out := e
+	out.Traces = filterWhen(e.Traces, variant, func(a *TraceAssertion) *string { return &a.When })
+	out.Logs = filterWhen(e.Logs, variant, func(a *LogAssertion) *string { return &a.When })
+	out.Metrics = filterWhen(e.Metrics, variant, func(a *MetricAssertion) *string { return &a.When })
+	out.Profiles = filterWhen(e.Profiles, variant, func(a *ProfileAssertion) *string { return &a.When })
+	out.Custom = filterWhen(e.Custom, variant, func(a *CustomCheck) *string { return &a.When })
+	out.Correlate = filterWhen(e.Correlate, variant, func(a *Correlation) *string { return &a.When })
+	return out
+}
+
+func filterWhen[T any](list []T, variant string, when func(*T) *string) []T {
+	if list == nil {
+		return nil
+	}
+	var out []T
+	for _, a := range list {
+		w := when(&a)
+		if *w != "" && !regexp.MustCompile(*w).MatchString(variant) {
+			continue
+		}
+		*w = ""
+		out = append(out, a)
+	}
+	return out
+}
+
+// HasAssertions reports whether the block holds anything to check.
+func (e Expected) HasAssertions() bool {
+	return len(e.Traces)+len(e.Metrics)+len(e.Logs)+len(e.Profiles)+len(e.Custom)+len(e.Correlate) > 0
+}
+
+type whenClause struct{ path, when string }
+
+// whenClauses lists every when: in the expected block at path, each with its
+// yaml path.
+func (e Expected) whenClauses(path string) []whenClause {
+	var out []whenClause
+	add := func(path, when string) {
+		if when != "" {
+			out = append(out, whenClause{path, when})
+		}
+	}
+	for i, a := range e.Traces {
+		add(fmt.Sprintf("%s.traces[%d].when", path, i), a.When)
+	}
+	for i, a := range e.Logs {
+		add(fmt.Sprintf("%s.logs[%d].when", path, i), a.When)
+	}
+	for i, a := range e.Metrics {
+		add(fmt.Sprintf("%s.metrics[%d].when", path, i), a.When)
+	}
+	for i, a := range e.Profiles {
+		add(fmt.Sprintf("%s.profiles[%d].when", path, i), a.When)
+	}
+	for i, a := range e.Custom {
+		add(fmt.Sprintf("%s.custom-checks[%d].when", path, i), a.When)
+	}
+	for i, a := range e.Correlate {
+		add(fmt.Sprintf("%s.correlate[%d].when", path, i), a.When)
+	}
+	return out
+}
+
+func (e Expected) validateWhen() error {
+	for _, w := range e.whenClauses("expected") {
+		if _, err := regexp.Compile(w.when); err != nil {
+			return fmt.Errorf("%s: invalid regexp %q: %v", w.path, w.when, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package casefile
+
+import (
+	"strings"
+	"testing"
+)
+
+const matrixCase = `
+name: dice
+fixture:
+  compose:
+    files: [docker-compose.yml]
+    env: [COLLECTOR=default, SDK_VERSION=0]
+    app_service: app
+    app_port: 8080
+seed:
+  vars:
+    svc: dice
+matrix:
+  - name: sdk-1
+    fixture:
+      compose:
+        env: [SDK_VERSION=1.40]
+    vars:
+      span: roll
+  - name: sdk-2
+    fixture:
+      compose:
+        files: [docker-compose.yml, collector-v2.yml]
+    vars:
+      span: rollTheDice
+expected:
+  traces:
+    - traceql: '{ name = "${vars.span}" }'
+      contains: ["${case.name}"]
+    - traceql: '{ resource.service.name = "${vars.svc}" }'
+      when: ^sdk-2$
+  custom-checks:
+    - script: ./v1-only.sh
+      when: sdk-1
+`
+
+func TestExpand_OneCasePerVariant(t *testing.T) {
+	c, err := Parse([]byte(matrixCase))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got, err := c.Expand()
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 variants, got %d", len(got))
+	}
+	v1, v2 := got[0], got[1]
+	if v1.Name != "dice[sdk-1]" || v1.Variant != "sdk-1" || v1.Matrix != nil {
+		t.Errorf("variant identity: %q %q %v", v1.Name, v1.Variant, v1.Matrix)
+	}
+	if env := strings.Join(v1.Fixture.Compose.Env, ","); env != "COLLECTOR=default,SDK_VERSION=1.40" {
+		t.Errorf("sdk-1 env: got %s", env)
+	}
+	if files := strings.Join(v1.Fixture.Compose.Files, ","); files != "docker-compose.yml" {
+		t.Errorf("sdk-1 files: got %s", files)
+	}
+	if files := strings.Join(v2.Fixture.Compose.Files, ","); files != "docker-compose.yml,collector-v2.yml" || v2.Fixture.Compose.AppService != "app" {
+		t.Errorf("sdk-2 fixture: got %+v", v2.Fixture.Compose)
+	}
+	if len(v1.Expected.Traces) != 1 || len(v1.Expected.Custom) != 1 {
+		t.Errorf("sdk-1 assertions: %+v", v1.Expected)
+	}
+	if len(v2.Expected.Traces) != 2 || len(v2.Expected.Custom) != 0 || v2.Expected.Traces[1].When != "" {
+		t.Errorf("sdk-2 assertions: %+v", v2.Expected)
+	}
+	// The source fixture is shared by reference until overlaid; it must not
+	// pick up a variant's env.
+	if env := strings.Join(c.Fixture.Compose.Env, ","); env != "COLLECTOR=default,SDK_VERSION=0" {
+		t.Errorf("Expand mutated the case fixture: %s", env)
+	}
+
+	// Variant vars layer over seed.vars, and ${case.name} is the variant name.
+	x, err := v2.Interpolate(Scope{Run: map[string]string{"id": "r"}})
+	if err != nil {
+		t.Fatalf("Interpolate: %v", err)
+	}
+	if q := x.Expected.Traces[0].TraceQL; q != `{ name = "rollTheDice" }` {
+		t.Errorf("variant var: got %q", q)
+	}
+	if q := x.Expected.Traces[1].TraceQL; q != `{ resource.service.name = "dice" }` {
+		t.Errorf("case var: got %q", q)
+	}
+	if s := x.Expected.Traces[0].Contains[0]; s != "dice[sdk-2]" {
+		t.Errorf("case.name: got %q", s)
+	}
+	if err := v2.Validate(); err != nil {
+		t.Errorf("expanded variant should validate: %v", err)
+	}
+}
+
+func TestValidate_MatrixErrors(t *testing.T) {
+	cases := []struct {
+		name, body, want string
+	}{
+		{
+			name: "when without matrix",
+			body: `
+expected:
+  traces:
+    - traceql: '{}'
+      when: v1
+`,
+			want: "expected.traces[0].when: requires a matrix",
+		},
+		{
+			name: "duplicate variant",
+			body: `
+matrix: [{name: v1}, {name: v1}]
+expected:
+  traces:
+    - traceql: '{}'
+`,
+			want: `matrix[1].name: duplicate variant "v1"`,
+		},
+		{
+			name: "bad when regexp",
+			body: `
+matrix: [{name: v1}]
+expected:
+  traces:
+    - traceql: '{}'
+      when: '['
+`,
+			want: `expected.traces[0].when: invalid regexp "["`,
+		},
+		{
+			name: "variant with nothing to assert",
+			body: `
+matrix: [{name: v1}, {name: v2}]
+expected:
+  traces:
+    - traceql: '{}'
+      when: v1
+`,
+			want: `matrix[1] "v2": no assertion applies to this variant`,
+		},
+		{
+			name: "fixture kind mismatch",
+			body: `
+fixture:
+  remote: {endpoint: http://localhost:3000}
+matrix:
+  - name: v1
+    fixture:
+      compose: {template: lgtm}
+expected:
+  traces:
+    - traceql: '{}'
+`,
+			want: "matrix[0].fixture: a compose variant cannot overlay a remote fixture",
+		},
+		{
+			name: "variant var missing",
+			body: `
+matrix:
+  - name: v1
+    vars: {span: roll}
+  - name: v2
+expected:
+  traces:
+    - traceql: '{ name = "${vars.span}" }'
+`,
+			want: `matrix[1] "v2": expected.traces[0].traceql: ${vars.span}: undefined variable "span"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte("name: m\n" + tc.body))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package casefile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Step is one entry of a case's scenario. Steps run in order after the
+// top-level inputs and before the top-level expected block, so a case can
+// drive the app, assert, act on the fixture and drive it again. Exactly one
+// field is set.
+type Step struct {
+	Input   *Input         `yaml:"input,omitempty"`
+	Sleep   time.Duration  `yaml:"sleep,omitempty"`
+	Expect  *Expected      `yaml:"expect,omitempty"`
+	Fixture *FixtureAction `yaml:"fixture,omitempty"`
+}
+
+// FixtureAction changes a service of the case's fixture: a Compose service,
+// or a Deployment of a k3d fixture. Exactly one of the service fields is set.
+type FixtureAction struct {
+	Restart string `yaml:"restart,omitempty"`
+	Stop    string `yaml:"stop,omitempty"`
+	Start   string `yaml:"start,omitempty"`
+	Kill    string `yaml:"kill,omitempty"`
+	Pause   string `yaml:"pause,omitempty"`
+	Unpause string `yaml:"unpause,omitempty"`
+	// Signal is what kill sends, by name ("SIGTERM") or number; SIGKILL by
+	// default.
+	Signal string `yaml:"signal,omitempty"`
+}
+
+// FixtureActions are the actions a FixtureAction can take, in field order.
+var FixtureActions = []string{"restart", "stop", "start", "kill", "pause", "unpause"}
+
+// Action returns the action to take and the service it targets.
+func (a FixtureAction) Action() (action, service string) {
+	for i, service := range a.services() {
+		if service != "" {
+			return FixtureActions[i], service
+		}
+	}
+	return "", ""
+}
+
+// EffectiveSignal returns the signal kill sends, defaulting to SIGKILL.
+func (a FixtureAction) EffectiveSignal() string {
+	if a.Signal == "" {
+		return "SIGKILL"
+	}
+	return a.Signal
+}
+
+func (a FixtureAction) services() []string {
+	return []string{a.Restart, a.Stop, a.Start, a.Kill, a.Pause, a.Unpause}
+}
+
+var signalName = regexp.MustCompile(`^(SIG)?[A-Z][A-Z0-9+-]*$|^[0-9]+$`)
+
+// Inputs lists the top-level inputs followed by the inputs of the steps, in
+// the order they run.
+func (c *Case) Inputs() []Input {
+	out := append([]Input(nil), c.Input...)
+	for _, st := range c.Steps {
+		if st.Input != nil {
+			out = append(out, *st.Input)
+		}
+	}
+	return out
+}
+
+func (c *Case) hasStepAssertions() bool {
+	for _, st := range c.Steps {
+		if st.Expect != nil && st.Expect.HasAssertions() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Case) validateSteps() error {
+	for i, st := range c.Steps {
+		path := fmt.Sprintf("steps[%d]", i)
+		set := 0
+		for _, present := range []bool{st.Input != nil, st.Sleep != 0, st.Expect != nil, st.Fixture != nil} {
+			if present {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("%s: set exactly one of input, sleep, expect, or fixture", path)
+		}
+		switch {
+		case st.Input != nil:
+			if err := c.validateInput(path+".input", *st.Input); err != nil {
+				return err
+			}
+		case st.Sleep < 0:
+			return fmt.Errorf("%s.sleep: must be > 0", path)
+		case st.Expect != nil:
+			if !st.Expect.HasAssertions() {
+				return fmt.Errorf("%s.expect: at least one assertion required (signal, correlate, or custom-check)", path)
+			}
+			if w := st.Expect.whenClauses(path + ".expect"); len(w) > 0 {
+				return fmt.Errorf("%s: only supported under expected", w[0].path)
+			}
+			if err := validateExpected(path+".expect", *st.Expect); err != nil {
+				return err
+			}
+		case st.Fixture != nil:
+			if err := c.validateFixtureAction(path+".fixture", *st.Fixture); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Case) validateFixtureAction(path string, a FixtureAction) error {
+	set := 0
+	for _, service := range a.services() {
+		if strings.TrimSpace(service) != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("%s: set exactly one of restart, stop, start, kill, pause, or unpause", path)
+	}
+	action, _ := a.Action()
+	if a.Signal != "" && action != "kill" {
+		return fmt.Errorf("%s.signal: only supported with kill", path)
+	}
+	if a.Signal != "" && !signalName.MatchString(a.Signal) {
+		return fmt.Errorf("%s.signal: expected a signal name such as SIGTERM or a number, got %q", path, a.Signal)
+	}
+	switch kind := c.fixtureKind(); kind {
+	case "remote":
+		return fmt.Errorf("%s: requires a Compose or k3d fixture", path)
+	case "k3d":
+		if action == "pause" || action == "unpause" {
+			return fmt.Errorf("%s.%s: not supported on k3d fixtures", path, action)
+		}
+	}
+	return nil
+}
+
+// validateInputFixture checks an input that takes a fixture action, which
+// sends no request and so takes none of the request keys.
+func (c *Case) validateInputFixture(path string, in Input) error {
+	if in.hasHTTPKeys() || in.Retry != nil || in.Compose != nil || in.GRPC != nil || in.Kubernetes != nil {
+		return fmt.Errorf("%s: set exactly one of path, compose, grpc, kubernetes, or fixture", path)
+	}
+	if in.Capture != nil || in.TraceContext != nil || in.Load() || in.Rate != "" || in.Concurrency != 0 {
+		return fmt.Errorf("%s.fixture: cannot be combined with capture, trace_context, or load keys", path)
+	}
+	return c.validateFixtureAction(path+".fixture", *in.Fixture)
+}
+
+func (c *Case) fixtureKind() string {
+	if c.Fixture == nil {
+		return ""
+	}
+	return c.Fixture.Kind()
+}
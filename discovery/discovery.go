@@ -157,6 +157,7 @@ func (c *RootConfig) PlanRun(f Filter) ([]Plan, error) {
 
 // loadCases expands every glob in Cases (relative to SourceDir), dedupes
 // overlapping matches, loads each case, and returns them sorted by SourcePath.
+// A matrix case contributes one case per variant, in declaration order.
 func (c *RootConfig) loadCases() ([]*casefile.Case, error) {
 	seen := make(map[string]struct{})
 	var cases []*casefile.Case
@@ -178,10 +179,14 @@ func (c *RootConfig) loadCases() ([]*casefile.Case, error) {
 			if loadErr != nil {
 				return nil, loadErr
 			}
-			cases = append(cases, tc)
+			variants, expandErr := tc.Expand()
+			if expandErr != nil {
+				return nil, fmt.Errorf("casefile expand %s: %w", m, expandErr)
+			}
+			cases = append(cases, variants...)
 		}
 	}
-	sort.Slice(cases, func(i, j int) bool {
+	sort.SliceStable(cases, func(i, j int) bool {
 		return cases[i].SourcePath < cases[j].SourcePath
 	})
 	return cases, nil
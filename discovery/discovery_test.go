@@ -308,6 +308,52 @@ cases: ["*/oats-case.yaml"]
 	}
 }
 
+// TestPlanRun_ExpandsMatrixVariants verifies that a matrix case runs once per
+// variant, and that variants with different fixtures boot separately.
+func TestPlanRun_ExpandsMatrixVariants(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "oats-config.yaml", `
+meta:
+  version: 3
+cases: ["cases/*.yaml"]
+`)
+	writeFile(t, dir, "cases/sdk.yaml", `
+name: sdk
+fixture:
+  compose:
+    file: docker-compose.yml
+    env: [COLLECTOR=default]
+matrix:
+  - name: v1
+    fixture:
+      compose:
+        env: [SDK_VERSION=1.0]
+  - name: v2
+    fixture:
+      compose:
+        env: [SDK_VERSION=2.0]
+expected:
+  traces:
+    - traceql: '{}'
+      absent: true
+`)
+
+	cfg, err := Load(filepath.Join(dir, "oats-config.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	plans, err := cfg.PlanRun(Filter{})
+	if err != nil {
+		t.Fatalf("PlanRun: %v", err)
+	}
+	if got := strings.Join(planNames(plans), ","); got != "sdk[v1],sdk[v2]" {
+		t.Fatalf("expected one plan per variant, got %s", got)
+	}
+	if env := strings.Join(plans[1].Fixture.Compose.Env, ","); env != "COLLECTOR=default,SDK_VERSION=2.0" {
+		t.Fatalf("expected merged variant env, got %s", env)
+	}
+}
+
 func TestPlanRun_EmptyGlobIsAnError(t *testing.T) {
 	dir := t.TempDir()
 	writeFile(t, dir, "oats-config.yaml", `
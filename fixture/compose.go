@@ -1,6 +1,8 @@
 package fixture
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,8 +13,10 @@ import (
 
 	"github.com/grafana/oats/casefile"
 	"github.com/grafana/oats/discovery"
+	"github.com/grafana/oats/seed"
 	"github.com/grafana/oats/testhelpers"
 	"github.com/grafana/oats/testhelpers/container"
+	"go.yaml.in/yaml/v3"
 )
 
 const (
@@ -23,7 +27,7 @@ func portString(port int) string {
 	return strconv.Itoa(port)
 }
 
-func startCompose(plan discovery.Plan, engine container.Engine) (Handle, Runtime, error) {
+func startCompose(plan discovery.Plan, engine container.Engine, runID string) (Handle, Runtime, error) {
 	compose := plan.Fixture.Compose
 	composeFiles, cleanup, err := resolveComposeFiles(plan.FixtureSourceDir, compose)
 	if err != nil {
@@ -32,6 +36,23 @@ func startCompose(plan discovery.Plan, engine container.Engine) (Handle, Runtime
 	project := composeProjectName(plan)
 	composeEnv := append([]string(nil), compose.Env...)
 	composeEnv = append(composeEnv, "COMPOSE_PROJECT_NAME="+project)
+	if runID != "" {
+		// Lets compose files reference ${OATS_RUN_ID} themselves, e.g. to
+		// append it to an OTEL_RESOURCE_ATTRIBUTES value they already set.
+		composeEnv = append(composeEnv, "OATS_RUN_ID="+runID)
+	}
+	injectRunID := compose.InjectRunID && runID != ""
+	if injectRunID {
+		f, err := injectComposeRunID(plan.FixtureSourceDir, engine, composeFiles, composeEnv, compose.AppService, runID)
+		if err != nil {
+			if cleanup != nil {
+				_ = cleanup()
+			}
+			return nil, Runtime{}, err
+		}
+		composeFiles = append(composeFiles, f)
+		cleanup = chainCleanup(func() error { return removeIfExists(f) }, cleanup)
+	}
 	stack, err := newComposeStack(composeFiles, composeEnv, engine)
 	if err != nil {
 		if cleanup != nil {
@@ -72,9 +93,11 @@ func startCompose(plan discovery.Plan, engine container.Engine) (Handle, Runtime
 		ComposeFiles:     composeFiles,
 		ComposeProject:   project,
 		ContainerRuntime: string(engine),
+		RunIDInjected:    injectRunID,
 	}
 	if commandHandle, ok := stack.(composeCommandHandle); ok {
 		rt.RunCompose = commandHandle.Run
+		rt.ControlService = composeControl(commandHandle)
 	}
 	// When the fixture manages the app (app_service + app_port), resolve the host
 	// port docker published for it. This lets the app bind an ephemeral host port
@@ -164,6 +187,124 @@ func writeBuiltinLGTMCompose(sourceDir string) (string, error) {
 	return path, nil
 }
 
+// injectComposeRunID writes the override that stamps the run ID on the app
+// service. Compose merges environment by key, so the override carries the
+// OTEL_RESOURCE_ATTRIBUTES the service already resolves to with the run ID
+// appended, rather than replacing it.
+func injectComposeRunID(sourceDir string, engine container.Engine, files, env []string, service, runID string) (string, error) {
+	environment, err := lookupComposeEnvironment(engine, files, env, service)
+	if err != nil {
+		return "", fmt.Errorf("read environment of service %q: %w", service, err)
+	}
+	attrs := withRunIDAttribute(environment["OTEL_RESOURCE_ATTRIBUTES"], runID)
+	f, err := writeRunIDOverride(sourceDir, service, attrs, runID)
+	if err != nil {
+		return "", fmt.Errorf("write run ID override: %w", err)
+	}
+	return f, nil
+}
+
+// withRunIDAttribute appends oats.run.id=<runID> to an OTEL_RESOURCE_ATTRIBUTES
+// value, dropping a run ID the value already carries (e.g. one the compose
+// file appends from ${OATS_RUN_ID}) so the attribute appears once.
+func withRunIDAttribute(attrs, runID string) string {
+	var kept []string
+	for _, kv := range strings.Split(attrs, ",") {
+		key, _, _ := strings.Cut(kv, "=")
+		if strings.TrimSpace(kv) == "" || strings.TrimSpace(key) == seed.RunIDAttribute {
+			continue
+		}
+		kept = append(kept, kv)
+	}
+	return strings.Join(append(kept, seed.RunIDAttribute+"="+runID), ",")
+}
+
+// composeEnvironment returns the environment compose resolves for service
+// across files, after interpolation, env_file and override merging.
+func composeEnvironment(engine container.Engine, files []string, env []string, service string) (map[string]string, error) {
+	args := engine.ComposeArgs()
+	for _, f := range files {
+		args = append(args, "-f", f)
+	}
+	args = append(args, "config")
+	cmd := exec.Command(engine.Binary(), args...)
+	cmd.Env = mergeEnvironment(cmd.Environ(), env)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("compose config: %w", err)
+	}
+	return parseComposeEnvironment(out, service)
+}
+
+// parseComposeEnvironment reads service's environment from `compose config`
+// output. Docker Compose prints it as a mapping; podman-compose keeps the
+// KEY=value list form the file used.
+func parseComposeEnvironment(config []byte, service string) (map[string]string, error) {
+	var doc struct {
+		Services map[string]struct {
+			Environment yaml.Node `yaml:"environment"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(config, &doc); err != nil {
+		return nil, fmt.Errorf("parse compose config: %w", err)
+	}
+	svc, ok := doc.Services[service]
+	if !ok {
+		return nil, fmt.Errorf("service %q is not defined", service)
+	}
+	environment := map[string]string{}
+	switch node := svc.Environment; node.Kind {
+	case 0:
+		// The service sets no environment.
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			environment[node.Content[i].Value] = node.Content[i+1].Value
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			key, value, _ := strings.Cut(item.Value, "=")
+			environment[key] = value
+		}
+	default:
+		return nil, fmt.Errorf("service %q: environment must be a mapping or a list", service)
+	}
+	return environment, nil
+}
+
+// writeRunIDOverride writes a compose override that sets the app service's
+// OTEL_RESOURCE_ATTRIBUTES to attrs and exports OATS_RUN_ID.
+func writeRunIDOverride(sourceDir, service, attrs, runID string) (string, error) {
+	if err := os.MkdirAll(sourceDir, 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(sourceDir, ".oats.run-id.*.compose.yml")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	// JSON strings are valid YAML flow scalars and escape anything unusual.
+	quote := func(s string) string {
+		b, _ := json.Marshal(s)
+		return string(b)
+	}
+	body := `services:
+  ` + quote(service) + `:
+    environment:
+      OTEL_RESOURCE_ATTRIBUTES: ` + quote(attrs) + `
+      OATS_RUN_ID: ` + quote(runID) + `
+`
+	if _, err := f.WriteString(body); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
 func composeCheckEnv(plan discovery.Plan, rt Runtime) []string {
 	files := rt.ComposeFiles
 	if len(files) == 0 {
@@ -437,3 +578,15 @@ func splitComposeHostPort(addr string) (string, string, error) {
 	}
 	return addr[:idx], addr[idx+1:], nil
 }
+
+// composeControl maps a fixture action onto the compose subcommand of the
+// same name; kill sends the action's signal.
+func composeControl(h composeCommandHandle) func(context.Context, casefile.FixtureAction) error {
+	return func(ctx context.Context, a casefile.FixtureAction) error {
+		action, service := a.Action()
+		if action == "kill" {
+			return h.Control(ctx, service, action, "-s", a.EffectiveSignal())
+		}
+		return h.Control(ctx, service, action)
+	}
+}
@@ -28,7 +28,7 @@ var (
 	newComposeStack = func(files []string, env []string, engine container.Engine) (Handle, error) {
 		return compose.StackFilesWithRuntime(files, env, engine)
 	}
-	newKubernetesEndpoint = func(plan discovery.Plan, ports remote.PortsConfig) *remote.Endpoint {
+	newKubernetesEndpoint = func(plan discovery.Plan, ports remote.PortsConfig, runID string) *remote.Endpoint {
 		sourceDir := plan.FixtureSourceDir
 		if sourceDir == "" {
 			sourceDir = "."
@@ -43,10 +43,14 @@ var (
 			AppDockerPort:    k3d.AppPort,
 			ImportImages:     k3d.ImportImages,
 		}
+		if k3d.InjectRunID {
+			model.RunID = runID
+		}
 		return kubernetes.NewEndpoint("localhost", model, ports, plan.Name, sourceDir)
 	}
-	waitForGrafanaToken = waitForGrafanaTokenImpl
-	lookupComposePort   = composePort
+	waitForGrafanaToken      = waitForGrafanaTokenImpl
+	lookupComposePort        = composePort
+	lookupComposeEnvironment = composeEnvironment
 )
 
 // Options controls host-side fixture behavior. It intentionally does not
@@ -54,6 +58,9 @@ var (
 // selected container engine without changing the test definition.
 type Options struct {
 	ContainerRuntime string
+	// RunID is exported to compose as OATS_RUN_ID and, for fixtures with
+	// inject_run_id, set on the app's OTEL_RESOURCE_ATTRIBUTES.
+	RunID string
 }
 
 // Runtime carries the resolved coordinates of a booted fixture back to the
@@ -71,7 +78,10 @@ type Runtime struct {
 	ParallelSafe     bool
 	ParallelDisabled string
 	ContainerRuntime string
-	RunCompose       func(context.Context, string, []string) error
+	RunCompose       func(context.Context, string, []string) (compose.RunResult, error)
+	RunKubernetes    func(context.Context, casefile.KubernetesInput) (compose.RunResult, error)
+	ControlService   func(ctx context.Context, a casefile.FixtureAction) error
+	RunIDInjected    bool
 }
 
 // Handle is a booted fixture that can be torn down.
@@ -85,14 +95,15 @@ type startableHandle interface {
 }
 
 type composeCommandHandle interface {
-	Run(context.Context, string, []string) error
+	Run(context.Context, string, []string) (compose.RunResult, error)
+	Control(ctx context.Context, service string, command ...string) error
 }
 
 // Start boots the fixture declared by the plan and returns a Handle for
 // teardown plus the resolved Runtime. Remote/empty fixtures need no boot and
 // return a nil Handle.
 func Start(ctx context.Context, plan discovery.Plan) (Handle, Runtime, error) {
-	return startWithEngine(ctx, plan, container.Docker)
+	return startWithEngine(ctx, plan, container.Docker, "")
 }
 
 // StartWithOptions boots a fixture using host-side options supplied by the
@@ -109,7 +120,7 @@ func StartWithOptions(ctx context.Context, plan discovery.Plan, opts Options) (H
 		if err != nil {
 			return nil, Runtime{}, err
 		}
-		return startWithEngine(ctx, plan, resolved)
+		return startWithEngine(ctx, plan, resolved, opts.RunID)
 	}
 
 	requested, err := container.Parse(engine)
@@ -119,17 +130,17 @@ func StartWithOptions(ctx context.Context, plan discovery.Plan, opts Options) (H
 	if requested == container.Podman {
 		return nil, Runtime{}, fmt.Errorf("k3d fixtures require Docker; Podman is currently only supported for Compose fixtures")
 	}
-	return startWithEngine(ctx, plan, container.Docker)
+	return startWithEngine(ctx, plan, container.Docker, opts.RunID)
 }
 
-func startWithEngine(ctx context.Context, plan discovery.Plan, engine container.Engine) (Handle, Runtime, error) {
+func startWithEngine(ctx context.Context, plan discovery.Plan, engine container.Engine, runID string) (Handle, Runtime, error) {
 	switch plan.Fixture.Kind() {
 	case "", "remote":
 		return nil, Runtime{ParallelSafe: true}, nil
 	case "compose":
-		return startCompose(plan, engine)
+		return startCompose(plan, engine, runID)
 	case "k3d":
-		return startK3D(ctx, plan)
+		return startK3D(ctx, plan, runID)
 	default:
 		return nil, Runtime{}, fmt.Errorf("fixture kind %q is not supported in oats", plan.Fixture.Kind())
 	}
@@ -164,9 +175,9 @@ func SupportsParallel(plan discovery.Plan) (bool, string) {
 			// App seeds are parallel-safe only when OATS can give the app an
 			// ephemeral host port instead of a shared fixed one — which requires
 			// fixture.app_service (+ app_port) so the published port can be
-			// discovered. Compose-command inputs run inside their isolated
-			// project and do not need a host port.
-			if c.Seed.EffectiveType() == "app" && hasHTTPInput(c) && !plan.Fixture.HasManagedApp() {
+			// discovered. Compose-command and fixture-action inputs run inside
+			// their isolated project and do not need a host port.
+			if c.Seed.EffectiveType() == "app" && hasAppInput(c) && !plan.Fixture.HasManagedApp() {
 				return false, "compose app-seed suites need fixture.app_service and app_port so OATS can publish an ephemeral app port; otherwise they share a fixed app port"
 			}
 		}
@@ -185,9 +196,11 @@ func SupportsParallel(plan discovery.Plan) (bool, string) {
 	}
 }
 
-func hasHTTPInput(c *casefile.Case) bool {
-	for _, input := range c.Input {
-		if input.Compose == nil {
+// hasAppInput reports whether the case sends HTTP or gRPC requests to the
+// app's host port.
+func hasAppInput(c *casefile.Case) bool {
+	for _, input := range c.Inputs() {
+		if input.Compose == nil && input.Kubernetes == nil && input.Fixture == nil {
 			return true
 		}
 	}
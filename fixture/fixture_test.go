@@ -13,6 +13,7 @@ import (
 	"github.com/grafana/oats/discovery"
 	"github.com/grafana/oats/runner"
 	"github.com/grafana/oats/testhelpers"
+	"github.com/grafana/oats/testhelpers/compose"
 	"github.com/grafana/oats/testhelpers/container"
 	"github.com/grafana/oats/testhelpers/remote"
 )
@@ -138,12 +139,24 @@ func TestStart_ComposeLifecycle(t *testing.T) {
 	if rt.RunCompose == nil {
 		t.Fatal("compose runtime is missing command runner")
 	}
-	if err := rt.RunCompose(context.Background(), "app", []string{"mise", "run", "hello"}); err != nil {
+	if _, err := rt.RunCompose(context.Background(), "app", []string{"mise", "run", "hello"}); err != nil {
 		t.Fatalf("RunCompose: %v", err)
 	}
 	if fake.runCalls != 1 || fake.runService != "app" || strings.Join(fake.runCommand, " ") != "mise run hello" {
 		t.Fatalf("compose command not forwarded: %+v", fake)
 	}
+	if err := rt.ControlService(context.Background(), casefile.FixtureAction{Restart: "app"}); err != nil {
+		t.Fatalf("ControlService: %v", err)
+	}
+	if fake.runCalls != 2 || fake.runService != "app" || strings.Join(fake.runCommand, " ") != "restart" {
+		t.Fatalf("compose control not forwarded: %+v", fake)
+	}
+	if err := rt.ControlService(context.Background(), casefile.FixtureAction{Kill: "app", Signal: "SIGTERM"}); err != nil {
+		t.Fatalf("ControlService: %v", err)
+	}
+	if fake.runCalls != 3 || strings.Join(fake.runCommand, " ") != "kill -s SIGTERM" {
+		t.Fatalf("compose kill not forwarded with its signal: %+v", fake)
+	}
 	if err := fix.Close(); err != nil {
 		t.Fatalf("fixture close: %v", err)
 	}
@@ -210,10 +223,10 @@ func TestStartWithOptionsRejectsInvalidRuntimeAndUnsupportedFixture(t *testing.T
 		t.Fatal("expected invalid container runtime error")
 	}
 
-	if fix, rt, err := startWithEngine(context.Background(), discovery.Plan{}, container.Docker); err != nil || fix != nil || !rt.ParallelSafe {
+	if fix, rt, err := startWithEngine(context.Background(), discovery.Plan{}, container.Docker, ""); err != nil || fix != nil || !rt.ParallelSafe {
 		t.Fatalf("empty fixture = fix:%v runtime:%+v err:%v", fix, rt, err)
 	}
-	if _, _, err := startWithEngine(context.Background(), discovery.Plan{Fixture: casefile.FixtureConfig{Remote: &casefile.RemoteFixture{}}}, container.Docker); err != nil {
+	if _, _, err := startWithEngine(context.Background(), discovery.Plan{Fixture: casefile.FixtureConfig{Remote: &casefile.RemoteFixture{}}}, container.Docker, ""); err != nil {
 		t.Fatalf("remote startWithEngine: %v", err)
 	}
 }
@@ -241,7 +254,7 @@ func TestStartComposeLookupFailuresAndManagedApp(t *testing.T) {
 		}
 		return "43" + port, nil
 	}
-	fix, rt, err := startCompose(plan, container.Docker)
+	fix, rt, err := startCompose(plan, container.Docker, "")
 	if err != nil {
 		t.Fatalf("managed app startCompose: %v", err)
 	}
@@ -276,7 +289,7 @@ func TestStartComposeLookupFailuresAndManagedApp(t *testing.T) {
 				}
 				return "43" + port, nil
 			}
-			_, _, err := startCompose(plan, container.Docker)
+			_, _, err := startCompose(plan, container.Docker, "")
 			if err == nil || !strings.Contains(err.Error(), tc.want) {
 				t.Fatalf("startCompose error = %v, want %q", err, tc.want)
 			}
@@ -289,11 +302,112 @@ func TestStartComposeLookupFailuresAndManagedApp(t *testing.T) {
 		}
 		return "43" + port, nil
 	}
-	if _, _, err := startCompose(plan, container.Docker); err == nil || !strings.Contains(err.Error(), "invalid app host port") {
+	if _, _, err := startCompose(plan, container.Docker, ""); err == nil || !strings.Contains(err.Error(), "invalid app host port") {
 		t.Fatalf("invalid managed app port error = %v", err)
 	}
 }
 
+func TestStartComposeInjectsRunID(t *testing.T) {
+	oldFactory := newComposeStack
+	oldLookup := lookupComposePort
+	oldEnvironment := lookupComposeEnvironment
+	t.Cleanup(func() {
+		newComposeStack = oldFactory
+		lookupComposePort = oldLookup
+		lookupComposeEnvironment = oldEnvironment
+	})
+
+	dir := t.TempDir()
+	lookupComposeEnvironment = func(_ container.Engine, files []string, env []string, service string) (map[string]string, error) {
+		if service != "app" || len(files) != 1 || env[len(env)-1] != "OATS_RUN_ID=r1" {
+			return nil, fmt.Errorf("unexpected lookup of %q in %v with %v", service, files, env)
+		}
+		return map[string]string{"OTEL_RESOURCE_ATTRIBUTES": "service.name=app,deployment.environment=ci"}, nil
+	}
+	plan := discovery.Plan{
+		Name:             "run-id",
+		Fixture:          casefile.FixtureConfig{Compose: &casefile.ComposeFixture{Template: "none", File: "app.yml", AppService: "app", InjectRunID: true}},
+		FixtureSourceDir: dir,
+	}
+	var gotFiles, gotEnv []string
+	var override string
+	newComposeStack = func(files []string, env []string, _ container.Engine) (Handle, error) {
+		gotFiles, gotEnv = files, env
+		data, err := os.ReadFile(files[len(files)-1])
+		if err != nil {
+			return nil, err
+		}
+		override = string(data)
+		return &fakeHandle{}, nil
+	}
+	lookupComposePort = func(_ container.Engine, _ []string, _ []string, _ string, port string) (string, error) {
+		return "43" + port, nil
+	}
+	fix, rt, err := startCompose(plan, container.Docker, "r1")
+	if err != nil {
+		t.Fatalf("startCompose: %v", err)
+	}
+	if !rt.RunIDInjected {
+		t.Error("runtime should report the run ID as injected")
+	}
+	if len(gotFiles) != 2 || gotFiles[0] != filepath.Join(dir, "app.yml") {
+		t.Fatalf("override should follow the user's files: %v", gotFiles)
+	}
+	for _, want := range []string{`"app":`, `OTEL_RESOURCE_ATTRIBUTES: "service.name=app,deployment.environment=ci,oats.run.id=r1"`, `OATS_RUN_ID: "r1"`} {
+		if !strings.Contains(override, want) {
+			t.Errorf("override missing %q:\n%s", want, override)
+		}
+	}
+	if gotEnv[len(gotEnv)-1] != "OATS_RUN_ID=r1" {
+		t.Errorf("compose env should export OATS_RUN_ID: %v", gotEnv)
+	}
+	if err := fix.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := os.Stat(gotFiles[1]); !os.IsNotExist(err) {
+		t.Errorf("override file should be removed on close: %v", err)
+	}
+}
+
+func TestWithRunIDAttribute(t *testing.T) {
+	cases := map[string]string{
+		"":                              "oats.run.id=r1",
+		"service.name=app":              "service.name=app,oats.run.id=r1",
+		"service.name=app,oats.run.id=": "service.name=app,oats.run.id=r1",
+		"oats.run.id=r1,a=b":            "a=b,oats.run.id=r1",
+	}
+	for attrs, want := range cases {
+		if got := withRunIDAttribute(attrs, "r1"); got != want {
+			t.Errorf("withRunIDAttribute(%q) = %q, want %q", attrs, got, want)
+		}
+	}
+}
+
+func TestParseComposeEnvironment(t *testing.T) {
+	config := []byte(`services:
+  app:
+    environment:
+      OTEL_RESOURCE_ATTRIBUTES: service.name=app
+  listed:
+    environment:
+      - OTEL_RESOURCE_ATTRIBUTES=service.name=listed
+  bare:
+    image: app
+`)
+	for service, want := range map[string]string{"app": "service.name=app", "listed": "service.name=listed", "bare": ""} {
+		env, err := parseComposeEnvironment(config, service)
+		if err != nil {
+			t.Fatalf("%s: %v", service, err)
+		}
+		if got := env["OTEL_RESOURCE_ATTRIBUTES"]; got != want {
+			t.Errorf("%s: OTEL_RESOURCE_ATTRIBUTES = %q, want %q", service, got, want)
+		}
+	}
+	if _, err := parseComposeEnvironment(config, "missing"); err == nil || !strings.Contains(err.Error(), `service "missing" is not defined`) {
+		t.Fatalf("missing service error = %v", err)
+	}
+}
+
 func TestSupportsParallelFixtureKinds(t *testing.T) {
 	cases := []struct {
 		name   string
@@ -317,7 +431,7 @@ func TestSupportsParallelFixtureKinds(t *testing.T) {
 }
 
 func TestFixtureCleanupAndErrorBranches(t *testing.T) {
-	if ep := newKubernetesEndpoint(discovery.Plan{Fixture: casefile.FixtureConfig{K3D: &casefile.K3DFixture{K8sDir: "k8s", AppService: "app", AppPort: 8080}}}, remote.PortsConfig{}); ep == nil {
+	if ep := newKubernetesEndpoint(discovery.Plan{Fixture: casefile.FixtureConfig{K3D: &casefile.K3DFixture{K8sDir: "k8s", AppService: "app", AppPort: 8080}}}, remote.PortsConfig{}, ""); ep == nil {
 		t.Fatal("default Kubernetes endpoint factory returned nil")
 	}
 	if _, _, err := StartWithOptions(context.Background(), discovery.Plan{Fixture: casefile.FixtureConfig{Remote: &casefile.RemoteFixture{}}}, Options{}); err != nil {
@@ -414,7 +528,7 @@ func TestStart_K3DLifecycle(t *testing.T) {
 	var capturedPlan discovery.Plan
 	var starts, stops int
 	var capturedPorts remote.PortsConfig
-	newKubernetesEndpoint = func(plan discovery.Plan, ports remote.PortsConfig) *remote.Endpoint {
+	newKubernetesEndpoint = func(plan discovery.Plan, ports remote.PortsConfig, _ string) *remote.Endpoint {
 		capturedPlan = plan
 		capturedPorts = ports
 		return remote.NewEndpoint("localhost", remote.PortsConfig{}, func(ctx context.Context) error {
@@ -469,7 +583,7 @@ func TestStart_K3DStartFailure(t *testing.T) {
 	oldFactory := newKubernetesEndpoint
 	defer func() { newKubernetesEndpoint = oldFactory }()
 
-	newKubernetesEndpoint = func(plan discovery.Plan, ports remote.PortsConfig) *remote.Endpoint {
+	newKubernetesEndpoint = func(plan discovery.Plan, ports remote.PortsConfig, _ string) *remote.Endpoint {
 		return remote.NewEndpoint("localhost", remote.PortsConfig{}, func(ctx context.Context) error {
 			return fmt.Errorf("cluster boom")
 		}, func(ctx context.Context) error {
@@ -688,10 +802,17 @@ func (f *fakeHandle) Close() error {
 	return f.closeErr
 }
 
-func (f *fakeHandle) Run(_ context.Context, service string, command []string) error {
+func (f *fakeHandle) Run(_ context.Context, service string, command []string) (compose.RunResult, error) {
 	f.runCalls++
 	f.runService = service
 	f.runCommand = append([]string(nil), command...)
+	return compose.RunResult{}, nil
+}
+
+func (f *fakeHandle) Control(_ context.Context, service string, command ...string) error {
+	f.runCalls++
+	f.runService = service
+	f.runCommand = command
 	return nil
 }
 
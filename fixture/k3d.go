@@ -5,18 +5,21 @@ import (
 	"fmt"
 	"os/exec"
 
+	"github.com/grafana/oats/casefile"
 	"github.com/grafana/oats/discovery"
 	"github.com/grafana/oats/runner"
 	"github.com/grafana/oats/testhelpers"
+	"github.com/grafana/oats/testhelpers/compose"
+	"github.com/grafana/oats/testhelpers/kubernetes"
 	"github.com/grafana/oats/testhelpers/remote"
 )
 
-func startK3D(ctx context.Context, plan discovery.Plan) (Handle, Runtime, error) {
+func startK3D(ctx context.Context, plan discovery.Plan, runID string) (Handle, Runtime, error) {
 	ports, err := allocateK3DPorts()
 	if err != nil {
 		return nil, Runtime{}, err
 	}
-	ep := newKubernetesEndpoint(plan, ports)
+	ep := newKubernetesEndpoint(plan, ports, runID)
 	if err := ep.Start(ctx); err != nil {
 		_ = ep.Stop(context.Background())
 		return nil, Runtime{}, err
@@ -30,6 +33,17 @@ func startK3D(ctx context.Context, plan discovery.Plan) (Handle, Runtime, error)
 		CustomCheckEnv:   k3dCheckEnv(runner.Endpoint{AppHost: testhelpers.LocalhostIPv4, AppPort: appPort}, ports),
 		ParallelSafe:     false,
 		ParallelDisabled: "k3d fixtures use a shared kubectl context and local port-forwards/app ports",
+		RunIDInjected:    plan.Fixture.K3D.InjectRunID && runID != "",
+		RunKubernetes: func(ctx context.Context, in casefile.KubernetesInput) (compose.RunResult, error) {
+			if in.Image != "" {
+				return kubernetes.RunJob(ctx, in.Image, in.Command)
+			}
+			return kubernetes.Exec(ctx, in.Deployment, in.Selector, in.Container, in.Command)
+		},
+		ControlService: func(ctx context.Context, a casefile.FixtureAction) error {
+			action, service := a.Action()
+			return kubernetes.Control(ctx, action, service, a.EffectiveSignal())
+		},
 	}
 	cfg, cfgErr := writeLocalGCXConfig(rt.GrafanaURL)
 	if cfgErr != nil {
@@ -23,10 +23,11 @@ import (
 	"github.com/grafana/oats/internal/legacyyaml/migrate"
 	"github.com/grafana/oats/report"
 	"github.com/grafana/oats/runner"
+	"github.com/grafana/oats/testhelpers/compose"
 )
 
 func TestResolveEndpoint_ComposeDefaults(t *testing.T) {
-	runCompose := func(context.Context, string, []string) error { return nil }
+	runCompose := func(context.Context, string, []string) (compose.RunResult, error) { return compose.RunResult{}, nil }
 	ep, err := resolveEndpoint(discovery.Plan{
 		Name:    "smoke",
 		Fixture: casefile.FixtureConfig{Compose: &casefile.ComposeFixture{Template: "lgtm"}},
@@ -148,6 +148,7 @@ func addRunFlags(fs *pflag.FlagSet) {
 	fs.Duration("interval", 500*time.Millisecond, "polling interval")
 	fs.Duration("absent-timeout", 10*time.Second, "how long an absent assertion must stay absent")
 	fs.Duration("seed-settle", 2*time.Second, "post-seed wait before first assertion")
+	fs.Duration("clock-skew", 5*time.Second, "how far before a case started its queries look back")
 	fs.String("gcx-context", "", "override the gcx --context value (otherwise derived from fixture endpoint)")
 	fs.String("lgtm-version", "latest", "version of docker.io/grafana/otel-lgtm used by the builtin Compose fixture")
 	fs.String("container-runtime", "auto", "container engine for Compose fixtures: auto | docker | podman")
@@ -311,12 +312,13 @@ func migrateAction(path string) error {
 	}
 
 	out, warnings, err := migrate.ConvertFile(path)
-	if err != nil {
-		return err
-	}
+	// Warnings explain a failed validation too, e.g. the k3d keys it names.
 	for _, w := range warnings {
 		fmt.Fprintln(os.Stderr, "migrate warning:", w)
 	}
+	if err != nil {
+		return err
+	}
 	fmt.Print(string(out))
 	return nil
 }
@@ -370,10 +372,12 @@ func runAction(cmd *cobra.Command, args []string, verbose int, exit *int) error
 	// lines and ndjson records are written one event at a time.
 	rep = &lockedReporter{inner: rep}
 
+	runID := runner.NewRunID()
 	rep.Emit(report.Event{
 		Type:          report.EventRunStart,
 		OatsVersion:   Version,
 		SchemaVersion: report.SchemaVersion,
+		RunID:         runID,
 		Ts:            time.Now(),
 	})
 
@@ -404,10 +408,12 @@ func runAction(cmd *cobra.Command, args []string, verbose int, exit *int) error
 		interval:           flagDur(fs, "interval"),
 		absentTimeout:      flagDur(fs, "absent-timeout"),
 		seedSettle:         flagDur(fs, "seed-settle"),
+		clockSkew:          flagDur(fs, "clock-skew"),
 		noCache:            flagBool(fs, "no-cache"),
 		cacheDir:           flagStr(fs, "cache-dir"),
 		cacheTTLDays:       cfg.Cache.TTLDays,
 		failFast:           flagBool(fs, "fail-fast"),
+		runID:              runID,
 	}
 	if fs.Lookup("lgtm-version").Changed {
 		opts.lgtmVersion = flagStr(fs, "lgtm-version")
@@ -492,6 +498,8 @@ func resolveEndpoint(plan discovery.Plan, rt fixture.Runtime, gcxContextOverride
 		}
 		ep.CustomCheckEnv = append(ep.CustomCheckEnv, rt.CustomCheckEnv...)
 		ep.RunCompose = rt.RunCompose
+		ep.ControlService = rt.ControlService
+		ep.RunIDInjected = rt.RunIDInjected
 	case "k3d":
 		if rt.GCXConfig != "" {
 			ep.GCXConfig = rt.GCXConfig
@@ -500,6 +508,9 @@ func resolveEndpoint(plan discovery.Plan, rt fixture.Runtime, gcxContextOverride
 			ep.OTLPHTTP = rt.OTLPHTTP
 		}
 		ep.CustomCheckEnv = append(ep.CustomCheckEnv, rt.CustomCheckEnv...)
+		ep.RunKubernetes = rt.RunKubernetes
+		ep.ControlService = rt.ControlService
+		ep.RunIDInjected = rt.RunIDInjected
 	default:
 		return ep, fmt.Errorf("fixture kind %q is not supported in oats", plan.Fixture.Kind())
 	}
@@ -532,10 +543,12 @@ type runOptions struct {
 	interval           time.Duration
 	absentTimeout      time.Duration
 	seedSettle         time.Duration
+	clockSkew          time.Duration
 	noCache            bool
 	cacheDir           string
 	cacheTTLDays       int
 	failFast           bool
+	runID              string // ${run.id}; shared by every group in one invocation
 }
 
 func runPlans(ctx context.Context, rep report.Reporter, plans []discovery.Plan, opts runOptions, parallel int) (int, int, error) {
@@ -643,7 +656,7 @@ func runPlansParallel(parent context.Context, rep report.Reporter, plans []disco
 func runPlan(ctx context.Context, rep report.Reporter, plan discovery.Plan, opts runOptions) groupResult {
 	plan = withLGTMVersion(plan, opts.lgtmVersion)
 	fixtureStart := emitFixtureStart(rep, plan)
-	fix, rt, err := fixture.StartWithOptions(ctx, plan, fixture.Options{ContainerRuntime: opts.containerRuntime})
+	fix, rt, err := fixture.StartWithOptions(ctx, plan, fixture.Options{ContainerRuntime: opts.containerRuntime, RunID: opts.runID})
 	if err != nil {
 		return groupResult{err: fmt.Errorf("fixture group %q: %w", plan.Name, err)}
 	}
@@ -677,6 +690,8 @@ func runPlan(ctx context.Context, rep report.Reporter, plan discovery.Plan, opts
 		Interval:        opts.interval,
 		AbsentTimeout:   opts.absentTimeout,
 		SeedSettleDelay: opts.seedSettle,
+		RunID:           opts.runID,
+		ClockSkew:       opts.clockSkew,
 	})
 	if !opts.noCache && opts.cacheDir != "" {
 		ttl := time.Duration(opts.cacheTTLDays) * 24 * time.Hour
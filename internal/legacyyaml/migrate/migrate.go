@@ -160,7 +160,8 @@ func ConvertTree(dir string) (*TreeResult, error) {
 // ConvertDefinition maps a legacy v1/v1.5-style OATS definition into the
 // current case yaml shape. Unsupported fields are dropped with warnings. The
 // legacy docker-compose/kubernetes fixture is carried over as a case-local
-// fixture: block.
+// fixture: block. A single matrix entry is flattened into the case; several
+// become a matrix: block, with each matrix-condition carried over as when:.
 func ConvertDefinition(def model.TestCaseDefinition, name string) (*casefile.Case, []string, error) {
 	var warnings []string
 	c := &casefile.Case{
@@ -168,15 +169,12 @@ func ConvertDefinition(def model.TestCaseDefinition, name string) (*casefile.Cas
 		Interval: def.Interval,
 	}
 	selectedMatrix := (*model.Matrix)(nil)
+	multiMatrix := len(def.Matrix) > 1
 
-	if len(def.Matrix) > 0 {
-		if len(def.Matrix) == 1 {
-			selectedMatrix = &def.Matrix[0]
-			c.Name = fmt.Sprintf("%s [%s]", name, selectedMatrix.Name)
-			warnings = append(warnings, fmt.Sprintf("flattened single matrix entry %q into the migrated case", selectedMatrix.Name))
-		} else {
-			warnings = append(warnings, "matrix definitions are not migrated automatically when multiple entries exist; convert expanded matrix cases manually")
-		}
+	if len(def.Matrix) == 1 {
+		selectedMatrix = &def.Matrix[0]
+		c.Name = fmt.Sprintf("%s [%s]", name, selectedMatrix.Name)
+		warnings = append(warnings, fmt.Sprintf("flattened single matrix entry %q into the migrated case", selectedMatrix.Name))
 	}
 	if len(def.Include) > 0 {
 		warnings = append(warnings, "include directives were resolved before migration; output is a flattened case")
@@ -195,11 +193,33 @@ func ConvertDefinition(def model.TestCaseDefinition, name string) (*casefile.Cas
 		return nil, warnings, fmt.Errorf("docker-compose present but no files declared")
 	}
 
-	c.Fixture = fixtureFor(def, selectedMatrix)
+	hasFixture, hasCompose := false, false
+	if multiMatrix {
+		// Legacy matrix entries replace the docker-compose/kubernetes block
+		// wholesale rather than overlaying it, so each variant carries its
+		// complete fixture and the case itself declares none.
+		for i := range def.Matrix {
+			m := &def.Matrix[i]
+			if m.DockerCompose != nil && len(m.DockerCompose.Files) == 0 {
+				return nil, warnings, fmt.Errorf("matrix %q docker-compose present but no files declared", m.Name)
+			}
+			fx, ws := fixtureFor(def, m)
+			warnings = append(warnings, ws...)
+			hasFixture = hasFixture || fx != nil
+			hasCompose = hasCompose || (fx != nil && fx.Compose != nil)
+			c.Matrix = append(c.Matrix, casefile.MatrixVariant{Name: m.Name, Fixture: fx})
+		}
+	} else {
+		fx, ws := fixtureFor(def, selectedMatrix)
+		warnings = append(warnings, ws...)
+		c.Fixture = fx
+		hasFixture = c.Fixture != nil
+		hasCompose = hasFixture && c.Fixture.Compose != nil
+	}
 	switch {
-	case c.Fixture != nil:
+	case hasFixture:
 		c.Seed.Type = "app"
-		if c.Fixture.Compose != nil {
+		if hasCompose {
 			warnings = append(warnings, "for parallel-safe app-seed runs, set fixture.compose.app_service + app_port (not derivable from the legacy file)")
 		}
 	default:
@@ -220,28 +240,55 @@ func ConvertDefinition(def model.TestCaseDefinition, name string) (*casefile.Cas
 		})
 	}
 
+	// when carries a matrix-condition over to a multi-entry matrix. With no
+	// matrix, or a flattened single entry, conditions were already applied by
+	// keepForMatrix and are dropped.
+	when := func(label, condition string) string {
+		if !multiMatrix || condition == "" {
+			return ""
+		}
+		if _, err := regexp.Compile(condition); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s matrix-condition %q is not a valid regexp and was dropped", label, condition))
+			return ""
+		}
+		return condition
+	}
 	for _, tr := range def.Expected.Traces {
 		if !keepForMatrix(tr.Signal.MatrixCondition, selectedMatrix) {
 			continue
 		}
-		assertion, ws := convertSignal(tr.TraceQL, tr.Signal)
+		signal := tr.Signal
+		if multiMatrix {
+			signal.MatrixCondition = ""
+		}
+		assertion, ws := convertSignal(tr.TraceQL, signal)
 		warnings = append(warnings, ws...)
+		assertion.When = when(tr.TraceQL, tr.Signal.MatrixCondition)
 		c.Expected.Traces = append(c.Expected.Traces, casefile.TraceAssertion{TraceQL: tr.TraceQL, MatchSpans: assertion.Match, AssertionCommon: withoutMatch(assertion)})
 	}
 	for _, lg := range def.Expected.Logs {
 		if !keepForMatrix(lg.Signal.MatrixCondition, selectedMatrix) {
 			continue
 		}
-		assertion, ws := convertSignal(lg.LogQL, lg.Signal)
+		signal := lg.Signal
+		if multiMatrix {
+			signal.MatrixCondition = ""
+		}
+		assertion, ws := convertSignal(lg.LogQL, signal)
 		warnings = append(warnings, ws...)
+		assertion.When = when(lg.LogQL, lg.Signal.MatrixCondition)
 		c.Expected.Logs = append(c.Expected.Logs, casefile.LogAssertion{LogQL: lg.LogQL, AssertionCommon: assertion})
 	}
 	for _, m := range def.Expected.Metrics {
 		if !keepForMatrix(m.MatrixCondition, selectedMatrix) {
 			continue
 		}
-		c.Expected.Metrics = append(c.Expected.Metrics, casefile.MetricAssertion{PromQL: m.PromQL, Value: m.Value})
-		if m.MatrixCondition != "" {
+		c.Expected.Metrics = append(c.Expected.Metrics, casefile.MetricAssertion{
+			PromQL:          m.PromQL,
+			Value:           m.Value,
+			AssertionCommon: casefile.AssertionCommon{When: when(m.PromQL, m.MatrixCondition)},
+		})
+		if m.MatrixCondition != "" && !multiMatrix {
 			warnings = append(warnings, fmt.Sprintf("metric %q matrix-condition dropped", m.PromQL))
 		}
 	}
@@ -258,9 +305,9 @@ func ConvertDefinition(def model.TestCaseDefinition, name string) (*casefile.Cas
 		}
 		c.Expected.Profiles = append(c.Expected.Profiles, casefile.ProfileAssertion{
 			Query:           p.Query,
-			AssertionCommon: casefile.AssertionCommon{Match: matches},
+			AssertionCommon: casefile.AssertionCommon{Match: matches, When: when(p.Query, p.MatrixCondition)},
 		})
-		if p.MatrixCondition != "" {
+		if p.MatrixCondition != "" && !multiMatrix {
 			warnings = append(warnings, fmt.Sprintf("profile %q matrix-condition dropped", p.Query))
 		}
 	}
@@ -268,8 +315,8 @@ func ConvertDefinition(def model.TestCaseDefinition, name string) (*casefile.Cas
 		if !keepForMatrix(cc.MatrixCondition, selectedMatrix) {
 			continue
 		}
-		c.Expected.Custom = append(c.Expected.Custom, casefile.CustomCheck{Script: cc.Script})
-		if cc.MatrixCondition != "" {
+		c.Expected.Custom = append(c.Expected.Custom, casefile.CustomCheck{Script: cc.Script, When: when("custom-check", cc.MatrixCondition)})
+		if cc.MatrixCondition != "" && !multiMatrix {
 			warnings = append(warnings, "custom-check matrix-condition dropped after filtering selected matrix")
 		}
 	}
@@ -282,8 +329,11 @@ func ConvertDefinition(def model.TestCaseDefinition, name string) (*casefile.Cas
 
 // fixtureFor builds the case-local fixture: block from a legacy definition. A
 // single-matrix override (selectedMatrix) takes precedence over the config-level
-// blocks. Returns nil when the legacy definition declares no fixture.
-func fixtureFor(def model.TestCaseDefinition, selectedMatrix *model.Matrix) *casefile.FixtureConfig {
+// blocks. Returns nil when the legacy definition declares no fixture. k3d keys
+// a case requires but the legacy block, a matrix entry in particular, left out
+// stay unset with a warning, so validation names them.
+
+func fixtureFor(def model.TestCaseDefinition, selectedMatrix *model.Matrix) (*casefile.FixtureConfig, []string) {
 	dc := def.DockerCompose
 	k8s := def.Kubernetes
 	if selectedMatrix != nil {
@@ -303,10 +353,10 @@ func fixtureFor(def model.TestCaseDefinition, selectedMatrix *model.Matrix) *cas
 		} else {
 			compose.Files = dc.Files
 		}
-		return &casefile.FixtureConfig{Compose: compose}
+		return &casefile.FixtureConfig{Compose: compose}, nil
 	}
 	if k8s != nil {
-		return &casefile.FixtureConfig{K3D: &casefile.K3DFixture{
+		k3d := &casefile.K3DFixture{
 			K8sDir:           k8s.Dir,
 			AppService:       k8s.AppService,
 			AppDockerFile:    k8s.AppDockerFile,
@@ -314,9 +364,21 @@ func fixtureFor(def model.TestCaseDefinition, selectedMatrix *model.Matrix) *cas
 			AppDockerTag:     k8s.AppDockerTag,
 			AppPort:          k8s.AppDockerPort,
 			ImportImages:     k8s.ImportImages,
-		}}
+		}
+		label := "kubernetes"
+		if selectedMatrix != nil && selectedMatrix.Kubernetes != nil {
+			label = fmt.Sprintf("matrix %q kubernetes", selectedMatrix.Name)
+		}
+		var warnings []string
+		if k3d.AppDockerTag == "" {
+			warnings = append(warnings, fmt.Sprintf("%s has no app-docker-tag; set app_docker_tag to the image the manifests run", label))
+		}
+		if k3d.AppPort == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s has no app-docker-port; set app_port", label))
+		}
+		return &casefile.FixtureConfig{K3D: k3d}, warnings
 	}
-	return nil
+	return nil, nil
 }
 
 func convertSignal(label string, s model.ExpectedSignal) (casefile.AssertionCommon, []string) {
@@ -337,9 +399,6 @@ func convertSignal(label string, s model.ExpectedSignal) (casefile.AssertionComm
 			out.Count = fmt.Sprintf("<= %d", s.Count.Max)
 		}
 	}
-	if s.NoExtraAttributes {
-		warnings = append(warnings, fmt.Sprintf("%s no-extra-attributes is not supported in the current schema and was dropped", label))
-	}
 	if s.MatrixCondition != "" {
 		warnings = append(warnings, fmt.Sprintf("%s matrix-condition dropped", label))
 	}
@@ -371,6 +430,23 @@ func convertSignal(label string, s model.ExpectedSignal) (casefile.AssertionComm
 			out.Match = append(out.Match, entry)
 		}
 	}
+	if s.NoExtraAttributes && !out.Absent {
+		// Legacy allowed the union of attributes and attribute-regexp keys on
+		// the one row; split into two entries, each ignores the other's keys.
+		// Legacy only saw span and log attributes, so the resource and scope
+		// levels v3 also checks are ignored to keep that meaning.
+		if len(out.Match) == 0 {
+			out.Match = append(out.Match, casefile.MatchEntry{})
+		}
+		for i := range out.Match {
+			out.Match[i].NoExtraAttributes = true
+			keys := sortedMapKeys(s.AttributeRegexp)
+			if out.Match[i].MatchType == casefile.MatchTypeRegexp {
+				keys = sortedMapKeys(s.Attributes)
+			}
+			out.Match[i].IgnoreAttributes = append(keys, "resource.*", "scope.*")
+		}
+	}
 	if len(out.Match) == 0 && !out.Absent && out.Count == "" {
 		warnings = append(warnings, fmt.Sprintf("%s has no structural checks after migration", label))
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -171,13 +172,28 @@ func TestMigrateSignalConversionBranches(t *testing.T) {
 	}
 
 	_, warnings := convertSignal("lossy", model.ExpectedSignal{
-		Count:             &model.ExpectedRange{Min: 1, Max: 3},
-		NoExtraAttributes: true,
-		MatrixCondition:   "linux",
+		Count:           &model.ExpectedRange{Min: 1, Max: 3},
+		MatrixCondition: "linux",
 	})
-	if len(warnings) != 3 {
+	if len(warnings) != 2 {
 		t.Fatalf("lossy conversion warnings = %v", warnings)
 	}
+
+	strict, warnings := convertSignal("strict", model.ExpectedSignal{
+		NameEquals:        "span",
+		Attributes:        map[string]string{"service": "api"},
+		AttributeRegexp:   map[string]string{"level": "warn|error"},
+		NoExtraAttributes: true,
+	})
+	if len(warnings) != 0 || len(strict.Match) != 2 {
+		t.Fatalf("no-extra-attributes conversion = %+v, warnings %v", strict.Match, warnings)
+	}
+	for i, want := range []string{"level", "service"} {
+		m := strict.Match[i]
+		if !m.NoExtraAttributes || !slices.Equal(m.IgnoreAttributes, []string{want, "resource.*", "scope.*"}) {
+			t.Fatalf("match[%d] should ignore the other entry's key %q and the resource and scope: %+v", i, want, m)
+		}
+	}
 	if _, warnings := convertSignal("empty", model.ExpectedSignal{}); len(warnings) != 1 {
 		t.Fatalf("empty conversion warnings = %v", warnings)
 	}
@@ -204,7 +220,7 @@ func TestMigrateHelpers(t *testing.T) {
 	}
 
 	def := model.TestCaseDefinition{DockerCompose: &model.DockerCompose{Files: []string{"a.yml", "b.yml"}}}
-	fixture := fixtureFor(def, nil)
+	fixture, _ := fixtureFor(def, nil)
 	if fixture == nil || fixture.Compose == nil || len(fixture.Compose.Files) != 2 {
 		t.Fatalf("fixtureFor multiple compose files = %+v", fixture)
 	}
@@ -214,25 +230,52 @@ func TestMigrateHelpers(t *testing.T) {
 }
 
 func TestConvertFile_MatrixSampleIsParseable(t *testing.T) {
-	sample := filepath.Join("..", "testdata", "valid-tests", "matrix-test.oats.yaml")
-	out, warnings, err := ConvertFile(sample)
-	if err != nil {
-		fatalf(t, "ConvertFile matrix sample: %v", err)
+	samples := filepath.Join("..", "testdata", "valid-tests")
+	sample := filepath.Join(samples, "matrix-test.oats.yaml")
+	// The sample's k8s entry has no app-docker-tag or app-docker-port, which
+	// a v3 case requires: migration names both rather than inventing them.
+	_, warnings, err := ConvertFile(sample)
+	if err == nil || !strings.Contains(err.Error(), "app_docker_tag") {
+		fatalf(t, "expected validation to flag the missing k3d keys, got %v", err)
 	}
 	joined := strings.Join(warnings, "\n")
-	if !strings.Contains(joined, "matrix definitions are not migrated automatically when multiple entries exist") {
-		fatalf(t, "expected multi-matrix warning:\n%s", joined)
+	for _, want := range []string{`matrix "k8s" kubernetes has no app-docker-tag`, `matrix "k8s" kubernetes has no app-docker-port`} {
+		if !strings.Contains(joined, want) {
+			fatalf(t, "expected warning %q:\n%s", want, joined)
+		}
+	}
+
+	// With both set, the sample migrates to a parseable matrix case.
+	dir := t.TempDir()
+	for name, extra := range map[string]string{
+		"matrix-test.oats.yaml": "      app-docker-tag: test-app:dev\n      app-docker-port: 8080\n",
+		"oats-template.yaml":    "",
+	} {
+		data, err := os.ReadFile(filepath.Join(samples, name))
+		if err != nil {
+			fatalf(t, "ReadFile: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), append(data, extra...), 0o644); err != nil {
+			fatalf(t, "WriteFile: %v", err)
+		}
+	}
+	out, warnings, err := ConvertFile(filepath.Join(dir, "matrix-test.oats.yaml"))
+	if err != nil {
+		fatalf(t, "ConvertFile matrix sample: %v", err)
 	}
 	c, err := casefile.Parse(out)
 	if err != nil {
 		fatalf(t, "migrated matrix yaml should parse as v2: %v\n%s", err, string(out))
 	}
-	if c.Seed.Type != "inline-otlp" {
-		fatalf(t, "expected multi-matrix sample to fall back to inline-otlp placeholder, got %+v", c.Seed)
+	if len(c.Matrix) != 2 || c.Matrix[0].Fixture.Compose == nil || c.Matrix[1].Fixture.K3D == nil {
+		fatalf(t, "expected a docker and a k8s variant, got %+v\nwarnings: %v", c.Matrix, warnings)
 	}
 	if len(c.Input) == 0 || len(c.Expected.Traces) == 0 || len(c.Expected.Metrics) == 0 {
 		fatalf(t, "expected included template fields to survive migration, got %+v", c)
 	}
+	if k3d := c.Matrix[1].Fixture.K3D; k3d.AppDockerTag != "test-app:dev" || k3d.AppPort != 8080 {
+		fatalf(t, "expected the k3d keys to carry over, got %+v", k3d)
+	}
 }
 
 func TestConvertFile_CustomChecksRoundTrip(t *testing.T) {
@@ -372,7 +415,7 @@ func TestConvertDefinition_FlattensSingleMatrixEntry(t *testing.T) {
 	}
 }
 
-func TestConvertDefinition_MultiMatrixWarnsAndFallsBack(t *testing.T) {
+func TestConvertDefinition_MultiMatrixBecomesVariants(t *testing.T) {
 	def := model.TestCaseDefinition{
 		Matrix: []model.Matrix{
 			{
@@ -400,6 +443,7 @@ func TestConvertDefinition_MultiMatrixWarnsAndFallsBack(t *testing.T) {
 					MatrixCondition: "docker|k8s",
 				},
 			}},
+			Metrics: []model.ExpectedMetrics{{PromQL: "up", MatrixCondition: "k8s"}},
 		},
 	}
 
@@ -407,17 +451,26 @@ func TestConvertDefinition_MultiMatrixWarnsAndFallsBack(t *testing.T) {
 	if err != nil {
 		fatalf(t, "ConvertDefinition multi matrix: %v", err)
 	}
-	// Multiple matrix entries are not migrated automatically: no fixture is
-	// selected and the case falls back to the inline-otlp placeholder.
-	if c.Fixture != nil {
-		fatalf(t, "expected no fixture for multi-matrix case, got %+v", c.Fixture)
+	// Each variant carries its whole fixture; the case itself declares none.
+	if c.Fixture != nil || c.Seed.Type != "app" {
+		fatalf(t, "expected an app case without a case-level fixture, got fixture=%+v seed=%+v", c.Fixture, c.Seed)
 	}
-	if c.Seed.Type != "inline-otlp" {
-		fatalf(t, "expected inline-otlp fallback, got %+v", c.Seed)
+	if len(c.Matrix) != 2 || c.Matrix[0].Name != "docker" || c.Matrix[0].Fixture.Compose == nil || c.Matrix[1].Fixture.K3D == nil {
+		fatalf(t, "expected docker and k8s variants, got %+v", c.Matrix)
 	}
-	joined := strings.Join(warnings, "\n")
-	if !strings.Contains(joined, "matrix definitions are not migrated automatically when multiple entries exist") {
-		fatalf(t, "expected multi-matrix warning:\n%s", joined)
+	if c.Expected.Logs[0].When != "docker|k8s" || c.Expected.Metrics[0].When != "k8s" {
+		fatalf(t, "expected matrix-conditions carried over as when:, got logs=%+v metrics=%+v", c.Expected.Logs, c.Expected.Metrics)
+	}
+	if joined := strings.Join(warnings, "\n"); strings.Contains(joined, "matrix-condition dropped") {
+		fatalf(t, "matrix-conditions should not be dropped:\n%s", joined)
+	}
+
+	variants, err := c.Expand()
+	if err != nil {
+		fatalf(t, "Expand: %v", err)
+	}
+	if len(variants) != 2 || variants[0].Name != "matrix case[docker]" || len(variants[0].Expected.Metrics) != 0 || len(variants[1].Expected.Metrics) != 1 {
+		fatalf(t, "unexpected variants: %+v", variants)
 	}
 }
 
@@ -31,6 +31,7 @@ const (
 	EventCaseSkip        EventType = "case.skip"
 	EventAssertFail      EventType = "assert.fail"
 	EventGCXExec         EventType = "gcx.exec"
+	EventInputLoad       EventType = "input.load"
 )
 
 // SchemaVersion travels with each run.start event. Consumers pin to a
@@ -52,6 +53,7 @@ type Event struct {
 	// Set on run.start only.
 	OatsVersion   string `json:"oats_version,omitempty"`
 	SchemaVersion int    `json:"schema_version,omitempty"`
+	RunID         string `json:"run_id,omitempty"`
 
 	// Identifying context.
 	Group       string `json:"group,omitempty"`
@@ -70,6 +72,16 @@ type Event struct {
 	Pass       int   `json:"pass,omitempty"`
 	Fail       int   `json:"fail,omitempty"`
 	Skip       int   `json:"skip,omitempty"`
+
+	// Set on input.load only: request latency across the load input.
+	Latency *Latency `json:"latency,omitempty"`
+}
+
+// Latency summarises request latencies in milliseconds.
+type Latency struct {
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	MaxMs float64 `json:"max_ms"`
 }
 
 // Reporter consumes Events as they happen and flushes its final output when
@@ -89,7 +101,7 @@ const (
 	// VerboseDefault prints failures plus the final summary. Pass events,
 	// fixture lifecycle, and gcx exec details are silent.
 	VerboseDefault Verbosity = iota
-	// VerbosePasses adds one line per passing case.
+	// VerbosePasses adds one line per passing case and per load input.
 	VerbosePasses
 	// VerboseCmd adds the gcx invocation behind each assertion (pass or fail).
 	VerboseCmd
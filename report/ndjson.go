@@ -36,7 +36,7 @@ func (r *NDJSONReporter) Close() error { return nil }
 
 func (r *NDJSONReporter) shouldEmit(e Event) bool {
 	switch e.Type {
-	case EventCasePass:
+	case EventCasePass, EventInputLoad:
 		return r.v >= VerbosePasses
 	case EventGCXExec:
 		return r.v >= VerboseCmd
@@ -245,6 +245,25 @@ func TestNDJSONReporter_EmitsGCXExecAtVerboseCmd(t *testing.T) {
 	}
 }
 
+func TestNDJSONReporter_EmitsInputLoadAtVerbosePasses(t *testing.T) {
+	load := Event{Type: EventInputLoad, Case: "a", Message: "input[0] GET /", Pass: 9, Fail: 1, Latency: &Latency{P50Ms: 1.5, P95Ms: 4, MaxMs: 7.2}}
+	var quiet, buf bytes.Buffer
+	NewNDJSONReporter(&quiet, VerboseDefault).Emit(load)
+	if quiet.Len() != 0 {
+		t.Errorf("input.load leaked through default verbosity:\n%s", quiet.String())
+	}
+	NewNDJSONReporter(&buf, VerbosePasses).Emit(load)
+	if !strings.Contains(buf.String(), `"latency":{"p50_ms":1.5,"p95_ms":4,"max_ms":7.2}`) {
+		t.Errorf("missing latency:\n%s", buf.String())
+	}
+
+	var text bytes.Buffer
+	NewTextReporter(&text, VerbosePasses).Emit(load)
+	if want := "LOAD a  input[0] GET /: 9 ok, 1 failed in 0ms (p50 1.5ms, p95 4ms, max 7.2ms)\n"; text.String() != want {
+		t.Errorf("text = %q, want %q", text.String(), want)
+	}
+}
+
 func TestSplitSource(t *testing.T) {
 	cases := []struct {
 		in       string
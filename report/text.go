@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -67,6 +68,10 @@ func (r *TextReporter) Emit(e Event) {
 		r.recordFailure(e)
 	case EventCaseFail:
 		r.fail++
+	case EventInputLoad:
+		if r.v >= VerbosePasses {
+			r.write("LOAD %s  %s\n", e.Case, formatLoad(e))
+		}
 	case EventGCXExec:
 		if r.v >= VerboseCmd {
 			r.write("  $ %s\n", e.Cmd)
@@ -80,6 +85,20 @@ func (r *TextReporter) Emit(e Event) {
 
 func (r *TextReporter) Close() error { return nil }
 
+// formatLoad renders an input.load summary, e.g.
+// "input[0] GET /rolldice: 98 ok, 2 failed in 10012ms (p50 3.1ms, p95 9ms, max 20.4ms)".
+func formatLoad(e Event) string {
+	s := fmt.Sprintf("%s: %d ok, %d failed in %dms", e.Message, e.Pass, e.Fail, e.DurationMs)
+	if l := e.Latency; l != nil {
+		s += fmt.Sprintf(" (p50 %sms, p95 %sms, max %sms)", formatMs(l.P50Ms), formatMs(l.P95Ms), formatMs(l.MaxMs))
+	}
+	return s
+}
+
+func formatMs(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', -1, 64)
+}
+
 func (r *TextReporter) resetRunState() {
 	r.pass = 0
 	r.fail = 0
@@ -6,29 +6,60 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/grafana/oats/assert"
 	"github.com/grafana/oats/casefile"
 	"github.com/grafana/oats/report"
+	"github.com/grafana/oats/seed"
 	"github.com/grafana/oats/signalcmd"
 	"github.com/grafana/oats/wait"
 )
 
-func (r *Runner) runTrace(ctx context.Context, c *casefile.Case, a *casefile.TraceAssertion) bool {
-	if len(a.MatchSpans) > 0 {
-		return r.runTraceStructured(ctx, c, a)
+// scopeRunID reports whether an assertion's query is narrowed to telemetry
+// carrying this run's ID. Inline-otlp seeds always carry it; app telemetry
+// carries it only when the fixture injected it and the signal keeps resource
+// attributes queryable (fromApp). An explicit scope_run_id wins either way.
+func (r *Runner) scopeRunID(c *casefile.Case, a casefile.AssertionCommon, fromApp bool) bool {
+	if a.ScopeRunID != nil {
+		return *a.ScopeRunID
+	}
+	if c.Seed.EffectiveType() == "inline-otlp" {
+		return true
+	}
+	return fromApp && r.endpoint.RunIDInjected
+}
+
+func (r *Runner) runTrace(ctx context.Context, c *casefile.Case, seedStart time.Time, a *casefile.TraceAssertion, caps captures) bool {
+	if r.scopeRunID(c, a.AssertionCommon, true) {
+		scoped := *a
+		scoped.TraceQL = signalcmd.ScopeTraceQL(a.TraceQL, r.opts.RunID)
+		a = &scoped
 	}
-	args := signalcmd.Traces(*a, 0)
-	return r.pollAssert(ctx, c, args, a.Absent, func(stdout, _ string, _ int) []assert.Failure {
+	if a.TraceID != "" {
+		pinned := *a
+		pinned.TraceQL = signalcmd.TraceQLForTrace(a.TraceQL, a.TraceID)
+		a = &pinned
+	}
+	if a.Structured() {
+		return r.runTraceStructured(ctx, c, seedStart, a, caps)
+	}
+	args := func() []string { return signalcmd.Traces(*a, r.querySince(seedStart, a.AssertionCommon)) }
+	return r.pollAssert(ctx, c, args, a.Absent, caps.capturing(a.Capture, func(stdout, _ string, _ int) []assert.Failure {
 		return evalCommonText(stdout, a.AssertionCommon)
-	})
+	}))
 }
 
-func (r *Runner) runTraceStructured(ctx context.Context, c *casefile.Case, a *casefile.TraceAssertion) bool {
+func (r *Runner) runTraceStructured(ctx context.Context, c *casefile.Case, seedStart time.Time, a *casefile.TraceAssertion, caps captures) bool {
+	var cmdStr string
 	run := func() []assert.Failure {
-		searchArgs := signalcmd.Traces(*a, 0)
+		// One lookback per poll: the trace fetches below reuse the search's.
+		since := r.querySince(seedStart, a.AssertionCommon)
+		searchArgs := signalcmd.Traces(*a, since)
 		searchCmd := signalcmd.Render(searchArgs)
+		cmdStr = searchCmd
 		execCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
 		defer cancel()
 		searchRes, err := r.exec.Execute(execCtx, searchArgs...)
@@ -43,15 +74,20 @@ func (r *Runner) runTraceStructured(ctx context.Context, c *casefile.Case, a *ca
 			}
 			return []assert.Failure{{Rule: "exec", Detail: detail}}
 		}
-		rows, count, err := r.fetchTraceRows(ctx, c, searchRes.Stdout)
-		return evalTraceStructured(searchRes.Stdout, *a, rows, count, gcxParseHint(err, r.opts.GCXVersion))
+		rows, count, err := r.fetchTraceRows(ctx, c, since, searchRes.Stdout)
+		if fails := evalTraceStructured(searchRes.Stdout, *a, rows, count, gcxParseHint(err, r.opts.GCXVersion)); len(fails) > 0 {
+			return fails
+		}
+		return caps.fromOutput(a.Capture, searchRes.Stdout)
 	}
 
 	result := wait.Until[assert.Failure](ctx, wait.Options{Timeout: r.opts.Timeout, Interval: r.caseInterval(c)}, run)
 	if result.OK {
 		return true
 	}
-	cmdStr := signalcmd.Render(signalcmd.Traces(*a, 0))
+	if cmdStr == "" {
+		cmdStr = signalcmd.Render(signalcmd.Traces(*a, r.querySince(seedStart, a.AssertionCommon)))
+	}
 	for _, f := range result.LastFailures {
 		r.reporter.Emit(report.Event{
 			Type:    report.EventAssertFail,
@@ -64,7 +100,7 @@ func (r *Runner) runTraceStructured(ctx context.Context, c *casefile.Case, a *ca
 	return false
 }
 
-func (r *Runner) fetchTraceRows(ctx context.Context, c *casefile.Case, searchStdout string) ([]assert.Row, int, error) {
+func (r *Runner) fetchTraceRows(ctx context.Context, c *casefile.Case, since time.Duration, searchStdout string) ([]assert.Row, int, error) {
 	traceIDs, count, err := extractTraceIDs(searchStdout)
 	if err != nil {
 		return nil, 0, err
@@ -81,7 +117,7 @@ func (r *Runner) fetchTraceRows(ctx context.Context, c *casefile.Case, searchStd
 	}
 	var rows []assert.Row
 	for _, traceID := range traceIDs {
-		args := signalcmd.TraceGet(traceID, 0)
+		args := signalcmd.TraceGet(traceID, since)
 		execCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
 		res, err := r.exec.Execute(execCtx, args...)
 		cancel()
@@ -100,26 +136,56 @@ func (r *Runner) fetchTraceRows(ctx context.Context, c *casefile.Case, searchStd
 		if err != nil {
 			return nil, count, err
 		}
+		for i := range traceRows {
+			if traceRows[i].TraceID == "" {
+				traceRows[i].TraceID = traceID
+			}
+		}
 		rows = append(rows, traceRows...)
 	}
 	return rows, count, nil
 }
 
-func (r *Runner) runLog(ctx context.Context, c *casefile.Case, a *casefile.LogAssertion) bool {
-	args := signalcmd.Logs(*a, 0)
-	return r.pollAssert(ctx, c, args, a.Absent, func(stdout, _ string, _ int) []assert.Failure {
-		if len(a.Match) == 0 {
+func (r *Runner) runLog(ctx context.Context, c *casefile.Case, seedStart time.Time, a *casefile.LogAssertion, caps captures) bool {
+	if r.scopeRunID(c, a.AssertionCommon, true) {
+		scoped := *a
+		scoped.LogQL = signalcmd.ScopeLogQL(a.LogQL, r.opts.RunID)
+		a = &scoped
+	}
+	if a.TraceID != "" {
+		pinned := *a
+		pinned.LogQL = signalcmd.LogQLForTrace(a.LogQL, a.TraceID)
+		a = &pinned
+	}
+	args := func() []string { return signalcmd.Logs(*a, r.querySince(seedStart, a.AssertionCommon)) }
+	return r.pollAssert(ctx, c, args, a.Absent, caps.capturing(a.Capture, func(stdout, _ string, _ int) []assert.Failure {
+		if len(a.Match) == 0 && a.Cardinality == nil {
 			return evalCommonText(stdout, a.AssertionCommon)
 		}
 		rows, count, err := extractLogRows(stdout)
-		return evalCommonStructured(stdout, a.AssertionCommon, rows, count, gcxParseHint(err, r.opts.GCXVersion))
-	})
+		err = gcxParseHint(err, r.opts.GCXVersion)
+		fails := evalCommonStructured(stdout, a.AssertionCommon, rows, count, err)
+		if a.Cardinality != nil {
+			fails = append(fails, evalCardinality(rows, err, *a.Cardinality, "streams")...)
+		}
+		return fails
+	}))
 }
 
-func (r *Runner) runMetric(ctx context.Context, c *casefile.Case, a *casefile.MetricAssertion) bool {
-	args := signalcmd.Metrics(*a, 0)
-	return r.pollAssert(ctx, c, args, a.Absent, func(stdout, _ string, _ int) []assert.Failure {
-		if a.Value == "" && len(a.Match) == 0 {
+func (r *Runner) runMetric(ctx context.Context, c *casefile.Case, seedStart time.Time, a *casefile.MetricAssertion, caps captures) bool {
+	// App metrics keep resource attributes on target_info only, so injection
+	// alone never makes them scopable; inline-otlp seeds tag the data points.
+	if r.scopeRunID(c, a.AssertionCommon, false) {
+		scoped := *a
+		scoped.PromQL = signalcmd.ScopePromQL(a.PromQL, r.opts.RunID)
+		a = &scoped
+	}
+	args := func() []string { return signalcmd.Metrics(*a, r.querySince(seedStart, a.AssertionCommon)) }
+	eval := func(stdout, _ string, _ int) []assert.Failure {
+		if a.Histogram != nil {
+			return evalHistogram(stdout, *a, r.opts.GCXVersion)
+		}
+		if a.Value == "" && !a.ComparesSeries() && a.Range == nil && a.Metadata == nil && a.Cardinality == nil && len(a.Match) == 0 {
 			return evalCommonText(stdout, a.AssertionCommon)
 		}
 		rows, count, actual, err := extractMetricRows(stdout)
@@ -132,19 +198,199 @@ func (r *Runner) runMetric(ctx context.Context, c *casefile.Case, a *casefile.Me
 				fails = append(fails, assert.Value(actual, a.Value)...)
 			}
 		}
+		if a.ComparesSeries() || a.Range != nil {
+			fails = append(fails, evalSeries(stdout, *a, r.opts.GCXVersion)...)
+		}
+		if a.Metadata != nil {
+			fails = append(fails, r.evalMetadata(ctx, c, *a, rows)...)
+		}
+		if a.Cardinality != nil {
+			fails = append(fails, evalCardinality(rows, err, *a.Cardinality, "series")...)
+		}
 		return fails
-	})
+	}
+	if a.TraceID != "" {
+		check := eval
+		eval = func(stdout, stderr string, exit int) []assert.Failure {
+			return append(check(stdout, stderr, exit), r.evalExemplar(ctx, c, seedStart, *a)...)
+		}
+	}
+	return r.pollAssert(ctx, c, args, a.Absent, caps.capturing(a.Capture, eval))
+}
+
+// evalExemplar checks that an exemplar of the series a selects points at
+// a.TraceID, the metric side of an input's trace_context.
+func (r *Runner) evalExemplar(ctx context.Context, c *casefile.Case, seedStart time.Time, a casefile.MetricAssertion) []assert.Failure {
+	query := a.PromQL
+	if a.Histogram != nil {
+		query = signalcmd.HistogramQuery(a)
+	}
+	stdout, err := r.execGCX(ctx, c, signalcmd.Exemplars(query, r.querySince(seedStart, a.AssertionCommon)))
+	if err != nil {
+		return []assert.Failure{{Rule: "exec", Detail: err.Error()}}
+	}
+	rows, err := extractExemplarRows(stdout)
+	if err != nil {
+		return []assert.Failure{{Rule: "exemplar", Detail: gcxParseHint(err, r.opts.GCXVersion).Error()}}
+	}
+	for _, row := range rows {
+		if strings.EqualFold(row.TraceID, a.TraceID) {
+			return nil
+		}
+	}
+	if len(rows) == 0 {
+		return []assert.Failure{{Rule: "exemplar", Detail: fmt.Sprintf("no exemplar points at trace %s: the series have no exemplars", a.TraceID)}}
+	}
+	return []assert.Failure{{Rule: "exemplar", Detail: fmt.Sprintf("no exemplar points at trace %s: the series have %d exemplars from other traces", a.TraceID, len(rows))}}
+}
+
+// evalSeries runs a's each/any/none comparisons and range checks over every
+// returned series.
+func evalSeries(stdout string, a casefile.MetricAssertion, gcxVersion string) []assert.Failure {
+	series, err := extractMetricSeries(stdout)
+	var fails []assert.Failure
+	if a.Range != nil {
+		if err != nil {
+			fails = append(fails, assert.Failure{Rule: "range", Detail: gcxParseHint(err, gcxVersion).Error()})
+		} else {
+			fails = append(fails, assert.CheckRange(series, *a.Range, time.Now())...)
+		}
+	}
+	for _, q := range []struct {
+		rule, expr string
+		check      func([]assert.Series, string) []assert.Failure
+	}{{"each", a.Each, assert.Each}, {"any", a.Any, assert.Any}, {"none", a.None, assert.None}} {
+		switch {
+		case q.expr == "":
+		case err != nil:
+			fails = append(fails, assert.Failure{Rule: q.rule, Detail: gcxParseHint(err, gcxVersion).Error()})
+		default:
+			fails = append(fails, q.check(series, q.expr)...)
+		}
+	}
+	return fails
+}
+
+// evalMetadata fetches the metadata of the metric a selects and checks it.
+// The metadata API is asked first, under the name as written and, for a
+// counter's _total series, its family name; when it has no entry the
+// series' own type and unit labels are used.
+func (r *Runner) evalMetadata(ctx context.Context, c *casefile.Case, a casefile.MetricAssertion, rows []assert.Row) []assert.Failure {
+	name, _, err := a.Selector()
+	if err != nil {
+		return []assert.Failure{{Rule: "metadata", Detail: err.Error()}}
+	}
+	names := []string{name}
+	if family, ok := strings.CutSuffix(name, "_total"); ok {
+		names = append(names, family)
+	}
+	for _, n := range names {
+		args := signalcmd.MetricMetadata(n)
+		execCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+		res, err := r.exec.Execute(execCtx, args...)
+		cancel()
+		if err != nil {
+			return []assert.Failure{{Rule: "exec", Detail: err.Error()}}
+		}
+		r.reporter.Emit(report.Event{Type: report.EventGCXExec, Case: c.Name, Cmd: signalcmd.Render(args)})
+		if res.ExitCode != 0 {
+			break // no metadata API behind this gcx; fall back to labels
+		}
+		md, ok, err := extractMetricMetadata(res.Stdout, n)
+		if err != nil {
+			return []assert.Failure{{Rule: "metadata", Detail: gcxParseHint(err, r.opts.GCXVersion).Error()}}
+		}
+		if ok {
+			md.Temporality = seriesTemporality(md, rows, seededTemporality(c, names))
+			return assert.CheckMetadata(md, *a.Metadata)
+		}
+	}
+	md, ok := metadataFromLabels(rows)
+	if !ok {
+		return []assert.Failure{{
+			Rule:   "metadata",
+			Detail: fmt.Sprintf("no metadata for %s: the metadata API has no entry and the series carry no __type__ label", name),
+		}}
+	}
+	md.Temporality = seriesTemporality(md, rows, seededTemporality(c, names))
+	return assert.CheckMetadata(md, *a.Metadata)
+}
+
+// seededTemporality is the temporality of the case's inline-OTLP seed metric
+// stored under one of names, or "" when the case seeds no such metric.
+// Prometheus-compatible backends store a seeded sum as name_total and a
+// histogram as name_bucket, name_count and name_sum.
+func seededTemporality(c *casefile.Case, names []string) string {
+	if c.Seed.EffectiveType() != "inline-otlp" {
+		return ""
+	}
+	for _, m := range c.Seed.Metrics {
+		base := strings.NewReplacer(".", "_", "-", "_").Replace(m.Name)
+		stored := []string{base, base + "_total"}
+		if m.Histogram != nil {
+			stored = []string{base, base + "_bucket", base + "_count", base + "_sum"}
+		}
+		for _, n := range names {
+			if slices.Contains(stored, n) {
+				return seed.Temporality
+			}
+		}
+	}
+	return ""
 }
 
-func (r *Runner) runProfile(ctx context.Context, c *casefile.Case, a *casefile.ProfileAssertion) bool {
-	args := signalcmd.Profiles(*a, 0)
-	return r.pollAssert(ctx, c, args, a.Absent, func(stdout, _ string, _ int) []assert.Failure {
+// evalHistogram sums the histogram series in stdout and runs a's histogram
+// checks, alongside the contains/not_contains/regex text checks.
+func evalHistogram(stdout string, a casefile.MetricAssertion, gcxVersion string) []assert.Failure {
+	var fails []assert.Failure
+	fails = append(fails, assert.Contains(stdout, a.Contains)...)
+	fails = append(fails, assert.NotContains(stdout, a.NotContains)...)
+	fails = append(fails, assert.Regex(stdout, a.Regex)...)
+	name, _, err := a.Selector()
+	if err != nil {
+		return append(fails, assert.Failure{Rule: "histogram", Detail: err.Error()})
+	}
+	if a.Cardinality != nil {
+		// Native histogram series carry no scalar value; only the labels
+		// matter here, so a value error with the rows parsed is no failure.
+		rows, _, _, err := extractMetricRows(stdout)
+		if len(rows) > 0 {
+			err = nil
+		}
+		fails = append(fails, evalCardinality(rows, gcxParseHint(err, gcxVersion), *a.Cardinality, "series")...)
+	}
+	h, err := extractHistogram(stdout, name)
+	if err != nil {
+		return append(fails, assert.Failure{Rule: "histogram", Detail: gcxParseHint(err, gcxVersion).Error()})
+	}
+	return append(fails, assert.CheckHistogram(h, *a.Histogram)...)
+}
+
+// evalCardinality checks a budget against the series or streams behind rows.
+// A log row's stream is its resource level, the stream labels.
+func evalCardinality(rows []assert.Row, parseErr error, b casefile.CardinalityBudget, noun string) []assert.Failure {
+	if parseErr != nil {
+		return []assert.Failure{{Rule: "cardinality", Detail: parseErr.Error()}}
+	}
+	labelSets := make([]map[string]string, len(rows))
+	for i, row := range rows {
+		labelSets[i] = row.Attributes
+		if stream, ok := row.Levels["resource"]; ok {
+			labelSets[i] = stream
+		}
+	}
+	return assert.Cardinality(labelSets, b, noun)
+}
+
+func (r *Runner) runProfile(ctx context.Context, c *casefile.Case, seedStart time.Time, a *casefile.ProfileAssertion, caps captures) bool {
+	args := func() []string { return signalcmd.Profiles(*a, r.querySince(seedStart, a.AssertionCommon)) }
+	return r.pollAssert(ctx, c, args, a.Absent, caps.capturing(a.Capture, func(stdout, _ string, _ int) []assert.Failure {
 		if len(a.Match) == 0 {
 			return evalCommonText(stdout, a.AssertionCommon)
 		}
 		rows, count, err := extractProfileRows(stdout)
 		return evalCommonStructured(stdout, a.AssertionCommon, rows, count, gcxParseHint(err, r.opts.GCXVersion))
-	})
+	}))
 }
 
 func gcxParseHint(err error, version string) error {
@@ -193,6 +439,10 @@ func evalTraceStructured(stdout string, a casefile.TraceAssertion, rows []assert
 		}
 		fails = append(fails, spanFails...)
 	}
+	fails = append(fails, assert.MatchTree(rows, a.Tree)...)
+	if a.SingleTrace {
+		fails = append(fails, assert.SingleTrace(rows)...)
+	}
 	if a.Count != "" {
 		fails = append(fails, assert.Count(count, a.Count)...)
 	}
@@ -0,0 +1,191 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/oats/assert"
+	"github.com/grafana/oats/casefile"
+	"github.com/grafana/oats/testhelpers/requests"
+)
+
+// captures holds the values one case run's steps captured, by name. Inputs
+// and assertions run one at a time, so it needs no locking.
+type captures map[string]string
+
+// fromResponse takes the captures an HTTP input declares from its response.
+// Nothing is recorded unless every capture succeeds.
+func (cs captures) fromResponse(specs map[string]casefile.CaptureSource, resp *requests.Response) error {
+	return cs.take(specs, resp.Header, string(resp.Body))
+}
+
+// fromCommand takes the captures a Compose input declares from the stdout
+// of its command, so the command can log to stderr freely.
+func (cs captures) fromCommand(specs map[string]casefile.CaptureSource, stdout string) error {
+	return cs.take(specs, nil, stdout)
+}
+
+func (cs captures) take(specs map[string]casefile.CaptureSource, header http.Header, body string) error {
+	taken := map[string]string{}
+	for _, name := range slices.Sorted(maps.Keys(specs)) {
+		v, err := captureValue(specs[name], header, body)
+		if err != nil {
+			return fmt.Errorf("capture %s: %w", name, err)
+		}
+		taken[name] = v
+	}
+	maps.Copy(cs, taken)
+	return nil
+}
+
+// fromOutput takes the captures an assertion declares from the gcx output of
+// its passing poll. A capture that cannot be taken fails the poll, so it is
+// retried like any other check.
+func (cs captures) fromOutput(specs map[string]casefile.CaptureSource, stdout string) []assert.Failure {
+	taken := map[string]string{}
+	var fails []assert.Failure
+	for _, name := range slices.Sorted(maps.Keys(specs)) {
+		v, err := captureValue(specs[name], nil, stdout)
+		if err != nil {
+			fails = append(fails, assert.Failure{Rule: "capture", Detail: fmt.Sprintf("%s: %v", name, err)})
+			continue
+		}
+		taken[name] = v
+	}
+	if len(fails) == 0 {
+		maps.Copy(cs, taken)
+	}
+	return fails
+}
+
+// capturing wraps an assertion's eval so that a passing poll also takes the
+// assertion's captures.
+func (cs captures) capturing(specs map[string]casefile.CaptureSource, eval func(stdout, stderr string, exit int) []assert.Failure) func(stdout, stderr string, exit int) []assert.Failure {
+	if len(specs) == 0 {
+		return eval
+	}
+	return func(stdout, stderr string, exit int) []assert.Failure {
+		if fails := eval(stdout, stderr, exit); len(fails) > 0 {
+			return fails
+		}
+		return cs.fromOutput(specs, stdout)
+	}
+}
+
+// captureValue extracts one value from a response (header and body) or from
+// gcx output (body alone).
+func captureValue(src casefile.CaptureSource, header http.Header, body string) (string, error) {
+	value := body
+	switch {
+	case src.Header != "":
+		value = header.Get(src.Header)
+		if value == "" {
+			return "", fmt.Errorf("header %s is not in the response", src.Header)
+		}
+	case src.JSON != "":
+		v, err := jsonPath(body, src.JSON)
+		if err != nil {
+			return "", fmt.Errorf("json %s: %w", src.JSON, err)
+		}
+		value = v
+	case src.TraceID:
+		ids, _, err := extractTraceIDs(body)
+		if err != nil {
+			return "", err
+		}
+		if len(ids) == 0 {
+			return "", fmt.Errorf("trace_id: the search returned no traces")
+		}
+		value = ids[0]
+	}
+	if src.Regex == "" {
+		return value, nil
+	}
+	m := regexp.MustCompile(src.Regex).FindStringSubmatch(value)
+	if m == nil {
+		return "", fmt.Errorf("regex %q did not match", src.Regex)
+	}
+	if len(m) > 1 {
+		return m[1], nil
+	}
+	return m[0], nil
+}
+
+// jsonPath walks a dotted path through a JSON document; numeric parts index
+// lists, e.g. "data.result.0.metric.pod". The value must be a scalar.
+func jsonPath(doc, path string) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(doc)))
+	dec.UseNumber()
+	var cur any
+	if err := dec.Decode(&cur); err != nil {
+		return "", fmt.Errorf("not JSON: %w", err)
+	}
+	walked := ""
+	for _, part := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[part]
+			if !ok {
+				return "", fmt.Errorf("no key %q", walked+part)
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("no index %q (the list has %d items)", walked+part, len(v))
+			}
+			cur = v[i]
+		default:
+			if walked == "" {
+				return "", fmt.Errorf("the document is a scalar")
+			}
+			return "", fmt.Errorf("%q is a scalar", strings.TrimSuffix(walked, "."))
+		}
+		walked += part + "."
+	}
+	switch v := cur.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case map[string]any, []any:
+		return "", fmt.Errorf("value is not a scalar")
+	case nil:
+		return "", nil
+	}
+	return fmt.Sprint(cur), nil
+}
+
+// scope is the interpolation scope for this run, with the values captured
+// so far.
+func (r *Runner) scope(caps captures) casefile.Scope {
+	return casefile.Scope{
+		Env:      os.LookupEnv,
+		Run:      map[string]string{"id": r.opts.RunID},
+		Captures: caps,
+	}
+}
+
+// withCaptures returns the case to run the step at path from: c itself when
+// the step reads no captures, otherwise raw expanded again with the values
+// captured so far. A capture whose step did not pass is an error.
+func (r *Runner) withCaptures(raw, c *casefile.Case, caps captures, path string) (*casefile.Case, error) {
+	refs := raw.CaptureRefs(path)
+	if len(refs) == 0 {
+		return c, nil
+	}
+	for _, name := range refs {
+		if _, ok := caps[name]; !ok {
+			return nil, fmt.Errorf("%s: capture %q has no value; the step that takes it did not pass", path, name)
+		}
+	}
+	return raw.Interpolate(r.scope(caps))
+}
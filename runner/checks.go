@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/grafana/oats/assert"
@@ -55,7 +56,8 @@ func (r *Runner) runCustomCheck(ctx context.Context, c *casefile.Case, chk *case
 		deadlineCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
 		defer cancel()
 
-		cmd, cleanup, err := customCheckCommand(deadlineCtx, dir, chk.Script, r.endpoint.CustomCheckEnv)
+		env := append(slices.Clip(r.endpoint.CustomCheckEnv), "OATS_RUN_ID="+r.opts.RunID)
+		cmd, cleanup, err := customCheckCommand(deadlineCtx, dir, chk.Script, env)
 		if err != nil {
 			return []assert.Failure{{Rule: "custom-check-setup", Detail: err.Error()}}
 		}
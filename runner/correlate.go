@@ -0,0 +1,213 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/oats/assert"
+	"github.com/grafana/oats/casefile"
+	"github.com/grafana/oats/report"
+	"github.com/grafana/oats/signalcmd"
+	"github.com/grafana/oats/wait"
+)
+
+// maxCorrelatedIDs caps how many IDs one poll resolves, so a busy source
+// query doesn't turn into hundreds of gcx calls.
+const maxCorrelatedIDs = 20
+
+// profileIDAttribute is the span attribute span profiling sets on the spans
+// whose profiles Pyroscope labelled with their span ID.
+const profileIDAttribute = "pyroscope.profile.id"
+
+// runCorrelation chains gcx calls the way fetchTraceRows chains search and
+// get: the source query yields IDs, and each ID is looked up in the target
+// signal until the resolve mode is satisfied or the timeout expires.
+func (r *Runner) runCorrelation(ctx context.Context, c *casefile.Case, seedStart time.Time, corr *casefile.Correlation) bool {
+	sourceArgs := func(since time.Duration) []string {
+		from := corr.From
+		switch from.Signal() {
+		case "logs":
+			query := from.LogQL
+			if r.scopeRunID(c, casefile.AssertionCommon{}, true) {
+				query = signalcmd.ScopeLogQL(query, r.opts.RunID)
+			}
+			return signalcmd.LogSearch(query, since)
+		case "exemplars":
+			query := from.Exemplars
+			if r.scopeRunID(c, casefile.AssertionCommon{}, false) {
+				query = signalcmd.ScopePromQL(query, r.opts.RunID)
+			}
+			return signalcmd.Exemplars(query, since)
+		}
+		query := from.TraceQL
+		if r.scopeRunID(c, casefile.AssertionCommon{}, true) {
+			query = signalcmd.ScopeTraceQL(query, r.opts.RunID)
+		}
+		return signalcmd.TraceSearch(query, since)
+	}
+
+	var cmdStr string
+	run := func() []assert.Failure {
+		since := r.querySince(seedStart, casefile.AssertionCommon{})
+		args := sourceArgs(since)
+		cmdStr = signalcmd.Render(args)
+		stdout, err := r.execGCX(ctx, c, args)
+		if err != nil {
+			return []assert.Failure{{Rule: "exec", Detail: err.Error()}}
+		}
+		ids, err := r.correlationIDs(ctx, c, since, corr.From, stdout)
+		if err != nil {
+			return []assert.Failure{{Rule: "correlate", Detail: gcxParseHint(err, r.opts.GCXVersion).Error()}}
+		}
+		result := assert.Correlation{From: corr.From.Signal(), Resolve: corr.EffectiveResolve()}
+		result.Noun, result.To = "trace ID", "traces"
+		if corr.To.Profiles != "" {
+			result.Noun, result.To = "span ID", "profiles"
+		}
+		for _, id := range ids {
+			reason, err := r.resolveID(ctx, c, since, corr.To, id)
+			if err != nil {
+				return []assert.Failure{{Rule: "correlate", Detail: gcxParseHint(err, r.opts.GCXVersion).Error()}}
+			}
+			result.Results = append(result.Results, assert.Resolution{ID: id, Reason: reason})
+			if reason == "" && result.Resolve == "any" {
+				break
+			}
+		}
+		return assert.CheckCorrelation(result)
+	}
+
+	result := wait.Until[assert.Failure](ctx, wait.Options{Timeout: r.opts.Timeout, Interval: r.caseInterval(c)}, run)
+	if result.OK {
+		return true
+	}
+	if cmdStr == "" {
+		cmdStr = signalcmd.Render(sourceArgs(r.querySince(seedStart, casefile.AssertionCommon{})))
+	}
+	for _, f := range result.LastFailures {
+		r.reporter.Emit(report.Event{
+			Type:    report.EventAssertFail,
+			Case:    c.Name,
+			Source:  c.SourcePath,
+			Message: f.Error(),
+			Cmd:     cmdStr,
+		})
+	}
+	return false
+}
+
+// correlationIDs runs the source side: it parses the rows the source query
+// returned, keeps those matching from.match, and collects the distinct IDs
+// they carry, at most maxCorrelatedIDs of them.
+func (r *Runner) correlationIDs(ctx context.Context, c *casefile.Case, since time.Duration, from casefile.CorrelationSource, stdout string) ([]string, error) {
+	var (
+		rows []assert.Row
+		err  error
+	)
+	switch from.Signal() {
+	case "logs":
+		rows, _, err = extractLogRows(stdout)
+	case "exemplars":
+		rows, err = extractExemplarRows(stdout)
+	default:
+		rows, _, err = r.fetchTraceRows(ctx, c, since, stdout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	seen := map[string]bool{}
+	for _, row := range assert.FilterRows(rows, from.Match) {
+		id := correlationID(from.Signal(), row)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		if len(ids) == maxCorrelatedIDs {
+			break
+		}
+	}
+	return ids, nil
+}
+
+// correlationID is the ID a source row links by: the trace ID on a log line
+// or exemplar, or the span ID span profiling recorded on a span.
+func correlationID(signal string, row assert.Row) string {
+	switch signal {
+	case "traces":
+		return row.Attributes[profileIDAttribute]
+	case "exemplars":
+		return row.TraceID
+	}
+	for _, key := range []string{"trace_id", "traceid", "traceID"} {
+		if id := row.Attributes[key]; id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// resolveID looks id up in the target signal. It returns why the ID did not
+// resolve, or "" when it did; an error means the lookup itself failed.
+func (r *Runner) resolveID(ctx context.Context, c *casefile.Case, since time.Duration, to casefile.CorrelationTarget, id string) (string, error) {
+	if to.Profiles != "" {
+		stdout, err := r.execGCX(ctx, c, signalcmd.ProfilesForSpan(to.Profiles, id, since))
+		if err != nil {
+			return "", err
+		}
+		_, count, err := extractProfileRows(stdout)
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return "no profile samples", nil
+		}
+		return "", nil
+	}
+	stdout, err := r.execGCX(ctx, c, signalcmd.TraceSearch(signalcmd.TraceQLForTrace(to.TraceQL, id), since))
+	if err != nil {
+		return "", err
+	}
+	_, count, err := extractTraceIDs(stdout)
+	if err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "no trace matched", nil
+	}
+	if len(to.MatchSpans) == 0 {
+		return "", nil
+	}
+	rows, _, err := r.fetchTraceRows(ctx, c, since, stdout)
+	if err != nil {
+		return "", err
+	}
+	if fails := assert.MatchRows(rows, to.MatchSpans); len(fails) > 0 {
+		return fails[0].Detail, nil
+	}
+	return "", nil
+}
+
+// execGCX runs one gcx command and returns its stdout; a non-zero exit is
+// an error carrying gcx's stderr.
+func (r *Runner) execGCX(ctx context.Context, c *casefile.Case, args []string) (string, error) {
+	execCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+	res, err := r.exec.Execute(execCtx, args...)
+	if err != nil {
+		return "", err
+	}
+	r.reporter.Emit(report.Event{Type: report.EventGCXExec, Case: c.Name, Cmd: signalcmd.Render(args)})
+	if res.ExitCode != 0 {
+		detail := strings.TrimSpace(res.Stderr)
+		if detail == "" {
+			detail = fmt.Sprintf("gcx exit code %d", res.ExitCode)
+		}
+		return "", errors.New(detail)
+	}
+	return res.Stdout, nil
+}
@@ -0,0 +1,275 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/grafana/oats/casefile"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Server reflection methods; the v1 and v1alpha messages share a wire
+// format, so the v1 types serve both.
+const (
+	reflectionV1      = "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"
+	reflectionV1Alpha = "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"
+)
+
+// doGRPC drives a gRPC input: one unary call to the application endpoint,
+// whose status must match the input's. Captures read the response message as
+// protobuf JSON, and its header metadata.
+func (r *Runner) doGRPC(ctx context.Context, in casefile.Input, caps captures) error {
+	g := *in.GRPC
+	if r.endpoint.AppHost == "" || r.endpoint.AppPort == 0 {
+		return fmt.Errorf("input requires application endpoint; set --app-host/--app-port or provide fixture-derived app endpoint")
+	}
+	want, err := g.ExpectedStatus()
+	if err != nil {
+		return err
+	}
+	md := metadata.New(g.Metadata)
+	var traceID string
+	if in.TraceContext != nil {
+		headers, id, err := newTraceContext(*in.TraceContext)
+		if err != nil {
+			return fmt.Errorf("trace_context: %w", err)
+		}
+		for k, v := range headers {
+			md.Set(k, v)
+		}
+		traceID = id
+	}
+	conn, err := grpc.NewClient(net.JoinHostPort(r.endpoint.AppHost, strconv.Itoa(r.endpoint.AppPort)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	var method protoreflect.MethodDescriptor
+	do := func(ctx context.Context) error {
+		if method == nil {
+			m, err := grpcMethod(ctx, conn, g)
+			if err != nil {
+				return err
+			}
+			method = m
+		}
+		body := g.Request
+		if body == "" {
+			body = "{}"
+		}
+		req := dynamicpb.NewMessage(method.Input())
+		if err := protojson.Unmarshal([]byte(body), req); err != nil {
+			return fmt.Errorf("request: %w", err)
+		}
+		resp := dynamicpb.NewMessage(method.Output())
+		var header metadata.MD
+		err := conn.Invoke(metadata.NewOutgoingContext(ctx, md), "/"+g.Service+"/"+g.Method, req, resp, grpc.Header(&header))
+		if got := status.Code(err); got != codes.Code(want) {
+			if err == nil {
+				return fmt.Errorf("status OK, want %s", grpcCodeName(codes.Code(want)))
+			}
+			return fmt.Errorf("status %s, want %s: %s", grpcCodeName(got), grpcCodeName(codes.Code(want)), status.Convert(err).Message())
+		}
+		if len(in.Capture) > 0 {
+			out, err := protojson.Marshal(resp)
+			if err != nil {
+				return fmt.Errorf("response: %w", err)
+			}
+			h := http.Header{}
+			for k, vs := range header {
+				for _, v := range vs {
+					h.Add(k, v)
+				}
+			}
+			if err := caps.take(in.Capture, h, string(out)); err != nil {
+				return err
+			}
+		}
+		if in.TraceContext != nil {
+			caps[in.TraceContext.EffectiveCapture()] = traceID
+		}
+		return nil
+	}
+	return r.retrying(ctx, in.Retry, do)
+}
+
+func grpcCodeName(c codes.Code) string {
+	if int(c) < len(casefile.GRPCCodes) {
+		return casefile.GRPCCodes[c]
+	}
+	return c.String()
+}
+
+// grpcMethod resolves the input's method from its descriptor set, or from
+// server reflection when it has none. Only unary methods are supported.
+func grpcMethod(ctx context.Context, conn *grpc.ClientConn, g casefile.GRPCInput) (protoreflect.MethodDescriptor, error) {
+	var files []*descriptorpb.FileDescriptorProto
+	var err error
+	if g.DescriptorSet != "" {
+		files, err = readDescriptorSet(g.DescriptorSet)
+	} else {
+		files, err = reflectDescriptors(ctx, conn, g.Service)
+	}
+	if err != nil {
+		return nil, err
+	}
+	reg, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: withLinkedImports(files)})
+	if err != nil {
+		return nil, fmt.Errorf("descriptors: %w", err)
+	}
+	d, err := reg.FindDescriptorByName(protoreflect.FullName(g.Service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s is not in the descriptors", g.Service)
+	}
+	svc, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", g.Service)
+	}
+	m := svc.Methods().ByName(protoreflect.Name(g.Method))
+	if m == nil {
+		return nil, fmt.Errorf("service %s has no method %s", g.Service, g.Method)
+	}
+	if m.IsStreamingClient() || m.IsStreamingServer() {
+		return nil, fmt.Errorf("%s/%s is a streaming method; only unary methods are supported", g.Service, g.Method)
+	}
+	return m, nil
+}
+
+func readDescriptorSet(path string) ([]*descriptorpb.FileDescriptorProto, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor_set: %w", err)
+	}
+	set := new(descriptorpb.FileDescriptorSet)
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("descriptor_set %s: not a FileDescriptorSet: %w", path, err)
+	}
+	return set.GetFile(), nil
+}
+
+// withLinkedImports adds the imports missing from files that this binary
+// links in, such as the well-known types, so a descriptor set built without
+// --include_imports still resolves.
+func withLinkedImports(files []*descriptorpb.FileDescriptorProto) []*descriptorpb.FileDescriptorProto {
+	have := map[string]bool{}
+	for _, fd := range files {
+		have[fd.GetName()] = true
+	}
+	for i := 0; i < len(files); i++ {
+		for _, dep := range files[i].GetDependency() {
+			if have[dep] {
+				continue
+			}
+			have[dep] = true
+			if fd, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				files = append(files, protodesc.ToFileDescriptorProto(fd))
+			}
+		}
+	}
+	return files
+}
+
+// reflectDescriptors fetches the file defining service, and the files it
+// imports, through server reflection, falling back to v1alpha for servers
+// that only offer that.
+func reflectDescriptors(ctx context.Context, conn *grpc.ClientConn, service string) ([]*descriptorpb.FileDescriptorProto, error) {
+	files, err := reflectFiles(ctx, conn, reflectionV1, service)
+	if status.Code(err) == codes.Unimplemented {
+		files, err = reflectFiles(ctx, conn, reflectionV1Alpha, service)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("server reflection: %w", err)
+	}
+	return files, nil
+}
+
+func reflectFiles(ctx context.Context, conn *grpc.ClientConn, method, service string) ([]*descriptorpb.FileDescriptorProto, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, method)
+	if err != nil {
+		return nil, err
+	}
+	ask := func(req *reflectionpb.ServerReflectionRequest) ([][]byte, error) {
+		// On io.EOF the stream is done and RecvMsg returns why.
+		if err := stream.SendMsg(req); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		resp := new(reflectionpb.ServerReflectionResponse)
+		if err := stream.RecvMsg(resp); err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+		}
+		return resp.GetFileDescriptorResponse().GetFileDescriptorProto(), nil
+	}
+
+	var files []*descriptorpb.FileDescriptorProto
+	seen := map[string]bool{}
+	add := func(raw [][]byte) error {
+		for _, b := range raw {
+			fd := new(descriptorpb.FileDescriptorProto)
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return fmt.Errorf("file descriptor: %w", err)
+			}
+			if !seen[fd.GetName()] {
+				seen[fd.GetName()] = true
+				files = append(files, fd)
+			}
+		}
+		return nil
+	}
+	raw, err := ask(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := add(raw); err != nil {
+		return nil, err
+	}
+	// Servers usually send the imports along; ask for any they left out.
+	for i := 0; i < len(files); i++ {
+		for _, dep := range files[i].GetDependency() {
+			if seen[dep] {
+				continue
+			}
+			if _, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				continue // withLinkedImports adds it
+			}
+			raw, err := ask(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("import %s: %w", dep, err)
+			}
+			if err := add(raw); err != nil {
+				return nil, err
+			}
+			seen[dep] = true
+		}
+	}
+	_ = stream.CloseSend()
+	return files, nil
+}
@@ -0,0 +1,142 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/grafana/oats/casefile"
+	"github.com/grafana/oats/report"
+	"github.com/grafana/oats/testhelpers/requests"
+)
+
+// driveLoad sends an HTTP input repeatedly: Repeat requests in total, or as
+// many as fit in Duration, from Concurrency workers sharing one Rate. Each
+// request gets its own Timeout, and one still in flight at the end of
+// Duration is allowed to finish. The summary is emitted as an input.load
+// event; any failed request fails the input.
+func (r *Runner) driveLoad(ctx context.Context, caseName, path string, in casefile.Input) error {
+	req, err := r.httpRequest(in)
+	if err != nil {
+		return err
+	}
+	var tick <-chan time.Time
+	if in.Rate != "" {
+		perSecond, err := casefile.ParseRate(in.Rate)
+		if err != nil {
+			return fmt.Errorf("rate: %w", err)
+		}
+		ticker := time.NewTicker(max(time.Duration(float64(time.Second)/perSecond), time.Nanosecond))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	loadCtx := ctx
+	if in.Duration > 0 {
+		var cancel context.CancelFunc
+		loadCtx, cancel = context.WithTimeout(ctx, in.Duration)
+		defer cancel()
+	}
+
+	var (
+		mu        sync.Mutex
+		remaining = in.Repeat
+		stats     loadStats
+	)
+	claim := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if in.Repeat == 0 {
+			return true
+		}
+		if remaining == 0 {
+			return false
+		}
+		remaining--
+		return true
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range max(in.Concurrency, 1) {
+		wg.Go(func() {
+			for claim() {
+				if tick != nil {
+					select {
+					case <-tick:
+					case <-loadCtx.Done():
+						return
+					}
+				}
+				if loadCtx.Err() != nil {
+					return
+				}
+				sent := time.Now()
+				reqCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+				_, err := requests.DoHTTPRequestWithResponse(reqCtx, req.url, req.method, req.headers, in.Body, req.status)
+				cancel()
+				mu.Lock()
+				stats.record(time.Since(sent), err)
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	r.reporter.Emit(report.Event{
+		Type:       report.EventInputLoad,
+		Case:       caseName,
+		Message:    fmt.Sprintf("%s %s %s", path, req.method, in.Path),
+		DurationMs: time.Since(start).Milliseconds(),
+		Pass:       stats.ok,
+		Fail:       len(stats.errs),
+		Latency:    stats.latency(),
+	})
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case len(stats.errs) > 0:
+		return fmt.Errorf("%d of %d requests failed (first: %v)", len(stats.errs), stats.ok+len(stats.errs), stats.errs[0])
+	case stats.ok == 0:
+		return fmt.Errorf("sent no requests in %s; raise duration or rate", in.Duration)
+	}
+	return nil
+}
+
+// loadStats accumulates the outcome of a load input's requests.
+type loadStats struct {
+	ok        int
+	errs      []error
+	latencies []time.Duration
+}
+
+func (s *loadStats) record(d time.Duration, err error) {
+	s.latencies = append(s.latencies, d)
+	if err != nil {
+		s.errs = append(s.errs, err)
+		return
+	}
+	s.ok++
+}
+
+// latency summarises every request, failed ones included, using the
+// nearest-rank percentile.
+func (s *loadStats) latency() *report.Latency {
+	if len(s.latencies) == 0 {
+		return nil
+	}
+	sorted := slices.Sorted(slices.Values(s.latencies))
+	rank := func(q float64) time.Duration {
+		i := int(math.Ceil(q*float64(len(sorted)))) - 1
+		return sorted[max(i, 0)]
+	}
+	ms := func(d time.Duration) float64 {
+		return float64(d.Round(100*time.Microsecond)) / float64(time.Millisecond)
+	}
+	return &report.Latency{
+		P50Ms: ms(rank(0.5)),
+		P95Ms: ms(rank(0.95)),
+		MaxMs: ms(sorted[len(sorted)-1]),
+	}
+}
@@ -3,9 +3,16 @@
 package runner
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/grafana/oats/assert"
 )
@@ -119,6 +126,282 @@ func extractMetricRows(stdout string) ([]assert.Row, int, float64, error) {
 	return rows, len(generic.Data.Result), f, nil
 }
 
+// extractMetricSeries returns every series in `gcx metrics query -o json`
+// output with its points, for the each/any/none comparisons and range
+// checks. An instant query yields one point per series.
+func extractMetricSeries(stdout string) ([]assert.Series, error) {
+	if strings.TrimSpace(stdout) == "" {
+		return nil, parseErrorf("metric value parse: empty result")
+	}
+	var generic struct {
+		Data struct {
+			Result []struct {
+				Metric map[string]any `json:"metric"`
+				Value  [2]any         `json:"value"`
+				Values [][2]any       `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &generic); err != nil {
+		return nil, parseErrorf("metric JSON parse: %w", err)
+	}
+	series := make([]assert.Series, 0, len(generic.Data.Result))
+	for _, item := range generic.Data.Result {
+		labels := stringifyMap(item.Metric)
+		points := item.Values
+		if len(points) == 0 && item.Value[1] != nil {
+			points = [][2]any{item.Value}
+		}
+		if len(points) == 0 {
+			return nil, parseErrorf("metric value parse: series %v has no numeric value", labels)
+		}
+		s := assert.Series{Labels: labels, Samples: make([]assert.Sample, 0, len(points))}
+		for _, p := range points {
+			sample, ok := parseSample(p)
+			if !ok {
+				return nil, parseErrorf("metric value parse: series %v has a point %v that is not [timestamp, number]", labels, p)
+			}
+			s.Samples = append(s.Samples, sample)
+		}
+		s.Value = s.Samples[len(s.Samples)-1].Value
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// parseSample reads a Prometheus API point: [unix seconds, "value"].
+func parseSample(p [2]any) (assert.Sample, bool) {
+	ts, ok := p[0].(float64)
+	raw, isStr := p[1].(string)
+	if !ok || !isStr {
+		return assert.Sample{}, false
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return assert.Sample{}, false
+	}
+	sec, frac := math.Modf(ts)
+	return assert.Sample{Time: time.Unix(int64(sec), int64(frac*1e9)), Value: v}, true
+}
+
+// extractMetricMetadata finds name in `gcx metrics metadata -o json` output,
+// which follows the Prometheus metadata API: metric name to a list of
+// {type, help, unit}. ok is false when the backend has no entry for name.
+func extractMetricMetadata(stdout, name string) (md assert.MetricMetadata, ok bool, err error) {
+	var data map[string][]struct {
+		Type string `json:"type"`
+		Help string `json:"help"`
+		Unit string `json:"unit"`
+	}
+	if err := decodeGCXData(stdout, "metadata", &data); err != nil {
+		return assert.MetricMetadata{}, false, err
+	}
+	entries := data[name]
+	if len(entries) == 0 {
+		return assert.MetricMetadata{}, false, nil
+	}
+	e := entries[0]
+	return assert.MetricMetadata{Type: e.Type, Unit: e.Unit, Description: e.Help, Source: "the metadata API"}, true, nil
+}
+
+// metadataFromLabels reads the __type__ and __unit__ labels a backend with
+// type-and-unit labels attaches to each series, for metrics the metadata API
+// has no entry for.
+func metadataFromLabels(rows []assert.Row) (assert.MetricMetadata, bool) {
+	for _, row := range rows {
+		if typ := row.Attributes["__type__"]; typ != "" {
+			return assert.MetricMetadata{Type: typ, Unit: row.Attributes["__unit__"], Source: "the series' __type__ label"}, true
+		}
+	}
+	return assert.MetricMetadata{}, false
+}
+
+// seriesTemporality is the temporality the series were stored with. A backend
+// ingesting OTLP deltas natively marks them with a __temporality__ label.
+// Without it, sent is the temporality of the raw OTLP OATS pushed for the
+// metric, if it did; counters, histograms and summaries are otherwise
+// unknown, since a converted delta looks like any cumulative series, and
+// other types have none.
+func seriesTemporality(md assert.MetricMetadata, rows []assert.Row, sent string) string {
+	for _, row := range rows {
+		if t := row.Attributes["__temporality__"]; t != "" {
+			return t
+		}
+	}
+	switch strings.ToLower(md.Type) {
+	case "counter", "histogram", "summary":
+		if sent != "" {
+			return sent
+		}
+		return assert.UnknownTemporality
+	}
+	return ""
+}
+
+// extractHistogram sums the histogram series named name in `gcx metrics
+// query -o json` output into one histogram. Classic series (_bucket, _sum,
+// _count) are preferred; native histogram samples are used only when the
+// query returned no classic series.
+func extractHistogram(stdout, name string) (assert.Histogram, error) {
+	if strings.TrimSpace(stdout) == "" {
+		return assert.Histogram{}, parseErrorf("histogram parse: empty result")
+	}
+	var generic struct {
+		Data struct {
+			Result []struct {
+				Metric     map[string]any       `json:"metric"`
+				Value      [2]any               `json:"value"`
+				Values     [][2]any             `json:"values"`
+				Histogram  [2]json.RawMessage   `json:"histogram"`
+				Histograms [][2]json.RawMessage `json:"histograms"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &generic); err != nil {
+		return assert.Histogram{}, parseErrorf("histogram JSON parse: %w", err)
+	}
+	var (
+		h       assert.Histogram
+		classic bool
+		hasCnt  bool
+		buckets = map[float64]float64{}
+		native  []nativeHistogram
+	)
+	for _, item := range generic.Data.Result {
+		attrs := stringifyMap(item.Metric)
+		raw := item.Histogram[1]
+		if len(item.Histograms) > 0 {
+			raw = item.Histograms[len(item.Histograms)-1][1]
+		}
+		if len(raw) > 0 && attrs["__name__"] == name {
+			var nh nativeHistogram
+			if err := json.Unmarshal(raw, &nh); err != nil {
+				return assert.Histogram{}, parseErrorf("histogram parse: native sample: %w", err)
+			}
+			native = append(native, nh)
+			continue
+		}
+		value, ok := lastSample(item.Value, item.Values)
+		if !ok {
+			continue
+		}
+		switch attrs["__name__"] {
+		case name + "_bucket":
+			le, err := strconv.ParseFloat(attrs["le"], 64)
+			if err != nil {
+				return assert.Histogram{}, parseErrorf("histogram parse: bucket le=%q is not a number", attrs["le"])
+			}
+			buckets[le] += value
+			classic = true
+		case name + "_sum":
+			h.Sum += value
+			classic = true
+		case name + "_count":
+			h.Count += value
+			hasCnt, classic = true, true
+		}
+	}
+	if classic {
+		bounds := make([]float64, 0, len(buckets))
+		for le := range buckets {
+			bounds = append(bounds, le)
+		}
+		sort.Float64s(bounds)
+		lower := 0.0
+		for i, le := range bounds {
+			if i == 0 && le <= 0 {
+				lower = le
+			}
+			h.Buckets = append(h.Buckets, assert.Bucket{Lower: lower, UpperBound: le, Count: buckets[le]})
+			lower = le
+		}
+		if !hasCnt && len(h.Buckets) > 0 {
+			h.Count = h.Buckets[len(h.Buckets)-1].Count
+		}
+		return h, nil
+	}
+	if len(native) > 0 {
+		return mergeNativeHistograms(native)
+	}
+	return h, nil
+}
+
+// nativeHistogram is a native histogram sample in the Prometheus query API.
+// Each bucket is [boundary rule, lower, upper, count], with counts per bucket
+// rather than cumulative.
+type nativeHistogram struct {
+	Count   string  `json:"count"`
+	Sum     string  `json:"sum"`
+	Buckets [][]any `json:"buckets"`
+}
+
+// mergeNativeHistograms sums native samples bucket by bucket. Samples with
+// different schemas yield buckets that overlap without lining up; those
+// cannot be summed and are reported instead.
+func mergeNativeHistograms(samples []nativeHistogram) (assert.Histogram, error) {
+	type span struct{ lower, upper float64 }
+	h := assert.Histogram{Native: true}
+	counts := map[span]float64{}
+	for _, s := range samples {
+		count, err1 := strconv.ParseFloat(s.Count, 64)
+		sum, err2 := strconv.ParseFloat(s.Sum, 64)
+		if err1 != nil || err2 != nil {
+			return assert.Histogram{}, parseErrorf("histogram parse: native sample count %q or sum %q is not a number", s.Count, s.Sum)
+		}
+		h.Count += count
+		h.Sum += sum
+		for _, b := range s.Buckets {
+			if len(b) != 4 {
+				return assert.Histogram{}, parseErrorf("histogram parse: native bucket %v needs 4 fields", b)
+			}
+			var nums [3]float64
+			for i, v := range b[1:] {
+				str, _ := v.(string)
+				f, err := strconv.ParseFloat(str, 64)
+				if err != nil {
+					return assert.Histogram{}, parseErrorf("histogram parse: native bucket %v: %q is not a number", b, v)
+				}
+				nums[i] = f
+			}
+			counts[span{nums[0], nums[1]}] += nums[2]
+		}
+	}
+	spans := make([]span, 0, len(counts))
+	for sp := range counts {
+		spans = append(spans, sp)
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].upper != spans[j].upper {
+			return spans[i].upper < spans[j].upper
+		}
+		return spans[i].lower < spans[j].lower
+	})
+	cumulative := 0.0
+	for i, sp := range spans {
+		if i > 0 && sp.lower < spans[i-1].upper {
+			return assert.Histogram{}, parseErrorf("histogram parse: native buckets (%g, %g] and (%g, %g] overlap; series with different schemas cannot be summed",
+				spans[i-1].lower, spans[i-1].upper, sp.lower, sp.upper)
+		}
+		cumulative += counts[sp]
+		h.Buckets = append(h.Buckets, assert.Bucket{Lower: sp.lower, UpperBound: sp.upper, Count: cumulative})
+	}
+	return h, nil
+}
+
+// lastSample returns the value of an instant sample, or the last point of a
+// range.
+func lastSample(value [2]any, values [][2]any) (float64, bool) {
+	raw, ok := value[1].(string)
+	if !ok && len(values) > 0 {
+		raw, ok = values[len(values)-1][1].(string)
+	}
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	return f, err == nil
+}
+
 func decodeGCXData(stdout, signal string, target any) error {
 	if strings.TrimSpace(stdout) == "" {
 		return parseErrorf("%s response is empty", signal)
@@ -198,14 +481,23 @@ func extractLogRows(stdout string) ([]assert.Row, int, error) {
 			if err != nil {
 				return rows, len(rows), parseErrorf("log response has unsupported format: data.result[%d].values[%d]: %w", streamIndex, valueIndex, err)
 			}
-			attrs := stringifyMap(stream.Stream)
-			for k, v := range stringifyMapAny(structuredMetadata) {
-				attrs[k] = v
-			}
+			// Loki indexes resource attributes as stream labels and keeps log
+			// attributes as structured metadata, so those stand in for the
+			// resource and log levels.
+			streamLabels := stringifyMap(stream.Stream)
+			logAttrs := stringifyMapAny(structuredMetadata)
 			for k, v := range stringifyMapAny(parsed) {
+				logAttrs[k] = v
+			}
+			attrs := stringifyMap(stream.Stream)
+			for k, v := range logAttrs {
 				attrs[k] = v
 			}
-			rows = append(rows, assert.Row{Name: line, Attributes: attrs})
+			rows = append(rows, assert.Row{
+				Name:       line,
+				Attributes: attrs,
+				Levels:     map[string]map[string]string{"resource": streamLabels, "log": logAttrs},
+			})
 		}
 	}
 	return rows, len(rows), nil
@@ -240,6 +532,37 @@ func parseLogValue(raw json.RawMessage) (string, map[string]any, map[string]any,
 	return *entry.Line, entry.StructuredMetadata, entry.Parsed, nil
 }
 
+// extractExemplarRows reads a Prometheus exemplar query response into one
+// row per exemplar: the series labels and exemplar labels as attributes, and
+// the exemplar's trace_id as the row's TraceID.
+func extractExemplarRows(stdout string) ([]assert.Row, error) {
+	var data []struct {
+		SeriesLabels map[string]any `json:"seriesLabels"`
+		Exemplars    []struct {
+			Labels map[string]any `json:"labels"`
+		} `json:"exemplars"`
+	}
+	if err := decodeGCXData(stdout, "exemplar", &data); err != nil {
+		return nil, err
+	}
+	var rows []assert.Row
+	for _, series := range data {
+		for _, ex := range series.Exemplars {
+			attrs := stringifyMap(series.SeriesLabels)
+			for k, v := range stringifyMap(ex.Labels) {
+				attrs[k] = v
+			}
+			row := assert.Row{Name: attrs["__name__"], Attributes: attrs, TraceID: attrs["trace_id"]}
+			if row.TraceID == "" {
+				row.TraceID = attrs["traceID"]
+			}
+			row.SpanID = attrs["span_id"]
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
 func extractTraceRows(stdout string) ([]assert.Row, int, error) {
 	if strings.TrimSpace(stdout) == "" {
 		return nil, 0, nil
@@ -425,9 +748,9 @@ func extractOTLPTraceRows(root any) ([]assert.Row, bool) {
 		if !ok {
 			continue
 		}
-		resourceAttrs := map[string]string{}
+		resourceAttrs, resourceTypes := map[string]string{}, map[string]string{}
 		if resource, ok := rs["resource"].(map[string]any); ok {
-			resourceAttrs = parseOTelAttributeList(resource["attributes"])
+			resourceAttrs, resourceTypes = parseOTelAttributeList(resource["attributes"])
 		}
 		scopeSpans, _ := rs["scopeSpans"].([]any)
 		for _, ssAny := range scopeSpans {
@@ -435,9 +758,12 @@ func extractOTLPTraceRows(root any) ([]assert.Row, bool) {
 			if !ok {
 				continue
 			}
-			scopeName := ""
+			scopeName, scopeVersion := "", ""
+			scopeAttrs, scopeTypes := map[string]string{}, map[string]string{}
 			if scope, ok := ss["scope"].(map[string]any); ok {
-				scopeName = fmt.Sprint(scope["name"])
+				scopeName, _ = scope["name"].(string)
+				scopeVersion, _ = scope["version"].(string)
+				scopeAttrs, scopeTypes = parseOTelAttributeList(scope["attributes"])
 			}
 			spans, _ := ss["spans"].([]any)
 			for _, spAny := range spans {
@@ -445,12 +771,13 @@ func extractOTLPTraceRows(root any) ([]assert.Row, bool) {
 				if !ok {
 					continue
 				}
-				attrs := map[string]string{}
+				spanAttrs, spanTypes := parseOTelAttributeList(sp["attributes"])
+				attrs, types := map[string]string{}, map[string]string{}
 				for k, v := range resourceAttrs {
-					attrs[k] = v
+					attrs[k], types[k] = v, resourceTypes[k]
 				}
-				for k, v := range parseOTelAttributeList(sp["attributes"]) {
-					attrs[k] = v
+				for k, v := range spanAttrs {
+					attrs[k], types[k] = v, spanTypes[k]
 				}
 				if scopeName != "" {
 					attrs["otel.scope.name"] = scopeName
@@ -459,10 +786,45 @@ func extractOTLPTraceRows(root any) ([]assert.Row, bool) {
 				if kind, ok := sp["kind"]; ok {
 					attrs["kind"] = fmt.Sprint(kind)
 				}
-				rows = append(rows, assert.Row{
-					Name:       fmt.Sprint(sp["name"]),
-					Attributes: attrs,
-				})
+				row := assert.Row{
+					Name:         fmt.Sprint(sp["name"]),
+					Attributes:   attrs,
+					Types:        types,
+					Levels:       map[string]map[string]string{"resource": resourceAttrs, "scope": scopeAttrs, "span": spanAttrs},
+					LevelTypes:   map[string]map[string]string{"resource": resourceTypes, "scope": scopeTypes, "span": spanTypes},
+					ScopeName:    scopeName,
+					ScopeVersion: scopeVersion,
+					TraceID:      idString(sp["traceId"]),
+					SpanID:       idString(sp["spanId"]),
+					ParentSpanID: idString(sp["parentSpanId"]),
+					Kind:         spanKind(sp["kind"]),
+					Duration:     spanDuration(sp["startTimeUnixNano"], sp["endTimeUnixNano"]),
+				}
+				if status, ok := sp["status"].(map[string]any); ok {
+					row.StatusCode = statusCode(status["code"])
+					row.StatusMessage, _ = status["message"].(string)
+				} else {
+					row.StatusCode = "unset"
+				}
+				for _, evAny := range asList(sp["events"]) {
+					if ev, ok := evAny.(map[string]any); ok {
+						name, _ := ev["name"].(string)
+						evAttrs, evTypes := parseOTelAttributeList(ev["attributes"])
+						row.Events = append(row.Events, assert.Row{Name: name, Attributes: evAttrs, Types: evTypes})
+					}
+				}
+				for _, linkAny := range asList(sp["links"]) {
+					if link, ok := linkAny.(map[string]any); ok {
+						linkAttrs, linkTypes := parseOTelAttributeList(link["attributes"])
+						row.Links = append(row.Links, assert.Row{
+							TraceID:    idString(link["traceId"]),
+							SpanID:     idString(link["spanId"]),
+							Attributes: linkAttrs,
+							Types:      linkTypes,
+						})
+					}
+				}
+				rows = append(rows, row)
 			}
 		}
 	}
@@ -472,12 +834,100 @@ func extractOTLPTraceRows(root any) ([]assert.Row, bool) {
 	return rows, true
 }
 
-func parseOTelAttributeList(v any) map[string]string {
+// idString returns a trace or span ID as it appears in the JSON, or "" when
+// it is absent or all zeros (how some exporters spell "no parent"). IDs come
+// as hex or, in OTLP JSON, as base64.
+func idString(v any) string {
+	s, _ := v.(string)
+	id, err := hex.DecodeString(s)
+	if err != nil {
+		id, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err == nil && !slices.ContainsFunc(id, func(b byte) bool { return b != 0 }) {
+		return ""
+	}
+	return s
+}
+
+// spanKind normalizes an OTLP span kind, sent as either the enum name
+// ("SPAN_KIND_SERVER") or its number, to "server", "client" and so on.
+func spanKind(v any) string {
+	switch k := v.(type) {
+	case string:
+		return strings.ToLower(strings.TrimPrefix(k, "SPAN_KIND_"))
+	case float64:
+		kinds := []string{"unspecified", "internal", "server", "client", "producer", "consumer"}
+		if i := int(k); i >= 0 && i < len(kinds) {
+			return kinds[i]
+		}
+	}
+	return "unspecified"
+}
+
+// statusCode normalizes an OTLP status code ("STATUS_CODE_ERROR" or 2) to
+// "unset", "ok" or "error".
+func statusCode(v any) string {
+	switch c := v.(type) {
+	case string:
+		return strings.ToLower(strings.TrimPrefix(c, "STATUS_CODE_"))
+	case float64:
+		switch c {
+		case 1:
+			return "ok"
+		case 2:
+			return "error"
+		}
+	}
+	return "unset"
+}
+
+// spanDuration is end minus start. OTLP JSON encodes the 64-bit nanosecond
+// timestamps as strings, but plain numbers are accepted too.
+func spanDuration(start, end any) time.Duration {
+	s, okStart := unixNano(start)
+	e, okEnd := unixNano(end)
+	if !okStart || !okEnd || e < s {
+		return 0
+	}
+	return time.Duration(e - s)
+}
+
+func unixNano(v any) (int64, bool) {
+	switch n := v.(type) {
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+func asList(v any) []any {
+	list, _ := v.([]any)
+	return list
+}
+
+// otelValueTypes maps an OTLP AnyValue field to the type name matchers use.
+var otelValueTypes = map[string]string{
+	"stringValue": "string",
+	"intValue":    "int",
+	"doubleValue": "double",
+	"boolValue":   "bool",
+	"arrayValue":  "array",
+	"kvlistValue": "map",
+	"bytesValue":  "bytes",
+}
+
+// parseOTelAttributeList returns an OTLP attribute list as string values
+// plus the value type of each.
+func parseOTelAttributeList(v any) (map[string]string, map[string]string) {
 	list, ok := v.([]any)
 	if !ok {
-		return map[string]string{}
+		return map[string]string{}, map[string]string{}
 	}
 	out := make(map[string]string, len(list))
+	types := make(map[string]string, len(list))
 	for _, itemAny := range list {
 		item, ok := itemAny.(map[string]any)
 		if !ok {
@@ -489,8 +939,13 @@ func parseOTelAttributeList(v any) map[string]string {
 		}
 		value, _ := item["value"].(map[string]any)
 		out[key] = parseOTelAnyValue(value)
+		for field := range value {
+			if typ, ok := otelValueTypes[field]; ok {
+				types[key] = typ
+			}
+		}
 	}
-	return out
+	return out, types
 }
 
 func parseOTelAnyValue(m map[string]any) string {
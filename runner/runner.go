@@ -8,10 +8,15 @@ package runner
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"maps"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +28,7 @@ import (
 	"github.com/grafana/oats/report"
 	"github.com/grafana/oats/seed"
 	"github.com/grafana/oats/signalcmd"
+	"github.com/grafana/oats/testhelpers/compose"
 	"github.com/grafana/oats/testhelpers/requests"
 	"github.com/grafana/oats/wait"
 )
@@ -61,7 +67,21 @@ type Endpoint struct {
 
 	// RunCompose executes a one-shot command in a service belonging to the
 	// active Compose fixture. It is nil for remote and k3d fixtures.
-	RunCompose func(context.Context, string, []string) error
+	RunCompose func(context.Context, string, []string) (compose.RunResult, error)
+
+	// RunKubernetes executes a Kubernetes input's one-shot command, in a pod
+	// or a Job of the active k3d fixture. It is nil for other fixtures.
+	RunKubernetes func(context.Context, casefile.KubernetesInput) (compose.RunResult, error)
+
+	// ControlService applies a fixture action (restart, stop, start, kill,
+	// pause, unpause) to a service of the active Compose or k3d fixture. It
+	// is nil for remote fixtures.
+	ControlService func(ctx context.Context, a casefile.FixtureAction) error
+
+	// RunIDInjected reports that the fixture stamped Options.RunID onto the
+	// app's resource attributes, so app-emitted traces and logs can be scoped
+	// to the run like inline-otlp seeds are.
+	RunIDInjected bool
 }
 
 // Options configures the polling cadence and per-case deadline. Sensible
@@ -90,6 +110,18 @@ type Options struct {
 	// assertion attempt. Helps when an upstream ingest pipeline has a known
 	// minimum buffer (e.g. Loki's ~5s). Default 2s.
 	SeedSettleDelay time.Duration
+
+	// RunID identifies this run: it is the ${run.id} value, the oats.run.id
+	// resource attribute on inline-otlp seeds, and the value scoped queries
+	// filter on. The CLI generates one per invocation so parallel groups
+	// share it; a fresh one is generated when empty.
+	RunID string
+
+	// ClockSkew widens every case-relative query window: queries look back
+	// to when the case started seeding, minus this allowance for clock drift
+	// between the runner and the telemetry source. Default 5s; negative
+	// disables it.
+	ClockSkew time.Duration
 }
 
 func (o Options) withDefaults() Options {
@@ -105,9 +137,28 @@ func (o Options) withDefaults() Options {
 	if o.SeedSettleDelay == 0 {
 		o.SeedSettleDelay = 2 * time.Second
 	}
+	if o.ClockSkew == 0 {
+		o.ClockSkew = 5 * time.Second
+	} else if o.ClockSkew < 0 {
+		o.ClockSkew = 0
+	}
+	if o.RunID == "" {
+		o.RunID = NewRunID()
+	}
 	return o
 }
 
+// NewRunID returns a short random identifier for ${run.id}. It is lowercase
+// hex so it is safe to splice into service names, label values, and queries
+// without quoting.
+func NewRunID() string {
+	var b [6]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b[:])
+}
+
 // Runner executes one or more cases against a single Endpoint, emitting
 // lifecycle events to the configured Reporter. It is intended to be created
 // once per group — the gcx Executor and Reporter are reused across cases.
@@ -144,7 +195,7 @@ func New(exec engine.Executor, rep report.Reporter, ep Endpoint, opts Options) *
 		reporter: rep,
 		endpoint: ep,
 		opts:     opts,
-		seeder:   &seed.Sender{OTLPEndpoint: ep.OTLPHTTP, Version: opts.OatsVersion},
+		seeder:   &seed.Sender{OTLPEndpoint: ep.OTLPHTTP, Version: opts.OatsVersion, RunID: opts.RunID},
 	}
 }
 
@@ -169,12 +220,34 @@ func (r *Runner) cacheKey(c *casefile.Case) cache.Key {
 	if len(yamlBytes) == 0 {
 		yamlBytes = []byte(fmt.Sprintf("case:%s\nsource:%s\n", c.Name, c.SourcePath))
 	}
+	// An edited fragment changes the case as surely as an edited case file.
+	for _, frag := range c.Fragments {
+		data, _ := os.ReadFile(frag)
+		yamlBytes = fmt.Appendf(yamlBytes, "\x00%s\x00%s", frag, data)
+	}
+	// ${env.*} values are part of what the case asserts against, so a
+	// changed environment must miss the cache like a changed yaml would.
+	// Matrix variants share one yaml file and may share a fixture, so the
+	// variant name keeps their keys apart.
+	extra := r.cacheCtx.Extra
+	if names := c.EnvReferences(); len(names) > 0 || c.Variant != "" {
+		extra = maps.Clone(extra)
+		if extra == nil {
+			extra = map[string]string{}
+		}
+		for _, name := range names {
+			extra["env."+name] = os.Getenv(name)
+		}
+		if c.Variant != "" {
+			extra["matrix.variant"] = c.Variant
+		}
+	}
 	return cache.Key{
 		CaseYAML:     yamlBytes,
 		FixtureBytes: r.cacheCtx.FixtureBytes,
 		GCXVersion:   r.cacheCtx.GCXVersion,
 		OatsVersion:  r.opts.OatsVersion,
-		Extra:        r.cacheCtx.Extra,
+		Extra:        extra,
 	}
 }
 
@@ -196,8 +269,22 @@ func (r *Runner) RunCase(ctx context.Context, c *casefile.Case) bool {
 		Ts:     caseStart,
 	})
 
+	// abort fails the case for a problem that stops it from running further.
+	abort := func(msg string) bool {
+		r.failCase(c, msg, "")
+		r.reporter.Emit(report.Event{
+			Type:       report.EventCaseFail,
+			Case:       c.Name,
+			DurationMs: time.Since(caseStart).Milliseconds(),
+		})
+		return false
+	}
+
+	// The key is taken from the case as written: the expanded copy below no
+	// longer carries the ${env.*} references the key folds in.
+	var key cache.Key
 	if r.cacheStore != nil {
-		key := r.cacheKey(c)
+		key = r.cacheKey(c)
 		if hit, _ := r.cacheStore.Lookup(key); hit {
 			r.reporter.Emit(report.Event{
 				Type:    report.EventCaseSkip,
@@ -209,84 +296,147 @@ func (r *Runner) RunCase(ctx context.Context, c *casefile.Case) bool {
 		}
 	}
 
+	// Expand ${...} references before anything reaches the stack. The
+	// expanded copy carries the same name and source, so events and cache
+	// bookkeeping below are unaffected.
+	// ${capture.*} references stay as written until their step runs; raw is
+	// kept to expand them then.
+	raw, caps := c, captures{}
+	expanded, err := c.Interpolate(r.scope(caps))
+	if err != nil {
+		return abort("interpolate: " + err.Error())
+	}
+	c = expanded
+
+	// Queries only look back to here, so cases that run back to back against
+	// one stack do not see each other's telemetry.
+	seedStart := time.Now()
+
 	// Seed and drive inputs exactly once. Assertions poll only the observability
 	// backend; repeating side-effecting inputs during each poll makes counts
 	// nondeterministic and is especially surprising for one-shot commands.
 	if err := r.seedCase(ctx, c); err != nil {
-		r.failCase(c, "seed: "+err.Error(), "")
-		r.reporter.Emit(report.Event{
-			Type:       report.EventCaseFail,
-			Case:       c.Name,
-			DurationMs: time.Since(caseStart).Milliseconds(),
-		})
-		return false
+		return abort("seed: " + err.Error())
 	}
-	if err := r.driveInputs(ctx, c); err != nil {
-		r.failCase(c, "input: "+err.Error(), "")
-		r.reporter.Emit(report.Event{
-			Type:       report.EventCaseFail,
-			Case:       c.Name,
-			DurationMs: time.Since(caseStart).Milliseconds(),
-		})
-		return false
+	if err := r.driveInputs(ctx, raw, c, caps); err != nil {
+		return abort("input: " + err.Error())
 	}
 
-	if r.opts.SeedSettleDelay > 0 {
+	// The settle delay runs before the first assertion after the app was last
+	// driven, giving its telemetry time to reach the backends.
+	settled := false
+	settle := func() bool {
+		if settled || r.opts.SeedSettleDelay <= 0 {
+			return true
+		}
+		settled = true
 		select {
 		case <-time.After(r.opts.SeedSettleDelay):
+			return true
 		case <-ctx.Done():
-			r.failCase(c, "context cancelled during seed-settle window", "")
-			r.reporter.Emit(report.Event{Type: report.EventCaseFail, Case: c.Name})
 			return false
 		}
 	}
+	ok := true
+	for i, st := range c.Steps {
+		path := fmt.Sprintf("steps[%d]", i)
+		if st.Expect != nil && !settle() {
+			return abort("context cancelled during seed-settle window")
+		}
+		passed, err := r.runStep(ctx, raw, c, caps, seedStart, i)
+		if err != nil {
+			return abort(path + ": " + err.Error())
+		}
+		if st.Input != nil || st.Fixture != nil {
+			settled = false
+		}
+		// Later steps build on the state this one asserted; stop here.
+		if !passed {
+			ok = false
+			break
+		}
+	}
+	if ok && (c.Expected.HasAssertions() || len(c.Expected.ComposeLogs) > 0) {
+		if !settle() {
+			return abort("context cancelled during seed-settle window")
+		}
+		ok = r.expect(ctx, raw, c, caps, seedStart, "expected", func(sc *casefile.Case) *casefile.Expected { return &sc.Expected })
+	}
 
-	// Assertions, signal by signal. A failure in any signal block fails the
-	// case but we still run the others — the report shows all problems.
+	durMs := time.Since(caseStart).Milliseconds()
+	if ok {
+		r.reporter.Emit(report.Event{Type: report.EventCasePass, Case: c.Name, DurationMs: durMs})
+		if r.cacheStore != nil {
+			_ = r.cacheStore.Record(key)
+		}
+	} else {
+		r.reporter.Emit(report.Event{Type: report.EventCaseFail, Case: c.Name, DurationMs: durMs})
+		if r.cacheStore != nil {
+			// Evict any prior green record so a flaky regression is not
+			// masked by a stale hit on the next run.
+			_ = r.cacheStore.Evict(key)
+		}
+	}
+	return ok
+}
+
+// expect runs the assertions of the expected block at path ("expected" or
+// "steps[2].expect"), signal by signal; block picks that block out of a case.
+// A failure in any signal block fails the block but the others still run, so
+// the report shows all problems.
+func (r *Runner) expect(ctx context.Context, raw, c *casefile.Case, caps captures, seedStart time.Time, path string, block func(*casefile.Case) *casefile.Expected) bool {
 	ok := true
-	for i := range c.Expected.Traces {
-		if !r.runTrace(ctx, c, &c.Expected.Traces[i]) {
+	// step resolves the captures the step at path reads; a missing one fails
+	// the step without running it.
+	step := func(path string) *casefile.Case {
+		sc, err := r.withCaptures(raw, c, caps, path)
+		if err != nil {
+			r.failCase(c, err.Error(), "")
 			ok = false
+			return nil
 		}
+		return sc
 	}
-	for i := range c.Expected.Logs {
-		if !r.runLog(ctx, c, &c.Expected.Logs[i]) {
+	exp := block(c)
+	for i := range exp.Traces {
+		sc := step(fmt.Sprintf("%s.traces[%d]", path, i))
+		if sc != nil && !r.runTrace(ctx, sc, seedStart, &block(sc).Traces[i], caps) {
 			ok = false
 		}
 	}
-	for i := range c.Expected.Metrics {
-		if !r.runMetric(ctx, c, &c.Expected.Metrics[i]) {
+	for i := range exp.Logs {
+		sc := step(fmt.Sprintf("%s.logs[%d]", path, i))
+		if sc != nil && !r.runLog(ctx, sc, seedStart, &block(sc).Logs[i], caps) {
 			ok = false
 		}
 	}
-	for i := range c.Expected.Profiles {
-		if !r.runProfile(ctx, c, &c.Expected.Profiles[i]) {
+	for i := range exp.Metrics {
+		sc := step(fmt.Sprintf("%s.metrics[%d]", path, i))
+		if sc != nil && !r.runMetric(ctx, sc, seedStart, &block(sc).Metrics[i], caps) {
 			ok = false
 		}
 	}
-	for _, msg := range c.Expected.ComposeLogs {
-		if !r.runComposeLogCheck(ctx, c, msg) {
+	for i := range exp.Profiles {
+		sc := step(fmt.Sprintf("%s.profiles[%d]", path, i))
+		if sc != nil && !r.runProfile(ctx, sc, seedStart, &block(sc).Profiles[i], caps) {
 			ok = false
 		}
 	}
-	for i := range c.Expected.Custom {
-		if !r.runCustomCheck(ctx, c, &c.Expected.Custom[i]) {
+	for i := range exp.Correlate {
+		sc := step(fmt.Sprintf("%s.correlate[%d]", path, i))
+		if sc != nil && !r.runCorrelation(ctx, sc, seedStart, &block(sc).Correlate[i]) {
 			ok = false
 		}
 	}
-
-	durMs := time.Since(caseStart).Milliseconds()
-	if ok {
-		r.reporter.Emit(report.Event{Type: report.EventCasePass, Case: c.Name, DurationMs: durMs})
-		if r.cacheStore != nil {
-			_ = r.cacheStore.Record(r.cacheKey(c))
+	for i := range exp.ComposeLogs {
+		sc := step(fmt.Sprintf("%s.compose-logs[%d]", path, i))
+		if sc != nil && !r.runComposeLogCheck(ctx, sc, block(sc).ComposeLogs[i]) {
+			ok = false
 		}
-	} else {
-		r.reporter.Emit(report.Event{Type: report.EventCaseFail, Case: c.Name, DurationMs: durMs})
-		if r.cacheStore != nil {
-			// Evict any prior green record so a flaky regression is not
-			// masked by a stale hit on the next run.
-			_ = r.cacheStore.Evict(r.cacheKey(c))
+	}
+	for i := range exp.Custom {
+		if !r.runCustomCheck(ctx, c, &exp.Custom[i]) {
+			ok = false
 		}
 	}
 	return ok
@@ -341,28 +491,54 @@ func toSeedPayload(s casefile.Seed) (seed.Payload, error) {
 		})
 	}
 	for _, m := range s.Metrics {
-		p.Metrics = append(p.Metrics, seed.Metric{
+		metric := seed.Metric{
 			Service: m.Service,
 			Name:    m.Name,
 			Value:   m.Value,
-		})
+		}
+		if m.Histogram != nil {
+			metric.Histogram = &seed.Histogram{Bounds: m.Histogram.Bounds, Observations: m.Histogram.Observations}
+		}
+		p.Metrics = append(p.Metrics, metric)
 	}
 	return p, nil
 }
 
+// querySince returns the --since lookback for one poll of an assertion. By
+// default it reaches back to seedStart plus the clock-skew allowance, so it
+// grows as polling goes on; rounding up to whole seconds keeps rendered gcx
+// commands readable. An assertion's since/window override this.
+func (r *Runner) querySince(seedStart time.Time, a casefile.AssertionCommon) time.Duration {
+	if a.Since > 0 {
+		return a.Since
+	}
+	margin := r.opts.ClockSkew
+	if a.Window > 0 {
+		margin = a.Window
+	}
+	since := time.Since(seedStart) + margin
+	if rounded := since.Truncate(time.Second); rounded < since {
+		since = rounded + time.Second
+	}
+	return since
+}
+
 // pollAssert handles the polling loop common to all signal types. The
-// runner builds the gcx args and an assertEval closure; pollAssert runs
-// wait.Until / wait.While accordingly.
+// runner supplies a gcx args builder (called per poll, since the query
+// window grows) and an assertEval closure; pollAssert runs wait.Until /
+// wait.While accordingly.
 func (r *Runner) pollAssert(
 	ctx context.Context,
 	c *casefile.Case,
-	args []string,
+	buildArgs func() []string,
 	absent bool,
 	evalFn func(stdout, stderr string, exit int) []assert.Failure,
 ) bool {
-	cmdStr := signalcmd.Render(args)
+	var cmdStr string
 
 	run := func() []assert.Failure {
+		args := buildArgs()
+		cmdStr = signalcmd.Render(args)
 		execCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
 		defer cancel()
 		res, err := r.exec.Execute(execCtx, args...)
@@ -396,6 +572,9 @@ func (r *Runner) pollAssert(
 	if result.OK {
 		return true
 	}
+	if cmdStr == "" {
+		cmdStr = signalcmd.Render(buildArgs())
+	}
 	if len(result.LastFailures) == 0 {
 		r.reporter.Emit(report.Event{
 			Type:    report.EventAssertFail,
@@ -435,68 +614,285 @@ func (r *Runner) failCase(c *casefile.Case, msg, cmd string) {
 	})
 }
 
-func (r *Runner) driveInputs(ctx context.Context, c *casefile.Case) error {
-	for _, in := range c.Input {
-		if err := r.doInput(ctx, in); err != nil {
+func (r *Runner) driveInputs(ctx context.Context, raw, c *casefile.Case, caps captures) error {
+	for i := range c.Input {
+		pick := func(sc *casefile.Case) casefile.Input { return sc.Input[i] }
+		if err := r.driveInput(ctx, raw, c, caps, fmt.Sprintf("input[%d]", i), pick); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (r *Runner) doInput(ctx context.Context, in casefile.Input) error {
-	if in.Compose != nil {
-		if r.endpoint.RunCompose == nil {
-			return fmt.Errorf("compose input requires a Compose fixture")
-		}
-		inputCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
-		defer cancel()
-		return r.endpoint.RunCompose(inputCtx, in.Compose.Service, in.Compose.Command)
-	}
-	if in.Path == "" {
-		return nil
-	}
+// driveInput drives the input at path, which pick selects from a case, once
+// the captures it reads are known.
+func (r *Runner) driveInput(ctx context.Context, raw, c *casefile.Case, caps captures, path string, pick func(*casefile.Case) casefile.Input) error {
+	sc, err := r.withCaptures(raw, c, caps, path)
+	if err != nil {
+		return err
+	}
+	in := pick(sc)
+	if in.Load() {
+		return r.driveLoad(ctx, c.Name, path, in)
+	}
+	// Load has already rebased a descriptor set from an extends fragment onto
+	// the case's directory.
+	if in.GRPC != nil && in.GRPC.DescriptorSet != "" && !filepath.IsAbs(in.GRPC.DescriptorSet) && c.SourcePath != "" {
+		g := *in.GRPC
+		g.DescriptorSet = filepath.Join(filepath.Dir(c.SourcePath), g.DescriptorSet)
+		in.GRPC = &g
+	}
+	return r.doInput(ctx, in, caps)
+}
+
+// httpInput is an HTTP input resolved against the application endpoint.
+type httpInput struct {
+	url     string
+	method  string
+	headers map[string]string
+	status  int
+}
+
+func (r *Runner) httpRequest(in casefile.Input) (httpInput, error) {
 	host := r.endpoint.AppHost
 	if in.Host != "" {
 		host = in.Host
 	}
 	if host == "" || r.endpoint.AppPort == 0 {
-		return fmt.Errorf("input requires application endpoint; set --app-host/--app-port or provide fixture-derived app endpoint")
+		return httpInput{}, fmt.Errorf("input requires application endpoint; set --app-host/--app-port or provide fixture-derived app endpoint")
 	}
 	scheme := "http"
 	if in.Scheme != "" {
 		scheme = in.Scheme
 	}
-	method := http.MethodGet
+	req := httpInput{method: http.MethodGet, headers: map[string]string{}, status: 200}
 	if in.Method != "" {
-		method = strings.ToUpper(in.Method)
+		req.method = strings.ToUpper(in.Method)
 	}
-	status := 200
 	if in.Status != "" {
 		parsed, err := strconv.Atoi(in.Status)
 		if err != nil {
-			return fmt.Errorf("input status %q is not an integer", in.Status)
+			return httpInput{}, fmt.Errorf("input status %q is not an integer", in.Status)
 		}
-		status = parsed
+		req.status = parsed
 	}
-	headers := map[string]string{}
 	if in.Headers != nil {
-		maps.Copy(headers, in.Headers)
+		maps.Copy(req.headers, in.Headers)
 	} else {
-		headers["Accept"] = "application/json"
+		req.headers["Accept"] = "application/json"
+	}
+	req.url = fmt.Sprintf("%s://%s:%d%s", scheme, host, r.endpoint.AppPort, in.Path)
+	return req, nil
+}
+
+// checkCommand holds the result of a Compose input's command to the input's
+// exit code and output checks.
+func checkCommand(in casefile.ComposeInput, res compose.RunResult) error {
+	if want := in.EffectiveExitCode(); res.ExitCode != want {
+		return fmt.Errorf("compose service %q exited with code %d, want %d", in.Service, res.ExitCode, want)
+	}
+	return checkOutput(in.Contains, in.Regex, res)
+}
+
+// checkKubernetesCommand is checkCommand for a Kubernetes input.
+func checkKubernetesCommand(in casefile.KubernetesInput, res compose.RunResult) error {
+	if want := in.EffectiveExitCode(); res.ExitCode != want {
+		target := "deployment " + in.Deployment
+		switch {
+		case in.Selector != "":
+			target = fmt.Sprintf("pod matching %q", in.Selector)
+		case in.Image != "":
+			target = "job of image " + in.Image
+		}
+		return fmt.Errorf("kubernetes %s exited with code %d, want %d", target, res.ExitCode, want)
+	}
+	return checkOutput(in.Contains, in.Regex, res)
+}
+
+func checkOutput(contains, regex casefile.StringList, res compose.RunResult) error {
+	output := res.Stdout + res.Stderr
+	for _, s := range contains {
+		if !strings.Contains(output, s) {
+			return fmt.Errorf("output does not contain %q", s)
+		}
+	}
+	// Patterns are checked at load time, but ${...} references expand
+	// afterwards and can make them invalid.
+	for _, p := range regex {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("invalid regexp %q: %v", p, err)
+		}
+		if !re.MatchString(output) {
+			return fmt.Errorf("output does not match regex %q", p)
+		}
+	}
+	return nil
+}
+
+// checkResponse holds an HTTP input's response to its expect_headers and
+// expect_body. Every mismatch is listed as want/got, followed by the start of
+// the body when a body check failed, so an error page is recognisable.
+func checkResponse(in casefile.Input, resp *requests.Response) error {
+	var diffs []string
+	for _, name := range slices.Sorted(maps.Keys(in.ExpectHeaders)) {
+		want, got := in.ExpectHeaders[name], resp.Header.Values(name)
+		if !slices.Contains(got, want) {
+			diffs = append(diffs, fmt.Sprintf("header %s: want %q, got %s", name, want, quoteValues(got)))
+		}
+	}
+	headerDiffs := len(diffs)
+	if eb := in.ExpectBody; eb != nil {
+		body := string(resp.Body)
+		for _, s := range eb.Contains {
+			if !strings.Contains(body, s) {
+				diffs = append(diffs, fmt.Sprintf("body: want it to contain %q", s))
+			}
+		}
+		for _, p := range eb.Regex {
+			re, err := regexp.Compile(p)
+			switch {
+			case err != nil:
+				diffs = append(diffs, fmt.Sprintf("body: invalid regexp %q: %v", p, err))
+			case !re.MatchString(body):
+				diffs = append(diffs, fmt.Sprintf("body: want it to match %q", p))
+			}
+		}
+		for _, path := range slices.Sorted(maps.Keys(eb.JSON)) {
+			want := eb.JSON[path]
+			got, err := jsonPath(body, path)
+			switch {
+			case err != nil:
+				diffs = append(diffs, fmt.Sprintf("json %s: want %q, %v", path, want, err))
+			case got != want:
+				diffs = append(diffs, fmt.Sprintf("json %s: want %q, got %q", path, want, got))
+			}
+		}
+		if len(diffs) > headerDiffs {
+			diffs = append(diffs, "body was "+bodyExcerpt(body))
+		}
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("unexpected response: %s", strings.Join(diffs, "; "))
+}
+
+func quoteValues(values []string) string {
+	if len(values) == 0 {
+		return "no such header"
+	}
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// bodyExcerpt quotes the start of a response body for a failure message.
+func bodyExcerpt(body string) string {
+	const limit = 200
+	if body == "" {
+		return "empty"
+	}
+	if r := []rune(body); len(r) > limit {
+		return strconv.Quote(string(r[:limit])) + "..."
 	}
-	url := fmt.Sprintf("%s://%s:%d%s", scheme, host, r.endpoint.AppPort, in.Path)
-	if in.Retry == nil {
+	return strconv.Quote(body)
+}
+
+// doInput drives one input, recording its captures into caps.
+func (r *Runner) doInput(ctx context.Context, in casefile.Input, caps captures) error {
+	if in.Compose != nil {
+		if r.endpoint.RunCompose == nil {
+			return fmt.Errorf("compose input requires a Compose fixture")
+		}
+		inputCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+		defer cancel()
+		res, err := r.endpoint.RunCompose(inputCtx, in.Compose.Service, in.Compose.Command)
+		if err != nil {
+			return err
+		}
+		if err := checkCommand(*in.Compose, res); err != nil {
+			return err
+		}
+		return caps.fromCommand(in.Capture, res.Stdout)
+	}
+	if in.Kubernetes != nil {
+		if r.endpoint.RunKubernetes == nil {
+			return fmt.Errorf("kubernetes input requires a k3d fixture")
+		}
+		inputCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+		defer cancel()
+		res, err := r.endpoint.RunKubernetes(inputCtx, *in.Kubernetes)
+		if err != nil {
+			return err
+		}
+		if err := checkKubernetesCommand(*in.Kubernetes, res); err != nil {
+			return err
+		}
+		return caps.fromCommand(in.Capture, res.Stdout)
+	}
+	if in.Fixture != nil {
+		if err := r.fixtureAction(ctx, *in.Fixture); err != nil {
+			return fmt.Errorf("fixture: %w", err)
+		}
+		return nil
+	}
+	if in.GRPC != nil {
+		return r.doGRPC(ctx, in, caps)
+	}
+	if in.Path == "" {
+		return nil
+	}
+	req, err := r.httpRequest(in)
+	if err != nil {
+		return err
+	}
+	headers := req.headers
+	var traceID string
+	if in.TraceContext != nil {
+		tcHeaders, id, err := newTraceContext(*in.TraceContext)
+		if err != nil {
+			return fmt.Errorf("trace_context: %w", err)
+		}
+		maps.Copy(headers, tcHeaders)
+		traceID = id
+	}
+	do := func(ctx context.Context) error {
+		resp, err := requests.DoHTTPRequestWithResponse(ctx, req.url, req.method, headers, in.Body, req.status)
+		if err != nil {
+			return err
+		}
+		if err := checkResponse(in, resp); err != nil {
+			return err
+		}
+		if err := caps.fromResponse(in.Capture, resp); err != nil {
+			return err
+		}
+		if in.TraceContext != nil {
+			caps[in.TraceContext.EffectiveCapture()] = traceID
+		}
+		return nil
+	}
+	return r.retrying(ctx, in.Retry, do)
+}
+
+// retrying runs one attempt of an input under the runner's timeout, or, when
+// the input opts into retry, attempts until one succeeds or retry's timeout
+// elapses.
+func (r *Runner) retrying(ctx context.Context, retry *casefile.InputRetry, do func(context.Context) error) error {
+	if retry == nil {
 		inputCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
 		defer cancel()
-		return requests.DoHTTPRequestWithContext(inputCtx, url, method, headers, in.Body, status)
+		return do(inputCtx)
 	}
 
-	timeout := in.Retry.Timeout
+	timeout := retry.Timeout
 	if timeout == 0 {
 		timeout = r.opts.Timeout
 	}
-	interval := in.Retry.Interval
+	interval := retry.Interval
 	if interval == 0 {
 		interval = r.opts.Interval
 	}
@@ -505,7 +901,7 @@ func (r *Runner) doInput(ctx context.Context, in casefile.Input) error {
 	result := wait.Until[error](ctx, wait.Options{Timeout: timeout, Interval: interval}, func() []error {
 		attemptCtx, cancel := context.WithDeadline(ctx, deadline)
 		defer cancel()
-		if err := requests.DoHTTPRequestWithContext(attemptCtx, url, method, headers, in.Body, status); err != nil {
+		if err := do(attemptCtx); err != nil {
 			if attemptCtx.Err() == nil || lastErr == nil {
 				lastErr = err
 			}
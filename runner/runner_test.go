@@ -10,6 +10,8 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -21,6 +23,15 @@ import (
 	"github.com/grafana/oats/casefile"
 	"github.com/grafana/oats/engine"
 	"github.com/grafana/oats/report"
+	"github.com/grafana/oats/testhelpers/compose"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 // stubExec is a deterministic Executor that returns the configured output
@@ -176,6 +187,589 @@ func TestRunCase_MetricsValueFail(t *testing.T) {
 	}
 }
 
+const metricsEachCase = `
+name: each
+seed:
+  type: app
+  compose: x.yml
+expected:
+  metrics:
+    - promql: 'up'
+      value: '== 1'
+      each: '== 1'
+`
+
+func TestRunCase_MetricsEachNamesOffendingSeries(t *testing.T) {
+	stdout := `{"status":"success","data":{"resultType":"vector","result":[` +
+		`{"metric":{"__name__":"up","pod":"a"},"value":[1700000000,"1"]},` +
+		`{"metric":{"__name__":"up","pod":"b"},"value":[1700000000,"0"]}]}}`
+	exec := &stubExec{stdout: stdout}
+	r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), mustParse(t, metricsEachCase))
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+
+	if ok {
+		t.Errorf("expected the case to fail: the first series is 1 but pod b is 0")
+	}
+	if !strings.Contains(buf.String(), `expected every series == 1, 1 of 2 did not: up{pod="b"} = 0`) {
+		t.Errorf("each failure should name the series:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "expected value == 1") {
+		t.Errorf("value still compares only the first series:\n%s", buf.String())
+	}
+}
+
+const metricsRangeCase = `
+name: range
+seed:
+  type: app
+  compose: x.yml
+expected:
+  metrics:
+    - promql: 'requests_total'
+      range:
+        step: 15s
+        no_resets: true
+        samples: '>= 3'
+`
+
+func TestRunCase_MetricsRangeReportsResets(t *testing.T) {
+	stdout := `{"status":"success","data":{"resultType":"matrix","result":[` +
+		`{"metric":{"__name__":"requests_total","pod":"a"},"values":[[1700000000,"4"],[1700000015,"9"],[1700000030,"1"]]}]}}`
+	exec := &stubExec{stdout: stdout}
+	r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), mustParse(t, metricsRangeCase))
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+
+	if ok {
+		t.Errorf("expected the case to fail on the counter reset")
+	}
+	if !strings.Contains(buf.String(), `requests_total{pod="a"} dropped from 9 to 1`) {
+		t.Errorf("range failure should name the reset:\n%s", buf.String())
+	}
+	if len(exec.captured) == 0 || !strings.Contains(strings.Join(exec.captured[0], " "), "--step 15s -o json requests_total") {
+		t.Errorf("expected a range query at the step, got %v", exec.captured)
+	}
+}
+
+// routeExec answers each gcx subcommand ("metrics query", "metrics
+// metadata") with its own canned result; anything else exits 1. byQuery
+// answers by the last argument instead, and wins over results.
+type routeExec struct {
+	results  map[string]engine.Result
+	byQuery  map[string]engine.Result
+	captured [][]string
+}
+
+func (s *routeExec) Execute(_ context.Context, args ...string) (*engine.Result, error) {
+	s.captured = append(s.captured, args)
+	res, ok := s.byQuery[args[len(args)-1]]
+	if !ok {
+		res, ok = s.results[strings.Join(args[:2], " ")]
+	}
+	if !ok {
+		res = engine.Result{ExitCode: 1, Stderr: "unknown command"}
+	}
+	res.Command = append([]string{"gcx-stub"}, args...)
+	return &res, nil
+}
+
+const metricsMetadataCase = `
+name: metadata
+seed:
+  type: app
+  compose: x.yml
+expected:
+  metrics:
+    - promql: 'http_requests_total{job="api"}'
+      metadata:
+        type: counter
+        unit: ""
+`
+
+func TestRunCase_MetricsMetadata(t *testing.T) {
+	query := engine.Result{Stdout: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"http_requests_total","job":"api"},"value":[1700000000,"3"]}]}}`}
+	cases := []struct {
+		name        string
+		metadata    *engine.Result
+		temporality bool   // also expect temporality: cumulative
+		want        string // substring of the output; empty means pass
+	}{
+		{name: "family name", metadata: &engine.Result{Stdout: `{"status":"success","data":{"http_requests":[{"type":"counter","help":"Requests.","unit":""}]}}`}},
+		{name: "wrong type", metadata: &engine.Result{Stdout: `{"status":"success","data":{"http_requests_total":[{"type":"gauge","help":"","unit":""}]}}`},
+			want: "type: expected counter, got gauge (from the metadata API)"},
+		{name: "no metadata API and no labels", want: "no metadata for http_requests_total"},
+		{name: "temporality unknown", metadata: &engine.Result{Stdout: `{"status":"success","data":{"http_requests":[{"type":"counter","help":"Requests.","unit":""}]}}`},
+			temporality: true, want: "temporality unknown: expected cumulative"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			exec := &routeExec{results: map[string]engine.Result{"metrics query": query}}
+			if tc.metadata != nil {
+				exec.results["metrics metadata"] = *tc.metadata
+			}
+			c := metricsMetadataCase
+			if tc.temporality {
+				c += "        temporality: cumulative\n"
+			}
+			r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+			r.reporter.Emit(report.Event{Type: report.EventRunStart})
+			ok := r.RunCase(context.Background(), mustParse(t, c))
+			r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+			if tc.want == "" {
+				if !ok {
+					t.Fatalf("expected pass:\n%s", buf.String())
+				}
+				return
+			}
+			if ok || !strings.Contains(buf.String(), tc.want) {
+				t.Fatalf("expected a failure containing %q:\n%s", tc.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestMetadataFromLabels(t *testing.T) {
+	rows := []assert.Row{{Attributes: map[string]string{"__type__": "counter", "__unit__": "seconds", "__temporality__": "delta"}}}
+	md, ok := metadataFromLabels(rows)
+	if !ok || md.Type != "counter" || md.Unit != "seconds" {
+		t.Fatalf("metadataFromLabels: %+v %v", md, ok)
+	}
+	if got := seriesTemporality(md, rows, "cumulative"); got != "delta" {
+		t.Errorf("a __temporality__ label wins, got %q", got)
+	}
+	if got := seriesTemporality(assert.MetricMetadata{Type: "gauge"}, nil, ""); got != "" {
+		t.Errorf("a gauge has no temporality, got %q", got)
+	}
+	if got := seriesTemporality(assert.MetricMetadata{Type: "counter"}, nil, ""); got != assert.UnknownTemporality {
+		t.Errorf("an unlabelled counter OATS did not send is unknown, got %q", got)
+	}
+	if got := seriesTemporality(assert.MetricMetadata{Type: "histogram"}, nil, "cumulative"); got != "cumulative" {
+		t.Errorf("the sent OTLP is the fallback, got %q", got)
+	}
+}
+
+func TestSeededTemporality(t *testing.T) {
+	c := &casefile.Case{Seed: casefile.Seed{Type: "inline-otlp", Metrics: []casefile.SeedMetric{
+		{Name: "orders.placed"},
+		{Name: "checkout.duration", Histogram: &casefile.SeedHistogram{Bounds: []float64{1}}},
+	}}}
+	for names, want := range map[string]string{
+		"orders_placed_total":                  "cumulative",
+		"checkout_duration_bucket":             "cumulative",
+		"orders_placed_bucket":                 "",
+		"http_requests_total http_requests":    "",
+		"checkout_duration_count checkout_dur": "cumulative",
+	} {
+		if got := seededTemporality(c, strings.Fields(names)); got != want {
+			t.Errorf("seededTemporality(%s) = %q, want %q", names, got, want)
+		}
+	}
+	c.Seed.Type = "app"
+	if got := seededTemporality(c, []string{"orders_placed_total"}); got != "" {
+		t.Errorf("app seeds send no OTLP, got %q", got)
+	}
+}
+
+const logsCardinalityCase = `
+name: streams
+seed:
+  type: app
+  compose: x.yml
+expected:
+  logs:
+    - logql: '{deployment_environment="prod"}'
+      cardinality:
+        max_streams: 1
+        per: service_name
+`
+
+func TestRunCase_LogsCardinalityPerService(t *testing.T) {
+	stream := func(service, pod string) string {
+		return `{"stream":{"service_name":"` + service + `","pod":"` + pod + `"},"values":[` +
+			`{"timestamp":"1700000000","line":"a","structuredMetadata":{"trace_id":"t1"}},` +
+			`{"timestamp":"1700000001","line":"b","structuredMetadata":{"trace_id":"t2"}}]}`
+	}
+	stdout := `{"status":"success","data":{"resultType":"streams","result":[` +
+		strings.Join([]string{stream("cart", "a"), stream("cart", "b"), stream("shop", "a")}, ",") + `]}}`
+	exec := &stubExec{stdout: stdout}
+	r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), mustParse(t, logsCardinalityCase))
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+
+	if ok {
+		t.Errorf("expected the case to fail: cart has two streams")
+	}
+	if !strings.Contains(buf.String(), `expected at most 1 streams per service_name, got 2 for service_name="cart"`) {
+		t.Errorf("cardinality failure should name the service:\n%s", buf.String())
+	}
+}
+
+const correlateCase = `
+name: logs link to traces
+seed:
+  type: app
+  compose: x.yml
+expected:
+  correlate:
+    - from:
+        logql: '{service_name="cart"}'
+      to:
+        traceql: '{ resource.service.name = "cart" }'
+`
+
+func TestRunCase_CorrelateLogsToTraces(t *testing.T) {
+	logs := engine.Result{Stdout: `{"status":"success","data":{"resultType":"streams","result":[` +
+		`{"stream":{"service_name":"cart"},"values":[` +
+		`{"timestamp":"1700000000","line":"a","structuredMetadata":{"trace_id":"aa"}},` +
+		`{"timestamp":"1700000001","line":"b","structuredMetadata":{"trace_id":"bb"}},` +
+		`{"timestamp":"1700000002","line":"c","structuredMetadata":{"trace_id":"aa"}}]}]}}`}
+	found := engine.Result{Stdout: `{"traces":[{"traceID":"aa"}]}`}
+	empty := engine.Result{Stdout: `{"traces":[]}`}
+	for _, tc := range []struct {
+		name string
+		bb   engine.Result
+		want string // substring of the output; empty means pass
+	}{
+		{name: "every id resolves", bb: found},
+		{name: "one id missing", bb: empty,
+			want: "correlate: expected every trace ID from logs to resolve in traces, 1 of 2 did not: bb (no trace matched)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			exec := &routeExec{
+				results: map[string]engine.Result{"logs query": logs},
+				byQuery: map[string]engine.Result{
+					`{ (resource.service.name = "cart") && trace:id = "aa" }`: found,
+					`{ (resource.service.name = "cart") && trace:id = "bb" }`: tc.bb,
+				},
+			}
+			r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+			r.reporter.Emit(report.Event{Type: report.EventRunStart})
+			ok := r.RunCase(context.Background(), mustParse(t, correlateCase))
+			r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+			if tc.want == "" {
+				if !ok {
+					t.Fatalf("expected pass:\n%s", buf.String())
+				}
+				return
+			}
+			if ok || !strings.Contains(buf.String(), tc.want) {
+				t.Fatalf("expected failure %q:\n%s", tc.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestExtractExemplarRows(t *testing.T) {
+	stdout := `{"status":"success","data":[{"seriesLabels":{"__name__":"http_requests_total","job":"api"},` +
+		`"exemplars":[{"labels":{"trace_id":"aa","span_id":"01"},"value":"1","timestamp":1700000000}]}]}`
+	rows, err := extractExemplarRows(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].TraceID != "aa" || rows[0].SpanID != "01" || rows[0].Attributes["job"] != "api" {
+		t.Errorf("unexpected rows: %+v", rows)
+	}
+}
+
+const captureCase = `
+name: capture
+seed:
+  type: app
+  compose: x.yml
+input:
+  - path: /checkout
+    capture:
+      trace_id: {header: traceparent, regex: '^00-([0-9a-f]{32})-'}
+      order_id: {json: order.id}
+expected:
+  traces:
+    - traceql: '{ trace:id = "${capture.trace_id}" }'
+      capture:
+        service: {json: traces.0.rootServiceName}
+  logs:
+    - logql: '{service_name="${capture.service}"} |= "${capture.order_id}"'
+      contains: order placed
+`
+
+func TestRunCase_CapturesFeedLaterSteps(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		_, _ = w.Write([]byte(`{"order":{"id":7}}`))
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name   string
+		traces string
+		want   string // substring of the output; empty means pass
+	}{
+		{name: "captured", traces: `{"traces":[{"traceID":"4bf92f3577b34da6a3ce929d0e0e4736","rootServiceName":"cart"}]}`},
+		{name: "trace not found", traces: `{"traces":[]}`,
+			want: `expected.logs[0]: capture "service" has no value; the step that takes it did not pass`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			exec := &routeExec{byQuery: map[string]engine.Result{
+				`{ trace:id = "4bf92f3577b34da6a3ce929d0e0e4736" }`: {Stdout: tc.traces},
+				`{service_name="cart"} |= "7"`:                      {Stdout: "order placed"},
+			}}
+			r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+			setInputEndpoint(t, r, server.URL)
+			r.reporter.Emit(report.Event{Type: report.EventRunStart})
+			ok := r.RunCase(context.Background(), mustParse(t, captureCase))
+			r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+			if tc.want == "" {
+				if !ok {
+					t.Fatalf("expected pass:\n%s", buf.String())
+				}
+				return
+			}
+			if ok || !strings.Contains(buf.String(), tc.want) {
+				t.Fatalf("expected failure %q:\n%s", tc.want, buf.String())
+			}
+			if !strings.Contains(buf.String(), "capture: service: json traces.0.rootServiceName: no index \"traces.0\" (the list has 0 items)") {
+				t.Errorf("the trace assertion should explain the failed capture:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestDoInputCaptureMissingHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer server.Close()
+	r, _ := newRunner(t, &stubExec{}, Options{Timeout: time.Second})
+	setInputEndpoint(t, r, server.URL)
+	caps := captures{}
+	err := r.doInput(context.Background(), casefile.Input{
+		Path:    "/checkout",
+		Capture: map[string]casefile.CaptureSource{"tp": {Header: "traceparent"}},
+	}, caps)
+	if err == nil || err.Error() != "capture tp: header traceparent is not in the response" {
+		t.Fatalf("doInput error = %v", err)
+	}
+	if len(caps) != 0 {
+		t.Errorf("nothing should be captured, got %v", caps)
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := `{"data":{"result":[{"metric":{"pod":"a"},"value":[1700000000,"3"]}]},"n":12345678901,"ok":true}`
+	for _, tc := range []struct{ path, want, err string }{
+		{path: "data.result.0.metric.pod", want: "a"},
+		{path: "data.result.0.value.1", want: "3"},
+		{path: "n", want: "12345678901"},
+		{path: "ok", want: "true"},
+		{path: "data.result.1", err: `no index "data.result.1" (the list has 1 items)`},
+		{path: "data.missing", err: `no key "data.missing"`},
+		{path: "n.x", err: `"n" is a scalar`},
+		{path: "data", err: "value is not a scalar"},
+	} {
+		got, err := jsonPath(doc, tc.path)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%s: expected error %q, got %v", tc.path, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %q, %v; want %q", tc.path, got, err, tc.want)
+		}
+	}
+}
+
+const traceContextCase = `
+name: trace context
+seed:
+  type: app
+  compose: x.yml
+input:
+  - path: /rolldice
+    trace_context:
+      baggage:
+        tenant: acme corp
+expected:
+  traces:
+    - traceql: '{ name = "GET /rolldice" }'
+      trace_id: ${capture.trace_id}
+  logs:
+    - logql: '{service_name="dice"}'
+      trace_id: ${capture.trace_id}
+  metrics:
+    - promql: 'http_server_request_duration_seconds_count{service_name="dice"}'
+      trace_id: ${capture.trace_id}
+`
+
+func TestRunCase_TraceContextPinsAssertions(t *testing.T) {
+	exec := &routeExec{results: map[string]engine.Result{
+		"traces search": {Stdout: "GET /rolldice"},
+		"logs query":    {Stdout: "rolled 4"},
+		"metrics query": {Stdout: "1"},
+	}}
+	var traceparent, baggage string
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		traceparent, baggage = req.Header.Get("traceparent"), req.Header.Get("baggage")
+		exec.results["metrics exemplars"] = engine.Result{Stdout: `{"status":"success","data":[{"seriesLabels":{"service_name":"dice"},` +
+			`"exemplars":[{"labels":{"trace_id":"` + strings.Split(traceparent, "-")[1] + `"},"value":"1","timestamp":1700000000}]}]}`}
+	}))
+	defer server.Close()
+
+	r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+	setInputEndpoint(t, r, server.URL)
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), mustParse(t, traceContextCase))
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+	if !ok {
+		t.Fatalf("expected pass:\n%s", buf.String())
+	}
+	if !regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`).MatchString(traceparent) {
+		t.Fatalf("traceparent = %q", traceparent)
+	}
+	if baggage != "tenant=acme%20corp" {
+		t.Errorf("baggage = %q", baggage)
+	}
+	traceID := strings.Split(traceparent, "-")[1]
+	var queries []string
+	for _, args := range exec.captured {
+		queries = append(queries, args[len(args)-1])
+	}
+	for _, want := range []string{
+		`{ (name = "GET /rolldice") && trace:id = "` + traceID + `" }`,
+		`{service_name="dice"} | trace_id="` + traceID + `"`,
+	} {
+		if !slices.Contains(queries, want) {
+			t.Errorf("no query %s in %q", want, queries)
+		}
+	}
+}
+
+func TestRunCase_MetricExemplarOtherTrace(t *testing.T) {
+	exec := &routeExec{results: map[string]engine.Result{
+		"metrics query": {Stdout: "1"},
+		"metrics exemplars": {Stdout: `{"status":"success","data":[{"seriesLabels":{"job":"api"},` +
+			`"exemplars":[{"labels":{"trace_id":"def"},"value":"1","timestamp":1700000000}]}]}`},
+	}}
+	r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), mustParse(t, `
+name: exemplar
+seed:
+  type: app
+  compose: x.yml
+expected:
+  metrics:
+    - promql: 'up{job="api"}'
+      trace_id: abc
+`))
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+	if ok || !strings.Contains(buf.String(), "exemplar: no exemplar points at trace abc: the series have 1 exemplars from other traces") {
+		t.Fatalf("expected an exemplar failure:\n%s", buf.String())
+	}
+}
+
+func TestNewTraceContextUnsampled(t *testing.T) {
+	sampled := false
+	headers, traceID, err := newTraceContext(casefile.TraceContext{Sampled: &sampled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tp := headers["traceparent"]; !strings.HasPrefix(tp, "00-"+traceID+"-") || !strings.HasSuffix(tp, "-00") {
+		t.Errorf("traceparent = %q for trace %s", tp, traceID)
+	}
+	if _, ok := headers["baggage"]; ok {
+		t.Errorf("no baggage was configured, got %q", headers["baggage"])
+	}
+}
+
+const histogramCase = `
+name: histogram
+seed:
+  type: app
+  compose: x.yml
+expected:
+  metrics:
+    - promql: 'http_server_request_duration_seconds{service_name="dice"}'
+      histogram:
+        count: '== 4'
+        buckets: [0.1, 0.5]
+        bucket_counts:
+          - le: "0.5"
+            count: '== 3'
+        quantiles:
+          p50: '< 400ms'
+`
+
+func TestRunCase_MetricsHistogram(t *testing.T) {
+	series := func(suffix, le, v string) string {
+		labels := `"__name__":"http_server_request_duration_seconds` + suffix + `"`
+		if le != "" {
+			labels += `,"le":"` + le + `"`
+		}
+		return `{"metric":{` + labels + `},"value":[1700000000,"` + v + `"]}`
+	}
+	stdout := `{"status":"success","data":{"resultType":"vector","result":[` + strings.Join([]string{
+		series("_bucket", "0.1", "1"), series("_bucket", "0.5", "3"), series("_bucket", "+Inf", "4"),
+		series("_sum", "", "1.6"), series("_count", "", "4"),
+	}, ",") + `]}}`
+	exec := &stubExec{stdout: stdout}
+	r, buf := newRunner(t, exec, Options{Timeout: 100 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), mustParse(t, histogramCase))
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+
+	if !ok {
+		t.Errorf("expected histogram case to pass:\n%s", buf.String())
+	}
+}
+
+func TestExtractHistogram(t *testing.T) {
+	classic := `{"data":{"result":[
+		{"metric":{"__name__":"d_bucket","le":"1","pod":"a"},"value":[1,"2"]},
+		{"metric":{"__name__":"d_bucket","le":"1","pod":"b"},"value":[1,"1"]},
+		{"metric":{"__name__":"d_bucket","le":"+Inf","pod":"a"},"value":[1,"4"]},
+		{"metric":{"__name__":"d_bucket","le":"+Inf","pod":"b"},"value":[1,"2"]},
+		{"metric":{"__name__":"d_sum","pod":"a"},"values":[[1,"1"],[2,"5"]]},
+		{"metric":{"__name__":"d_sum","pod":"b"},"value":[1,"2"]},
+		{"metric":{"__name__":"other_bucket","le":"1"},"value":[1,"9"]}
+	]}}`
+	h, err := extractHistogram(classic, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Native || h.Count != 6 || h.Sum != 7 || len(h.Buckets) != 2 || h.Buckets[0].Count != 3 || h.Buckets[0].Lower != 0 {
+		t.Errorf("classic series should sum by le and take the last range point: %+v", h)
+	}
+
+	native := `{"data":{"result":[
+		{"metric":{"__name__":"d","pod":"a"},"histogram":[1,{"count":"3","sum":"0.6","buckets":[[0,"0.125","0.25","1"],[0,"0.25","0.5","2"]]}]},
+		{"metric":{"__name__":"d","pod":"b"},"histogram":[1,{"count":"1","sum":"0.2","buckets":[[0,"0.125","0.25","1"]]}]}
+	]}}`
+	h, err = extractHistogram(native, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Native || h.Count != 4 || len(h.Buckets) != 2 || h.Buckets[0].Count != 2 || h.Buckets[1].Count != 4 {
+		t.Errorf("native samples should sum bucket by bucket: %+v", h)
+	}
+
+	overlap := `{"data":{"result":[
+		{"metric":{"__name__":"d"},"histogram":[1,{"count":"1","sum":"1","buckets":[[0,"0.5","1","1"]]}]},
+		{"metric":{"__name__":"d"},"histogram":[1,{"count":"1","sum":"1","buckets":[[0,"0.7","1.4","1"]]}]}
+	]}}`
+	if _, err := extractHistogram(overlap, "d"); err == nil || !strings.Contains(err.Error(), "different schemas") {
+		t.Errorf("expected an overlap error, got %v", err)
+	}
+	if _, err := extractHistogram("not json", "d"); err == nil {
+		t.Error("expected a parse error")
+	}
+}
+
 func TestRunCase_LogsStructuredMatchPass(t *testing.T) {
 	exec := &stubExec{stdout: `{"status":"success","data":{"resultType":"streams","result":[{"stream":{"service_name":"svc"},"values":[{"timestamp":"1700000000","line":"seed-log-line","structuredMetadata":{"trace_id":"abc123"}}]}]}}`}
 	r, buf := newRunner(t, exec, Options{Timeout: 100 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
@@ -351,12 +945,12 @@ func TestRunCase_ComposeInput(t *testing.T) {
 	exec := &stubExec{stdout: "hello"}
 	r, _ := newRunner(t, exec, Options{Timeout: 100 * time.Millisecond, SeedSettleDelay: 1})
 	var calls int
-	r.endpoint.RunCompose = func(_ context.Context, service string, command []string) error {
+	r.endpoint.RunCompose = func(_ context.Context, service string, command []string) (compose.RunResult, error) {
 		calls++
 		if service != "app" || strings.Join(command, " ") != "mise run hello" {
 			t.Fatalf("compose input = service %q command %#v", service, command)
 		}
-		return nil
+		return compose.RunResult{}, nil
 	}
 	c := mustParse(t, `
 name: one-shot cli
@@ -379,8 +973,8 @@ expected:
 
 func TestRunCase_ComposeInputFailure(t *testing.T) {
 	r, buf := newRunner(t, &stubExec{}, Options{Timeout: 100 * time.Millisecond})
-	r.endpoint.RunCompose = func(_ context.Context, _ string, _ []string) error {
-		return errors.New("command failed")
+	r.endpoint.RunCompose = func(_ context.Context, _ string, _ []string) (compose.RunResult, error) {
+		return compose.RunResult{}, errors.New("command failed")
 	}
 	c := mustParse(t, `
 name: failing one-shot cli
@@ -402,19 +996,163 @@ expected:
 	}
 }
 
-func TestRunCase_InlineOTLPSeedRequiresEndpoint(t *testing.T) {
+func TestRunCase_ComposeInputExitCodeOutputAndCapture(t *testing.T) {
+	exec := &stubExec{stdout: "job 42 failed"}
+	r, buf := newRunner(t, exec, Options{Timeout: 100 * time.Millisecond, SeedSettleDelay: 1})
+	r.endpoint.RunCompose = func(context.Context, string, []string) (compose.RunResult, error) {
+		return compose.RunResult{ExitCode: 2, Stdout: `{"job": 42}` + "\n", Stderr: "error: disk full\n"}, nil
+	}
 	c := mustParse(t, `
-name: inline seed
-seed:
-  type: inline-otlp
-  traces:
-    - service: svc
-      spans:
-        - name: op
+name: failing batch job
+input:
+  - compose:
+      service: app
+      command: [job]
+      exit_code: 2
+      contains: disk full
+      regex: '"job": \d+'
+    capture:
+      job: {json: job}
 expected:
-  traces:
-    - traceql: '{}'
-      contains: ["svc"]
+  logs:
+    - logql: '{service_name="job-${capture.job}"}'
+      contains: failed
+`)
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), c)
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+	if !ok {
+		t.Fatalf("expected case to pass:\n%s", buf.String())
+	}
+	if len(exec.captured) == 0 || !slices.Contains(exec.captured[0], `{service_name="job-42"}`) {
+		t.Fatalf("capture not applied to the log query: %q", exec.captured)
+	}
+}
+
+func TestRunCase_ComposeInputInterpolatedRegexFailsInput(t *testing.T) {
+	r, buf := newRunner(t, &stubExec{}, Options{Timeout: 100 * time.Millisecond})
+	r.endpoint.RunCompose = func(context.Context, string, []string) (compose.RunResult, error) {
+		return compose.RunResult{Stdout: "done\n"}, nil
+	}
+	c := mustParse(t, `
+name: bad pattern from vars
+seed:
+  vars:
+    p: a(
+input:
+  - compose:
+      service: app
+      command: [job]
+      regex: ${vars.p}
+expected:
+  logs:
+    - logql: '{}'
+`)
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	if r.RunCase(context.Background(), c) {
+		t.Fatal("expected case to fail")
+	}
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+	if !strings.Contains(buf.String(), `input: invalid regexp "a("`) {
+		t.Fatalf("expected input failure output, got:\n%s", buf.String())
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	one, two := 1, 2
+	res := compose.RunResult{ExitCode: 1, Stdout: "done\n", Stderr: "warning: slow\n"}
+	for _, tc := range []struct {
+		name string
+		in   casefile.ComposeInput
+		want string
+	}{
+		{name: "exit code", in: casefile.ComposeInput{Service: "app"}, want: `compose service "app" exited with code 1, want 0`},
+		{name: "other exit code", in: casefile.ComposeInput{Service: "app", ExitCode: &two}, want: `compose service "app" exited with code 1, want 2`},
+		{name: "contains stderr", in: casefile.ComposeInput{ExitCode: &one, Contains: casefile.StringList{"slow"}}},
+		{name: "missing text", in: casefile.ComposeInput{ExitCode: &one, Contains: casefile.StringList{"fast"}}, want: `output does not contain "fast"`},
+		{name: "regex", in: casefile.ComposeInput{ExitCode: &one, Regex: casefile.StringList{`^done`}}},
+		{name: "regex mismatch", in: casefile.ComposeInput{ExitCode: &one, Regex: casefile.StringList{`^warning`}}, want: `output does not match regex "^warning"`},
+		{name: "invalid interpolated regex", in: casefile.ComposeInput{ExitCode: &one, Regex: casefile.StringList{`a(`}}, want: "invalid regexp \"a(\": error parsing regexp: missing closing ): `a(`"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkCommand(tc.in, res)
+			if tc.want == "" && err != nil || tc.want != "" && (err == nil || err.Error() != tc.want) {
+				t.Fatalf("checkCommand = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRunCase_KubernetesInput(t *testing.T) {
+	exec := &stubExec{stdout: "run 7 done"}
+	r, buf := newRunner(t, exec, Options{Timeout: 100 * time.Millisecond, SeedSettleDelay: 1})
+	var got casefile.KubernetesInput
+	r.endpoint.RunKubernetes = func(_ context.Context, in casefile.KubernetesInput) (compose.RunResult, error) {
+		got = in
+		return compose.RunResult{Stdout: "starting\nrun=7\n"}, nil
+	}
+	c := mustParse(t, `
+name: cronjob
+input:
+  - kubernetes:
+      image: reports:dev
+      command: [--once]
+      contains: starting
+    capture:
+      run: {regex: 'run=(\d+)'}
+expected:
+  logs:
+    - logql: '{run="${capture.run}"}'
+      contains: done
+`)
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), c)
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+	if !ok {
+		t.Fatalf("expected case to pass:\n%s", buf.String())
+	}
+	if got.Image != "reports:dev" || !slices.Equal(got.Command, []string{"--once"}) {
+		t.Fatalf("RunKubernetes input = %+v", got)
+	}
+	if len(exec.captured) == 0 || !slices.Contains(exec.captured[0], `{run="7"}`) {
+		t.Fatalf("capture not applied to the log query: %q", exec.captured)
+	}
+}
+
+func TestDoInput_KubernetesInput(t *testing.T) {
+	r, _ := newRunner(t, &stubExec{}, Options{Timeout: 100 * time.Millisecond})
+	in := casefile.Input{Kubernetes: &casefile.KubernetesInput{Selector: "app=worker", Command: []string{"migrate"}}}
+	if err := r.doInput(context.Background(), in, captures{}); err == nil || err.Error() != "kubernetes input requires a k3d fixture" {
+		t.Fatalf("doInput without k3d fixture = %v", err)
+	}
+	r.endpoint.RunKubernetes = func(context.Context, casefile.KubernetesInput) (compose.RunResult, error) {
+		return compose.RunResult{ExitCode: 1, Stderr: "no such table\n"}, nil
+	}
+	err := r.doInput(context.Background(), in, captures{})
+	if err == nil || err.Error() != `kubernetes pod matching "app=worker" exited with code 1, want 0` {
+		t.Fatalf("doInput = %v", err)
+	}
+	one := 1
+	in.Kubernetes.ExitCode = &one
+	in.Kubernetes.Contains = casefile.StringList{"no such table"}
+	if err := r.doInput(context.Background(), in, captures{}); err != nil {
+		t.Fatalf("doInput with expected exit code: %v", err)
+	}
+}
+
+func TestRunCase_InlineOTLPSeedRequiresEndpoint(t *testing.T) {
+	c := mustParse(t, `
+name: inline seed
+seed:
+  type: inline-otlp
+  traces:
+    - service: svc
+      spans:
+        - name: op
+expected:
+  traces:
+    - traceql: '{}'
+      contains: ["svc"]
 `)
 	// Endpoint with no OTLPHTTP — seed step must fail loudly.
 	exec := &stubExec{stdout: "svc"}
@@ -717,6 +1455,9 @@ func TestExtractTraceRows_OTLPShape(t *testing.T) {
 	for _, row := range rows {
 		if row.Name == "GET /stock" && row.Attributes["http.route"] == "/stock" {
 			found = true
+			if row.Kind != "server" || row.StatusCode != "unset" || row.Duration != 1303150*time.Nanosecond {
+				t.Fatalf("GET /stock kind=%q status=%q duration=%v", row.Kind, row.StatusCode, row.Duration)
+			}
 			break
 		}
 	}
@@ -725,6 +1466,48 @@ func TestExtractTraceRows_OTLPShape(t *testing.T) {
 	}
 }
 
+func TestExtractTraceRows_SpanDetails(t *testing.T) {
+	rows, _, err := extractTraceRows(`{"resourceSpans":[{
+		"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "payments"}}]},
+		"scopeSpans":[{
+		"scope": {"name": "io.opentelemetry.okhttp", "version": "1.2.0"},
+		"spans":[{
+		"name": "charge",
+		"kind": 3,
+		"attributes": [
+			{"key": "service.name", "value": {"stringValue": "override"}},
+			{"key": "http.response.status_code", "value": {"intValue": "402"}}
+		],
+		"startTimeUnixNano": "1000000000",
+		"endTimeUnixNano": "1250000000",
+		"status": {"code": "STATUS_CODE_ERROR", "message": "card declined"},
+		"events": [{"name": "exception", "attributes": [{"key": "exception.type", "value": {"stringValue": "CardError"}}]}],
+		"links": [{"traceId": "0af7651916cd43dd8448eb211c80319c", "spanId": "b7ad6b7169203331"}]
+	}]}]}]}`)
+	if err != nil {
+		t.Fatalf("extractTraceRows: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected one row, got %+v", rows)
+	}
+	row := rows[0]
+	if row.Kind != "client" || row.StatusCode != "error" || row.StatusMessage != "card declined" || row.Duration != 250*time.Millisecond {
+		t.Fatalf("span details: kind=%q status=%q message=%q duration=%v", row.Kind, row.StatusCode, row.StatusMessage, row.Duration)
+	}
+	if row.Levels["resource"]["service.name"] != "payments" || row.Levels["span"]["service.name"] != "override" || row.ScopeName != "io.opentelemetry.okhttp" || row.ScopeVersion != "1.2.0" {
+		t.Fatalf("levels: %#v scope=%q %q", row.Levels, row.ScopeName, row.ScopeVersion)
+	}
+	if row.Types["http.response.status_code"] != "int" || row.Types["service.name"] != "string" || row.LevelTypes["span"]["http.response.status_code"] != "int" {
+		t.Fatalf("types: %#v %#v", row.Types, row.LevelTypes)
+	}
+	if len(row.Events) != 1 || row.Events[0].Name != "exception" || row.Events[0].Attributes["exception.type"] != "CardError" {
+		t.Fatalf("events: %+v", row.Events)
+	}
+	if len(row.Links) != 1 || row.Links[0].TraceID != "0af7651916cd43dd8448eb211c80319c" || row.Links[0].SpanID != "b7ad6b7169203331" {
+		t.Fatalf("links: %+v", row.Links)
+	}
+}
+
 func TestExtractProfileRows_FlamebearerShape(t *testing.T) {
 	rows, count, err := extractProfileRows(`{"flamebearer":{"names":["main","worker"]}}`)
 	if err != nil {
@@ -851,6 +1634,14 @@ func TestExtractLogRowsBranches(t *testing.T) {
 	if count != 2 || rows[0].Name != "ready" || rows[1].Name != "" || rows[0].Attributes["service"] != "api" {
 		t.Fatalf("unexpected log rows: %#v count=%d", rows, count)
 	}
+
+	rows, _, err = extractLogRows(`{"data":{"result":[{"stream":{"service_name":"api"},"values":[{"line":"ready","structuredMetadata":{"user_id":"7"},"parsed":{"level":"info"}}]}]}}`)
+	if err != nil {
+		t.Fatalf("extractLogRows: %v", err)
+	}
+	if got := rows[0].Levels; got["resource"]["service_name"] != "api" || got["log"]["user_id"] != "7" || got["log"]["level"] != "info" || len(got["resource"]) != 1 {
+		t.Fatalf("log levels = %#v", got)
+	}
 	if _, _, err := extractLogRows("not json"); err == nil || !strings.Contains(err.Error(), "log JSON parse") {
 		t.Fatalf("malformed log error = %v", err)
 	}
@@ -925,8 +1716,11 @@ func TestParseOTelHelpers(t *testing.T) {
 					"scopeSpans": []any{map[string]any{
 						"scope": map[string]any{"name": "instrumentation"},
 						"spans": []any{map[string]any{
-							"name": "operation",
-							"kind": 2,
+							"name":         "operation",
+							"kind":         2,
+							"traceId":      "5b8efff798038103d269b633813fc60c",
+							"spanId":       "eee19b7ec3c1b174",
+							"parentSpanId": "AAAAAAAAAAA=",
 							"attributes": []any{
 								map[string]any{"key": "count", "value": map[string]any{"intValue": 3}},
 								map[string]any{"key": "flags", "value": map[string]any{"arrayValue": map[string]any{"values": []any{
@@ -947,6 +1741,9 @@ func TestParseOTelHelpers(t *testing.T) {
 	if rows[0].Attributes["service.name"] != "api" || rows[0].Attributes["count"] != "3" || rows[0].Attributes["flags"] != "true,1.5" || rows[0].Attributes["kind"] != "2" {
 		t.Fatalf("OTLP attributes = %#v", rows[0].Attributes)
 	}
+	if rows[0].TraceID != "5b8efff798038103d269b633813fc60c" || rows[0].SpanID != "eee19b7ec3c1b174" || rows[0].ParentSpanID != "" {
+		t.Fatalf("OTLP IDs = %q %q %q (an all-zero parent means no parent)", rows[0].TraceID, rows[0].SpanID, rows[0].ParentSpanID)
+	}
 
 	if got := stringifyMapAny("not a map"); len(got) != 0 {
 		t.Fatalf("stringifyMapAny non-map = %#v", got)
@@ -956,6 +1753,24 @@ func TestParseOTelHelpers(t *testing.T) {
 	}
 }
 
+func TestIDString(t *testing.T) {
+	for in, want := range map[any]string{
+		nil:                                "",
+		"":                                 "",
+		"0000000000000000":                 "",
+		"AAAAAAAAAAA=":                     "",
+		"AAAAAAAAAAAAAAAAAAAAAA==":         "",
+		"eee19b7ec3c1b174":                 "eee19b7ec3c1b174",
+		"7uGbfsPBsXQ=":                     "7uGbfsPBsXQ=",
+		"00000000000000000000000000000a00": "00000000000000000000000000000a00",
+		"AAAAAAAAAAE=":                     "AAAAAAAAAAE=",
+	} {
+		if got := idString(in); got != want {
+			t.Errorf("idString(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
+
 func TestToSeedPayload(t *testing.T) {
 	payload, err := toSeedPayload(casefile.Seed{
 		Traces:  []casefile.SeedTrace{{Service: "api", Spans: []casefile.SeedSpan{{Name: "op", Duration: "2ms"}}}},
@@ -1026,34 +1841,37 @@ expected:
     - traceql: '{}'
 `)
 
-	rows, count, err := r.fetchTraceRows(context.Background(), c, `{"traces":[{"traceID":"abc"}]}`)
+	rows, count, err := r.fetchTraceRows(context.Background(), c, time.Minute, `{"traces":[{"traceID":"abc"}]}`)
 	if err != nil {
 		t.Fatalf("fetchTraceRows: %v", err)
 	}
-	if count != 1 || len(rows) != 1 || rows[0].Name != "operation" {
+	if count != 1 || len(rows) != 1 || rows[0].Name != "operation" || rows[0].TraceID != "abc" {
 		t.Fatalf("rows=%#v count=%d", rows, count)
 	}
 	if len(exec.captured) != 1 || exec.captured[0][0] != "traces" || exec.captured[0][1] != "get" || exec.captured[0][len(exec.captured[0])-1] != "abc" {
 		t.Fatalf("unexpected TraceGet args: %#v", exec.captured)
 	}
+	if got := exec.captured[0][3]; got != "1m0s" {
+		t.Fatalf("TraceGet should reuse the search lookback, got --since %s", got)
+	}
 }
 
 func TestDoInputValidation(t *testing.T) {
 	r, _ := newRunner(t, &stubExec{}, Options{Timeout: time.Millisecond})
-	if err := r.doInput(context.Background(), casefile.Input{Path: "/health"}); err == nil || !strings.Contains(err.Error(), "application endpoint") {
+	if err := r.doInput(context.Background(), casefile.Input{Path: "/health"}, nil); err == nil || !strings.Contains(err.Error(), "application endpoint") {
 		t.Fatalf("missing endpoint error = %v", err)
 	}
-	if err := r.doInput(context.Background(), casefile.Input{}); err != nil {
+	if err := r.doInput(context.Background(), casefile.Input{}, nil); err != nil {
 		t.Fatalf("empty input should be ignored: %v", err)
 	}
-	if err := r.doInput(context.Background(), casefile.Input{Compose: &casefile.ComposeInput{Service: "app", Command: []string{"run"}}}); err == nil || !strings.Contains(err.Error(), "requires a Compose fixture") {
+	if err := r.doInput(context.Background(), casefile.Input{Compose: &casefile.ComposeInput{Service: "app", Command: []string{"run"}}}, nil); err == nil || !strings.Contains(err.Error(), "requires a Compose fixture") {
 		t.Fatalf("missing Compose fixture error = %v", err)
 	}
 
 	invalidStatus, _ := newRunner(t, &stubExec{}, Options{Timeout: time.Millisecond})
 	invalidStatus.endpoint.AppHost = "127.0.0.1"
 	invalidStatus.endpoint.AppPort = 1
-	if err := invalidStatus.doInput(context.Background(), casefile.Input{Path: "/health", Status: "created"}); err == nil || !strings.Contains(err.Error(), "not an integer") {
+	if err := invalidStatus.doInput(context.Background(), casefile.Input{Path: "/health", Status: "created"}, nil); err == nil || !strings.Contains(err.Error(), "not an integer") {
 		t.Fatalf("invalid status error = %v", err)
 	}
 }
@@ -1068,7 +1886,7 @@ func TestDoInputDoesNotRetryByDefault(t *testing.T) {
 
 	r, _ := newRunner(t, &stubExec{}, Options{Timeout: 100 * time.Millisecond, Interval: time.Millisecond})
 	setInputEndpoint(t, r, server.URL)
-	err := r.doInput(context.Background(), casefile.Input{Path: "/ready"})
+	err := r.doInput(context.Background(), casefile.Input{Path: "/ready"}, nil)
 	if err == nil || !strings.Contains(err.Error(), "got: 503") {
 		t.Fatalf("doInput error = %v, want status mismatch", err)
 	}
@@ -1090,7 +1908,7 @@ func TestDoInputRetrySucceeds(t *testing.T) {
 
 	r, _ := newRunner(t, &stubExec{}, Options{Timeout: 100 * time.Millisecond, Interval: time.Millisecond})
 	setInputEndpoint(t, r, server.URL)
-	err := r.doInput(context.Background(), casefile.Input{Path: "/ready", Retry: &casefile.InputRetry{}})
+	err := r.doInput(context.Background(), casefile.Input{Path: "/ready", Retry: &casefile.InputRetry{}}, nil)
 	if err != nil {
 		t.Fatalf("doInput: %v", err)
 	}
@@ -1112,7 +1930,7 @@ func TestDoInputRetryExhausted(t *testing.T) {
 	err := r.doInput(context.Background(), casefile.Input{
 		Path:  "/ready",
 		Retry: &casefile.InputRetry{Timeout: 50 * time.Millisecond, Interval: time.Millisecond},
-	})
+	}, nil)
 	if err == nil || !strings.Contains(err.Error(), "retry exhausted") || !strings.Contains(err.Error(), "got: 503") {
 		t.Fatalf("doInput error = %v, want exhausted status mismatch", err)
 	}
@@ -1121,6 +1939,285 @@ func TestDoInputRetryExhausted(t *testing.T) {
 	}
 }
 
+func TestDoInputExpectResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"ok","checks":{"db":"up"},"version":"1.2"}`))
+	}))
+	defer server.Close()
+
+	r, _ := newRunner(t, &stubExec{}, Options{})
+	setInputEndpoint(t, r, server.URL)
+	err := r.doInput(context.Background(), casefile.Input{
+		Path:          "/health",
+		ExpectHeaders: map[string]string{"content-type": "application/json"},
+		ExpectBody: &casefile.ExpectBody{
+			Contains: casefile.StringList{`"status"`},
+			Regex:    casefile.StringList{`"version":"\d+\.\d+"`},
+			JSON:     map[string]string{"status": "ok", "checks.db": "up"},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("doInput: %v", err)
+	}
+}
+
+func TestDoInputExpectResponseInvalidInterpolatedRegex(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	r, _ := newRunner(t, &stubExec{}, Options{})
+	setInputEndpoint(t, r, server.URL)
+	// Validation sees ${vars.p}; the pattern only breaks once expanded.
+	err := r.doInput(context.Background(), casefile.Input{
+		Path:       "/health",
+		ExpectBody: &casefile.ExpectBody{Regex: casefile.StringList{"a("}},
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), `unexpected response: body: invalid regexp "a("`) {
+		t.Fatalf("doInput error = %v, want invalid regexp", err)
+	}
+}
+
+func TestRunCase_ExpectResponseMismatchFailsInput(t *testing.T) {
+	var hits atomic.Int32
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html>Something went wrong</html>"))
+	}))
+	defer app.Close()
+	host, port := splitHostPort(t, app.Listener.Addr().String())
+
+	exec := &stubExec{}
+	r, buf := newRunner(t, exec, Options{Timeout: 100 * time.Millisecond, Interval: time.Millisecond})
+	r.endpoint.AppHost = host
+	r.endpoint.AppPort = port
+	c := mustParse(t, `
+name: error page
+input:
+  - path: /health
+    expect_headers:
+      Content-Type: application/json
+    expect_body:
+      contains: ok
+      json:
+        status: ok
+expected:
+  logs:
+    - logql: '{}'
+`)
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	if r.RunCase(context.Background(), c) {
+		t.Fatal("expected case to fail")
+	}
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+	out := buf.String()
+	for _, want := range []string{
+		`input: unexpected response: header Content-Type: want "application/json", got "text/html"`,
+		`body: want it to contain "ok"`,
+		`json status: want "ok", not JSON`,
+		`body was "<html>Something went wrong</html>"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+	if len(exec.captured) != 0 {
+		t.Fatalf("expected no assertion queries after the input failed, got %d", len(exec.captured))
+	}
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("request count = %d, want 1", got)
+	}
+}
+
+const stepsCase = `
+name: restart
+seed:
+  type: app
+  compose: x.yml
+steps:
+  - input:
+      path: /first
+  - expect:
+      traces:
+        - traceql: '{ name = "GET /first" }'
+  - fixture:
+      restart: app
+  - sleep: 1ms
+  - input:
+      path: /second
+  - expect:
+      logs:
+        - logql: '{service_name="dice"}'
+          contains: second
+expected:
+  metrics:
+    - promql: up
+`
+
+// orderedExec records gcx calls into a log shared with the other actors of a
+// scenario, so a test can check the order steps ran in.
+type orderedExec struct {
+	routeExec
+	log *[]string
+}
+
+func (s *orderedExec) Execute(ctx context.Context, args ...string) (*engine.Result, error) {
+	if entry := strings.Join(args[:2], " "); len(*s.log) == 0 || (*s.log)[len(*s.log)-1] != entry {
+		*s.log = append(*s.log, entry)
+	}
+	return s.routeExec.Execute(ctx, args...)
+}
+
+func TestRunCase_StepsRunInOrder(t *testing.T) {
+	var log []string
+	exec := &orderedExec{log: &log, routeExec: routeExec{results: map[string]engine.Result{
+		"traces search": {Stdout: "GET /first"},
+		"logs query":    {Stdout: "second request"},
+		"metrics query": {Stdout: "1"},
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		log = append(log, req.Method+" "+req.URL.Path)
+	}))
+	defer server.Close()
+	r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+	setInputEndpoint(t, r, server.URL)
+	r.endpoint.ControlService = func(_ context.Context, a casefile.FixtureAction) error {
+		action, service := a.Action()
+		log = append(log, action+" "+service)
+		return nil
+	}
+
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), mustParse(t, stepsCase))
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+	if !ok {
+		t.Fatalf("expected pass:\n%s", buf.String())
+	}
+	want := []string{"GET /first", "traces search", "restart app", "GET /second", "logs query", "metrics query"}
+	if !slices.Equal(log, want) {
+		t.Fatalf("ran %q, want %q", log, want)
+	}
+}
+
+func TestRunCase_StepsStopAtFailedExpect(t *testing.T) {
+	var log []string
+	exec := &orderedExec{log: &log, routeExec: routeExec{results: map[string]engine.Result{
+		"traces search": {Stdout: ""},
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		log = append(log, req.Method+" "+req.URL.Path)
+	}))
+	defer server.Close()
+	r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+	setInputEndpoint(t, r, server.URL)
+
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), mustParse(t, stepsCase))
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+	if ok {
+		t.Fatalf("expected fail:\n%s", buf.String())
+	}
+	if want := []string{"GET /first", "traces search"}; !slices.Equal(log, want) {
+		t.Fatalf("ran %q, want %q", log, want)
+	}
+}
+
+func TestRunCase_StepFixtureActionNeedsFixture(t *testing.T) {
+	exec := &routeExec{results: map[string]engine.Result{"traces search": {Stdout: "GET /first"}}}
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	r, buf := newRunner(t, exec, Options{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1})
+	setInputEndpoint(t, r, server.URL)
+
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), mustParse(t, stepsCase))
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+	if ok || !strings.Contains(buf.String(), "steps[2]: fixture: fixture actions require a Compose or k3d fixture") {
+		t.Fatalf("expected fixture action failure:\n%s", buf.String())
+	}
+}
+
+func TestDoInput_FixtureAction(t *testing.T) {
+	r, _ := newRunner(t, &stubExec{}, Options{Timeout: 100 * time.Millisecond})
+	var got casefile.FixtureAction
+	r.endpoint.ControlService = func(ctx context.Context, a casefile.FixtureAction) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("fixture action ran without a timeout")
+		}
+		got = a
+		return nil
+	}
+	want := casefile.FixtureAction{Kill: "app", Signal: "SIGTERM"}
+	if err := r.doInput(context.Background(), casefile.Input{Fixture: &want}, nil); err != nil {
+		t.Fatalf("doInput: %v", err)
+	}
+	if got != want {
+		t.Fatalf("fixture action = %+v, want %+v", got, want)
+	}
+
+	r.endpoint.ControlService = func(context.Context, casefile.FixtureAction) error { return errors.New("no such service") }
+	if err := r.doInput(context.Background(), casefile.Input{Fixture: &want}, nil); err == nil || err.Error() != "fixture: no such service" {
+		t.Fatalf("doInput error = %v, want fixture: no such service", err)
+	}
+}
+
+func TestDriveLoadRepeat(t *testing.T) {
+	var sent, inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(2 * time.Millisecond)
+		if sent.Add(1)%10 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	r, buf := newRunner(t, &stubExec{}, Options{Timeout: time.Second})
+	setInputEndpoint(t, r, server.URL)
+
+	err := r.driveLoad(context.Background(), "load", "input[0]", casefile.Input{Path: "/rolldice", Repeat: 20, Concurrency: 4})
+	if got := sent.Load(); got != 20 {
+		t.Errorf("sent %d requests, want 20", got)
+	}
+	if peak.Load() > 4 {
+		t.Errorf("%d requests in flight, want at most 4", peak.Load())
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "2 of 20 requests failed (first: ") {
+		t.Fatalf("driveLoad error = %v", err)
+	}
+	if !regexp.MustCompile(`LOAD load  input\[0\] GET /rolldice: 18 ok, 2 failed in \d+ms \(p50 [\d.]+ms, p95 [\d.]+ms, max [\d.]+ms\)`).MatchString(buf.String()) {
+		t.Errorf("no load summary in:\n%s", buf.String())
+	}
+}
+
+func TestDriveLoadDurationAndRate(t *testing.T) {
+	var sent atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { sent.Add(1) }))
+	defer server.Close()
+	r, _ := newRunner(t, &stubExec{}, Options{Timeout: time.Second})
+	setInputEndpoint(t, r, server.URL)
+
+	in := casefile.Input{Path: "/rolldice", Duration: 200 * time.Millisecond, Rate: "50/s", Concurrency: 3}
+	if err := r.driveLoad(context.Background(), "load", "input[0]", in); err != nil {
+		t.Fatalf("driveLoad: %v", err)
+	}
+	// 50/s for 200ms is 10 requests whatever the concurrency; allow for
+	// scheduling slack at the edges.
+	if got := sent.Load(); got < 5 || got > 11 {
+		t.Errorf("sent %d requests, want about 10", got)
+	}
+
+	in = casefile.Input{Path: "/rolldice", Duration: 20 * time.Millisecond, Rate: "1/m"}
+	if err := r.driveLoad(context.Background(), "load", "input[0]", in); err == nil || err.Error() != "sent no requests in 20ms; raise duration or rate" {
+		t.Fatalf("driveLoad error = %v", err)
+	}
+}
+
 func setInputEndpoint(t *testing.T, r *Runner, serverURL string) {
 	t.Helper()
 	host, portText, err := net.SplitHostPort(strings.TrimPrefix(serverURL, "http://"))
@@ -1265,11 +2362,372 @@ expected:
 	}
 
 	failingExec, _ := newRunner(t, &stubExec{err: errors.New("gcx unavailable")}, Options{Timeout: 5 * time.Millisecond, Interval: time.Millisecond, SeedSettleDelay: -1})
-	if failingExec.pollAssert(context.Background(), mustParse(t, tracesCase), []string{"traces", "search"}, false, func(string, string, int) []assert.Failure { return nil }) {
+	if failingExec.pollAssert(context.Background(), mustParse(t, tracesCase), func() []string { return []string{"traces", "search"} }, false, func(string, string, int) []assert.Failure { return nil }) {
 		t.Fatal("pollAssert should fail when gcx execution errors")
 	}
 	nonZero, _ := newRunner(t, &stubExec{stderr: "gcx failed", exit: 1}, Options{Timeout: 5 * time.Millisecond, Interval: time.Millisecond, SeedSettleDelay: -1})
-	if nonZero.pollAssert(context.Background(), mustParse(t, tracesCase), []string{"traces", "search"}, true, func(string, string, int) []assert.Failure { return nil }) {
+	if nonZero.pollAssert(context.Background(), mustParse(t, tracesCase), func() []string { return []string{"traces", "search"} }, true, func(string, string, int) []assert.Failure { return nil }) {
 		t.Fatal("pollAssert should fail for a non-zero gcx exit")
 	}
 }
+
+func TestRunCase_InterpolatesQueriesAndInputs(t *testing.T) {
+	var gotPath string
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.RequestURI()
+	}))
+	defer app.Close()
+	host, port := splitHostPort(t, app.Listener.Addr().String())
+
+	exec := &stubExec{stdout: "checkout"}
+	r, buf := newRunner(t, exec, Options{Timeout: 100 * time.Millisecond, Interval: 5 * time.Millisecond, SeedSettleDelay: 1, RunID: "r42"})
+	r.endpoint.AppHost = host
+	r.endpoint.AppPort = port
+
+	c := mustParse(t, `
+name: interpolated
+seed:
+  vars:
+    svc: checkout
+input:
+  - path: /cart?run=${run.id}
+expected:
+  traces:
+    - traceql: '{ resource.service.name = "${vars.svc}" }'
+      contains: ["${vars.svc}"]
+`)
+	if !r.RunCase(context.Background(), c) {
+		t.Fatalf("expected pass:\n%s", buf.String())
+	}
+	if gotPath != "/cart?run=r42" {
+		t.Errorf("input path: got %q", gotPath)
+	}
+	args := strings.Join(exec.captured[0], " ")
+	if !strings.Contains(args, `{ resource.service.name = "checkout" }`) {
+		t.Errorf("gcx args not expanded: %s", args)
+	}
+}
+
+func TestRunCase_InterpolateFailureSurfaced(t *testing.T) {
+	exec := &stubExec{stdout: "x"}
+	r, buf := newRunner(t, exec, Options{Timeout: 10 * time.Millisecond, Interval: time.Millisecond, SeedSettleDelay: 1})
+	c := mustParse(t, `
+name: missing env
+expected:
+  traces:
+    - traceql: '{ resource.service.name = "${env.OATS_TEST_UNSET_VAR}" }'
+`)
+	r.reporter.Emit(report.Event{Type: report.EventRunStart})
+	ok := r.RunCase(context.Background(), c)
+	r.reporter.Emit(report.Event{Type: report.EventRunEnd})
+	if ok {
+		t.Fatal("expected fail for unset env reference")
+	}
+	if len(exec.captured) != 0 {
+		t.Errorf("gcx should not run when interpolation fails: %v", exec.captured)
+	}
+	if !strings.Contains(buf.String(), "interpolate: expected.traces[0].traceql") {
+		t.Errorf("interpolate failure missing:\n%s", buf.String())
+	}
+}
+
+func TestCacheKeyIncludesEnvReferences(t *testing.T) {
+	r, _ := newRunner(t, &stubExec{}, Options{})
+	c := mustParse(t, `
+name: env key
+expected:
+  metrics:
+    - promql: 'up{job="${env.OATS_TEST_JOB}"}'
+`)
+	t.Setenv("OATS_TEST_JOB", "a")
+	a := r.cacheKey(c).Hash()
+	t.Setenv("OATS_TEST_JOB", "b")
+	if b := r.cacheKey(c).Hash(); a == b {
+		t.Fatal("cache key should change with referenced env values")
+	}
+}
+
+func TestCacheKeySeparatesMatrixVariants(t *testing.T) {
+	r, _ := newRunner(t, &stubExec{}, Options{})
+	c := mustParse(t, `
+name: matrix key
+matrix: [{name: v1}, {name: v2}]
+expected:
+  metrics:
+    - promql: up
+`)
+	// Variants share the case file, so its bytes cannot tell them apart.
+	c.SourcePath = filepath.Join(t.TempDir(), "matrix.yaml")
+	if err := os.WriteFile(c.SourcePath, []byte("name: matrix key"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	variants, err := c.Expand()
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if r.cacheKey(variants[0]).Hash() == r.cacheKey(variants[1]).Hash() {
+		t.Fatal("matrix variants of one case should not share a cache key")
+	}
+}
+
+func TestCacheKeyIncludesFragments(t *testing.T) {
+	r, _ := newRunner(t, &stubExec{}, Options{})
+	dir := t.TempDir()
+	frag := filepath.Join(dir, "base.yaml")
+	casePath := filepath.Join(dir, "case.yaml")
+	if err := os.WriteFile(frag, []byte("expected:\n  metrics:\n    - promql: up\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(casePath, []byte("extends: [base.yaml]\nname: fragment key\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := casefile.Load(casePath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	a := r.cacheKey(c).Hash()
+	if err := os.WriteFile(frag, []byte("expected:\n  metrics:\n    - promql: down\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if b := r.cacheKey(c).Hash(); a == b {
+		t.Fatal("cache key should change when a fragment changes")
+	}
+}
+
+func TestRunCase_ScopesQueriesToRunID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	run := func(t *testing.T, ep Endpoint, src string) []string {
+		t.Helper()
+		exec := &stubExec{stdout: "svc"}
+		var buf bytes.Buffer
+		ep.GCXContext = "test"
+		ep.OTLPHTTP = server.URL
+		r := New(exec, report.NewTextReporter(&buf, report.VerbosePasses), ep, Options{
+			Timeout: 50 * time.Millisecond, Interval: time.Millisecond, SeedSettleDelay: -1, RunID: "r1",
+		})
+		if !r.RunCase(context.Background(), mustParse(t, src)) {
+			t.Fatalf("expected pass:\n%s", buf.String())
+		}
+		var queries []string
+		for _, args := range exec.captured {
+			queries = append(queries, args[len(args)-1])
+		}
+		return queries
+	}
+
+	t.Run("inline-otlp scopes every signal", func(t *testing.T) {
+		got := run(t, Endpoint{}, `
+name: inline
+seed:
+  type: inline-otlp
+  traces:
+    - service: svc
+      spans: [{name: op}]
+expected:
+  traces:
+    - traceql: '{}'
+      contains: svc
+  logs:
+    - logql: '{service_name="svc"}'
+      contains: svc
+  metrics:
+    - promql: 'seed_total'
+      contains: svc
+    - promql: 'seed_total'
+      contains: svc
+      scope_run_id: false
+`)
+		want := []string{
+			`{ resource.oats.run.id = "r1" }`,
+			`{service_name="svc"} | oats_run_id="r1"`,
+			`seed_total{oats_run_id="r1"}`,
+			`seed_total`,
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("queries:\n got %q\nwant %q", got, want)
+		}
+	})
+
+	t.Run("injected app scopes traces and logs only", func(t *testing.T) {
+		got := run(t, Endpoint{RunIDInjected: true}, `
+name: app
+expected:
+  traces:
+    - traceql: '{}'
+      contains: svc
+  logs:
+    - logql: '{service_name="svc"}'
+      contains: svc
+  metrics:
+    - promql: 'up'
+      contains: svc
+`)
+		want := []string{
+			`{ resource.oats.run.id = "r1" }`,
+			`{service_name="svc"} | oats_run_id="r1"`,
+			`up`,
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("queries:\n got %q\nwant %q", got, want)
+		}
+	})
+
+	t.Run("app without injection is unscoped unless forced", func(t *testing.T) {
+		got := run(t, Endpoint{}, `
+name: app
+expected:
+  traces:
+    - traceql: '{}'
+      contains: svc
+    - traceql: '{}'
+      contains: svc
+      scope_run_id: true
+`)
+		want := []string{`{}`, `{ resource.oats.run.id = "r1" }`}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("queries:\n got %q\nwant %q", got, want)
+		}
+	})
+}
+
+func TestRunCase_QueryWindowIsCaseRelative(t *testing.T) {
+	exec := &stubExec{stdout: "svc"}
+	r, buf := newRunner(t, exec, Options{Timeout: 50 * time.Millisecond, Interval: time.Millisecond, SeedSettleDelay: 1, ClockSkew: 3 * time.Second})
+	c := mustParse(t, `
+name: windows
+expected:
+  traces:
+    - traceql: '{}'
+      contains: svc
+  logs:
+    - logql: '{a="b"}'
+      contains: svc
+      since: 15m
+  metrics:
+    - promql: 'up'
+      contains: svc
+      window: 1m
+`)
+	if !r.RunCase(context.Background(), c) {
+		t.Fatalf("expected pass:\n%s", buf.String())
+	}
+	var got []string
+	for _, args := range exec.captured {
+		got = append(got, args[3])
+	}
+	want := []string{"4s", "15m0s", "1m1s"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("--since values: got %v want %v", got, want)
+	}
+}
+
+// startGRPC serves the standard health service on a local port, recording
+// the metadata of each call, and points r's application endpoint at it.
+func startGRPC(t *testing.T, r *Runner, withReflection bool) *[]metadata.MD {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []metadata.MD
+	srv := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		seen = append(seen, md)
+		_ = grpc.SetHeader(ctx, metadata.Pairs("x-request-id", "req-7"))
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	if withReflection {
+		reflection.Register(srv)
+	}
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	setInputEndpoint(t, r, "http://"+lis.Addr().String())
+	return &seen
+}
+
+func TestDoGRPC_ServerReflection(t *testing.T) {
+	r, _ := newRunner(t, &stubExec{}, Options{Timeout: 5 * time.Second})
+	seen := startGRPC(t, r, true)
+	caps := captures{}
+	in := casefile.Input{
+		GRPC: &casefile.GRPCInput{
+			Service:  "grpc.health.v1.Health",
+			Method:   "Check",
+			Request:  `{"service": ""}`,
+			Metadata: map[string]string{"x-tenant": "a"},
+		},
+		TraceContext: &casefile.TraceContext{},
+		Capture: map[string]casefile.CaptureSource{
+			"state":   {JSON: "status"},
+			"request": {Header: "X-Request-Id"},
+		},
+	}
+	if err := r.doInput(context.Background(), in, caps); err != nil {
+		t.Fatalf("doInput: %v", err)
+	}
+	if caps["state"] != "SERVING" || caps["request"] != "req-7" || len(caps["trace_id"]) != 32 {
+		t.Fatalf("captures = %v", caps)
+	}
+	if len(*seen) != 1 || (*seen)[0].Get("x-tenant")[0] != "a" || !strings.Contains((*seen)[0].Get("traceparent")[0], caps["trace_id"]) {
+		t.Fatalf("metadata = %v", *seen)
+	}
+}
+
+func TestDoGRPC_Status(t *testing.T) {
+	r, _ := newRunner(t, &stubExec{}, Options{Timeout: 5 * time.Second})
+	startGRPC(t, r, true)
+	call := &casefile.GRPCInput{Service: "grpc.health.v1.Health", Method: "Check", Request: `{"service": "missing"}`}
+	err := r.doInput(context.Background(), casefile.Input{GRPC: call}, nil)
+	if err == nil || err.Error() != "status NOT_FOUND, want OK: unknown service" {
+		t.Fatalf("doInput error = %v, want NOT_FOUND status mismatch", err)
+	}
+	call.Status = "NOT_FOUND"
+	if err := r.doInput(context.Background(), casefile.Input{GRPC: call}, nil); err != nil {
+		t.Fatalf("doInput with expected NOT_FOUND: %v", err)
+	}
+	call.Method = "Watch"
+	if err := r.doInput(context.Background(), casefile.Input{GRPC: call}, nil); err == nil || !strings.Contains(err.Error(), "only unary methods are supported") {
+		t.Fatalf("doInput streaming error = %v", err)
+	}
+}
+
+func TestDoGRPC_DescriptorSet(t *testing.T) {
+	r, _ := newRunner(t, &stubExec{}, Options{Timeout: 5 * time.Second})
+	startGRPC(t, r, false)
+	call := &casefile.GRPCInput{Service: "grpc.health.v1.Health", Method: "Check"}
+	if err := r.doInput(context.Background(), casefile.Input{GRPC: call}, nil); err == nil || !strings.Contains(err.Error(), "server reflection") {
+		t.Fatalf("doInput without reflection = %v, want a server reflection error", err)
+	}
+
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "health.protoset"), set, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := mustParse(t, `
+name: grpc health
+input:
+  - grpc:
+      service: grpc.health.v1.Health
+      method: Check
+      descriptor_set: health.protoset
+expected:
+  traces:
+    - traceql: '{}'
+`)
+	c.SourcePath = filepath.Join(dir, "case.yaml")
+	pick := func(sc *casefile.Case) casefile.Input { return sc.Input[0] }
+	if err := r.driveInput(context.Background(), c, c, captures{}, "input[0]", pick); err != nil {
+		t.Fatalf("driveInput with descriptor set: %v", err)
+	}
+}
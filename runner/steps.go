@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grafana/oats/casefile"
+)
+
+// runStep runs steps[i] of the case. An error means the step could not run
+// (an input or fixture action failed); passed is false when its assertions
+// failed, which have already been reported.
+func (r *Runner) runStep(ctx context.Context, raw, c *casefile.Case, caps captures, seedStart time.Time, i int) (passed bool, err error) {
+	st := c.Steps[i]
+	path := fmt.Sprintf("steps[%d]", i)
+	switch {
+	case st.Input != nil:
+		pick := func(sc *casefile.Case) casefile.Input { return *sc.Steps[i].Input }
+		if err := r.driveInput(ctx, raw, c, caps, path+".input", pick); err != nil {
+			return false, fmt.Errorf("input: %w", err)
+		}
+	case st.Sleep > 0:
+		select {
+		case <-time.After(st.Sleep):
+		case <-ctx.Done():
+			return false, fmt.Errorf("sleep: %w", ctx.Err())
+		}
+	case st.Expect != nil:
+		block := func(sc *casefile.Case) *casefile.Expected { return sc.Steps[i].Expect }
+		return r.expect(ctx, raw, c, caps, seedStart, path+".expect", block), nil
+	case st.Fixture != nil:
+		if err := r.fixtureAction(ctx, *st.Fixture); err != nil {
+			return false, fmt.Errorf("fixture: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// fixtureAction applies a fixture action to a service of the Compose or k3d
+// fixture.
+func (r *Runner) fixtureAction(ctx context.Context, a casefile.FixtureAction) error {
+	if r.endpoint.ControlService == nil {
+		return fmt.Errorf("fixture actions require a Compose or k3d fixture")
+	}
+	actionCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+	return r.endpoint.ControlService(actionCtx, a)
+}
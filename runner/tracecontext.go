@@ -0,0 +1,38 @@
+package runner
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/grafana/oats/casefile"
+)
+
+// newTraceContext returns W3C trace context headers for an input that
+// starts its own trace, and the generated trace ID. The span ID stands for a
+// client span OATS never exports, so the app's server span is its child.
+func newTraceContext(spec casefile.TraceContext) (map[string]string, string, error) {
+	var ids [24]byte
+	if _, err := rand.Read(ids[:]); err != nil {
+		return nil, "", err
+	}
+	traceID := hex.EncodeToString(ids[:16])
+	flags := "01"
+	if spec.Sampled != nil && !*spec.Sampled {
+		flags = "00"
+	}
+	headers := map[string]string{
+		"traceparent": "00-" + traceID + "-" + hex.EncodeToString(ids[16:]) + "-" + flags,
+	}
+	if len(spec.Baggage) > 0 {
+		members := make([]string, 0, len(spec.Baggage))
+		for _, k := range slices.Sorted(maps.Keys(spec.Baggage)) {
+			members = append(members, k+"="+url.PathEscape(spec.Baggage[k]))
+		}
+		headers["baggage"] = strings.Join(members, ",")
+	}
+	return headers, traceID, nil
+}
@@ -22,12 +22,18 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
 
+// RunIDAttribute is the resource attribute that carries Sender.RunID. Queries
+// scoped to a run filter on it (see signalcmd.ScopeTraceQL and friends).
+const RunIDAttribute = "oats.run.id"
+
 // jsonString renders s as a JSON string literal (quotes included), escaped per
 // JSON rules. Payloads are assembled with fmt.Sprintf, so any field carrying
 // user-supplied text (service names, span/metric names, log bodies) must go
@@ -71,6 +77,35 @@ type Metric struct {
 	Service string
 	Name    string
 	Value   int64
+	// Histogram, when set, is sent instead of the monotonic sum Value.
+	Histogram *Histogram
+}
+
+// Histogram is an explicit-bucket histogram built from raw observations.
+type Histogram struct {
+	Bounds       []float64
+	Observations []float64
+}
+
+// dataPoint renders the histogram's count, sum and bucket counts. OTLP
+// buckets are upper-inclusive: bucket i holds bounds[i-1] < v <= bounds[i].
+func (h Histogram) dataPoint() string {
+	counts := make([]string, len(h.Bounds)+1)
+	n := make([]int, len(h.Bounds)+1)
+	sum := 0.0
+	for _, v := range h.Observations {
+		sum += v
+		i := sort.SearchFloat64s(h.Bounds, v)
+		n[i]++
+	}
+	for i, c := range n {
+		counts[i] = fmt.Sprintf("%q", strconv.Itoa(c))
+	}
+	bounds, _ := json.Marshal(h.Bounds)
+	return fmt.Sprintf(`"count": "%d",
+            "sum": %s,
+            "bucketCounts": [%s],
+            "explicitBounds": %s`, len(h.Observations), strconv.FormatFloat(sum, 'g', -1, 64), strings.Join(counts, ","), bounds)
 }
 
 // Sender pushes a Payload at an OTLP/HTTP endpoint (e.g. http://localhost:4318).
@@ -83,6 +118,25 @@ type Sender struct {
 	// User-Agent is bare "oats"; the runner sets it so seed traffic is
 	// identifiable to the receiving backend as "oats/<version>".
 	Version string
+	// RunID, when set, is stamped on every payload as the RunIDAttribute
+	// resource attribute, and on metric data points so it survives as a
+	// series label (Prometheus keeps resource attributes on target_info only).
+	RunID string
+}
+
+// resourceAttributes renders the resource attribute list shared by every
+// signal: service.name, plus the run ID when the Sender carries one.
+func (s *Sender) resourceAttributes(service string) string {
+	attrs := `{"key":"service.name","value":{"stringValue":` + jsonString(service) + `}}`
+	if s.RunID != "" {
+		attrs += `,
+      ` + s.runIDAttribute()
+	}
+	return attrs
+}
+
+func (s *Sender) runIDAttribute() string {
+	return `{"key":` + jsonString(RunIDAttribute) + `,"value":{"stringValue":` + jsonString(s.RunID) + `}}`
 }
 
 // userAgent identifies inline-otlp seed traffic as "oats/<version>", or bare
@@ -144,7 +198,7 @@ func (s *Sender) sendTrace(ctx context.Context, t Trace, now time.Time) error {
 	body := fmt.Sprintf(`{
   "resourceSpans": [{
     "resource": {"attributes": [
-      {"key":"service.name","value":{"stringValue":%s}}
+      %s
     ]},
     "scopeSpans": [{
       "scope": {"name":"oats-inline-seed"},
@@ -158,7 +212,7 @@ func (s *Sender) sendTrace(ctx context.Context, t Trace, now time.Time) error {
       }]
     }]
   }]
-}`, jsonString(t.Service), mustRandHex(16), mustRandHex(8), jsonString(t.Span.Name), kind, start, end)
+}`, s.resourceAttributes(t.Service), mustRandHex(16), mustRandHex(8), jsonString(t.Span.Name), kind, start, end)
 	return s.post(ctx, "/v1/traces", body)
 }
 
@@ -174,7 +228,7 @@ func (s *Sender) sendLog(ctx context.Context, l Log, now time.Time) error {
 	body := fmt.Sprintf(`{
   "resourceLogs": [{
     "resource": {"attributes": [
-      {"key":"service.name","value":{"stringValue":%s}}
+      %s
     ]},
     "scopeLogs": [{
       "scope": {"name":"oats-inline-seed"},
@@ -186,35 +240,48 @@ func (s *Sender) sendLog(ctx context.Context, l Log, now time.Time) error {
       }]
     }]
   }]
-}`, jsonString(l.Service), now.UnixNano(), sev, jsonString(sevText), jsonString(l.Body))
+}`, s.resourceAttributes(l.Service), now.UnixNano(), sev, jsonString(sevText), jsonString(l.Body))
 	return s.post(ctx, "/v1/logs", body)
 }
 
+// Temporality is the aggregation temporality of the sums and histograms
+// sendMetric pushes (aggregationTemporality 2).
+const Temporality = "cumulative"
+
 func (s *Sender) sendMetric(ctx context.Context, m Metric, now time.Time) error {
 	end := now.UnixNano()
 	start := now.Add(-time.Second).UnixNano()
+	pointAttrs := ""
+	if s.RunID != "" {
+		pointAttrs = `
+            "attributes": [` + s.runIDAttribute() + `],`
+	}
+	kind, point := `"sum": {
+          "isMonotonic": true,`, fmt.Sprintf(`"asInt": "%d"`, m.Value)
+	if m.Histogram != nil {
+		kind, point = `"histogram": {`, m.Histogram.dataPoint()
+	}
 	body := fmt.Sprintf(`{
   "resourceMetrics": [{
     "resource": {"attributes": [
-      {"key":"service.name","value":{"stringValue":%s}}
+      %s
     ]},
     "scopeMetrics": [{
       "scope": {"name":"oats-inline-seed"},
       "metrics": [{
         "name": %s,
-        "sum": {
-          "isMonotonic": true,
+        %s
           "aggregationTemporality": 2,
-          "dataPoints": [{
+          "dataPoints": [{%s
             "startTimeUnixNano": "%d",
             "timeUnixNano": "%d",
-            "asInt": "%d"
+            %s
           }]
         }
       }]
     }]
   }]
-}`, jsonString(m.Service), jsonString(m.Name), start, end, m.Value)
+}`, s.resourceAttributes(m.Service), jsonString(m.Name), kind, pointAttrs, start, end, point)
 	return s.post(ctx, "/v1/metrics", body)
 }
 
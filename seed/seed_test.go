@@ -179,3 +179,75 @@ func TestSender_SpanDefaultsApply(t *testing.T) {
 		t.Errorf("timestamps empty: %+v", span)
 	}
 }
+
+func TestSender_StampsRunID(t *testing.T) {
+	srv, h := newRecorder()
+	defer srv.Close()
+
+	s := &Sender{OTLPEndpoint: srv.URL, RunID: "abc123"}
+	err := s.Send(context.Background(), Payload{
+		Traces:  []Trace{{Service: "svc", Span: SpanFields{Name: "op"}}},
+		Logs:    []Log{{Service: "svc", Body: "line"}},
+		Metrics: []Metric{{Service: "svc", Name: "things", Value: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	attr := `{"key":"oats.run.id","value":{"stringValue":"abc123"}}`
+	for _, path := range []string{"/v1/traces", "/v1/logs", "/v1/metrics"} {
+		body := string(h.requests[path])
+		if !json.Valid(h.requests[path]) {
+			t.Errorf("payload at %s is not valid JSON:\n%s", path, body)
+		}
+		if !strings.Contains(body, attr) {
+			t.Errorf("payload at %s missing run ID attribute:\n%s", path, body)
+		}
+	}
+	// Metrics carry it twice: on the resource and on the data point.
+	if n := strings.Count(string(h.requests["/v1/metrics"]), attr); n != 2 {
+		t.Errorf("metric payload should carry the run ID on resource and data point, got %d", n)
+	}
+}
+
+func TestSender_SendsHistogram(t *testing.T) {
+	srv, h := newRecorder()
+	defer srv.Close()
+
+	s := &Sender{OTLPEndpoint: srv.URL, RunID: "abc123"}
+	err := s.Send(context.Background(), Payload{Metrics: []Metric{{
+		Service:   "svc",
+		Name:      "latency_seconds",
+		Histogram: &Histogram{Bounds: []float64{0.1, 0.5}, Observations: []float64{0.05, 0.1, 0.3, 2}},
+	}}})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	var payload struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Histogram struct {
+						AggregationTemporality int `json:"aggregationTemporality"`
+						DataPoints             []struct {
+							Count          string    `json:"count"`
+							Sum            float64   `json:"sum"`
+							BucketCounts   []string  `json:"bucketCounts"`
+							ExplicitBounds []float64 `json:"explicitBounds"`
+							Attributes     []any     `json:"attributes"`
+						} `json:"dataPoints"`
+					} `json:"histogram"`
+				} `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal(h.requests["/v1/metrics"], &payload); err != nil {
+		t.Fatalf("metric payload is not valid JSON: %v\n%s", err, h.requests["/v1/metrics"])
+	}
+	hist := payload.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Histogram
+	dp := hist.DataPoints[0]
+	// 0.1 sits on a bound, so it lands in the first (upper-inclusive) bucket.
+	if hist.AggregationTemporality != 2 || dp.Count != "4" || dp.Sum != 2.45 || strings.Join(dp.BucketCounts, ",") != "2,1,1" || len(dp.ExplicitBounds) != 2 || len(dp.Attributes) != 1 {
+		t.Fatalf("histogram data point = %+v", dp)
+	}
+}
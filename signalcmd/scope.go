@@ -0,0 +1,269 @@
+package signalcmd
+
+import (
+	"strings"
+
+	"github.com/grafana/oats/seed"
+)
+
+// RunIDLabel is the run ID attribute as Loki and Prometheus expose it: OTLP
+// ingestion rewrites dots to underscores in label and metadata names.
+var RunIDLabel = strings.ReplaceAll(seed.RunIDAttribute, ".", "_")
+
+// ScopeTraceQL narrows a TraceQL query to spans whose resource carries runID.
+// Every spanset filter is narrowed, so neither side of `{ a } || { b }` nor of
+// a structural query such as `{ parent } >> { child }` can match another run's
+// spans. A query that must match spans from services OATS did not tag opts out
+// with scope_run_id: false.
+func ScopeTraceQL(query, runID string) string {
+	cond := "resource." + seed.RunIDAttribute + " = " + quote(runID)
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case isQuote(c):
+			end := skipQuoted(query, i)
+			b.WriteString(query[i:end])
+			i = end
+		case c == '{':
+			end := matchingBrace(query, i)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(andSpanset(query[i+1:end], cond))
+			i = end + 1
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// TraceQLForTrace narrows a TraceQL query to the trace with traceID, so a
+// search answers whether that one trace matches.
+func TraceQLForTrace(query, traceID string) string {
+	return narrowTraceQL(query, "trace:id = "+quote(traceID))
+}
+
+// narrowTraceQL ANDs cond into the query's first spanset filter.
+func narrowTraceQL(query, cond string) string {
+	open := indexUnquoted(query, '{', 0)
+	if open < 0 {
+		return query
+	}
+	end := matchingBrace(query, open)
+	if end < 0 {
+		return query
+	}
+	return query[:open] + andSpanset(query[open+1:end], cond) + query[end+1:]
+}
+
+// andSpanset returns the spanset filter with body inner ANDed with cond.
+func andSpanset(inner, cond string) string {
+	inner = strings.TrimSpace(inner)
+	if inner == "" {
+		return "{ " + cond + " }"
+	}
+	return "{ (" + inner + ") && " + cond + " }"
+}
+
+// ScopeLogQL adds a run ID label filter after every stream selector. The
+// filter matches a stream label or structured metadata alike, which is where
+// OTLP ingestion puts non-indexed resource attributes.
+func ScopeLogQL(query, runID string) string {
+	return filterLogQL(query, " | "+RunIDLabel+"="+quote(runID))
+}
+
+// LogQLForTrace narrows a LogQL query to the lines whose trace_id, kept as
+// structured metadata by OTLP ingestion, is traceID.
+func LogQLForTrace(query, traceID string) string {
+	return filterLogQL(query, " | trace_id="+quote(traceID))
+}
+
+// filterLogQL inserts filter after every stream selector.
+func filterLogQL(query, filter string) string {
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case isQuote(c):
+			end := skipQuoted(query, i)
+			b.WriteString(query[i:end])
+			i = end
+		case c == '{':
+			end := matchingBrace(query, i)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : end+1])
+			b.WriteString(filter)
+			i = end + 1
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// promKeywords are PromQL identifiers that are never metric names: operators,
+// literals, and aggregations (which may take `by (...)` before their argument).
+var promKeywords = map[string]bool{
+	"and": true, "or": true, "unless": true, "bool": true, "offset": true,
+	"atan2": true, "inf": true, "nan": true,
+	"sum": true, "avg": true, "count": true, "min": true, "max": true,
+	"group": true, "stddev": true, "stdvar": true, "topk": true, "bottomk": true,
+	"quantile": true, "count_values": true, "limitk": true, "limit_ratio": true,
+}
+
+// promGrouping are PromQL keywords followed by a parenthesised label list.
+var promGrouping = map[string]bool{
+	"by": true, "without": true, "on": true, "ignoring": true,
+	"group_left": true, "group_right": true,
+}
+
+// ScopePromQL adds a run ID label matcher to every vector selector, whether
+// it is written as a bare metric name, name{...}, or {...}.
+func ScopePromQL(query, runID string) string {
+	var b strings.Builder
+	matcher := RunIDLabel + "=" + quote(runID)
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case isQuote(c):
+			end := skipQuoted(query, i)
+			b.WriteString(query[i:end])
+			i = end
+		case c == '[':
+			// Range and subquery durations.
+			end := strings.IndexByte(query[i:], ']')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+1])
+			i += end + 1
+		case c == '{':
+			end := matchingBrace(query, i)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			inner := strings.TrimRight(strings.TrimSpace(query[i+1:end]), ",")
+			if inner == "" {
+				b.WriteString("{" + matcher + "}")
+			} else {
+				b.WriteString("{" + inner + ", " + matcher + "}")
+			}
+			i = end + 1
+		case isIdentStart(c):
+			j := i
+			for j < len(query) && isIdentChar(query[j]) {
+				j++
+			}
+			ident := query[i:j]
+			b.WriteString(ident)
+			next := j
+			for next < len(query) && query[next] == ' ' {
+				next++
+			}
+			switch {
+			case promGrouping[strings.ToLower(ident)]:
+				if next < len(query) && query[next] == '(' {
+					end := strings.IndexByte(query[next:], ')')
+					if end >= 0 {
+						b.WriteString(query[j : next+end+1])
+						j = next + end + 1
+					}
+				}
+			case promKeywords[strings.ToLower(ident)]:
+			case next < len(query) && (query[next] == '(' || query[next] == '{'):
+				// A function call, or a metric name whose selector the '{'
+				// branch scopes.
+			default:
+				b.WriteString("{" + matcher + "}")
+			}
+			i = j
+		case c >= '0' && c <= '9':
+			// Numbers and durations: 1e3, 0x1f, 5m.
+			j := i
+			for j < len(query) && (isIdentChar(query[j]) || query[j] == '.') {
+				j++
+			}
+			b.WriteString(query[i:j])
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func isQuote(c byte) bool { return c == '"' || c == '\'' || c == '`' }
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool { return isIdentStart(c) || (c >= '0' && c <= '9') }
+
+// skipQuoted returns the index just past the string literal opening at i.
+// Backtick strings are raw; the others honour backslash escapes.
+func skipQuoted(s string, i int) int {
+	q := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if q != '`' {
+				j++
+			}
+		case q:
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// indexUnquoted returns the first index of c at or after from that is not
+// inside a string literal, or -1.
+func indexUnquoted(s string, c byte, from int) int {
+	for i := from; i < len(s); {
+		switch {
+		case isQuote(s[i]):
+			i = skipQuoted(s, i)
+		case s[i] == c:
+			return i
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// matchingBrace returns the index of the '}' closing the '{' at open, skipping
+// string literals, or -1 when it is unbalanced.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); {
+		switch c := s[i]; {
+		case isQuote(c):
+			i = skipQuoted(s, i)
+			continue
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+		i++
+	}
+	return -1
+}
@@ -0,0 +1,67 @@
+package signalcmd
+
+import "testing"
+
+func TestScopeTraceQL(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{`{}`, `{ resource.oats.run.id = "r1" }`},
+		{`{ span.http.route = "/x" }`, `{ (span.http.route = "/x") && resource.oats.run.id = "r1" }`},
+		{`{ name = "a}b" } >> { name = "c" }`, `{ (name = "a}b") && resource.oats.run.id = "r1" } >> { (name = "c") && resource.oats.run.id = "r1" }`},
+		{`{ a || b } | count() > 1`, `{ (a || b) && resource.oats.run.id = "r1" } | count() > 1`},
+		{`{ name = "a" } || { name = "b" }`, `{ (name = "a") && resource.oats.run.id = "r1" } || { (name = "b") && resource.oats.run.id = "r1" }`},
+		{`({ } && { name = "b" }) | select(span.x)`, `({ resource.oats.run.id = "r1" } && { (name = "b") && resource.oats.run.id = "r1" }) | select(span.x)`},
+		{`no spanset`, `no spanset`},
+	} {
+		if got := ScopeTraceQL(tc.in, "r1"); got != tc.want {
+			t.Errorf("ScopeTraceQL(%q):\n got %q\nwant %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestTraceQLForTrace(t *testing.T) {
+	got := TraceQLForTrace(`{ span.http.route = "/x" } >> { name = "db" }`, "4bf92f35")
+	want := `{ (span.http.route = "/x") && trace:id = "4bf92f35" } >> { name = "db" }`
+	if got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestScopeLogQL(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{`{service_name="x"}`, `{service_name="x"} | oats_run_id="r1"`},
+		{`{service_name="x"} |= "{a}" | line_format "{{.msg}}"`, `{service_name="x"} | oats_run_id="r1" |= "{a}" | line_format "{{.msg}}"`},
+		{`sum(count_over_time({a="b"}[5m])) / sum(count_over_time({a="c"}[5m]))`,
+			`sum(count_over_time({a="b"} | oats_run_id="r1"[5m])) / sum(count_over_time({a="c"} | oats_run_id="r1"[5m]))`},
+	} {
+		if got := ScopeLogQL(tc.in, "r1"); got != tc.want {
+			t.Errorf("ScopeLogQL(%q):\n got %q\nwant %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestLogQLForTrace(t *testing.T) {
+	got := LogQLForTrace(`{service_name="x"} |= "GET"`, "4bf92f35")
+	if want := `{service_name="x"} | trace_id="4bf92f35" |= "GET"`; got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestScopePromQL(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{`up`, `up{oats_run_id="r1"}`},
+		{`up{job="a"}`, `up{job="a", oats_run_id="r1"}`},
+		{`{__name__="up"}`, `{__name__="up", oats_run_id="r1"}`},
+		{`up{}`, `up{oats_run_id="r1"}`},
+		{`rate(x_total[5m]) > 0`, `rate(x_total{oats_run_id="r1"}[5m]) > 0`},
+		{`sum by (job) (rate(x[1m])) / on(job) group_left sum(y)`,
+			`sum by (job) (rate(x{oats_run_id="r1"}[1m])) / on(job) group_left sum(y{oats_run_id="r1"})`},
+		{`histogram_quantile(0.9, sum(rate(h_bucket{le!="+Inf"}[5m])) without (instance))`,
+			`histogram_quantile(0.9, sum(rate(h_bucket{le!="+Inf", oats_run_id="r1"}[5m])) without (instance))`},
+		{`x offset 5m and bool y`, `x{oats_run_id="r1"} offset 5m and bool y{oats_run_id="r1"}`},
+		{`label_replace(x, "dst", "$1", "src", "(.*)")`, `label_replace(x{oats_run_id="r1"}, "dst", "$1", "src", "(.*)")`},
+	} {
+		if got := ScopePromQL(tc.in, "r1"); got != tc.want {
+			t.Errorf("ScopePromQL(%q):\n got %q\nwant %q", tc.in, got, tc.want)
+		}
+	}
+}
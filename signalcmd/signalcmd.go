@@ -31,7 +31,7 @@ func Traces(a casefile.TraceAssertion, since time.Duration) []string {
 		"traces", "search",
 		"--since", since.String(),
 	}
-	if len(a.MatchSpans) > 0 {
+	if a.Structured() || a.CapturesJSON() {
 		args = append(args, "-o", "json")
 	}
 	args = append(args, a.TraceQL)
@@ -60,7 +60,7 @@ func Logs(a casefile.LogAssertion, since time.Duration) []string {
 		"logs", "query",
 		"--since", since.String(),
 	}
-	if len(a.Match) > 0 {
+	if len(a.Match) > 0 || a.Cardinality != nil || a.CapturesJSON() {
 		args = append(args, "-o", "json")
 	}
 	args = append(args, a.LogQL)
@@ -70,7 +70,8 @@ func Logs(a casefile.LogAssertion, since time.Duration) []string {
 // Metrics builds the gcx args for a MetricAssertion. When the assertion
 // declares a numeric `value` comparison we ask gcx for JSON so the runner
 // can parse the actual value out; otherwise the default agent text format
-// is enough for substring matching.
+// is enough for substring matching. A `range` block turns the instant query
+// into a range query at its step.
 func Metrics(a casefile.MetricAssertion, since time.Duration) []string {
 	if since <= 0 {
 		since = DefaultSince
@@ -79,13 +80,84 @@ func Metrics(a casefile.MetricAssertion, since time.Duration) []string {
 		"metrics", "query",
 		"--since", since.String(),
 	}
-	if a.Value != "" || len(a.Match) > 0 {
+	if a.Histogram != nil {
+		return append(args, "-o", "json", HistogramQuery(a))
+	}
+	if a.Range != nil {
+		args = append(args, "--step", a.Range.Step.String())
+	}
+	if a.Value != "" || a.ComparesSeries() || a.Range != nil || a.Metadata != nil || a.Cardinality != nil || len(a.Match) > 0 || a.CapturesJSON() {
 		args = append(args, "-o", "json")
 	}
 	args = append(args, a.PromQL)
 	return args
 }
 
+// Exemplars builds the gcx args that fetch the exemplars attached to the
+// series promql selects.
+func Exemplars(promql string, since time.Duration) []string {
+	if since <= 0 {
+		since = DefaultSince
+	}
+	return []string{"metrics", "exemplars", "--since", since.String(), "-o", "json", promql}
+}
+
+// LogSearch builds the gcx args for a LogQL query with JSON output.
+func LogSearch(logql string, since time.Duration) []string {
+	if since <= 0 {
+		since = DefaultSince
+	}
+	return []string{"logs", "query", "--since", since.String(), "-o", "json", logql}
+}
+
+// TraceSearch builds the gcx args for a TraceQL search with JSON output.
+func TraceSearch(traceql string, since time.Duration) []string {
+	if since <= 0 {
+		since = DefaultSince
+	}
+	return []string{"traces", "search", "--since", since.String(), "-o", "json", traceql}
+}
+
+// ProfilesForSpan builds the gcx args for a profile query narrowed to the
+// samples span profiling recorded under spanID, with JSON output.
+func ProfilesForSpan(query, spanID string, since time.Duration) []string {
+	if since <= 0 {
+		since = DefaultSince
+	}
+	profileType, expr := splitProfileQuery(query)
+	matcher := "span_id=" + quote(spanID)
+	inner := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(expr, "{"), "}"))
+	if inner != "" {
+		matcher = strings.TrimRight(inner, ", ") + ", " + matcher
+	}
+	args := []string{"profiles", "query", "--since", since.String(), "-o", "json"}
+	if profileType != "" {
+		args = append(args, "--profile-type", profileType)
+	}
+	return append(args, "{"+matcher+"}")
+}
+
+// MetricMetadata builds the gcx args that fetch the metadata (type, unit,
+// help) the backend recorded for the metric name.
+func MetricMetadata(name string) []string {
+	return []string{"metrics", "metadata", "--metric", name, "-o", "json"}
+}
+
+// HistogramQuery selects every series of the histogram a.PromQL names: the
+// classic _bucket, _sum and _count series and a native histogram series.
+// A PromQL that is not a plain selector is returned unchanged.
+func HistogramQuery(a casefile.MetricAssertion) string {
+	name, matchers, err := a.Selector()
+	if err != nil {
+		return a.PromQL
+	}
+	query := `{__name__=~"` + name + `(_bucket|_sum|_count)?"`
+	if matchers = strings.TrimRight(matchers, ", "); matchers != "" {
+		query += ", " + matchers
+	}
+	return query + "}"
+}
+
 // Profiles builds the gcx args for a ProfileAssertion.
 func Profiles(a casefile.ProfileAssertion, since time.Duration) []string {
 	if since <= 0 {
@@ -96,7 +168,7 @@ func Profiles(a casefile.ProfileAssertion, since time.Duration) []string {
 		"profiles", "query",
 		"--since", since.String(),
 	}
-	if len(a.Match) > 0 {
+	if len(a.Match) > 0 || a.CapturesJSON() {
 		args = append(args, "-o", "json")
 	}
 	if profileType != "" {
@@ -65,6 +65,57 @@ func TestMetrics_WithValueAsksForJSON(t *testing.T) {
 	}
 }
 
+func TestMetrics_RangeAddsStep(t *testing.T) {
+	got := Metrics(casefile.MetricAssertion{PromQL: "up", Range: &casefile.RangeAssertion{Step: 30 * time.Second}}, time.Minute)
+	want := []string{"metrics", "query", "--since", "1m0s", "--step", "30s", "-o", "json", "up"}
+	if !equal(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestMetricMetadata(t *testing.T) {
+	got := MetricMetadata("http_requests_total")
+	want := []string{"metrics", "metadata", "--metric", "http_requests_total", "-o", "json"}
+	if !equal(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestCorrelationCommands(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"exemplars", Exemplars(`http_requests_total{job="api"}`, time.Minute),
+			[]string{"metrics", "exemplars", "--since", "1m0s", "-o", "json", `http_requests_total{job="api"}`}},
+		{"log search", LogSearch(`{service_name="cart"}`, time.Minute),
+			[]string{"logs", "query", "--since", "1m0s", "-o", "json", `{service_name="cart"}`}},
+		{"trace search", TraceSearch(`{}`, 0),
+			[]string{"traces", "search", "--since", DefaultSince.String(), "-o", "json", `{}`}},
+		{"profiles for span", ProfilesForSpan(`process_cpu:cpu:nanoseconds:cpu:nanoseconds{service_name="cart"}`, "00f067aa", time.Minute),
+			[]string{"profiles", "query", "--since", "1m0s", "-o", "json", "--profile-type", "process_cpu:cpu:nanoseconds:cpu:nanoseconds", `{service_name="cart", span_id="00f067aa"}`}},
+		{"profiles for span, empty selector", ProfilesForSpan(`process_cpu:cpu:nanoseconds:cpu:nanoseconds`, "00f067aa", time.Minute),
+			[]string{"profiles", "query", "--since", "1m0s", "-o", "json", "--profile-type", "process_cpu:cpu:nanoseconds:cpu:nanoseconds", `{span_id="00f067aa"}`}},
+	} {
+		if !equal(tc.got, tc.want) {
+			t.Errorf("%s:\n got %v\nwant %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestMetrics_HistogramSelectsEverySeries(t *testing.T) {
+	a := casefile.MetricAssertion{
+		PromQL:    `http_server_request_duration_seconds{service_name="dice"}`,
+		Histogram: &casefile.HistogramAssertion{Count: ">= 1"},
+	}
+	got := Metrics(a, time.Minute)
+	want := `{__name__=~"http_server_request_duration_seconds(_bucket|_sum|_count)?", service_name="dice"}`
+	if !contains(got, "-o", "json") || got[len(got)-1] != want {
+		t.Errorf("got %v\nwant -o json and %s", got, want)
+	}
+}
+
 func TestProfiles(t *testing.T) {
 	got := Profiles(casefile.ProfileAssertion{Query: "process_cpu:cpu:nanoseconds:cpu:nanoseconds{}"}, 0)
 	want := []string{"profiles", "query", "--since", "10m0s", "--profile-type", "process_cpu:cpu:nanoseconds:cpu:nanoseconds", "{}"}
@@ -125,30 +125,64 @@ func (c *Compose) Stop() error {
 
 // Run executes a service as a one-shot container in the Compose project.
 // The service is built on demand, which lets callers keep command-only
-// services behind a profile so they are not started with the fixture.
-func (c *Compose) Run(ctx context.Context, service string, argv []string) error {
+// services behind a profile so they are not started with the fixture. A
+// non-zero exit is not an error: compose run exits with the command's code,
+// which the result carries along with its output for the caller to judge.
+func (c *Compose) Run(ctx context.Context, service string, argv []string) (RunResult, error) {
 	if err := c.runComposeContext(ctx, "build", service); err != nil {
-		return fmt.Errorf("failed to build compose service %q: %w", service, err)
+		return RunResult{}, fmt.Errorf("failed to build compose service %q: %w", service, err)
 	}
 	// The fixture is already running. Avoid Compose recreating dependencies
 	// before the one-shot command, which can reset application readiness and
 	// disrupt instrumentation attached to the existing containers.
 	args := append([]string{"run", "--rm", "--no-deps", service}, argv...)
-	if err := c.runComposeContext(ctx, args...); err != nil {
-		return fmt.Errorf("failed to run compose service %q: %w", service, err)
+	var stdout, stderr strings.Builder
+	err := c.runComposeOutput(ctx, io.MultiWriter(os.Stderr, &stdout), io.MultiWriter(os.Stderr, &stderr), args...)
+	res := RunResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exit) && ctx.Err() == nil:
+		res.ExitCode = exit.ExitCode()
+	default:
+		return res, fmt.Errorf("failed to run compose service %q: %w", service, err)
+	}
+	return res, nil
+}
+
+// RunResult is the outcome of a one-shot command that ran to completion.
+type RunResult struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+// Control runs a lifecycle command (restart, stop, start, kill, pause or
+// unpause, with any flags) against one service of the running Compose
+// project.
+func (c *Compose) Control(ctx context.Context, service string, command ...string) error {
+	if len(command) == 0 {
+		return fmt.Errorf("no command for compose service %q", service)
+	}
+	if err := c.runComposeContext(ctx, append(command, service)...); err != nil {
+		return fmt.Errorf("failed to %s compose service %q: %w", command[0], service, err)
 	}
 	return nil
 }
 
 func (c *Compose) runComposeContext(ctx context.Context, args ...string) error {
+	// Keep command output off stdout: the CLI reserves stdout for reporter
+	// records, which must remain valid NDJSON in machine-readable mode.
+	return c.runComposeOutput(ctx, os.Stderr, os.Stderr, args...)
+}
+
+func (c *Compose) runComposeOutput(ctx context.Context, stdout, stderr io.Writer, args ...string) error {
 	cmdArgs := append([]string(nil), c.DefaultArgs...)
 	cmdArgs = append(cmdArgs, args...)
 	cmd := exec.CommandContext(ctx, c.Command, cmdArgs...)
 	cmd.Env = c.Env
-	// Keep command output off stdout: the CLI reserves stdout for reporter
-	// records, which must remain valid NDJSON in machine-readable mode.
-	cmd.Stdout = os.Stderr
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 	slog.Info("Running", "command", cmd.String(), "compose_files", c.Paths)
 	return cmd.Run()
 }
@@ -46,7 +46,7 @@ esac
 	if err := c.Up(); err != nil {
 		t.Fatalf("Up: %v", err)
 	}
-	if err := c.Run(context.Background(), "app", []string{"mise", "run", "hello world"}); err != nil {
+	if _, err := c.Run(context.Background(), "app", []string{"mise", "run", "hello world"}); err != nil {
 		t.Fatalf("Run: %v", err)
 	}
 	var output strings.Builder
@@ -97,34 +97,49 @@ esac
 	}
 }
 
-func TestRunReportsBuildAndCommandFailures(t *testing.T) {
+func TestRunReportsBuildFailure(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("test uses a POSIX executable")
 	}
 
-	for _, tc := range []struct {
-		name string
-		fail string
-		want string
-	}{
-		{name: "build", fail: "build", want: `failed to build compose service "app"`},
-		{name: "run", fail: "run", want: `failed to run compose service "app"`},
-	} {
-		t.Run(tc.name, func(t *testing.T) {
-			command := filepath.Join(t.TempDir(), "compose")
-			script := "#!/bin/sh\ncase \"$*\" in\n  *" + tc.fail + "*) exit 1 ;;\nesac\n"
-			if err := os.WriteFile(command, []byte(script), 0o700); err != nil {
-				t.Fatal(err)
-			}
-			c, err := StackFilesWithRuntime([]string{"compose.yml"}, nil, container.Docker)
-			if err != nil {
-				t.Fatal(err)
-			}
-			c.Command = command
-			if err := c.Run(context.Background(), "app", []string{"true"}); err == nil || !strings.Contains(err.Error(), tc.want) {
-				t.Fatalf("Run error = %v, want %q", err, tc.want)
-			}
-		})
+	command := filepath.Join(t.TempDir(), "compose")
+	script := "#!/bin/sh\ncase \"$*\" in\n  *build*) exit 1 ;;\nesac\n"
+	if err := os.WriteFile(command, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	c, err := StackFilesWithRuntime([]string{"compose.yml"}, nil, container.Docker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Command = command
+	want := `failed to build compose service "app"`
+	if _, err := c.Run(context.Background(), "app", []string{"true"}); err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("Run error = %v, want %q", err, want)
+	}
+}
+
+func TestRunReturnsExitCodeAndOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a POSIX executable")
+	}
+
+	command := filepath.Join(t.TempDir(), "compose")
+	script := "#!/bin/sh\ncase \"$*\" in\n  *run*) echo '{\"job\":\"42\"}'; echo 'boom' >&2; exit 2 ;;\nesac\n"
+	if err := os.WriteFile(command, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	c, err := StackFilesWithRuntime([]string{"compose.yml"}, nil, container.Docker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Command = command
+	res, err := c.Run(context.Background(), "app", []string{"job"})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := RunResult{ExitCode: 2, Stdout: "{\"job\":\"42\"}\n", Stderr: "boom\n"}
+	if res != want {
+		t.Fatalf("Run = %+v, want %+v", res, want)
 	}
 }
 
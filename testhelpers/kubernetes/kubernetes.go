@@ -1,18 +1,24 @@
 package kubernetes
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 
+	"github.com/grafana/oats/seed"
 	"github.com/grafana/oats/testhelpers"
+	"github.com/grafana/oats/testhelpers/compose"
 	"github.com/grafana/oats/testhelpers/remote"
 )
 
@@ -24,6 +30,10 @@ type Kubernetes struct {
 	AppDockerTag     string   `yaml:"app-docker-tag"`
 	AppDockerPort    int      `yaml:"app-docker-port"`
 	ImportImages     []string `yaml:"import-images"`
+	// RunID, when set, is added to the app deployment's
+	// OTEL_RESOURCE_ATTRIBUTES (as oats.run.id) and OATS_RUN_ID after the
+	// manifests are applied.
+	RunID string `yaml:"-"`
 }
 
 const (
@@ -34,35 +44,84 @@ const (
 	defaultAppRemotePort = 8080
 )
 
+// portForwardRestartDelay is how long an exited port-forward waits before it
+// is started again; a var so tests can shorten it.
+var portForwardRestartDelay = time.Second
+
+// jobPollInterval is how often RunJob checks whether its Job's pod has
+// finished; a var so tests can shorten it.
+var jobPollInterval = time.Second
+
 func NewEndpoint(host string, model *Kubernetes, ports remote.PortsConfig, testName string, dir string) *remote.Endpoint {
-	var killList []*os.Process
+	var (
+		mu       sync.Mutex
+		killList []*os.Process
+		stopped  bool
+		stop     = make(chan struct{})
+		watchers sync.WaitGroup
+	)
 	cluster := clusterName(testName)
+	// forward starts a background port-forward and starts it again whenever
+	// it exits before Stop: kubectl port-forward ends when the pod it targets
+	// goes away, which fixture actions do on purpose.
+	var forward func(cmd *exec.Cmd) error
+	forward = func(cmd *exec.Cmd) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return nil
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		killList = append(killList, cmd.Process)
+		watchers.Go(func() {
+			_ = cmd.Wait()
+			select {
+			case <-time.After(portForwardRestartDelay):
+			case <-stop:
+				return
+			}
+			next := exec.Command(cmd.Path, cmd.Args[1:]...)
+			next.Stdout, next.Stderr, next.Dir = cmd.Stdout, cmd.Stderr, cmd.Dir
+			slog.Info("restarting port-forward", "command", next.String())
+			if err := forward(next); err != nil {
+				slog.Warn("port-forward restart failed", "command", next.String(), "error", err)
+			}
+		})
+		return nil
+	}
 	run := func(cmd *exec.Cmd, background bool) error {
 		slog.Info("running", "command", cmd.String(), "dir", dir)
-		cmd.Stdout = os.Stdout
+		if cmd.Stdout == nil {
+			cmd.Stdout = os.Stdout
+		}
 		cmd.Stderr = os.Stderr
 		cmd.Dir = dir
 		if background {
-			err := cmd.Start()
-			if err != nil {
-				return err
-			}
-			killList = append(killList, cmd.Process)
-			return nil
+			return forward(cmd)
 		}
 		return cmd.Run()
 	}
 	return remote.NewEndpoint(host, ports, func(ctx context.Context) error {
 		return start(model, ports, testName, run)
 	}, func(ctx context.Context) error {
+		mu.Lock()
+		if !stopped {
+			stopped = true
+			close(stop)
+		}
+		procs := killList
+		mu.Unlock()
 		var errs []error
-		for _, p := range killList {
+		for _, p := range procs {
 			// A port-forward that already exited returns os.ErrProcessDone;
 			// that means cleanup is already done, not a teardown failure.
 			if err := p.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
 				errs = append(errs, err)
 			}
 		}
+		watchers.Wait()
 		if err := run(exec.Command(k3dCLIBinary, "cluster", "delete", cluster), false); err != nil {
 			errs = append(errs, err)
 		}
@@ -116,6 +175,11 @@ func start(model *Kubernetes, ports remote.PortsConfig, testName string, run fun
 	if err != nil {
 		return err
 	}
+	if model.RunID != "" {
+		if err := injectRunID(model.AppService, model.RunID, run); err != nil {
+			return err
+		}
+	}
 	err = run(
 		exec.Command(
 			kubernetesCLIBinary,
@@ -181,6 +245,242 @@ func start(model *Kubernetes, ports remote.PortsConfig, testName string, run fun
 	return nil
 }
 
+// injectRunID adds the run ID to OTEL_RESOURCE_ATTRIBUTES of the app container
+// of the app deployment, after any attributes the manifest sets, and sets
+// OATS_RUN_ID. The app container is the one named after the deployment, or the
+// first one; sidecars are left alone, so they keep their own identity and the
+// deployment rolls once.
+func injectRunID(appService, runID string, run func(cmd *exec.Cmd, background bool) error) error {
+	deployment := "deployment/" + appService
+	var out strings.Builder
+	get := exec.Command(kubernetesCLIBinary, "get", deployment, "-o",
+		`jsonpath={range .spec.template.spec.containers[*]}{.name}{"\t"}{.env[?(@.name=="OTEL_RESOURCE_ATTRIBUTES")].value}{"\n"}{end}`)
+	get.Stdout = &out
+	if err := run(get, false); err != nil {
+		return err
+	}
+	var container, attrs string
+	for i, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		name, value, _ := strings.Cut(line, "\t")
+		if i == 0 || name == appService {
+			container, attrs = name, value
+		}
+		if name == appService {
+			break
+		}
+	}
+	if container == "" {
+		return fmt.Errorf("%s has no containers", deployment)
+	}
+	attr := seed.RunIDAttribute + "=" + runID
+	if attrs = strings.TrimSpace(attrs); attrs != "" {
+		attr = attrs + "," + attr
+	}
+	err := run(exec.Command(kubernetesCLIBinary, "set", "env", deployment, "-c", container,
+		"OTEL_RESOURCE_ATTRIBUTES="+attr, "OATS_RUN_ID="+runID), false)
+	if err != nil {
+		return err
+	}
+	// `set env` rolls the deployment; wait for the rollout so the pod OATS
+	// port-forwards to is one that carries the run ID.
+	return run(exec.Command(kubernetesCLIBinary, "rollout", "status", "--timeout=5m", deployment), false)
+}
+
+// replicasAnnotation records on a Deployment the replica count stop scaled it
+// down from, for start to restore.
+const replicasAnnotation = "oats.grafana.com/replicas"
+
+// Control applies a fixture action to a Deployment of the cluster started by
+// NewEndpoint, through the current kubectl context. Restart rolls the
+// Deployment; stop scales it to zero, recording its replica count in the
+// oats.grafana.com/replicas annotation, and start scales it back to that count
+// (one when none is recorded), each waiting for the rollout. Kill sends signal
+// to PID 1 of one of its pods, which needs a kill binary in the image. Pause
+// and unpause have no Kubernetes equivalent.
+func Control(ctx context.Context, action, service, signal string) error {
+	return control(ctx, action, service, signal, runKubectl)
+}
+
+func control(ctx context.Context, action, service, signal string, kubectl kubectlFunc) error {
+	deployment := "deployment/" + service
+	// Keep command output off stdout, which carries reporter records.
+	run := func(args ...string) error {
+		return kubectl(ctx, nil, os.Stderr, os.Stderr, args...)
+	}
+	get := func(jsonpath string) (string, error) {
+		var out strings.Builder
+		err := kubectl(ctx, nil, &out, os.Stderr, "get", deployment, "-o", "jsonpath="+jsonpath)
+		return strings.TrimSpace(out.String()), err
+	}
+	var err error
+	switch action {
+	case "restart":
+		err = run("rollout", "restart", deployment)
+	case "stop":
+		var replicas string
+		replicas, err = get("{.spec.replicas}")
+		// Stopping a stopped Deployment keeps the count recorded before.
+		if err == nil && replicas != "" && replicas != "0" {
+			err = run("annotate", "--overwrite", deployment, replicasAnnotation+"="+replicas)
+		}
+		if err == nil {
+			err = run("scale", "--replicas=0", deployment)
+		}
+	case "start":
+		var replicas string
+		replicas, err = get("{.metadata.annotations." + strings.ReplaceAll(replicasAnnotation, ".", `\.`) + "}")
+		if replicas == "" {
+			replicas = "1"
+		}
+		if err == nil {
+			err = run("scale", "--replicas="+replicas, deployment)
+		}
+	case "kill":
+		err = run("exec", deployment, "--", "kill", "-s", strings.TrimPrefix(signal, "SIG"), "1")
+		if err != nil {
+			return fmt.Errorf("failed to kill %s: %w", deployment, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s is not supported on k3d fixtures", action)
+	}
+	if err == nil {
+		err = run("rollout", "status", "--timeout=5m", deployment)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s %s: %w", action, deployment, err)
+	}
+	return nil
+}
+
+// kubectlFunc runs kubectl with args, stdin and output streams.
+type kubectlFunc func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, args ...string) error
+
+func runKubectl(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, kubernetesCLIBinary, args...)
+	slog.Info("running", "command", cmd.String())
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// Exec runs argv with kubectl exec in a running pod of deployment, or of the
+// first running pod matching the label selector when deployment is empty,
+// in container when set. As with compose.Run, a non-zero exit of the command
+// is not an error: the result carries it along with the output.
+func Exec(ctx context.Context, deployment, selector, container string, argv []string) (compose.RunResult, error) {
+	return execIn(ctx, deployment, selector, container, argv, runKubectl)
+}
+
+func execIn(ctx context.Context, deployment, selector, container string, argv []string, kubectl kubectlFunc) (compose.RunResult, error) {
+	target := "deployment/" + deployment
+	if deployment == "" {
+		var names strings.Builder
+		err := kubectl(ctx, nil, &names, os.Stderr, "get", "pods", "-l", selector,
+			"--field-selector=status.phase=Running", "-o", "jsonpath={.items[*].metadata.name}")
+		if err != nil {
+			return compose.RunResult{}, fmt.Errorf("failed to list pods matching %q: %w", selector, err)
+		}
+		pods := strings.Fields(names.String())
+		if len(pods) == 0 {
+			return compose.RunResult{}, fmt.Errorf("no running pod matches %q", selector)
+		}
+		target = "pod/" + pods[0]
+	}
+	args := []string{"exec", target}
+	if container != "" {
+		args = append(args, "-c", container)
+	}
+	args = append(append(args, "--"), argv...)
+	// Keep command output off stdout, which carries reporter records.
+	var stdout, stderr strings.Builder
+	err := kubectl(ctx, nil, io.MultiWriter(os.Stderr, &stdout), io.MultiWriter(os.Stderr, &stderr), args...)
+	res := compose.RunResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	if err == nil {
+		return res, nil
+	}
+	// kubectl exec exits with the command's code and says so; any other
+	// failure is kubectl's own.
+	var exit interface{ ExitCode() int }
+	if errors.As(err, &exit) && ctx.Err() == nil && strings.Contains(res.Stderr, "command terminated with exit code") {
+		res.ExitCode = exit.ExitCode()
+		return res, nil
+	}
+	return res, fmt.Errorf("failed to exec in %s: %w", target, err)
+}
+
+// RunJob runs image as a Job, with argv as its container's args, waits for
+// its pod to finish and deletes it. The Job is not retried, and the image is
+// only pulled when the cluster does not have it, so images imported into the
+// k3d cluster work. The pod's log, stdout and stderr interleaved, is the
+// result's Stdout; a non-zero exit is not an error.
+func RunJob(ctx context.Context, image string, argv []string) (compose.RunResult, error) {
+	name := "oats-input-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	return runJob(ctx, name, image, argv, runKubectl)
+}
+
+func runJob(ctx context.Context, name, image string, argv []string, kubectl kubectlFunc) (compose.RunResult, error) {
+	container := map[string]any{"name": "input", "image": image, "imagePullPolicy": "IfNotPresent"}
+	if len(argv) > 0 {
+		container["args"] = argv
+	}
+	manifest, err := json.Marshal(map[string]any{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]any{"name": name, "labels": map[string]string{"app.kubernetes.io/managed-by": "oats"}},
+		"spec": map[string]any{
+			"backoffLimit": 0,
+			"template": map[string]any{"spec": map[string]any{
+				"restartPolicy": "Never",
+				"containers":    []any{container},
+			}},
+		},
+	})
+	if err != nil {
+		return compose.RunResult{}, err
+	}
+	job := "job/" + name
+	if err := kubectl(ctx, bytes.NewReader(manifest), os.Stderr, os.Stderr, "create", "-f", "-"); err != nil {
+		return compose.RunResult{}, fmt.Errorf("failed to create %s: %w", job, err)
+	}
+	defer func() {
+		// Clean up even when ctx is done, which is when a Job is most likely
+		// still running.
+		if err := kubectl(context.WithoutCancel(ctx), nil, os.Stderr, os.Stderr, "delete", job, "--ignore-not-found", "--wait=false"); err != nil {
+			slog.Warn("job cleanup failed", "job", job, "error", err)
+		}
+	}()
+
+	var res compose.RunResult
+	for {
+		var codes strings.Builder
+		err := kubectl(ctx, nil, &codes, os.Stderr, "get", "pods", "-l", "job-name="+name,
+			"-o", "jsonpath={.items[*].status.containerStatuses[*].state.terminated.exitCode}")
+		if err == nil {
+			if fields := strings.Fields(codes.String()); len(fields) > 0 {
+				if res.ExitCode, err = strconv.Atoi(fields[0]); err != nil {
+					return res, fmt.Errorf("%s: unexpected exit code %q", job, fields[0])
+				}
+				break
+			}
+		} else if ctx.Err() == nil {
+			return res, fmt.Errorf("failed to get the pod of %s: %w", job, err)
+		}
+		select {
+		case <-ctx.Done():
+			return res, fmt.Errorf("%s did not finish: %w", job, ctx.Err())
+		case <-time.After(jobPollInterval):
+		}
+	}
+	var logs strings.Builder
+	if err := kubectl(ctx, nil, io.MultiWriter(os.Stderr, &logs), os.Stderr, "logs", job); err != nil {
+		return res, fmt.Errorf("failed to read the logs of %s: %w", job, err)
+	}
+	res.Stdout = logs.String()
+	return res, nil
+}
+
 func clusterName(testName string) string {
 	var b strings.Builder
 	lastDash := false
@@ -2,13 +2,18 @@ package kubernetes
 
 import (
 	"context"
+	"errors"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/grafana/oats/testhelpers/remote"
 	"github.com/stretchr/testify/require"
@@ -137,6 +142,60 @@ func TestStartWaitsForLgtmDeploymentAvailability(t *testing.T) {
 	})
 }
 
+func TestStartInjectsRunIDIntoAppDeployment(t *testing.T) {
+	t.Parallel()
+
+	model := &Kubernetes{
+		Dir:           "k8s",
+		AppService:    "dice",
+		AppDockerFile: "Dockerfile",
+		AppDockerTag:  "dice:test",
+		AppDockerPort: 8080,
+		RunID:         "r1",
+	}
+
+	var commands []string
+	run := func(cmd *exec.Cmd, background bool) error {
+		commands = append(commands, strings.Join(cmd.Args, " "))
+		if slices.Equal(cmd.Args[:3], []string{"kubectl", "get", "deployment/dice"}) {
+			_, _ = io.WriteString(cmd.Stdout, "istio-proxy\tservice.name=mesh\ndice\tservice.name=dice,deployment.environment=ci\nsidecar\t\n")
+		}
+		return nil
+	}
+
+	require.NoError(t, start(model, remote.PortsConfig{}, "run-oats", run))
+
+	apply := slices.Index(commands, "kubectl apply -f k8s")
+	setEnv := slices.Index(commands, "kubectl set env deployment/dice -c dice OTEL_RESOURCE_ATTRIBUTES=service.name=dice,deployment.environment=ci,oats.run.id=r1 OATS_RUN_ID=r1")
+	rollout := slices.Index(commands, "kubectl rollout status --timeout=5m deployment/dice")
+	require.True(t, apply >= 0 && setEnv > apply && rollout > setEnv, "unexpected command order: %v", commands)
+	var sets, rollouts int
+	for _, c := range commands {
+		if strings.HasPrefix(c, "kubectl set env") {
+			sets++
+		}
+		if strings.HasPrefix(c, "kubectl rollout status") {
+			rollouts++
+		}
+	}
+	require.Equal(t, 1, sets, "only the app container is stamped: %v", commands)
+	require.Equal(t, 1, rollouts, "the deployment rolls once: %v", commands)
+}
+
+func TestInjectRunID_FallsBackToFirstContainer(t *testing.T) {
+	var commands []string
+	err := injectRunID("dice", "r1", func(cmd *exec.Cmd, _ bool) error {
+		commands = append(commands, strings.Join(cmd.Args, " "))
+		if cmd.Args[1] == "get" {
+			_, _ = io.WriteString(cmd.Stdout, "app\t\nsidecar\t\n")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "kubectl set env deployment/dice -c app OTEL_RESOURCE_ATTRIBUTES=oats.run.id=r1 OATS_RUN_ID=r1", commands[1])
+	require.Len(t, commands, 3)
+}
+
 func TestStart_SkipsGrafanaAndOTLPPortsWhenUnset(t *testing.T) {
 	t.Parallel()
 
@@ -211,3 +270,202 @@ func TestNewEndpoint_StartAndStopWithFakeCLIs(t *testing.T) {
 		t.Fatalf("Endpoint.Stop: %v", err)
 	}
 }
+
+func TestControl_CommandSequence(t *testing.T) {
+	const (
+		getReplicas = "get deployment/app -o jsonpath={.spec.replicas}"
+		getSaved    = `get deployment/app -o jsonpath={.metadata.annotations.oats\.grafana\.com/replicas}`
+	)
+	tests := []struct {
+		name, action, signal string
+		// get is what kubectl get prints.
+		get  string
+		want []string
+	}{
+		{name: "restart", action: "restart", want: []string{"rollout restart deployment/app", "rollout status --timeout=5m deployment/app"}},
+		{name: "stop", action: "stop", get: "3", want: []string{
+			getReplicas,
+			"annotate --overwrite deployment/app oats.grafana.com/replicas=3",
+			"scale --replicas=0 deployment/app",
+			"rollout status --timeout=5m deployment/app",
+		}},
+		{name: "stop stopped", action: "stop", get: "0", want: []string{
+			getReplicas,
+			"scale --replicas=0 deployment/app",
+			"rollout status --timeout=5m deployment/app",
+		}},
+		{name: "start", action: "start", get: "3", want: []string{getSaved, "scale --replicas=3 deployment/app", "rollout status --timeout=5m deployment/app"}},
+		{name: "start unrecorded", action: "start", want: []string{getSaved, "scale --replicas=1 deployment/app", "rollout status --timeout=5m deployment/app"}},
+		{name: "kill", action: "kill", signal: "SIGTERM", want: []string{"exec deployment/app -- kill -s TERM 1"}},
+		{name: "kill number", action: "kill", signal: "9", want: []string{"exec deployment/app -- kill -s 9 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			err := control(context.Background(), tt.action, "app", tt.signal,
+				func(_ context.Context, _ io.Reader, stdout, _ io.Writer, args ...string) error {
+					calls = append(calls, strings.Join(args, " "))
+					if args[0] == "get" {
+						_, _ = io.WriteString(stdout, tt.get)
+					}
+					return nil
+				})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, calls)
+		})
+	}
+
+	err := control(context.Background(), "pause", "app", "", func(context.Context, io.Reader, io.Writer, io.Writer, ...string) error {
+		t.Fatal("pause must not run kubectl")
+		return nil
+	})
+	require.EqualError(t, err, "pause is not supported on k3d fixtures")
+}
+
+type exitError int
+
+func (e exitError) Error() string { return "exit status " + strconv.Itoa(int(e)) }
+func (e exitError) ExitCode() int { return int(e) }
+
+func TestExecIn_TargetsAndExitCode(t *testing.T) {
+	tests := []struct {
+		name                            string
+		deployment, selector, container string
+		want                            []string
+	}{
+		{name: "deployment", deployment: "app", want: []string{"exec deployment/app -- migrate --dry-run"}},
+		{name: "container", deployment: "app", container: "sidecar", want: []string{"exec deployment/app -c sidecar -- migrate --dry-run"}},
+		{name: "selector", selector: "app=worker", want: []string{
+			"get pods -l app=worker --field-selector=status.phase=Running -o jsonpath={.items[*].metadata.name}",
+			"exec pod/worker-1 -- migrate --dry-run",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			res, err := execIn(context.Background(), tt.deployment, tt.selector, tt.container, []string{"migrate", "--dry-run"},
+				func(_ context.Context, _ io.Reader, stdout, stderr io.Writer, args ...string) error {
+					calls = append(calls, strings.Join(args, " "))
+					if args[0] == "get" {
+						_, _ = io.WriteString(stdout, "worker-1 worker-2")
+						return nil
+					}
+					_, _ = io.WriteString(stdout, "pending: 2\n")
+					_, _ = io.WriteString(stderr, "command terminated with exit code 3\n")
+					return exitError(3)
+				})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, calls)
+			require.Equal(t, 3, res.ExitCode)
+			require.Equal(t, "pending: 2\n", res.Stdout)
+		})
+	}
+}
+
+func TestExecIn_Failures(t *testing.T) {
+	_, err := execIn(context.Background(), "", "app=none", "", []string{"true"},
+		func(context.Context, io.Reader, io.Writer, io.Writer, ...string) error { return nil })
+	require.EqualError(t, err, `no running pod matches "app=none"`)
+
+	// An exit without kubectl's exit-code message is kubectl failing, not
+	// the command.
+	_, err = execIn(context.Background(), "app", "", "", []string{"true"},
+		func(_ context.Context, _ io.Reader, _, stderr io.Writer, _ ...string) error {
+			_, _ = io.WriteString(stderr, "Error from server (NotFound): deployments.apps \"app\" not found\n")
+			return exitError(1)
+		})
+	require.ErrorContains(t, err, "failed to exec in deployment/app")
+}
+
+func TestRunJob_CommandSequence(t *testing.T) {
+	old := jobPollInterval
+	jobPollInterval = time.Millisecond
+	defer func() { jobPollInterval = old }()
+
+	var calls []string
+	var manifest []byte
+	polls := 0
+	res, err := runJob(context.Background(), "oats-input-1", "cron:dev", []string{"--once"},
+		func(_ context.Context, stdin io.Reader, stdout, _ io.Writer, args ...string) error {
+			calls = append(calls, strings.Join(args, " "))
+			switch args[0] {
+			case "create":
+				manifest, _ = io.ReadAll(stdin)
+			case "get":
+				if polls++; polls > 1 {
+					_, _ = io.WriteString(stdout, "4")
+				}
+			case "logs":
+				_, _ = io.WriteString(stdout, "processed 0 items\n")
+			}
+			return nil
+		})
+	require.NoError(t, err)
+	require.Equal(t, 4, res.ExitCode)
+	require.Equal(t, "processed 0 items\n", res.Stdout)
+	poll := "get pods -l job-name=oats-input-1 -o jsonpath={.items[*].status.containerStatuses[*].state.terminated.exitCode}"
+	require.Equal(t, []string{"create -f -", poll, poll, "logs job/oats-input-1", "delete job/oats-input-1 --ignore-not-found --wait=false"}, calls)
+	require.JSONEq(t, `{
+		"apiVersion": "batch/v1",
+		"kind": "Job",
+		"metadata": {"name": "oats-input-1", "labels": {"app.kubernetes.io/managed-by": "oats"}},
+		"spec": {
+			"backoffLimit": 0,
+			"template": {"spec": {
+				"restartPolicy": "Never",
+				"containers": [{"name": "input", "image": "cron:dev", "imagePullPolicy": "IfNotPresent", "args": ["--once"]}]
+			}}
+		}
+	}`, string(manifest))
+}
+
+func TestRunJob_DeletesJobThatDoesNotFinish(t *testing.T) {
+	old := jobPollInterval
+	jobPollInterval = time.Millisecond
+	defer func() { jobPollInterval = old }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var deleted bool
+	_, err := runJob(ctx, "oats-input-2", "cron:dev", nil,
+		func(ctx context.Context, _ io.Reader, _, _ io.Writer, args ...string) error {
+			if args[0] == "delete" {
+				deleted = ctx.Err() == nil
+			}
+			return nil
+		})
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "err = %v", err)
+	require.True(t, deleted, "job must be deleted with a live context")
+}
+
+func TestNewEndpoint_RestartsExitedPortForwards(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses POSIX executables")
+	}
+	old := portForwardRestartDelay
+	portForwardRestartDelay = time.Millisecond
+	defer func() { portForwardRestartDelay = old }()
+
+	bin := t.TempDir()
+	forwards := filepath.Join(t.TempDir(), "forwards")
+	kubectl := "#!/bin/sh\nif [ \"$1\" = port-forward ]; then echo \"$2\" >> " + forwards + "; fi\nexit 0\n"
+	for name, script := range map[string]string{"docker": "#!/bin/sh\nexit 0\n", "k3d": "#!/bin/sh\nexit 0\n", "kubectl": kubectl} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ep := NewEndpoint("localhost", &Kubernetes{Dir: t.TempDir(), AppService: "app", AppDockerPort: 8080}, remote.PortsConfig{
+		LokiHTTPPort:       3100,
+		PrometheusHTTPPort: 9090,
+		TempoHTTPPort:      3200,
+		PyroscopeHTTPPort:  4040,
+	}, "restart-test", t.TempDir())
+	require.NoError(t, ep.Start(context.Background()))
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(forwards)
+		return strings.Count(string(data), "service/app\n") >= 3
+	}, 5*time.Second, 10*time.Millisecond, "app port-forward was not restarted")
+	require.NoError(t, ep.Stop(context.Background()))
+}
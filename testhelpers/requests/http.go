@@ -17,10 +17,20 @@ var testHTTPClient = &http.Client{
 	Transport: tr,
 }
 
-func doRequest(req *http.Request, statusCode int) (err error) {
+// maxResponseBody caps how much of a response body is kept for captures.
+const maxResponseBody = 1 << 20
+
+// Response is what an application request returned: its headers and up to
+// maxResponseBody bytes of its body.
+type Response struct {
+	Header http.Header
+	Body   []byte
+}
+
+func doRequest(req *http.Request, statusCode int) (resp *Response, err error) {
 	r, err := testHTTPClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		_, _ = io.Copy(io.Discard, r.Body)
@@ -30,14 +40,19 @@ func doRequest(req *http.Request, statusCode int) (err error) {
 	}()
 
 	if r.StatusCode != statusCode {
-		return fmt.Errorf("expected HTTP status %d, but got: %d", statusCode, r.StatusCode)
+		return nil, fmt.Errorf("expected HTTP status %d, but got: %d", statusCode, r.StatusCode)
 	}
 
-	return nil
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxResponseBody))
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Header: r.Header, Body: body}, nil
 }
 
 func DoHTTPRequest(url string, method string, headers map[string]string, payload string, statusCode int) error {
-	return doHTTPRequest(context.Background(), url, method, headers, payload, statusCode)
+	_, err := doHTTPRequest(context.Background(), url, method, headers, payload, statusCode)
+	return err
 }
 
 // DoHTTPRequestWithTimeout drives an application request with the supplied
@@ -50,16 +65,24 @@ func DoHTTPRequestWithTimeout(url string, method string, headers map[string]stri
 		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
-	return doHTTPRequest(ctx, url, method, headers, payload, statusCode)
+	_, err := doHTTPRequest(ctx, url, method, headers, payload, statusCode)
+	return err
 }
 
 // DoHTTPRequestWithContext drives an application request until it completes or
 // the supplied context is cancelled.
 func DoHTTPRequestWithContext(ctx context.Context, url string, method string, headers map[string]string, payload string, statusCode int) error {
+	_, err := doHTTPRequest(ctx, url, method, headers, payload, statusCode)
+	return err
+}
+
+// DoHTTPRequestWithResponse is DoHTTPRequestWithContext that also returns the
+// response headers and body, for callers that capture values from them.
+func DoHTTPRequestWithResponse(ctx context.Context, url string, method string, headers map[string]string, payload string, statusCode int) (*Response, error) {
 	return doHTTPRequest(ctx, url, method, headers, payload, statusCode)
 }
 
-func doHTTPRequest(ctx context.Context, url string, method string, headers map[string]string, payload string, statusCode int) error {
+func doHTTPRequest(ctx context.Context, url string, method string, headers map[string]string, payload string, statusCode int) (*Response, error) {
 	var body io.Reader = nil
 
 	if payload != "" {
@@ -69,7 +92,7 @@ func doHTTPRequest(ctx context.Context, url string, method string, headers map[s
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for k, v := range headers {
@@ -40,3 +40,22 @@ func TestDoHTTPRequestWithTimeout(t *testing.T) {
 		t.Fatalf("error = %v, want context deadline exceeded", err)
 	}
 }
+
+func TestDoHTTPRequestWithResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		_, _ = w.Write([]byte(`{"order":{"id":"o-1"}}`))
+	}))
+	defer server.Close()
+
+	resp, err := DoHTTPRequestWithResponse(context.Background(), server.URL, http.MethodGet, nil, "", http.StatusOK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("traceparent"); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("traceparent = %q", got)
+	}
+	if string(resp.Body) != `{"order":{"id":"o-1"}}` {
+		t.Errorf("body = %q", resp.Body)
+	}
+}